@@ -1,7 +1,9 @@
 package addr
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"encoding/base32"
 	"fmt"
 )
 
@@ -30,15 +32,92 @@ func (n NameInModule) String() string {
 	}
 }
 
-// ID returns an opaque string that uniquely identifies the recieving
-// qualified name using only alphanumeric characters, suitable for use
-// as a resource identifier in CloudFormation template JSON.
+// MaxIDLength is the maximum length of a logical id in a CloudFormation
+// template. The result of NameInModule.ID never exceeds this length.
+const MaxIDLength = 255
+
+// idHashLength is the number of characters of hash included at the end
+// of each generated id. 13 base32 characters encode 64 bits of the hash.
+const idHashLength = 13
+
+var idHashEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ID returns a string that identifies the recieving qualified name using
+// only alphanumeric characters, suitable for use as a resource identifier in
+// CloudFormation template JSON.
 //
-// The result is not intelligible to humans, so objects using such ids
-// should generally be annotated with a human-readable form too so that
-// users can map generated objects back onto the source construct that
+// A name in the root module without an index is returned verbatim, since
+// it is already a valid identifier and is the name the user would expect.
+// Otherwise, the result is a human-readable prefix built from the
+// alphanumeric characters of the module path, name and index, followed by
+// a fixed-length hash of the full address that distinguishes addresses that
+// would otherwise produce the same prefix.
+//
+// The readable prefix is only an approximation of the address, so objects
+// using such ids should generally be annotated with the full address too so
+// that users can map generated objects back onto the source construct that
 // created them.
+//
+// The hash makes collisions between distinct addresses vanishingly unlikely
+// but cannot rule them out entirely, so callers that need a guarantee of
+// uniqueness must still check for duplicate ids across all of the names
+// they use.
 func (n NameInModule) ID() string {
+	if n.Module.IsRoot() && n.Key == NoEachIndex {
+		return n.Name
+	}
+
+	var buf bytes.Buffer
+	for _, rawStep := range n.Module {
+		switch step := rawStep.(type) {
+		case modulePathName:
+			writeIDPart(&buf, string(step))
+		case modulePathIndex:
+			writeIDPart(&buf, eachIndexIDPart(step.EachIndex))
+		}
+	}
+	writeIDPart(&buf, n.Name)
+	if n.Key != NoEachIndex {
+		writeIDPart(&buf, eachIndexIDPart(n.Key))
+	}
+
+	prefix := buf.Bytes()
+	if len(prefix) > MaxIDLength-idHashLength {
+		prefix = prefix[:MaxIDLength-idHashLength]
+	}
+
 	hash := sha1.Sum([]byte(n.String()))
-	return string(hash[:])
+	return string(prefix) + idHashEncoding.EncodeToString(hash[:])[:idHashLength]
+}
+
+func eachIndexIDPart(key EachIndex) string {
+	switch tk := key.(type) {
+	case EachString:
+		// We use the raw string here, rather than the quoted form returned
+		// by String, so that its quotes and escapes don't appear in the id.
+		return string(tk)
+	default:
+		return key.String()
+	}
+}
+
+// writeIDPart writes the alphanumeric characters from the given string to
+// the buffer, with the first letter capitalized so that the parts remain
+// distinguishable when read together. All other characters, including
+// non-ASCII letters and digits, are discarded.
+func writeIDPart(buf *bytes.Buffer, s string) {
+	first := true
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			if first {
+				r = r - 'a' + 'A'
+			}
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		default:
+			continue
+		}
+		buf.WriteRune(r)
+		first = false
+	}
 }
@@ -0,0 +1,123 @@
+package addr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameInModuleString(t *testing.T) {
+	tests := []struct {
+		Name NameInModule
+		Want string
+	}{
+		{
+			NameInModule{Module: RootModulePath, Name: "Bucket", Key: NoEachIndex},
+			"Bucket",
+		},
+		{
+			NameInModule{Module: RootModulePath, Name: "Bucket", Key: EachInt(2)},
+			"Bucket[2]",
+		},
+		{
+			NameInModule{Module: RootModulePath.AppendName("network"), Name: "Vpc", Key: NoEachIndex},
+			".network:Vpc",
+		},
+		{
+			NameInModule{
+				Module: RootModulePath.AppendName("network").AppendIndex(EachString("us-east-1")),
+				Name:   "Subnet",
+				Key:    EachString("a"),
+			},
+			`.network["us-east-1"]:Subnet["a"]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Want, func(t *testing.T) {
+			if got := test.Name.String(); got != test.Want {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestNameInModuleID(t *testing.T) {
+	longModule := RootModulePath
+	for i := 0; i < 50; i++ {
+		longModule = longModule.AppendName("averyveryverylongmodulename").AppendIndex(EachInt(i))
+	}
+
+	tests := map[string]NameInModule{
+		"root with key": {
+			Module: RootModulePath,
+			Name:   "Bucket",
+			Key:    EachString("us-east-1"),
+		},
+		"child": {
+			Module: RootModulePath.AppendName("network"),
+			Name:   "Vpc",
+			Key:    NoEachIndex,
+		},
+		"non-alphanumeric characters": {
+			Module: RootModulePath.AppendName("net_work").AppendIndex(EachString("ünï/cödé")),
+			Name:   "Vpc",
+			Key:    EachString("a b\"c"),
+		},
+		"very long module path": {
+			Module: longModule,
+			Name:   "Bucket",
+			Key:    EachInt(1),
+		},
+		"very long key": {
+			Module: RootModulePath,
+			Name:   "Bucket",
+			Key:    EachString(strings.Repeat("x", 1000)),
+		},
+	}
+
+	for name, n := range tests {
+		t.Run(name, func(t *testing.T) {
+			id := n.ID()
+			if len(id) == 0 || len(id) > MaxIDLength {
+				t.Errorf("id %q has length %d; want 1 to %d", id, len(id), MaxIDLength)
+			}
+			for _, r := range id {
+				if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+					t.Errorf("id %q contains non-alphanumeric character %q", id, r)
+					break
+				}
+			}
+			if again := n.ID(); again != id {
+				t.Errorf("id is not stable: got %q and then %q", id, again)
+			}
+		})
+	}
+}
+
+func TestNameInModuleIDRootName(t *testing.T) {
+	n := NameInModule{Module: RootModulePath, Name: "Bucket", Key: NoEachIndex}
+	if got, want := n.ID(), "Bucket"; got != want {
+		t.Errorf("wrong id %q; want %q", got, want)
+	}
+}
+
+func TestNameInModuleIDDistinct(t *testing.T) {
+	// These keys and names all have the same alphanumeric characters, so
+	// they can be told apart only by the hash at the end of each id.
+	var names []NameInModule
+	for _, s := range []string{"a-b", "a_b", "ab", "äb"} {
+		names = append(names,
+			NameInModule{Module: RootModulePath, Name: "Bucket", Key: EachString(s)},
+			NameInModule{Module: RootModulePath.AppendName(s), Name: "Bucket", Key: NoEachIndex},
+		)
+	}
+
+	seen := map[string]NameInModule{}
+	for _, n := range names {
+		id := n.ID()
+		if prev, exists := seen[id]; exists {
+			t.Errorf("%s and %s both have id %q", prev, n, id)
+		}
+		seen[id] = n
+	}
+}
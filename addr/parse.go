@@ -0,0 +1,130 @@
+package addr
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// ParseResourceNameInModule interprets the given traversal as a reference to a
+// resource, optionally inside a child module, relative to the given base
+// module path.
+//
+// The accepted syntax is zero or more module steps of the form
+// Module.name or Module.name[key], followed by a single resource step of the
+// form Resource.name or Resource.name[key].
+//
+// If the traversal is invalid then error diagnostics are returned and the
+// returned name is not meaningful.
+func ParseResourceNameInModule(base ModulePath, traversal hcl.Traversal) (NameInModule, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	ret := NameInModule{
+		Module: base,
+	}
+
+	remain := traversal
+	for len(remain) > 0 {
+		kind, name, key, rest, stepDiags := parseAddrStep(remain)
+		diags = append(diags, stepDiags...)
+		if stepDiags.HasErrors() {
+			return ret, diags
+		}
+
+		switch kind {
+		case "Module":
+			ret.Module = ret.Module.AppendName(name)
+			if key != NoEachIndex {
+				ret.Module = ret.Module.AppendIndex(key)
+			}
+		case "Resource":
+			if len(rest) != 0 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid resource address",
+					Detail:   "A resource address must end with the resource name and, optionally, its ForEach key.",
+					Subject:  rest[0].SourceRange().Ptr(),
+				})
+				return ret, diags
+			}
+			ret.Name = name
+			ret.Key = key
+			return ret, diags
+		default:
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid resource address",
+				Detail:   "A resource address must consist of zero or more \"Module\" steps followed by a \"Resource\" step.",
+				Subject:  remain[0].SourceRange().Ptr(),
+			})
+			return ret, diags
+		}
+		remain = rest
+	}
+
+	diags = append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid resource address",
+		Detail:   "A resource address must end with a \"Resource\" step selecting a particular resource.",
+		Subject:  traversal.SourceRange().Ptr(),
+	})
+	return ret, diags
+}
+
+// parseAddrStep consumes a single step of the form Kind.name or
+// Kind.name[key] from the start of the given traversal, returning the
+// remaining traversal steps after it.
+func parseAddrStep(traversal hcl.Traversal) (kind, name string, key EachIndex, rest hcl.Traversal, diags hcl.Diagnostics) {
+	switch ts := traversal[0].(type) {
+	case hcl.TraverseRoot:
+		kind = ts.Name
+	case hcl.TraverseAttr:
+		kind = ts.Name
+	default:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   "Expected either \"Module\" or \"Resource\".",
+			Subject:  traversal[0].SourceRange().Ptr(),
+		})
+		return
+	}
+
+	var nameStep hcl.TraverseAttr
+	if len(traversal) >= 2 {
+		nameStep, _ = traversal[1].(hcl.TraverseAttr)
+	}
+	if nameStep.Name == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   fmt.Sprintf("The %q step must be followed by an attribute giving a name.", kind),
+			Subject:  traversal.SourceRange().Ptr(),
+		})
+		return
+	}
+	name = nameStep.Name
+	rest = traversal[2:]
+
+	if len(rest) > 0 {
+		if keyStep, ok := rest[0].(hcl.TraverseIndex); ok {
+			keyVal := keyStep.Key
+			if !keyVal.IsKnown() || keyVal.IsNull() {
+				key = NoEachIndex
+			} else {
+				key = MakeEachIndex(keyVal)
+			}
+			if key == NoEachIndex {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid address",
+					Detail:   "An index key must be either a whole number or a string.",
+					Subject:  &keyStep.SrcRange,
+				})
+				return
+			}
+			rest = rest[1:]
+		}
+	}
+
+	return
+}
@@ -0,0 +1,468 @@
+// Package cfneval evaluates a generated CloudFormation template locally,
+// given concrete values for its parameters, in order to determine which
+// resources CloudFormation would create and what their properties and the
+// template's outputs would be.
+//
+// This allows the behavior of a configuration, and of its conditions in
+// particular, to be checked without deploying a stack.
+package cfneval
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apparentlymart/awsup/cfnjson"
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// Environment provides the values that CloudFormation would supply when
+// creating a stack, for use in place of a real deployment.
+type Environment struct {
+	// Parameters are the values given for the template's parameters. Any
+	// parameter not given here takes its default value.
+	Parameters map[string]string
+
+	// PseudoParameters overrides the values of pseudo parameters such as
+	// "AWS::Region". Those not given take the values from
+	// DefaultPseudoParameters.
+	PseudoParameters map[string]interface{}
+
+	// PhysicalIDs gives the values returned by Ref for resources. A resource
+	// not given here has its logical id as its physical id.
+	PhysicalIDs map[string]string
+
+	// Attributes gives the values of resource attributes for Fn::GetAtt,
+	// keyed by logical id and then by attribute name. Attributes not given
+	// here are replaced with placeholder strings like "Bucket.Arn".
+	Attributes map[string]map[string]interface{}
+
+	// AZs gives the availability zones returned by Fn::GetAZs for each
+	// region. A region not given here has three zones with the suffixes
+	// "a", "b" and "c".
+	AZs map[string][]string
+
+	// Imports gives the values of the exports that may be used with
+	// Fn::ImportValue.
+	Imports map[string]interface{}
+}
+
+// DefaultPseudoParameters are the values of the pseudo parameters used when
+// an Environment does not override them.
+var DefaultPseudoParameters = map[string]interface{}{
+	"AWS::AccountId":        "123456789012",
+	"AWS::NotificationARNs": []interface{}{},
+	"AWS::Partition":        "aws",
+	"AWS::Region":           "us-east-1",
+	"AWS::StackId":          "arn:aws:cloudformation:us-east-1:123456789012:stack/awsup-test/00000000-0000-0000-0000-000000000000",
+	"AWS::StackName":        "awsup-test",
+	"AWS::URLSuffix":        "amazonaws.com",
+}
+
+// Result describes what CloudFormation would do with a template in a
+// particular environment.
+type Result struct {
+	// Conditions gives the value of each of the template's named conditions.
+	Conditions map[string]bool
+
+	// Resources contains the resources that would be created, omitting any
+	// whose condition is false.
+	Resources map[string]*Resource
+
+	// Outputs contains the values of the outputs that would be produced,
+	// omitting any whose condition is false.
+	Outputs map[string]*Output
+}
+
+// Resource is a resource that would be created, with all of the intrinsic
+// functions in its properties and metadata resolved.
+type Resource struct {
+	Type       string
+	Properties map[string]interface{}
+	Metadata   map[string]interface{}
+	DependsOn  []string
+
+	// DeletionPolicy and UpdateReplacePolicy are empty if not set.
+	DeletionPolicy      string
+	UpdateReplacePolicy string
+	CreationPolicy      map[string]interface{}
+	UpdatePolicy        map[string]interface{}
+}
+
+// Output is the resolved value of an output.
+type Output struct {
+	Value      interface{}
+	ExportName interface{}
+}
+
+// ResourceNames returns the logical ids of the resources in the result in
+// lexicographical order.
+func (r *Result) ResourceNames() []string {
+	names := make([]string, 0, len(r.Resources))
+	for name := range r.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Evaluate renders the given template and then evaluates it as described
+// for EvaluateJSON.
+func Evaluate(template *eval.FlatTemplate, env *Environment) (*Result, hcl.Diagnostics) {
+	src, diags := cfnjson.Marshal(template)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	result, evalDiags := EvaluateJSON(src, env)
+	diags = append(diags, evalDiags...)
+	return result, diags
+}
+
+// EvaluateJSON evaluates the given template, in CloudFormation's JSON
+// syntax, resolving all of the conditions and intrinsic functions within it
+// using the values from the given environment.
+//
+// The template's rules are checked too, and each assertion that does not
+// hold produces an error, since CloudFormation would refuse to create the
+// stack.
+func EvaluateJSON(src []byte, env *Environment) (*Result, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	if env == nil {
+		env = &Environment{}
+	}
+
+	var template map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(string(src)))
+	dec.UseNumber()
+	err := dec.Decode(&template)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid template",
+			Detail:   fmt.Sprintf("The template is not valid JSON: %s.", err),
+		})
+		return nil, diags
+	}
+
+	e := &evaluator{
+		env:        env,
+		parameters: map[string]interface{}{},
+		mappings:   objectAt(template, "Mappings"),
+		conditions: objectAt(template, "Conditions"),
+		resources:  objectAt(template, "Resources"),
+		condValues: map[string]bool{},
+		condActive: map[string]bool{},
+	}
+	e.setParameters(objectAt(template, "Parameters"))
+
+	ret := &Result{
+		Conditions: map[string]bool{},
+		Resources:  map[string]*Resource{},
+		Outputs:    map[string]*Output{},
+	}
+
+	for _, name := range sortedKeys(e.conditions) {
+		ret.Conditions[name] = e.condition(name, "Conditions."+name)
+	}
+
+	rules := objectAt(template, "Rules")
+	for _, name := range sortedKeys(rules) {
+		raw, _ := rules[name].(map[string]interface{})
+		e.rule(name, raw)
+	}
+
+	for _, name := range sortedKeys(e.resources) {
+		path := "Resources." + name
+		raw, _ := e.resources[name].(map[string]interface{})
+		if !e.included(raw, path) {
+			continue
+		}
+		res := &Resource{}
+		res.Type, _ = raw["Type"].(string)
+		if props, exists := raw["Properties"]; exists {
+			res.Properties, _ = e.value(props, path+".Properties").(map[string]interface{})
+		}
+		if meta, exists := raw["Metadata"]; exists {
+			res.Metadata, _ = e.value(meta, path+".Metadata").(map[string]interface{})
+		}
+		res.DeletionPolicy, _ = raw["DeletionPolicy"].(string)
+		res.UpdateReplacePolicy, _ = raw["UpdateReplacePolicy"].(string)
+		if policy, exists := raw["CreationPolicy"]; exists {
+			res.CreationPolicy, _ = e.value(policy, path+".CreationPolicy").(map[string]interface{})
+		}
+		if policy, exists := raw["UpdatePolicy"]; exists {
+			res.UpdatePolicy, _ = e.value(policy, path+".UpdatePolicy").(map[string]interface{})
+		}
+		switch deps := raw["DependsOn"].(type) {
+		case string:
+			res.DependsOn = []string{deps}
+		case []interface{}:
+			for _, dep := range deps {
+				if depName, ok := dep.(string); ok {
+					res.DependsOn = append(res.DependsOn, depName)
+				}
+			}
+		}
+		for _, dep := range res.DependsOn {
+			if !e.resourceCreated(dep) {
+				e.errorf("Dependency on resource that is not created", "Resource %q depends on %q, which would not be created.", name, dep)
+			}
+		}
+		ret.Resources[name] = res
+	}
+
+	outputs := objectAt(template, "Outputs")
+	for _, name := range sortedKeys(outputs) {
+		path := "Outputs." + name
+		raw, _ := outputs[name].(map[string]interface{})
+		if !e.included(raw, path) {
+			continue
+		}
+		out := &Output{
+			Value: e.value(raw["Value"], path+".Value"),
+		}
+		if out.Value == noValue {
+			out.Value = nil
+		}
+		if export, ok := raw["Export"].(map[string]interface{}); ok {
+			out.ExportName = e.value(export["Name"], path+".Export.Name")
+		}
+		ret.Outputs[name] = out
+	}
+
+	diags = append(diags, e.diags...)
+	return ret, diags
+}
+
+// evaluator holds the state for the evaluation of a single template.
+type evaluator struct {
+	env        *Environment
+	parameters map[string]interface{}
+	mappings   map[string]interface{}
+	conditions map[string]interface{}
+	resources  map[string]interface{}
+
+	// condValues caches the values of conditions that have already been
+	// evaluated, while condActive tracks those currently being evaluated
+	// so that we can detect cycles.
+	condValues map[string]bool
+	condActive map[string]bool
+
+	// inRule is true while evaluating a rule, which is the only place
+	// where the rule functions such as Fn::Contains may be used.
+	inRule bool
+
+	diags hcl.Diagnostics
+}
+
+func (e *evaluator) errorf(summary, detail string, args ...interface{}) {
+	e.diags = append(e.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+	})
+}
+
+func (e *evaluator) warnf(summary, detail string, args ...interface{}) {
+	e.diags = append(e.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+	})
+}
+
+// setParameters determines the value of each of the given parameter
+// declarations, using either the value given in the environment or the
+// parameter's default.
+func (e *evaluator) setParameters(decls map[string]interface{}) {
+	for name := range e.env.Parameters {
+		if _, declared := decls[name]; !declared {
+			e.errorf("Value for undeclared parameter", "A value was given for parameter %q, but the template does not declare it.", name)
+		}
+	}
+
+	for _, name := range sortedKeys(decls) {
+		decl, _ := decls[name].(map[string]interface{})
+		val, given := e.env.Parameters[name]
+		if !given {
+			def, hasDefault := decl["Default"]
+			if !hasDefault {
+				e.errorf("Missing value for parameter", "Parameter %q has no default value, so a value must be given.", name)
+				continue
+			}
+			val = scalarString(def)
+			if items, isList := def.([]interface{}); isList {
+				// The defaults of list parameters may be given as lists
+				// rather than as comma-separated strings.
+				strs := make([]string, len(items))
+				for i, item := range items {
+					strs[i] = scalarString(item)
+				}
+				val = strings.Join(strs, ",")
+			}
+		}
+
+		if allowed, ok := decl["AllowedValues"].([]interface{}); ok {
+			permitted := false
+			for _, a := range allowed {
+				if scalarString(a) == val {
+					permitted = true
+					break
+				}
+			}
+			if !permitted {
+				e.errorf("Value not permitted for parameter", "The value %q is not one of the allowed values for parameter %q.", val, name)
+			}
+		}
+
+		// Parameters of list types are split into lists when referenced.
+		typeName, _ := decl["Type"].(string)
+		if typeName == "CommaDelimitedList" || strings.HasPrefix(typeName, "List<") {
+			var items []interface{}
+			if val != "" {
+				for _, item := range strings.Split(val, ",") {
+					items = append(items, strings.TrimSpace(item))
+				}
+			}
+			e.parameters[name] = items
+			continue
+		}
+		e.parameters[name] = val
+	}
+}
+
+// included returns true if the given resource or output would be included
+// in the stack, considering its Condition.
+func (e *evaluator) included(raw map[string]interface{}, path string) bool {
+	condName, hasCond := raw["Condition"]
+	if !hasCond {
+		return true
+	}
+	name, ok := condName.(string)
+	if !ok {
+		e.errorf("Invalid condition", "The Condition for %s must be the name of a condition.", path)
+		return false
+	}
+	return e.condition(name, path+".Condition")
+}
+
+// resourceCreated returns true if the resource with the given logical id is
+// declared and its condition, if any, is true.
+func (e *evaluator) resourceCreated(name string) bool {
+	raw, declared := e.resources[name].(map[string]interface{})
+	if !declared {
+		return false
+	}
+	return e.included(raw, "Resources."+name)
+}
+
+// condition returns the value of the named condition, evaluating it if
+// necessary.
+func (e *evaluator) condition(name, path string) bool {
+	if val, done := e.condValues[name]; done {
+		return val
+	}
+	def, exists := e.conditions[name]
+	if !exists {
+		e.errorf("Reference to undeclared condition", "%s refers to condition %q, which is not declared.", path, name)
+		e.condValues[name] = false
+		return false
+	}
+	if e.condActive[name] {
+		e.errorf("Condition refers to itself", "Condition %q depends on its own value.", name)
+		return false
+	}
+
+	e.condActive[name] = true
+	val := e.value(def, "Conditions."+name)
+	delete(e.condActive, name)
+
+	b, ok := val.(bool)
+	if !ok {
+		e.errorf("Invalid condition", "Condition %q does not produce a boolean value.", name)
+	}
+	e.condValues[name] = b
+	return b
+}
+
+// rule checks the assertions of the given rule, if its condition holds,
+// reporting an error for each assertion that does not, just as
+// CloudFormation would refuse to create the stack.
+//
+// Fn::ValueOf and Fn::RefAll depend on the resources in a real AWS account,
+// so conditions and assertions that use them are skipped with a warning.
+func (e *evaluator) rule(name string, raw map[string]interface{}) {
+	path := "Rules." + name
+	e.inRule = true
+	defer func() { e.inRule = false }()
+
+	if cond, exists := raw["RuleCondition"]; exists {
+		condPath := path + ".RuleCondition"
+		if fn := accountFunction(cond); fn != "" {
+			e.warnf("Rule not checked", "The condition of rule %q uses %s, which cannot be evaluated locally, so none of its assertions were checked.", name, fn)
+			return
+		}
+		if !e.bool(e.value(cond, condPath), condPath) {
+			return
+		}
+	}
+
+	assertions, _ := raw["Assertions"].([]interface{})
+	for i, rawAssertion := range assertions {
+		assertPath := fmt.Sprintf("%s.Assertions[%d].Assert", path, i)
+		assertion, _ := rawAssertion.(map[string]interface{})
+		if fn := accountFunction(assertion["Assert"]); fn != "" {
+			e.warnf("Rule assertion not checked", "%s uses %s, which cannot be evaluated locally.", assertPath, fn)
+			continue
+		}
+		if e.bool(e.value(assertion["Assert"], assertPath), assertPath) {
+			continue
+		}
+		detail, _ := assertion["AssertDescription"].(string)
+		if detail == "" {
+			detail = fmt.Sprintf("Assertion %d of rule %q is false.", i, name)
+		}
+		e.errorf("Rule assertion failed", "%s", detail)
+	}
+}
+
+// accountFunction returns the name of the first rule function within the
+// given raw value whose result depends on the resources in an AWS account,
+// or an empty string if there is none.
+func accountFunction(raw interface{}) string {
+	switch tv := raw.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(tv) {
+			if key == "Fn::ValueOf" || key == "Fn::ValueOfAll" || key == "Fn::RefAll" {
+				return key
+			}
+			if fn := accountFunction(tv[key]); fn != "" {
+				return fn
+			}
+		}
+	case []interface{}:
+		for _, item := range tv {
+			if fn := accountFunction(item); fn != "" {
+				return fn
+			}
+		}
+	}
+	return ""
+}
+
+func objectAt(obj map[string]interface{}, key string) map[string]interface{} {
+	ret, _ := obj[key].(map[string]interface{})
+	return ret
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
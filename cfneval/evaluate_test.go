@@ -0,0 +1,207 @@
+package cfneval
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateJSON(t *testing.T) {
+	template := `{
+  "Parameters": {
+    "Env": {"Type": "String", "Default": "dev"},
+    "Zones": {"Type": "CommaDelimitedList", "Default": ["a", "b"]}
+  },
+  "Conditions": {
+    "IsProd": {"Fn::Equals": [{"Ref": "Env"}, "prod"]},
+    "NotProd": {"Fn::Not": [{"Condition": "IsProd"}]}
+  },
+  "Resources": {
+    "Store": {
+      "Type": "AWS::S3::Bucket",
+      "Condition": "IsProd",
+      "Properties": {
+        "BucketName": {"Fn::Sub": "${AWS::StackName}-${Env}"}
+      }
+    },
+    "Topic": {
+      "Type": "AWS::SNS::Topic",
+      "Properties": {
+        "TopicName": {"Fn::If": ["IsProd", "prod-topic", {"Ref": "AWS::NoValue"}]},
+        "Zone": {"Fn::Select": [1, {"Ref": "Zones"}]}
+      }
+    }
+  },
+  "Outputs": {
+    "StoreName": {
+      "Condition": "IsProd",
+      "Value": {"Ref": "Store"}
+    },
+    "TopicArn": {
+      "Value": {"Fn::GetAtt": ["Topic", "Arn"]}
+    }
+  }
+}`
+
+	t.Run("defaults", func(t *testing.T) {
+		result, diags := EvaluateJSON([]byte(template), nil)
+		if len(diags) != 0 {
+			t.Fatalf("unexpected diagnostics: %s", diags.Error())
+		}
+		if got, want := result.Conditions, map[string]bool{"IsProd": false, "NotProd": true}; !reflect.DeepEqual(got, want) {
+			t.Errorf("wrong conditions\ngot:  %#v\nwant: %#v", got, want)
+		}
+		if got, want := result.ResourceNames(), []string{"Topic"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("wrong resources\ngot:  %#v\nwant: %#v", got, want)
+		}
+		if got, want := result.Resources["Topic"].Properties, map[string]interface{}{"Zone": "b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("wrong properties\ngot:  %#v\nwant: %#v", got, want)
+		}
+		if _, exists := result.Outputs["StoreName"]; exists {
+			t.Errorf("output StoreName exists, but its condition is false")
+		}
+		if got, want := result.Outputs["TopicArn"].Value, "Topic.Arn"; got != want {
+			t.Errorf("wrong value for TopicArn\ngot:  %#v\nwant: %#v", got, want)
+		}
+	})
+
+	t.Run("prod", func(t *testing.T) {
+		result, diags := EvaluateJSON([]byte(template), &Environment{
+			Parameters:  map[string]string{"Env": "prod"},
+			PhysicalIDs: map[string]string{"Store": "store-bucket"},
+		})
+		if len(diags) != 0 {
+			t.Fatalf("unexpected diagnostics: %s", diags.Error())
+		}
+		if got, want := result.ResourceNames(), []string{"Store", "Topic"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("wrong resources\ngot:  %#v\nwant: %#v", got, want)
+		}
+		if got, want := result.Resources["Store"].Properties["BucketName"], "awsup-test-prod"; got != want {
+			t.Errorf("wrong BucketName\ngot:  %#v\nwant: %#v", got, want)
+		}
+		if got, want := result.Outputs["StoreName"].Value, "store-bucket"; got != want {
+			t.Errorf("wrong value for StoreName\ngot:  %#v\nwant: %#v", got, want)
+		}
+	})
+}
+
+func TestEvaluateJSONRules(t *testing.T) {
+	template := `{
+  "Parameters": {
+    "Env": {"Type": "String"},
+    "Zones": {"Type": "CommaDelimitedList"},
+    "Subnet": {"Type": "AWS::EC2::Subnet::Id", "Default": "subnet-1"}
+  },
+  "Rules": {
+    "Envs": {
+      "Assertions": [
+        {
+          "Assert": {"Fn::Contains": [["dev", "prod"], {"Ref": "Env"}]},
+          "AssertDescription": "Env must be dev or prod"
+        },
+        {
+          "Assert": {"Fn::EachMemberIn": [{"Ref": "Zones"}, ["a", "b", "c"]]}
+        }
+      ]
+    },
+    "ProdZones": {
+      "RuleCondition": {"Fn::Equals": [{"Ref": "Env"}, "prod"]},
+      "Assertions": [
+        {
+          "Assert": {"Fn::EachMemberEquals": [{"Ref": "Zones"}, "a"]},
+          "AssertDescription": "Production uses only zone a"
+        }
+      ]
+    },
+    "Subnets": {
+      "Assertions": [
+        {
+          "Assert": {"Fn::Equals": [{"Fn::ValueOf": ["Subnet", "VpcId"]}, "vpc-1"]}
+        }
+      ]
+    }
+  }
+}`
+
+	tests := map[string]struct {
+		Parameters map[string]string
+		Want       []string
+	}{
+		"valid": {
+			map[string]string{"Env": "dev", "Zones": "a,b"},
+			nil,
+		},
+		"valid in prod": {
+			map[string]string{"Env": "prod", "Zones": "a,a"},
+			nil,
+		},
+		"invalid env": {
+			map[string]string{"Env": "qa", "Zones": "a"},
+			[]string{"Env must be dev or prod"},
+		},
+		"invalid zones": {
+			map[string]string{"Env": "dev", "Zones": "a,d"},
+			[]string{`Assertion 1 of rule "Envs" is false.`},
+		},
+		"invalid zones in prod": {
+			map[string]string{"Env": "prod", "Zones": "a,b"},
+			[]string{"Production uses only zone a"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, diags := EvaluateJSON([]byte(template), &Environment{
+				Parameters: test.Parameters,
+			})
+
+			// The assertion using Fn::ValueOf is always skipped.
+			var warnings int
+			var got []string
+			for _, diag := range diags {
+				if diag.Summary == "Rule assertion not checked" {
+					warnings++
+					continue
+				}
+				got = append(got, diag.Detail)
+			}
+			if warnings != 1 {
+				t.Errorf("got %d warnings for the Subnets rule; want 1", warnings)
+			}
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestEvaluateJSONUnsupported(t *testing.T) {
+	tests := map[string]struct {
+		Template string
+		Summary  string
+	}{
+		"transform": {
+			`{"Resources": {"Topic": {"Type": "AWS::SNS::Topic", "Properties": {"Fn::Transform": {"Name": "Example::Macro"}}}}}`,
+			"Macro not evaluated",
+		},
+		"rule function outside of rules": {
+			`{"Conditions": {"Yes": {"Fn::Contains": [["a"], "a"]}}}`,
+			"Invalid use of rule function",
+		},
+		"unknown function": {
+			`{"Conditions": {"Yes": {"Fn::Nope": []}}}`,
+			"Unsupported intrinsic function",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, diags := EvaluateJSON([]byte(test.Template), nil)
+			if len(diags) == 0 {
+				t.Fatalf("no diagnostics; want %q", test.Summary)
+			}
+			if got := diags[0].Summary; got != test.Summary {
+				t.Errorf("wrong diagnostic\ngot:  %s\nwant: %s", got, test.Summary)
+			}
+		})
+	}
+}
@@ -0,0 +1,545 @@
+package cfneval
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// noValueType is the type of noValue, which represents the result of a
+// reference to AWS::NoValue.
+type noValueType struct{}
+
+// noValue is the result of a reference to the AWS::NoValue pseudo parameter,
+// which causes the enclosing property or list element to be removed.
+var noValue = noValueType{}
+
+// value evaluates the given raw template value, resolving any intrinsic
+// function calls within it. The path describes the location of the value
+// within the template, for use in error messages.
+func (e *evaluator) value(raw interface{}, path string) interface{} {
+	switch tv := raw.(type) {
+
+	case map[string]interface{}:
+		if len(tv) == 1 {
+			for name, arg := range tv {
+				if name == "Ref" || name == "Condition" || strings.HasPrefix(name, "Fn::") {
+					return e.call(name, arg, path+"."+name)
+				}
+			}
+		}
+		ret := make(map[string]interface{}, len(tv))
+		for key, rawVal := range tv {
+			val := e.value(rawVal, path+"."+key)
+			if val == noValue {
+				continue
+			}
+			ret[key] = val
+		}
+		return ret
+
+	case []interface{}:
+		ret := make([]interface{}, 0, len(tv))
+		for i, rawVal := range tv {
+			val := e.value(rawVal, fmt.Sprintf("%s[%d]", path, i))
+			if val == noValue {
+				continue
+			}
+			ret = append(ret, val)
+		}
+		return ret
+
+	default:
+		return raw
+	}
+}
+
+// call evaluates a call to the intrinsic function with the given name.
+func (e *evaluator) call(name string, arg interface{}, path string) interface{} {
+	switch name {
+
+	case "Ref":
+		ref, ok := arg.(string)
+		if !ok {
+			e.errorf("Invalid Ref", "The argument to Ref at %s must be a logical id.", path)
+			return nil
+		}
+		return e.ref(ref, path)
+
+	case "Condition":
+		cond, ok := arg.(string)
+		if !ok {
+			e.errorf("Invalid Condition", "The argument to Condition at %s must be the name of a condition.", path)
+			return false
+		}
+		return e.condition(cond, path)
+
+	case "Fn::GetAtt":
+		var resource, attr string
+		switch targ := arg.(type) {
+		case string:
+			dot := strings.Index(targ, ".")
+			if dot > 0 {
+				resource, attr = targ[:dot], targ[dot+1:]
+			}
+		case []interface{}:
+			if len(targ) == 2 {
+				resource, _ = targ[0].(string)
+				attr, _ = e.str(e.value(targ[1], path+"[1]"), path+"[1]")
+			}
+		}
+		if resource == "" || attr == "" {
+			e.errorf("Invalid Fn::GetAtt", "The argument to Fn::GetAtt at %s must give a logical id and an attribute name.", path)
+			return nil
+		}
+		return e.getAttr(resource, attr, path)
+
+	case "Fn::If":
+		args, ok := e.args(name, arg, 3, path)
+		if !ok {
+			return nil
+		}
+		cond, ok := args[0].(string)
+		if !ok {
+			e.errorf("Invalid Fn::If", "The first argument to Fn::If at %s must be the name of a condition.", path)
+			return nil
+		}
+		// Only the selected result is evaluated, just as in CloudFormation,
+		// so that the other may refer to resources that are not created.
+		if e.condition(cond, path) {
+			return e.value(args[1], path+"[1]")
+		}
+		return e.value(args[2], path+"[2]")
+
+	case "Fn::Equals":
+		args, ok := e.args(name, arg, 2, path)
+		if !ok {
+			return false
+		}
+		a := e.value(args[0], path+"[0]")
+		b := e.value(args[1], path+"[1]")
+		return equalValues(a, b)
+
+	case "Fn::And", "Fn::Or":
+		items, ok := arg.([]interface{})
+		if !ok || len(items) < 2 {
+			e.errorf("Invalid "+name, "The argument to %s at %s must be a list of at least two conditions.", name, path)
+			return false
+		}
+		and := name == "Fn::And"
+		for i, item := range items {
+			if e.bool(e.value(item, fmt.Sprintf("%s[%d]", path, i)), path) != and {
+				return !and
+			}
+		}
+		return and
+
+	case "Fn::Not":
+		args, ok := e.args(name, arg, 1, path)
+		if !ok {
+			return false
+		}
+		return !e.bool(e.value(args[0], path+"[0]"), path)
+
+	case "Fn::FindInMap":
+		args, ok := e.args(name, arg, 3, path)
+		if !ok {
+			return nil
+		}
+		var keys [3]string
+		for i, rawKey := range args {
+			keys[i], ok = e.str(e.value(rawKey, fmt.Sprintf("%s[%d]", path, i)), path)
+			if !ok {
+				return nil
+			}
+		}
+		mapping, ok := e.mappings[keys[0]].(map[string]interface{})
+		if !ok {
+			e.errorf("Reference to undeclared mapping", "%s refers to mapping %q, which is not declared.", path, keys[0])
+			return nil
+		}
+		table, ok := mapping[keys[1]].(map[string]interface{})
+		if !ok {
+			e.errorf("Missing mapping key", "Mapping %q has no key %q, as required by %s.", keys[0], keys[1], path)
+			return nil
+		}
+		val, ok := table[keys[2]]
+		if !ok {
+			e.errorf("Missing mapping key", "Mapping %q has no key %q under %q, as required by %s.", keys[0], keys[2], keys[1], path)
+			return nil
+		}
+		return val
+
+	case "Fn::Sub":
+		return e.sub(arg, path)
+
+	case "Fn::Join":
+		args, ok := e.args(name, arg, 2, path)
+		if !ok {
+			return nil
+		}
+		delim, ok := e.str(e.value(args[0], path+"[0]"), path)
+		if !ok {
+			return nil
+		}
+		list, ok := e.value(args[1], path+"[1]").([]interface{})
+		if !ok {
+			e.errorf("Invalid Fn::Join", "The second argument to Fn::Join at %s must be a list.", path)
+			return nil
+		}
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i], ok = e.str(item, path)
+			if !ok {
+				return nil
+			}
+		}
+		return strings.Join(parts, delim)
+
+	case "Fn::Select":
+		args, ok := e.args(name, arg, 2, path)
+		if !ok {
+			return nil
+		}
+		indexStr, ok := e.str(e.value(args[0], path+"[0]"), path)
+		if !ok {
+			return nil
+		}
+		list, ok := e.value(args[1], path+"[1]").([]interface{})
+		if !ok {
+			e.errorf("Invalid Fn::Select", "The second argument to Fn::Select at %s must be a list.", path)
+			return nil
+		}
+		index, err := strconv.Atoi(indexStr)
+		if err != nil || index < 0 || index >= len(list) {
+			e.errorf("Invalid Fn::Select", "The index %q at %s is not valid for a list of %d elements.", indexStr, path, len(list))
+			return nil
+		}
+		return list[index]
+
+	case "Fn::Split":
+		args, ok := e.args(name, arg, 2, path)
+		if !ok {
+			return nil
+		}
+		delim, ok := e.str(e.value(args[0], path+"[0]"), path)
+		if !ok {
+			return nil
+		}
+		str, ok := e.str(e.value(args[1], path+"[1]"), path)
+		if !ok {
+			return nil
+		}
+		parts := strings.Split(str, delim)
+		ret := make([]interface{}, len(parts))
+		for i, part := range parts {
+			ret[i] = part
+		}
+		return ret
+
+	case "Fn::Base64":
+		str, ok := e.str(e.value(arg, path), path)
+		if !ok {
+			return nil
+		}
+		return base64.StdEncoding.EncodeToString([]byte(str))
+
+	case "Fn::GetAZs":
+		region, ok := e.str(e.value(arg, path), path)
+		if !ok {
+			return nil
+		}
+		if region == "" {
+			region, _ = e.str(e.ref("AWS::Region", path), path)
+		}
+		azs, given := e.env.AZs[region]
+		if !given {
+			azs = []string{region + "a", region + "b", region + "c"}
+		}
+		ret := make([]interface{}, len(azs))
+		for i, az := range azs {
+			ret[i] = az
+		}
+		return ret
+
+	case "Fn::ImportValue":
+		exportName, ok := e.str(e.value(arg, path), path)
+		if !ok {
+			return nil
+		}
+		val, exists := e.env.Imports[exportName]
+		if !exists {
+			e.errorf("Missing value for import", "%s imports %q, but no value was given for it.", path, exportName)
+			return nil
+		}
+		return val
+
+	case "Fn::Transform":
+		// Macros run within CloudFormation, so we can't know what they
+		// would produce.
+		argObj, _ := arg.(map[string]interface{})
+		macro, _ := argObj["Name"].(string)
+		e.warnf("Macro not evaluated", "%s calls the macro %q, which cannot be run locally, so the name of the macro is used in place of its result.", path, macro)
+		return macro
+
+	case "Fn::Contains", "Fn::EachMemberEquals", "Fn::EachMemberIn":
+		if !e.inRule {
+			e.errorf("Invalid use of rule function", "The function %s at %s may be used only in the Rules section.", name, path)
+			return false
+		}
+		args, ok := e.args(name, arg, 2, path)
+		if !ok {
+			return false
+		}
+		list, ok := e.strs(e.value(args[0], path+"[0]"), path+"[0]")
+		if !ok {
+			return false
+		}
+		switch name {
+		case "Fn::Contains":
+			want, ok := e.str(e.value(args[1], path+"[1]"), path+"[1]")
+			return ok && stringInList(want, list)
+		case "Fn::EachMemberEquals":
+			want, ok := e.str(e.value(args[1], path+"[1]"), path+"[1]")
+			if !ok {
+				return false
+			}
+			for _, item := range list {
+				if item != want {
+					return false
+				}
+			}
+			return true
+		default:
+			allowed, ok := e.strs(e.value(args[1], path+"[1]"), path+"[1]")
+			if !ok {
+				return false
+			}
+			for _, item := range list {
+				if !stringInList(item, allowed) {
+					return false
+				}
+			}
+			return true
+		}
+
+	case "Fn::ValueOf", "Fn::ValueOfAll", "Fn::RefAll":
+		// The rule method skips any assertion that uses these, so we get
+		// here only if they are used elsewhere.
+		e.errorf("Invalid use of rule function", "The function %s at %s may be used only in the Rules section.", name, path)
+		return nil
+
+	default:
+		e.errorf("Unsupported intrinsic function", "The function %s at %s cannot be evaluated.", name, path)
+		return nil
+	}
+}
+
+// ref returns the value of the parameter, pseudo parameter or resource with
+// the given name.
+func (e *evaluator) ref(name, path string) interface{} {
+	if val, isParam := e.parameters[name]; isParam {
+		return val
+	}
+	if name == "AWS::NoValue" {
+		return noValue
+	}
+	if strings.HasPrefix(name, "AWS::") {
+		if val, exists := e.env.PseudoParameters[name]; exists {
+			return val
+		}
+		if val, exists := DefaultPseudoParameters[name]; exists {
+			return val
+		}
+		e.errorf("Reference to unknown pseudo parameter", "%s refers to %s, which is not a pseudo parameter.", path, name)
+		return nil
+	}
+	if _, isResource := e.resources[name]; isResource {
+		if !e.resourceCreated(name) {
+			e.errorf("Reference to resource that is not created", "%s refers to resource %q, which would not be created.", path, name)
+			return nil
+		}
+		if id, given := e.env.PhysicalIDs[name]; given {
+			return id
+		}
+		return name
+	}
+	e.errorf("Reference to undeclared object", "%s refers to %q, which is not a parameter or resource.", path, name)
+	return nil
+}
+
+// getAttr returns the value of the given attribute of the given resource.
+func (e *evaluator) getAttr(resource, attr, path string) interface{} {
+	if _, isResource := e.resources[resource]; !isResource {
+		e.errorf("Reference to undeclared resource", "%s refers to resource %q, which is not declared.", path, resource)
+		return nil
+	}
+	if !e.resourceCreated(resource) {
+		e.errorf("Reference to resource that is not created", "%s refers to resource %q, which would not be created.", path, resource)
+		return nil
+	}
+	if val, given := e.env.Attributes[resource][attr]; given {
+		return val
+	}
+	return resource + "." + attr
+}
+
+// sub evaluates a call to Fn::Sub, whose argument is either a template
+// string or a list of a template string and a map of variables.
+func (e *evaluator) sub(arg interface{}, path string) interface{} {
+	tmpl, ok := arg.(string)
+	vars := map[string]interface{}{}
+	if list, isList := arg.([]interface{}); isList && len(list) == 2 {
+		tmpl, ok = list[0].(string)
+		rawVars, _ := list[1].(map[string]interface{})
+		for name, rawVal := range rawVars {
+			vars[name] = e.value(rawVal, path+"[1]."+name)
+		}
+	}
+	if !ok {
+		e.errorf("Invalid Fn::Sub", "The argument to Fn::Sub at %s must be either a string or a list of a string and a map of variables.", path)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	remain := tmpl
+	for {
+		start := strings.Index(remain, "${")
+		if start < 0 {
+			buf.WriteString(remain)
+			break
+		}
+		buf.WriteString(remain[:start])
+		remain = remain[start+2:]
+		end := strings.Index(remain, "}")
+		if end < 0 {
+			buf.WriteString("${" + remain)
+			break
+		}
+		name := remain[:end]
+		remain = remain[end+1:]
+
+		if strings.HasPrefix(name, "!") {
+			buf.WriteString("${" + name[1:] + "}")
+			continue
+		}
+
+		var val interface{}
+		if varVal, exists := vars[name]; exists {
+			val = varVal
+		} else if dot := strings.Index(name, "."); dot > 0 {
+			val = e.getAttr(name[:dot], name[dot+1:], path)
+		} else {
+			val = e.ref(name, path)
+		}
+		str, ok := e.str(val, path)
+		if !ok {
+			return nil
+		}
+		buf.WriteString(str)
+	}
+	return buf.String()
+}
+
+// args returns the arguments of a call to an intrinsic function that
+// expects a list of exactly the given number of arguments.
+func (e *evaluator) args(name string, arg interface{}, n int, path string) ([]interface{}, bool) {
+	list, ok := arg.([]interface{})
+	if !ok || len(list) != n {
+		e.errorf("Invalid "+name, "The argument to %s at %s must be a list of %d items.", name, path, n)
+		return nil, false
+	}
+	return list, true
+}
+
+// str converts the given value to a string, as CloudFormation does when
+// a primitive value is used where a string is expected.
+func (e *evaluator) str(val interface{}, path string) (string, bool) {
+	switch tv := val.(type) {
+	case nil:
+		// An error was already reported for whatever produced the null.
+		return "", false
+	case string, json.Number, bool:
+		return scalarString(tv), true
+	default:
+		e.errorf("Invalid value", "A string is required at %s.", path)
+		return "", false
+	}
+}
+
+// strs converts the given value to a list of strings, as required by the
+// rule functions.
+func (e *evaluator) strs(val interface{}, path string) ([]string, bool) {
+	list, ok := val.([]interface{})
+	if !ok {
+		if val != nil {
+			e.errorf("Invalid value", "A list of strings is required at %s.", path)
+		}
+		return nil, false
+	}
+	ret := make([]string, len(list))
+	for i, item := range list {
+		str, ok := e.str(item, fmt.Sprintf("%s[%d]", path, i))
+		if !ok {
+			return nil, false
+		}
+		ret[i] = str
+	}
+	return ret, true
+}
+
+// bool returns the given value as a boolean, as required by the condition
+// functions.
+func (e *evaluator) bool(val interface{}, path string) bool {
+	b, ok := val.(bool)
+	if !ok {
+		e.errorf("Invalid condition", "A condition is required at %s.", path)
+	}
+	return b
+}
+
+// scalarString returns the string representation of the given primitive
+// value, as used by CloudFormation when comparing values.
+func scalarString(val interface{}) string {
+	switch tv := val.(type) {
+	case string:
+		return tv
+	case json.Number:
+		return tv.String()
+	case bool:
+		return strconv.FormatBool(tv)
+	default:
+		return fmt.Sprintf("%v", tv)
+	}
+}
+
+func stringInList(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues implements the comparison made by Fn::Equals, under which
+// primitive values are compared as strings.
+func equalValues(a, b interface{}) bool {
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	if aIsList || bIsList {
+		if !(aIsList && bIsList) || len(aList) != len(bList) {
+			return false
+		}
+		for i := range aList {
+			if !equalValues(aList[i], bList[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return scalarString(a) == scalarString(b)
+}
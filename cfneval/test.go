@@ -0,0 +1,322 @@
+package cfneval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// RunTest evaluates the given template in the environment described by the
+// given test and then checks each of the test's assertions.
+//
+// The test passes if the returned diagnostics contain no errors. Each
+// assertion that does not hold produces an error diagnostic whose subject is
+// the assertion's condition.
+func RunTest(template *eval.FlatTemplate, test *config.TestFile) hcl.Diagnostics {
+	env, diags := testEnvironment(test)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	result, evalDiags := Evaluate(template, env)
+	diags = append(diags, evalDiags...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	ctx := resultEvalContext(template, result)
+	for _, assert := range test.Asserts {
+		val, valDiags := assert.Condition.Value(ctx)
+		diags = append(diags, valDiags...)
+		if valDiags.HasErrors() {
+			continue
+		}
+
+		val, err := convert.Convert(val, cty.Bool)
+		if err != nil || val.IsNull() || !val.IsKnown() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid assertion condition",
+				Detail:   "The condition for an assertion must be either true or false.",
+				Subject:  assert.Condition.Range().Ptr(),
+			})
+			continue
+		}
+		if val.True() {
+			continue
+		}
+
+		detail := "The condition for this assertion is false."
+		msg, msgDiags := assert.ErrorMessage.Value(ctx)
+		diags = append(diags, msgDiags...)
+		if msg, err := convert.Convert(msg, cty.String); err == nil && !msg.IsNull() && msg.IsKnown() {
+			detail = msg.AsString()
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Assertion failed",
+			Detail:   detail,
+			Subject:  assert.Condition.Range().Ptr(),
+		})
+	}
+
+	return diags
+}
+
+// testEnvironment produces the environment described by the parameter
+// values and stubs in the given test.
+func testEnvironment(test *config.TestFile) (*Environment, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	env := &Environment{
+		Parameters:       map[string]string{},
+		PseudoParameters: map[string]interface{}{},
+		PhysicalIDs:      map[string]string{},
+		Attributes:       map[string]map[string]interface{}{},
+	}
+
+	for name, attr := range test.Parameters {
+		val, valDiags := attr.Expr.Value(nil)
+		diags = append(diags, valDiags...)
+		if valDiags.HasErrors() {
+			continue
+		}
+		str, ok := parameterString(val)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid parameter value",
+				Detail:   "A parameter value must be either a string or a list of strings.",
+				Subject:  attr.Expr.Range().Ptr(),
+			})
+			continue
+		}
+		env.Parameters[name] = str
+	}
+
+	for name, attr := range test.PseudoParameters {
+		val, valDiags := attr.Expr.Value(nil)
+		diags = append(diags, valDiags...)
+		if valDiags.HasErrors() {
+			continue
+		}
+		env.PseudoParameters["AWS::"+name] = rawValue(val)
+	}
+
+	for logicalID, res := range test.Resources {
+		id, idDiags := res.PhysicalID.Value(nil)
+		diags = append(diags, idDiags...)
+		if !idDiags.HasErrors() && !id.IsNull() {
+			idStr, err := convert.Convert(id, cty.String)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid physical id",
+					Detail:   fmt.Sprintf("Unsuitable value for PhysicalId: %s.", err),
+					Subject:  res.PhysicalID.Range().Ptr(),
+				})
+			} else {
+				env.PhysicalIDs[logicalID] = idStr.AsString()
+			}
+		}
+
+		attrs, attrsDiags := res.Attributes.Value(nil)
+		diags = append(diags, attrsDiags...)
+		if !attrsDiags.HasErrors() && !attrs.IsNull() {
+			raw, isObj := rawValue(attrs).(map[string]interface{})
+			if !isObj {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid resource attributes",
+					Detail:   "Attributes must be an object whose attributes are the stub values of the resource's attributes.",
+					Subject:  res.Attributes.Range().Ptr(),
+				})
+			} else {
+				env.Attributes[logicalID] = raw
+			}
+		}
+	}
+
+	imports, importsDiags := test.Imports.Value(nil)
+	diags = append(diags, importsDiags...)
+	if !importsDiags.HasErrors() && !imports.IsNull() {
+		raw, isObj := rawValue(imports).(map[string]interface{})
+		if !isObj {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid imports",
+				Detail:   "Imports must be an object whose attributes are the values of the exports imported by the template.",
+				Subject:  test.Imports.Range().Ptr(),
+			})
+		} else {
+			env.Imports = raw
+		}
+	}
+
+	return env, diags
+}
+
+// resultEvalContext returns the context in which the assertions of a test
+// are evaluated.
+//
+// The outputs, resources and conditions of the template are available as
+// Output.Name, Resource.LogicalId and Condition.Name respectively. Outputs
+// and resources that would not be created are null, which assertions can
+// detect using the exists function.
+func resultEvalContext(template *eval.FlatTemplate, result *Result) *hcl.EvalContext {
+	outputs := map[string]cty.Value{}
+	for name := range template.Outputs {
+		outputs[name] = cty.NullVal(cty.DynamicPseudoType)
+		if out, exists := result.Outputs[name]; exists {
+			outputs[name] = ctyValue(out.Value)
+		}
+	}
+
+	resources := map[string]cty.Value{}
+	for logicalID := range template.Resources {
+		resources[logicalID] = cty.NullVal(cty.DynamicPseudoType)
+		if res, exists := result.Resources[logicalID]; exists {
+			resources[logicalID] = ctyValue(map[string]interface{}{
+				"Type":                res.Type,
+				"Properties":          res.Properties,
+				"Metadata":            res.Metadata,
+				"DependsOn":           res.DependsOn,
+				"DeletionPolicy":      res.DeletionPolicy,
+				"UpdateReplacePolicy": res.UpdateReplacePolicy,
+				"CreationPolicy":      res.CreationPolicy,
+				"UpdatePolicy":        res.UpdatePolicy,
+			})
+		}
+	}
+
+	conditions := map[string]cty.Value{}
+	for name, val := range result.Conditions {
+		conditions[name] = cty.BoolVal(val)
+	}
+
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"Output":    cty.ObjectVal(outputs),
+			"Resource":  cty.ObjectVal(resources),
+			"Condition": cty.ObjectVal(conditions),
+		},
+		Functions: testFunctions,
+	}
+}
+
+// testFunctions is the table of functions available in test assertions.
+var testFunctions = map[string]function.Function{
+	"exists":     existsFunc,
+	"jsonencode": stdlib.JSONEncodeFunc,
+	"length":     stdlib.LengthFunc,
+}
+
+// existsFunc tests whether its argument is non-null.
+//
+// This is needed because the equality operators cannot compare values of
+// unknown type, which includes null itself, with null.
+var existsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:             "value",
+			Type:             cty.DynamicPseudoType,
+			AllowNull:        true,
+			AllowDynamicType: true,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.BoolVal(!args[0].IsNull()), nil
+	},
+})
+
+// parameterString returns the given value in the string form that
+// CloudFormation expects for parameter values, with the elements of lists
+// separated by commas.
+func parameterString(val cty.Value) (string, bool) {
+	if val.IsNull() || !val.IsKnown() {
+		return "", false
+	}
+	ty := val.Type()
+	if ty.IsListType() || ty.IsTupleType() || ty.IsSetType() {
+		var parts []string
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			part, ok := parameterString(elem)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, ","), true
+	}
+	str, err := convert.Convert(val, cty.String)
+	if err != nil {
+		return "", false
+	}
+	return str.AsString(), true
+}
+
+// rawValue converts the given value to the representation of JSON values
+// used by the evaluator.
+func rawValue(val cty.Value) interface{} {
+	src, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		// Should never happen for the wholly-known values we deal with here.
+		panic(fmt.Errorf("failed to marshal value: %s", err))
+	}
+	var ret interface{}
+	dec := json.NewDecoder(strings.NewReader(string(src)))
+	dec.UseNumber()
+	dec.Decode(&ret)
+	return ret
+}
+
+// ctyValue is the inverse of rawValue.
+func ctyValue(raw interface{}) cty.Value {
+	switch tv := raw.(type) {
+	case string:
+		return cty.StringVal(tv)
+	case json.Number:
+		f, _, err := big.ParseFloat(tv.String(), 10, 512, big.ToNearestEven)
+		if err != nil {
+			// Should never happen, since the JSON decoder validates numbers.
+			panic(fmt.Errorf("invalid number %q: %s", tv, err))
+		}
+		return cty.NumberVal(f)
+	case bool:
+		return cty.BoolVal(tv)
+	case []interface{}:
+		if len(tv) == 0 {
+			return cty.EmptyTupleVal
+		}
+		elems := make([]cty.Value, len(tv))
+		for i, elem := range tv {
+			elems[i] = ctyValue(elem)
+		}
+		return cty.TupleVal(elems)
+	case map[string]interface{}:
+		attrs := make(map[string]cty.Value, len(tv))
+		for name, attr := range tv {
+			attrs[name] = ctyValue(attr)
+		}
+		return cty.ObjectVal(attrs)
+	case []string:
+		elems := make([]interface{}, len(tv))
+		for i, elem := range tv {
+			elems[i] = elem
+		}
+		return ctyValue(elems)
+	default:
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+}
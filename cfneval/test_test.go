@@ -0,0 +1,60 @@
+package cfneval
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/apparentlymart/awsup/schema"
+)
+
+func TestRunTest(t *testing.T) {
+	const dir = "testdata/run-test"
+
+	// Want gives the summary and detail of each diagnostic, in order.
+	tests := map[string][]string{
+		"pass.awsuptest": nil,
+		"fail.awsuptest": {
+			"Assertion failed: The queue must be created.",
+			"Assertion failed: The condition for this assertion is false.",
+		},
+		"disabled.awsuptest": nil,
+		"invalid-attributes.awsuptest": {
+			"Invalid resource attributes: Attributes must be an object whose attributes are the stub values of the resource's attributes.",
+		},
+		"invalid-imports.awsuptest": {
+			"Invalid imports: Imports must be an object whose attributes are the values of the exports imported by the template.",
+		},
+		"invalid-parameter.awsuptest": {
+			"Invalid parameter value: A parameter value must be either a string or a list of strings.",
+		},
+	}
+
+	parser := config.NewParser()
+	for filename, want := range tests {
+		t.Run(filename, func(t *testing.T) {
+			test, diags := parser.ParseTestFile(filepath.Join(dir, filename))
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics parsing test: %s", diags.Error())
+			}
+			ctx, diags := eval.NewRootContext(parser, dir, test.Constants, schema.Builtin())
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading module: %s", diags.Error())
+			}
+			template, diags := ctx.Build()
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors building template: %s", diags.Error())
+			}
+
+			var got []string
+			for _, diag := range RunTest(template, test) {
+				got = append(got, diag.Summary+": "+diag.Detail)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package cfnimport
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// hclExpr is the source code for an HCL expression, along with its
+// precedence so that it can be parenthesized where needed when used as an
+// operand.
+type hclExpr struct {
+	src  string
+	prec int
+}
+
+// These are the precedence levels of the HCL operators we generate, from
+// loosest to tightest binding.
+const (
+	precConditional = iota
+	precOr
+	precAnd
+	precEquality
+	precNot
+	precPrimary
+)
+
+var nullExpr = hclExpr{src: "null", prec: precPrimary}
+
+// operand returns the source code for the given expression, parenthesized
+// if it binds more loosely than the given precedence.
+func (e hclExpr) operand(prec int) string {
+	if e.prec < prec {
+		return "(" + e.src + ")"
+	}
+	return e.src
+}
+
+// expr converts the given template value, which may contain intrinsic
+// function calls, into an HCL expression.
+func (im *importer) expr(node *yaml.Node) hclExpr {
+	node = resolveAlias(node)
+
+	if name, arg, ok := intrinsic(node); ok {
+		return im.intrinsic(node, name, arg)
+	}
+
+	switch node.Kind {
+
+	case yaml.ScalarNode:
+		return scalarExpr(node)
+
+	case yaml.SequenceNode:
+		var buf bytes.Buffer
+		buf.WriteString("[")
+		multiline := !allScalars(node.Content)
+		for i, item := range node.Content {
+			switch {
+			case multiline:
+				buf.WriteString("\n")
+			case i > 0:
+				buf.WriteString(", ")
+			}
+			buf.WriteString(im.expr(item).src)
+			if multiline {
+				buf.WriteString(",")
+			}
+		}
+		if multiline {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("]")
+		return hclExpr{src: buf.String(), prec: precPrimary}
+
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			return hclExpr{src: "{}", prec: precPrimary}
+		}
+		var buf bytes.Buffer
+		buf.WriteString("{\n")
+		eachMapping(node, func(key string, _, val *yaml.Node) {
+			buf.WriteString(objectKey(key))
+			buf.WriteString(" = ")
+			buf.WriteString(im.expr(val).src)
+			buf.WriteString("\n")
+		})
+		buf.WriteString("}")
+		return hclExpr{src: buf.String(), prec: precPrimary}
+
+	default:
+		im.errorf(node, "Unsupported value", "This value cannot be converted.")
+		return nullExpr
+	}
+}
+
+// intrinsic returns the name and argument of the intrinsic function call
+// represented by the given node, if any. Calls may be written either as
+// an object with a single key, or using YAML's short form tags such as !Ref.
+func intrinsic(node *yaml.Node) (name string, arg *yaml.Node, ok bool) {
+	if strings.HasPrefix(node.Tag, "!") && !strings.HasPrefix(node.Tag, "!!") && node.Tag != "!" {
+		name = node.Tag[1:]
+		if name != "Ref" && name != "Condition" {
+			name = "Fn::" + name
+		}
+		// The argument is the same node without the tag, so that it will
+		// be interpreted as an ordinary value.
+		argNode := *node
+		argNode.Tag = ""
+		return name, &argNode, true
+	}
+
+	if node.Kind == yaml.MappingNode && len(node.Content) == 2 {
+		key := resolveAlias(node.Content[0]).Value
+		if key == "Ref" || key == "Condition" || strings.HasPrefix(key, "Fn::") {
+			return key, resolveAlias(node.Content[1]), true
+		}
+	}
+
+	return "", nil, false
+}
+
+func scalarExpr(node *yaml.Node) hclExpr {
+	switch node.ShortTag() {
+	case "!!null":
+		return nullExpr
+	case "!!bool":
+		b, err := strconv.ParseBool(strings.ToLower(node.Value))
+		if err == nil {
+			return hclExpr{src: strconv.FormatBool(b), prec: precPrimary}
+		}
+	case "!!int", "!!float":
+		if numberPattern.MatchString(node.Value) {
+			return hclExpr{src: node.Value, prec: precPrimary}
+		}
+	}
+	return hclExpr{src: quoteString(node.Value), prec: precPrimary}
+}
+
+// numberPattern matches the number syntax that JSON and HCL have in common.
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+func allScalars(nodes []*yaml.Node) bool {
+	for _, node := range nodes {
+		node = resolveAlias(node)
+		if _, _, isCall := intrinsic(node); isCall || node.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteString returns the given string as a quoted HCL string literal,
+// escaping any sequences that would otherwise be interpreted as template
+// interpolations or directives.
+func quoteString(s string) string {
+	return `"` + escapeTemplateLiteral(s) + `"`
+}
+
+// escapeTemplateLiteral escapes the given literal text for inclusion in a
+// quoted HCL template.
+func escapeTemplateLiteral(s string) string {
+	var buf bytes.Buffer
+	for i, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '$', '%':
+			buf.WriteRune(r)
+			if i+1 < len(s) && s[i+1] == '{' {
+				buf.WriteRune(r)
+			}
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u`)
+				buf.WriteString(strconv.FormatInt(int64(r)+0x10000, 16)[1:])
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// validIdentifier returns true if the given string can be used as an HCL
+// identifier, such as an attribute name.
+func validIdentifier(s string) bool {
+	return identifierPattern.MatchString(s)
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// validName returns true if the given string is acceptable as the name of
+// a parameter, resource, output, condition or mapping, which is the same
+// rule CloudFormation uses for logical ids.
+func validName(s string) bool {
+	return namePattern.MatchString(s)
+}
+
+// objectKey returns the given string in a form suitable for use as a key in
+// an HCL object constructor.
+func objectKey(s string) string {
+	if validIdentifier(s) {
+		return s
+	}
+	return quoteString(s)
+}
+
+// indexStep returns a traversal step that looks up the given key, using
+// attribute syntax where possible.
+func indexStep(key string) string {
+	if validName(key) && !unicode.IsDigit(rune(key[0])) {
+		return "." + key
+	}
+	return "[" + quoteString(key) + "]"
+}
@@ -0,0 +1,149 @@
+package cfnimport
+
+import (
+	"bytes"
+	"strings"
+)
+
+// format applies the canonical layout to the configuration source generated
+// by the importer, which is written without any indentation.
+//
+// Each line is indented according to the brackets that are open at its
+// start, and the equals signs of consecutive single-line attribute
+// definitions at the same level are aligned.
+func format(src []byte) []byte {
+	lines := strings.Split(strings.TrimRight(string(src), "\n"), "\n")
+
+	type formatLine struct {
+		text   string
+		indent int
+
+		// nameLen is the length of the attribute name, for lines that
+		// define attributes whose values are on a single line, or -1
+		// otherwise.
+		nameLen int
+	}
+	formatted := make([]formatLine, len(lines))
+
+	// As with hclwrite, a line that opens several brackets at once increases
+	// the indent level only by one, and so we track how many brackets
+	// each level of indentation represents.
+	var levels []int
+	var stack []byte
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		opened, closedFirst := bracketChanges(line, &stack)
+		indent := len(levels)
+		switch {
+		case opened > 0:
+			levels = append(levels, opened)
+		case opened < 0:
+			for closed := -opened; closed > 0 && len(levels) > 0; {
+				top := &levels[len(levels)-1]
+				if closed < *top {
+					*top -= closed
+					break
+				}
+				closed -= *top
+				levels = levels[:len(levels)-1]
+			}
+			if closedFirst {
+				indent = len(levels)
+			}
+		}
+
+		nameLen := -1
+		if eq := strings.Index(line, " = "); eq > 0 && opened == 0 && validIdentifier(line[:eq]) {
+			nameLen = eq
+		}
+		formatted[i] = formatLine{
+			text:    line,
+			indent:  indent,
+			nameLen: nameLen,
+		}
+	}
+
+	// Align the equals signs in each run of attribute definitions.
+	for start := 0; start < len(formatted); {
+		end := start
+		maxLen := 0
+		for end < len(formatted) && formatted[end].nameLen >= 0 && formatted[end].indent == formatted[start].indent {
+			if formatted[end].nameLen > maxLen {
+				maxLen = formatted[end].nameLen
+			}
+			end++
+		}
+		if end == start {
+			start++
+			continue
+		}
+		for i := start; i < end; i++ {
+			line := &formatted[i]
+			pad := strings.Repeat(" ", maxLen-line.nameLen)
+			line.text = line.text[:line.nameLen] + pad + line.text[line.nameLen:]
+		}
+		start = end
+	}
+
+	var buf bytes.Buffer
+	for _, line := range formatted {
+		if line.text != "" {
+			buf.WriteString(strings.Repeat("  ", line.indent))
+			buf.WriteString(line.text)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// bracketChanges returns the net number of brackets opened on the given
+// line outside of string literals, and whether the line begins by closing
+// a bracket.
+//
+// The stack tracks the nesting of string literals and the interpolation
+// sequences within them, which may span multiple lines.
+func bracketChanges(line string, stack *[]byte) (opened int, closedFirst bool) {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		top := byte(0)
+		if len(*stack) > 0 {
+			top = (*stack)[len(*stack)-1]
+		}
+
+		if top == '"' {
+			switch {
+			case c == '\\':
+				i++
+			case c == '"':
+				*stack = (*stack)[:len(*stack)-1]
+			case (c == '$' || c == '%') && strings.HasPrefix(line[i+1:], string(c)+"{"):
+				i += 2
+			case (c == '$' || c == '%') && strings.HasPrefix(line[i+1:], "{"):
+				*stack = append(*stack, '$')
+				i++
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			*stack = append(*stack, '"')
+		case '{', '[', '(':
+			if top == 0 {
+				opened++
+			} else {
+				*stack = append(*stack, c)
+			}
+		case '}', ']', ')':
+			if top == 0 {
+				if opened == 0 && i == 0 {
+					closedFirst = true
+				}
+				opened--
+			} else {
+				*stack = (*stack)[:len(*stack)-1]
+			}
+		}
+	}
+	return opened, closedFirst
+}
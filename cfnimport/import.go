@@ -0,0 +1,476 @@
+// Package cfnimport converts existing CloudFormation templates, in either
+// JSON or YAML syntax, into equivalent awsup configuration source code.
+package cfnimport
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hashicorp/hcl2/hcl"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Import converts the given CloudFormation template source into awsup
+// configuration source code.
+//
+// The result maps filenames to the source code to write into each file,
+// with one file for each of the top-level sections of the template that are
+// present. Together the files form a single module that generates a template
+// equivalent to the one given.
+//
+// Constructs that cannot be represented in awsup configuration are reported
+// as warnings and omitted from the result. If any errors are returned then
+// the result is incomplete and should not be used.
+func Import(src []byte, filename string) (map[string][]byte, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	var doc yaml.Node
+	err := yaml.Unmarshal(src, &doc)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid template syntax",
+			Detail:   fmt.Sprintf("The template %s could not be parsed as either JSON or YAML: %s.", filename, err),
+		})
+		return nil, diags
+	}
+	if len(doc.Content) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Empty template",
+			Detail:   fmt.Sprintf("The template %s does not contain any content.", filename),
+		})
+		return nil, diags
+	}
+
+	im := &importer{
+		filename:   filename,
+		params:     map[string]bool{},
+		resources:  map[string]bool{},
+		conditions: map[string]bool{},
+		mappings:   map[string]bool{},
+	}
+	root := resolveAlias(doc.Content[0])
+	if root.Kind != yaml.MappingNode {
+		im.errorf(root, "Invalid template", "The root of a template must be an object.")
+		return nil, im.diags
+	}
+
+	// We collect the names declared in each of the sections first, so that
+	// references to them can be resolved regardless of the order in which
+	// they appear.
+	sections := map[string]*yaml.Node{}
+	eachMapping(root, func(key string, keyNode, val *yaml.Node) {
+		sections[key] = val
+		switch key {
+		case "Parameters":
+			eachMapping(val, func(name string, _, _ *yaml.Node) { im.params[name] = true })
+		case "Resources":
+			eachMapping(val, func(name string, _, _ *yaml.Node) { im.resources[name] = true })
+		case "Conditions":
+			eachMapping(val, func(name string, _, _ *yaml.Node) { im.conditions[name] = true })
+		case "Mappings":
+			eachMapping(val, func(name string, _, _ *yaml.Node) { im.mappings[name] = true })
+		case "AWSTemplateFormatVersion", "Description", "Metadata", "Outputs", "Transform":
+			// Handled below
+		default:
+			im.warnf(keyNode, "Unsupported template section", "The %q section is not supported by awsup, so it has been omitted.", key)
+		}
+	})
+
+	files := map[string][]byte{}
+	addFile := func(name string, buf *bytes.Buffer) {
+		if buf.Len() > 0 {
+			files[name] = format(buf.Bytes())
+		}
+	}
+
+	{
+		var buf bytes.Buffer
+		if desc, exists := sections["Description"]; exists {
+			fmt.Fprintf(&buf, "Description = %s\n", im.expr(desc).src)
+		}
+		if transform, exists := sections["Transform"]; exists {
+			if isTransformNames(transform) {
+				fmt.Fprintf(&buf, "Transform = %s\n", im.expr(transform).src)
+			} else {
+				im.warnf(transform, "Unsupported transform", "Transform must be the name of a transform or a list of names, so it has been omitted.")
+			}
+		}
+		if meta, exists := sections["Metadata"]; exists {
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			im.writeMetadata(&buf, meta)
+		}
+		addFile("main.awsup", &buf)
+	}
+
+	if sec, exists := sections["Parameters"]; exists {
+		var buf bytes.Buffer
+		eachMapping(sec, func(name string, _, val *yaml.Node) {
+			im.writeParameter(&buf, name, val)
+		})
+		addFile("parameters.awsup", &buf)
+	}
+
+	if sec, exists := sections["Mappings"]; exists {
+		var buf bytes.Buffer
+		buf.WriteString("Mappings {\n")
+		eachMapping(sec, func(name string, keyNode, val *yaml.Node) {
+			im.writeAttr(&buf, name, keyNode, im.expr(val))
+		})
+		buf.WriteString("}\n")
+		addFile("mappings.awsup", &buf)
+	}
+
+	if sec, exists := sections["Conditions"]; exists {
+		var buf bytes.Buffer
+		buf.WriteString("Conditions {\n")
+		eachMapping(sec, func(name string, keyNode, val *yaml.Node) {
+			im.writeAttr(&buf, name, keyNode, im.expr(val))
+		})
+		buf.WriteString("}\n")
+		addFile("conditions.awsup", &buf)
+	}
+
+	if sec, exists := sections["Resources"]; exists {
+		var buf bytes.Buffer
+		eachMapping(sec, func(name string, _, val *yaml.Node) {
+			im.writeResource(&buf, name, val)
+		})
+		addFile("resources.awsup", &buf)
+	}
+
+	if sec, exists := sections["Outputs"]; exists {
+		var buf bytes.Buffer
+		eachMapping(sec, func(name string, _, val *yaml.Node) {
+			im.writeOutput(&buf, name, val)
+		})
+		addFile("outputs.awsup", &buf)
+	}
+
+	return files, im.diags
+}
+
+// importer holds the state used while converting a single template.
+type importer struct {
+	filename string
+
+	// These are the names declared in each of the template sections that
+	// can be referenced from elsewhere in the template.
+	params, resources, conditions, mappings map[string]bool
+
+	diags hcl.Diagnostics
+}
+
+func (im *importer) writeParameter(buf *bytes.Buffer, name string, val *yaml.Node) {
+	if !im.checkName(val, "parameter", name) {
+		return
+	}
+	fmt.Fprintf(buf, "Parameter %q {\n", name)
+	eachMapping(val, func(key string, keyNode, val *yaml.Node) {
+		switch key {
+		case "Type", "Description", "Default", "AllowedPattern", "AllowedValues",
+			"ConstraintDescription", "MinLength", "MaxLength", "MinValue", "MaxValue":
+			im.writeAttr(buf, key, keyNode, im.expr(val))
+		case "NoEcho":
+			im.writeAttr(buf, "Obscure", keyNode, im.expr(val))
+		default:
+			im.warnf(keyNode, "Unsupported parameter argument", "Parameter %q sets %q, which is not supported by awsup, so it has been omitted.", name, key)
+		}
+	})
+	buf.WriteString("}\n\n")
+}
+
+func (im *importer) writeResource(buf *bytes.Buffer, name string, val *yaml.Node) {
+	if !im.checkName(val, "resource", name) {
+		return
+	}
+	fmt.Fprintf(buf, "Resource %q {\n", name)
+	var props, meta, creationPolicy, updatePolicy *yaml.Node
+	eachMapping(val, func(key string, keyNode, val *yaml.Node) {
+		switch key {
+		case "Type", "DeletionPolicy", "UpdateReplacePolicy":
+			im.writeAttr(buf, key, keyNode, im.expr(val))
+		case "Condition":
+			if val.Kind != yaml.ScalarNode || !im.conditions[val.Value] {
+				im.errorf(val, "Invalid Condition", "The Condition of a resource must be the name of a condition declared in the template.")
+				return
+			}
+			im.writeAttr(buf, key, keyNode, primary("Condition."+val.Value))
+		case "DependsOn":
+			im.writeAttr(buf, key, keyNode, im.dependsOn(val))
+		case "Properties":
+			props = val
+		case "Metadata":
+			meta = val
+		case "CreationPolicy":
+			creationPolicy = val
+		case "UpdatePolicy":
+			updatePolicy = val
+		default:
+			im.warnf(keyNode, "Unsupported resource argument", "Resource %q sets %q, which is not yet supported by awsup, so it has been omitted.", name, key)
+		}
+	})
+	if props != nil {
+		buf.WriteString("\nProperties {\n")
+		eachMapping(props, func(key string, keyNode, val *yaml.Node) {
+			im.writeAttr(buf, key, keyNode, im.expr(val))
+		})
+		buf.WriteString("}\n")
+	}
+	if meta != nil {
+		buf.WriteByte('\n')
+		im.writeMetadata(buf, meta)
+	}
+	if creationPolicy != nil {
+		im.writePolicy(buf, name, "CreationPolicy", creationPolicy, creationPolicyBlocks, nil)
+	}
+	if updatePolicy != nil {
+		im.writePolicy(buf, name, "UpdatePolicy", updatePolicy, updatePolicyBlocks, updatePolicyArgs)
+	}
+	buf.WriteString("}\n\n")
+}
+
+// policyBlock describes the nested block that represents one of the
+// policies within a resource's CreationPolicy or UpdatePolicy.
+type policyBlock struct {
+	Name string
+	Args []string
+}
+
+// creationPolicyBlocks and updatePolicyBlocks map the keys of the policies
+// within CreationPolicy and UpdatePolicy to the nested blocks that represent
+// them in configuration.
+var creationPolicyBlocks = map[string]policyBlock{
+	"AutoScalingCreationPolicy": {"AutoScaling", []string{"MinSuccessfulInstancesPercent"}},
+	"ResourceSignal":            {"Signal", []string{"Count", "Timeout"}},
+}
+var updatePolicyBlocks = map[string]policyBlock{
+	"AutoScalingReplacingUpdate": {"AutoScalingReplacingUpdate", []string{"WillReplace"}},
+	"AutoScalingRollingUpdate": {"AutoScalingRollingUpdate", []string{
+		"MaxBatchSize", "MinActiveInstancesPercent", "MinInstancesInService",
+		"MinSuccessfulInstancesPercent", "PauseTime", "SuspendProcesses",
+		"WaitOnResourceSignals",
+	}},
+	"AutoScalingScheduledAction": {"AutoScalingScheduledAction", []string{"IgnoreUnmodifiedGroupSizeProperties"}},
+	"CodeDeployLambdaAliasUpdate": {"CodeDeployLambdaAliasUpdate", []string{
+		"AfterAllowTrafficHook", "ApplicationName", "BeforeAllowTrafficHook",
+		"DeploymentGroupName",
+	}},
+}
+
+// updatePolicyArgs are the arguments that are set directly in an
+// UpdatePolicy block, rather than in one of its nested blocks.
+var updatePolicyArgs = []string{"EnableVersionUpgrade", "UseOnlineResharding"}
+
+// writePolicy writes the given CreationPolicy or UpdatePolicy (given as
+// kind) of a resource as a block of the same name, with a nested block for
+// each of the policies it contains.
+func (im *importer) writePolicy(buf *bytes.Buffer, resourceName, kind string, val *yaml.Node, blocks map[string]policyBlock, args []string) {
+	if val.Kind != yaml.MappingNode {
+		im.errorf(val, fmt.Sprintf("Invalid %s", kind), "The %s of a resource must be an object.", kind)
+		return
+	}
+	fmt.Fprintf(buf, "\n%s {\n", kind)
+	eachMapping(val, func(key string, keyNode, val *yaml.Node) {
+		if stringInList(key, args) {
+			im.writeAttr(buf, key, keyNode, im.expr(val))
+			return
+		}
+		block, exists := blocks[key]
+		if !exists || val.Kind != yaml.MappingNode {
+			im.warnf(keyNode, "Unsupported policy", "Resource %q sets %q in its %s, which is not supported by awsup, so it has been dropped.", resourceName, key, kind)
+			return
+		}
+		fmt.Fprintf(buf, "%s {\n", block.Name)
+		eachMapping(val, func(arg string, argNode, val *yaml.Node) {
+			if !stringInList(arg, block.Args) {
+				im.warnf(argNode, "Unsupported policy argument", "Resource %q sets %q in %s.%s, which is not supported by awsup, so it has been dropped.", resourceName, arg, kind, key)
+				return
+			}
+			im.writeAttr(buf, arg, argNode, im.expr(val))
+		})
+		buf.WriteString("}\n")
+	})
+	buf.WriteString("}\n")
+}
+
+func (im *importer) writeOutput(buf *bytes.Buffer, name string, val *yaml.Node) {
+	if !im.checkName(val, "output", name) {
+		return
+	}
+	fmt.Fprintf(buf, "Output %q {\n", name)
+	eachMapping(val, func(key string, keyNode, val *yaml.Node) {
+		switch key {
+		case "Description", "Value":
+			im.writeAttr(buf, key, keyNode, im.expr(val))
+		case "Condition":
+			if val.Kind != yaml.ScalarNode || !im.conditions[val.Value] {
+				im.errorf(val, "Invalid Condition", "The Condition of an output must be the name of a condition declared in the template.")
+				return
+			}
+			im.writeAttr(buf, key, keyNode, primary("Condition."+val.Value))
+		case "Export":
+			buf.WriteString("\nExport {\n")
+			eachMapping(val, func(key string, keyNode, val *yaml.Node) {
+				if key != "Name" {
+					im.warnf(keyNode, "Unsupported export argument", "Output %q sets %q in its export, which is not supported by awsup, so it has been omitted.", name, key)
+					return
+				}
+				im.writeAttr(buf, key, keyNode, im.expr(val))
+			})
+			buf.WriteString("}\n")
+		default:
+			im.warnf(keyNode, "Unsupported output argument", "Output %q sets %q, which is not yet supported by awsup, so it has been omitted.", name, key)
+		}
+	})
+	buf.WriteString("}\n\n")
+}
+
+func (im *importer) writeMetadata(buf *bytes.Buffer, meta *yaml.Node) {
+	buf.WriteString("Metadata {\n")
+	eachMapping(meta, func(key string, keyNode, val *yaml.Node) {
+		if !validIdentifier(key) {
+			// Metadata keys often use namespaced names like
+			// AWS::CloudFormation::Init, which cannot be used as HCL
+			// attribute names.
+			im.warnf(keyNode, "Unsupported metadata key", "The metadata key %q cannot be used as an attribute name, so it has been omitted.", key)
+			return
+		}
+		im.writeAttr(buf, key, keyNode, im.expr(val))
+	})
+	buf.WriteString("}\n")
+}
+
+// writeAttr writes an attribute definition, or reports an error if the
+// given name is not a valid attribute name.
+func (im *importer) writeAttr(buf *bytes.Buffer, name string, nameNode *yaml.Node, val hclExpr) {
+	if !validIdentifier(name) {
+		im.errorf(nameNode, "Invalid attribute name", "The name %q cannot be used as an attribute name.", name)
+		return
+	}
+	fmt.Fprintf(buf, "%s = %s\n", name, val.src)
+}
+
+// dependsOn converts the value of a resource's DependsOn argument, which
+// may be either a single logical id or a list of them.
+func (im *importer) dependsOn(val *yaml.Node) hclExpr {
+	val = resolveAlias(val)
+	var names []*yaml.Node
+	switch val.Kind {
+	case yaml.ScalarNode:
+		names = []*yaml.Node{val}
+	case yaml.SequenceNode:
+		names = val.Content
+	default:
+		im.errorf(val, "Invalid DependsOn", "DependsOn must be either a logical id or a list of logical ids.")
+		return nullExpr
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, nameNode := range names {
+		nameNode = resolveAlias(nameNode)
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if nameNode.Kind != yaml.ScalarNode || !im.resources[nameNode.Value] {
+			im.errorf(nameNode, "Invalid DependsOn", "DependsOn must refer only to resources declared in the template.")
+			continue
+		}
+		buf.WriteString("Resource.")
+		buf.WriteString(nameNode.Value)
+	}
+	buf.WriteByte(']')
+	return hclExpr{src: buf.String(), prec: precPrimary}
+}
+
+// checkName verifies that the given name, from the given section, is
+// acceptable as the name of an awsup configuration object.
+func (im *importer) checkName(node *yaml.Node, kind, name string) bool {
+	if !validName(name) {
+		im.errorf(node, fmt.Sprintf("Invalid %s name", kind), "The name %q is not valid: names may contain only alphanumeric characters.", name)
+		return false
+	}
+	return true
+}
+
+func (im *importer) errorf(node *yaml.Node, summary, detail string, args ...interface{}) {
+	im.diags = append(im.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject:  im.nodeRange(node).Ptr(),
+	})
+}
+
+func (im *importer) warnf(node *yaml.Node, summary, detail string, args ...interface{}) {
+	im.diags = append(im.diags, &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject:  im.nodeRange(node).Ptr(),
+	})
+}
+
+func (im *importer) nodeRange(node *yaml.Node) hcl.Range {
+	start := hcl.Pos{
+		Line:   node.Line,
+		Column: node.Column,
+	}
+	end := start
+	end.Column++
+	return hcl.Range{
+		Filename: im.filename,
+		Start:    start,
+		End:      end,
+	}
+}
+
+// eachMapping calls the given function for each of the key/value pairs in
+// the given mapping node, in the order they appear in the source. Nodes
+// that are not mappings are ignored.
+func eachMapping(node *yaml.Node, cb func(key string, keyNode, val *yaml.Node)) {
+	node = resolveAlias(node)
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := resolveAlias(node.Content[i])
+		cb(keyNode.Value, keyNode, resolveAlias(node.Content[i+1]))
+	}
+}
+
+// isTransformNames returns true if the given node is a literal string or a
+// list of literal strings, which are the forms of the Transform section that
+// awsup supports.
+func isTransformNames(node *yaml.Node) bool {
+	node = resolveAlias(node)
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			if !isLiteralString(resolveAlias(item)) {
+				return false
+			}
+		}
+		return true
+	}
+	return isLiteralString(node)
+}
+
+func stringInList(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
@@ -0,0 +1,395 @@
+package cfnimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/apparentlymart/awsup/cfnjson"
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/apparentlymart/awsup/schema"
+)
+
+// TestImportRoundTrip imports each template and then generates a template
+// from the result, which must be equivalent to the original.
+func TestImportRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		Source string
+
+		// Want is the JSON template we expect to generate, if it differs
+		// from Source.
+		Want string
+	}{
+		"parameters": {
+			Source: `{
+  "Parameters": {
+    "Env": {
+      "Type": "String",
+      "Description": "The environment",
+      "Default": "dev",
+      "AllowedValues": ["dev", "prod"],
+      "ConstraintDescription": "Must be dev or prod"
+    },
+    "Name": {
+      "Type": "String",
+      "AllowedPattern": "[a-z]+",
+      "MinLength": 1,
+      "MaxLength": 10,
+      "NoEcho": true
+    },
+    "Size": {
+      "Type": "Number",
+      "MinValue": 1,
+      "MaxValue": 5
+    }
+  }
+}`,
+		},
+		"metadata and mappings": {
+			Source: `{
+  "Description": "Round trip test",
+  "Metadata": {
+    "Team": {"Name": "platform", "Members": ["a", "b"], "Size": 2, "Active": true}
+  },
+  "Mappings": {
+    "Regions": {
+      "us-east-1": {"Ami": "ami-1", "Zones": ["a", "b"]},
+      "eu-west-1": {"Ami": "ami-2", "Zones": ["c"]}
+    }
+  }
+}`,
+		},
+		"conditions": {
+			Source: `{
+  "Parameters": {
+    "Env": {"Type": "String"}
+  },
+  "Conditions": {
+    "IsProd": {"Fn::Equals": [{"Ref": "Env"}, "prod"]},
+    "NotProd": {"Fn::Not": [{"Condition": "IsProd"}]},
+    "Both": {"Fn::And": [{"Condition": "IsProd"}, {"Fn::Equals": [{"Ref": "AWS::Region"}, "us-east-1"]}]},
+    "Either": {"Fn::Or": [{"Condition": "IsProd"}, {"Condition": "NotProd"}]}
+  }
+}`,
+		},
+		"resources": {
+			Source: `{
+  "Parameters": {
+    "Env": {"Type": "String"}
+  },
+  "Conditions": {
+    "IsProd": {"Fn::Equals": [{"Ref": "Env"}, "prod"]}
+  },
+  "Mappings": {
+    "Regions": {
+      "us-east-1": {"Ami": "ami-1"}
+    }
+  },
+  "Resources": {
+    "Topic": {
+      "Type": "AWS::SNS::Topic",
+      "Properties": {
+        "TopicName": {"Fn::Join": ["-", [{"Ref": "AWS::StackName"}, {"Ref": "Env"}]]}
+      }
+    },
+    "Store": {
+      "Type": "AWS::S3::Bucket",
+      "Condition": "IsProd",
+      "DependsOn": ["Topic"],
+      "DeletionPolicy": "Retain",
+      "UpdateReplacePolicy": "Retain",
+      "Properties": {
+        "BucketName": {"Fn::If": ["IsProd", {"Fn::Join": ["-", ["prod", {"Ref": "AWS::Region"}]]}, {"Ref": "AWS::NoValue"}]},
+        "Tags": [
+          {"Key": "ami", "Value": {"Fn::FindInMap": ["Regions", {"Ref": "AWS::Region"}, "Ami"]}},
+          {"Key": "topic", "Value": {"Fn::GetAtt": ["Topic", "TopicName"]}},
+          {"Key": "zone", "Value": {"Fn::Select": [0, {"Fn::GetAZs": ""}]}},
+          {"Key": "part", "Value": {"Fn::Select": [1, {"Fn::Split": [",", {"Ref": "Env"}]}]}},
+          {"Key": "encoded", "Value": {"Fn::Base64": {"Ref": "Env"}}},
+          {"Key": "imported", "Value": {"Fn::ImportValue": "Shared"}}
+        ]
+      },
+      "Metadata": {
+        "Owner": "platform"
+      }
+    }
+  }
+}`,
+		},
+		"outputs": {
+			Source: `{
+  "Conditions": {
+    "IsUsEast1": {"Fn::Equals": [{"Ref": "AWS::Region"}, "us-east-1"]}
+  },
+  "Resources": {
+    "Topic": {"Type": "AWS::SNS::Topic"}
+  },
+  "Outputs": {
+    "TopicArn": {
+      "Description": "The topic",
+      "Value": {"Ref": "Topic"},
+      "Export": {"Name": {"Fn::Join": ["", [{"Ref": "AWS::StackName"}, "-topic"]]}}
+    },
+    "TopicName": {
+      "Condition": "IsUsEast1",
+      "Value": {"Fn::GetAtt": ["Topic", "TopicName"]}
+    }
+  }
+}`,
+		},
+		"policies": {
+			Source: `{
+  "Parameters": {
+    "BatchSize": {"Type": "Number"}
+  },
+  "Resources": {
+    "Group": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {
+        "MinSize": "1",
+        "MaxSize": "4"
+      },
+      "CreationPolicy": {
+        "AutoScalingCreationPolicy": {"MinSuccessfulInstancesPercent": 50},
+        "ResourceSignal": {"Count": 2, "Timeout": "PT15M"}
+      },
+      "UpdatePolicy": {
+        "AutoScalingRollingUpdate": {
+          "MaxBatchSize": {"Ref": "BatchSize"},
+          "PauseTime": "PT5M",
+          "SuspendProcesses": ["AlarmNotification"],
+          "WaitOnResourceSignals": true
+        },
+        "AutoScalingScheduledAction": {"IgnoreUnmodifiedGroupSizeProperties": true}
+      }
+    },
+    "Alias": {
+      "Type": "AWS::Lambda::Alias",
+      "Properties": {
+        "FunctionName": "example",
+        "FunctionVersion": "1",
+        "Name": "live"
+      },
+      "UpdatePolicy": {
+        "CodeDeployLambdaAliasUpdate": {"ApplicationName": "app", "DeploymentGroupName": "group"}
+      }
+    },
+    "Cache": {
+      "Type": "AWS::ElastiCache::ReplicationGroup",
+      "Properties": {
+        "ReplicationGroupDescription": "example"
+      },
+      "UpdatePolicy": {
+        "UseOnlineResharding": true
+      }
+    }
+  }
+}`,
+		},
+		"yaml short forms": {
+			Source: `
+AWSTemplateFormatVersion: "2010-09-09"
+Parameters:
+  Env:
+    Type: String
+Conditions:
+  IsProd: !Equals [!Ref Env, prod]
+Resources:
+  Topic:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !Sub "${AWS::StackName}-${Env}"
+  Store:
+    Type: AWS::S3::Bucket
+    DependsOn: Topic
+    Properties:
+      BucketName: !If [IsProd, !GetAtt Topic.TopicName, !Ref "AWS::NoValue"]
+`,
+			Want: `{
+  "Parameters": {
+    "Env": {"Type": "String"}
+  },
+  "Conditions": {
+    "IsProd": {"Fn::Equals": [{"Ref": "Env"}, "prod"]}
+  },
+  "Resources": {
+    "Topic": {
+      "Type": "AWS::SNS::Topic",
+      "Properties": {
+        "TopicName": {"Fn::Join": ["", [{"Ref": "AWS::StackName"}, "-", {"Ref": "Env"}]]}
+      }
+    },
+    "Store": {
+      "Type": "AWS::S3::Bucket",
+      "DependsOn": ["Topic"],
+      "Properties": {
+        "BucketName": {"Fn::If": ["IsProd", {"Fn::GetAtt": ["Topic", "TopicName"]}, {"Ref": "AWS::NoValue"}]}
+      }
+    }
+  }
+}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			files, diags := Import([]byte(test.Source), "template")
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics from import: %s", diags.Error())
+			}
+
+			dir, err := ioutil.TempDir("", "awsup-cfnimport")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, src := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), src, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx, diags := eval.NewRootContext(config.NewParser(), dir, nil, schema.Builtin())
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading imported configuration: %s", diags.Error())
+			}
+			template, diags := ctx.Build()
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors building imported configuration: %s", diags.Error())
+			}
+			raw, diags := cfnjson.PrepareStructure(template)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors preparing template: %s", diags.Error())
+			}
+			gotSrc, err := json.Marshal(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantSrc := test.Want
+			if wantSrc == "" {
+				wantSrc = test.Source
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(gotSrc, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(wantSrc), &want); err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range jsonDiff(got, want, "") {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+func TestImportDiagnostics(t *testing.T) {
+	tests := map[string]struct {
+		Source string
+		Want   []string
+	}{
+		"not an object": {
+			`["a"]`,
+			[]string{"Invalid template"},
+		},
+		"empty": {
+			``,
+			[]string{"Empty template"},
+		},
+		"unsupported section": {
+			`{"Hooks": {}}`,
+			[]string{"Unsupported template section"},
+		},
+		"unsupported resource argument": {
+			`{"Resources": {"Topic": {"Type": "AWS::SNS::Topic", "Version": "1"}}}`,
+			[]string{"Unsupported resource argument"},
+		},
+		"unsupported policy": {
+			`{"Resources": {"Group": {"Type": "AWS::AutoScaling::AutoScalingGroup", "UpdatePolicy": {"Fn::If": ["A", {}, {}]}}}}`,
+			[]string{"Unsupported policy"},
+		},
+		"unsupported policy argument": {
+			`{"Resources": {"Group": {"Type": "AWS::AutoScaling::AutoScalingGroup", "CreationPolicy": {"ResourceSignal": {"Count": 1, "Interval": "PT1M"}}}}}`,
+			[]string{"Unsupported policy argument"},
+		},
+		"invalid policy": {
+			`{"Resources": {"Group": {"Type": "AWS::AutoScaling::AutoScalingGroup", "CreationPolicy": "yes"}}}`,
+			[]string{"Invalid CreationPolicy"},
+		},
+		"invalid resource name": {
+			`{"Resources": {"My-Topic": {"Type": "AWS::SNS::Topic"}}}`,
+			[]string{"Invalid resource name"},
+		},
+		"undeclared condition": {
+			`{"Resources": {"Topic": {"Type": "AWS::SNS::Topic", "Condition": "Nope"}}}`,
+			[]string{"Invalid Condition"},
+		},
+		"undeclared dependency": {
+			`{"Resources": {"Topic": {"Type": "AWS::SNS::Topic", "DependsOn": "Nope"}}}`,
+			[]string{"Invalid DependsOn"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, diags := Import([]byte(test.Source), "template")
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary)
+			}
+			if !reflect.DeepEqual(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+		})
+	}
+}
+
+// jsonDiff returns a description of each of the differences between the
+// given decoded JSON values.
+func jsonDiff(got, want interface{}, ptr string) []string {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(got)+len(want))
+		for k := range want {
+			keys = append(keys, k)
+		}
+		for k := range got {
+			if _, exists := want[k]; !exists {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var ret []string
+		for _, k := range keys {
+			ret = append(ret, jsonDiff(got[k], want[k], ptr+"/"+k)...)
+		}
+		return ret
+	case []interface{}:
+		got, ok := got.([]interface{})
+		if !ok || len(got) != len(want) {
+			break
+		}
+		var ret []string
+		for i := range want {
+			ret = append(ret, jsonDiff(got[i], want[i], fmt.Sprintf("%s/%d", ptr, i))...)
+		}
+		return ret
+	}
+	if reflect.DeepEqual(got, want) {
+		return nil
+	}
+	gotSrc, _ := json.Marshal(got)
+	wantSrc, _ := json.Marshal(want)
+	return []string{fmt.Sprintf("wrong value at %q\ngot:  %s\nwant: %s", ptr, gotSrc, wantSrc)}
+}
@@ -0,0 +1,341 @@
+package cfnimport
+
+import (
+	"bytes"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// intrinsic converts a call to the intrinsic function with the given name
+// into an equivalent HCL expression.
+func (im *importer) intrinsic(node *yaml.Node, name string, arg *yaml.Node) hclExpr {
+	switch name {
+
+	case "Ref":
+		if arg.Kind != yaml.ScalarNode {
+			im.errorf(arg, "Invalid Ref", "The argument to Ref must be a logical id.")
+			return nullExpr
+		}
+		return im.ref(arg, arg.Value)
+
+	case "Condition":
+		if arg.Kind != yaml.ScalarNode || !im.conditions[arg.Value] {
+			im.errorf(arg, "Invalid Condition", "The argument to Condition must be the name of a condition declared in the template.")
+			return nullExpr
+		}
+		return primary("Condition." + arg.Value)
+
+	case "Fn::GetAtt":
+		var resource, attr string
+		switch {
+		case arg.Kind == yaml.ScalarNode:
+			dot := strings.Index(arg.Value, ".")
+			if dot > 0 {
+				resource, attr = arg.Value[:dot], arg.Value[dot+1:]
+			}
+		case arg.Kind == yaml.SequenceNode && len(arg.Content) == 2:
+			resNode, attrNode := resolveAlias(arg.Content[0]), resolveAlias(arg.Content[1])
+			if resNode.Kind == yaml.ScalarNode && isLiteralString(attrNode) {
+				resource, attr = resNode.Value, attrNode.Value
+			}
+		}
+		if resource == "" || attr == "" {
+			im.errorf(arg, "Invalid Fn::GetAtt", "The argument to Fn::GetAtt must give a logical id and a literal attribute name.")
+			return nullExpr
+		}
+		return im.getAttr(arg, resource, attr)
+
+	case "Fn::Sub":
+		return im.sub(arg)
+
+	case "Fn::If":
+		args, ok := im.args(name, arg, 3)
+		if !ok {
+			return nullExpr
+		}
+		cond := args[0]
+		if cond.Kind != yaml.ScalarNode || !im.conditions[cond.Value] {
+			im.errorf(cond, "Invalid Fn::If", "The first argument to Fn::If must be the name of a condition declared in the template.")
+			return nullExpr
+		}
+		trueResult := im.expr(args[1])
+		falseResult := im.expr(args[2])
+		return hclExpr{
+			src:  "Condition." + cond.Value + " ? " + trueResult.operand(precOr) + " : " + falseResult.operand(precConditional),
+			prec: precConditional,
+		}
+
+	case "Fn::Equals":
+		args, ok := im.args(name, arg, 2)
+		if !ok {
+			return nullExpr
+		}
+		a, b := im.expr(args[0]), im.expr(args[1])
+		return hclExpr{
+			src:  a.operand(precNot) + " == " + b.operand(precNot),
+			prec: precEquality,
+		}
+
+	case "Fn::Not":
+		args, ok := im.args(name, arg, 1)
+		if !ok {
+			return nullExpr
+		}
+		// Negated equality tests are more readable using the != operator,
+		// which lowers back to the same Fn::Not and Fn::Equals calls.
+		if innerName, innerArg, isCall := intrinsic(args[0]); isCall && innerName == "Fn::Equals" {
+			if eqArgs, ok := im.args(innerName, innerArg, 2); ok {
+				a, b := im.expr(eqArgs[0]), im.expr(eqArgs[1])
+				return hclExpr{
+					src:  a.operand(precNot) + " != " + b.operand(precNot),
+					prec: precEquality,
+				}
+			}
+			return nullExpr
+		}
+		return hclExpr{
+			src:  "!" + im.expr(args[0]).operand(precNot),
+			prec: precNot,
+		}
+
+	case "Fn::And", "Fn::Or":
+		if arg.Kind != yaml.SequenceNode || len(arg.Content) < 2 {
+			im.errorf(arg, "Invalid "+name, "The argument to %s must be a list of at least two conditions.", name)
+			return nullExpr
+		}
+		op, prec := " && ", precAnd
+		if name == "Fn::Or" {
+			op, prec = " || ", precOr
+		}
+		parts := make([]string, len(arg.Content))
+		for i, item := range arg.Content {
+			parts[i] = im.expr(item).operand(prec)
+		}
+		return hclExpr{
+			src:  strings.Join(parts, op),
+			prec: prec,
+		}
+
+	case "Fn::FindInMap":
+		args, ok := im.args(name, arg, 3)
+		if !ok {
+			return nullExpr
+		}
+		mapName := args[0]
+		if mapName.Kind != yaml.ScalarNode || !im.mappings[mapName.Value] {
+			im.errorf(mapName, "Invalid Fn::FindInMap", "The first argument to Fn::FindInMap must be the name of a mapping declared in the template.")
+			return nullExpr
+		}
+		var buf bytes.Buffer
+		buf.WriteString("Mapping.")
+		buf.WriteString(mapName.Value)
+		for _, key := range args[1:] {
+			if _, _, isCall := intrinsic(key); !isCall && key.Kind == yaml.ScalarNode {
+				buf.WriteString(indexStep(key.Value))
+				continue
+			}
+			buf.WriteString("[")
+			buf.WriteString(im.expr(key).src)
+			buf.WriteString("]")
+		}
+		return primary(buf.String())
+
+	case "Fn::Select":
+		args, ok := im.args(name, arg, 2)
+		if !ok {
+			return nullExpr
+		}
+		index := args[0]
+		indexSrc := im.expr(index).src
+		if _, _, isCall := intrinsic(index); !isCall && index.Kind == yaml.ScalarNode && numberPattern.MatchString(index.Value) {
+			// Indices are often given as strings, but HCL requires numbers.
+			indexSrc = index.Value
+		}
+		list := im.expr(args[1])
+		if list.prec < precPrimary || strings.HasPrefix(list.src, "[") {
+			list.src = "(" + list.src + ")"
+		}
+		return primary(list.src + "[" + indexSrc + "]")
+
+	case "Fn::Join":
+		args, ok := im.args(name, arg, 2)
+		if !ok {
+			return nullExpr
+		}
+		if !isLiteralString(args[0]) {
+			im.errorf(args[0], "Invalid Fn::Join", "The delimiter for Fn::Join must be a literal string.")
+			return nullExpr
+		}
+		return primary("join(" + quoteString(args[0].Value) + ", " + im.expr(args[1]).src + ")")
+
+	case "Fn::Split":
+		args, ok := im.args(name, arg, 2)
+		if !ok {
+			return nullExpr
+		}
+		if !isLiteralString(args[0]) {
+			im.errorf(args[0], "Invalid Fn::Split", "The delimiter for Fn::Split must be a literal string.")
+			return nullExpr
+		}
+		return primary("split(" + quoteString(args[0].Value) + ", " + im.expr(args[1]).src + ")")
+
+	case "Fn::Base64":
+		return primary("base64encode(" + im.expr(arg).src + ")")
+
+	case "Fn::GetAZs":
+		if _, _, isCall := intrinsic(arg); !isCall && arg.Kind == yaml.ScalarNode && arg.Value == "" {
+			return primary("azs()")
+		}
+		return primary("azs(" + im.expr(arg).src + ")")
+
+	case "Fn::ImportValue":
+		return primary("import_value(" + im.expr(arg).src + ")")
+
+	case "Fn::Transform":
+		var transform, params *yaml.Node
+		if arg.Kind == yaml.MappingNode {
+			eachMapping(arg, func(key string, _, val *yaml.Node) {
+				switch key {
+				case "Name":
+					transform = val
+				case "Parameters":
+					params = val
+				}
+			})
+		}
+		if transform == nil || !isLiteralString(transform) {
+			im.errorf(arg, "Invalid Fn::Transform", "The argument to Fn::Transform must be an object giving a literal Name for the transform and its Parameters.")
+			return nullExpr
+		}
+		paramsSrc := "{}"
+		if params != nil {
+			paramsSrc = im.expr(params).src
+		}
+		return primary("transform(" + quoteString(transform.Value) + ", " + paramsSrc + ")")
+
+	default:
+		im.errorf(node, "Unsupported intrinsic function", "The function %s is not supported by awsup.", name)
+		return nullExpr
+	}
+}
+
+// ref converts a reference to the given logical id or pseudo parameter.
+func (im *importer) ref(node *yaml.Node, name string) hclExpr {
+	switch {
+	case im.params[name]:
+		return primary("Param." + name)
+	case im.resources[name]:
+		return primary("Resource." + name)
+	case strings.HasPrefix(name, "AWS::") && validName(name[5:]):
+		return primary("AWS." + name[5:])
+	default:
+		im.errorf(node, "Reference to undeclared object", "There is no parameter or resource named %q in the template.", name)
+		return nullExpr
+	}
+}
+
+// getAttr converts a reference to an attribute of the given resource.
+func (im *importer) getAttr(node *yaml.Node, resource, attr string) hclExpr {
+	if !im.resources[resource] {
+		im.errorf(node, "Reference to undeclared resource", "There is no resource named %q in the template.", resource)
+		return nullExpr
+	}
+	// Nested attribute names, such as Endpoint.Address, are written as
+	// nested attribute accesses.
+	for _, step := range strings.Split(attr, ".") {
+		if !validName(step) {
+			im.errorf(node, "Unsupported attribute name", "The attribute name %q cannot yet be used in awsup configuration.", attr)
+			return nullExpr
+		}
+	}
+	return primary("Resource." + resource + "." + attr)
+}
+
+// sub converts a call to Fn::Sub into an HCL string template.
+func (im *importer) sub(arg *yaml.Node) hclExpr {
+	str := arg
+	vars := map[string]*yaml.Node{}
+	if arg.Kind == yaml.SequenceNode {
+		if len(arg.Content) != 2 {
+			im.errorf(arg, "Invalid Fn::Sub", "The argument to Fn::Sub must be either a string or a list of a string and a map of variables.")
+			return nullExpr
+		}
+		str = resolveAlias(arg.Content[0])
+		eachMapping(arg.Content[1], func(key string, _, val *yaml.Node) {
+			vars[key] = val
+		})
+	}
+	if !isLiteralString(str) {
+		im.errorf(str, "Invalid Fn::Sub", "The string given to Fn::Sub must be a literal string.")
+		return nullExpr
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	remain := str.Value
+	for {
+		start := strings.Index(remain, "${")
+		if start < 0 {
+			buf.WriteString(escapeTemplateLiteral(remain))
+			break
+		}
+		buf.WriteString(escapeTemplateLiteral(remain[:start]))
+		remain = remain[start+2:]
+		end := strings.Index(remain, "}")
+		if end < 0 {
+			// CloudFormation treats an unterminated sequence literally.
+			buf.WriteString(escapeTemplateLiteral("${" + remain))
+			break
+		}
+		name := remain[:end]
+		remain = remain[end+1:]
+
+		if strings.HasPrefix(name, "!") {
+			// ${!Literal} is CloudFormation's escape for a literal ${Literal}
+			buf.WriteString(escapeTemplateLiteral("${" + name[1:] + "}"))
+			continue
+		}
+
+		var val hclExpr
+		if varNode, exists := vars[name]; exists {
+			if isLiteralString(varNode) {
+				buf.WriteString(escapeTemplateLiteral(varNode.Value))
+				continue
+			}
+			val = im.expr(varNode)
+		} else if dot := strings.Index(name, "."); dot > 0 {
+			val = im.getAttr(str, name[:dot], name[dot+1:])
+		} else {
+			val = im.ref(str, name)
+		}
+		buf.WriteString("${")
+		buf.WriteString(val.src)
+		buf.WriteString("}")
+	}
+	buf.WriteByte('"')
+	return primary(buf.String())
+}
+
+// args returns the arguments of a call to an intrinsic function that
+// expects a list of exactly the given number of arguments.
+func (im *importer) args(name string, arg *yaml.Node, n int) ([]*yaml.Node, bool) {
+	if arg.Kind != yaml.SequenceNode || len(arg.Content) != n {
+		im.errorf(arg, "Invalid "+name, "The argument to %s must be a list of %d items.", name, n)
+		return nil, false
+	}
+	ret := make([]*yaml.Node, n)
+	for i, item := range arg.Content {
+		ret[i] = resolveAlias(item)
+	}
+	return ret, true
+}
+
+func isLiteralString(node *yaml.Node) bool {
+	_, _, isCall := intrinsic(node)
+	return !isCall && node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str"
+}
+
+func primary(src string) hclExpr {
+	return hclExpr{src: src, prec: precPrimary}
+}
@@ -0,0 +1,268 @@
+package cfnjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// timestampLayouts are the forms of ISO 8601 timestamp that we accept for
+// properties of the Timestamp primitive type.
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// preparePropertyValue is like prepareDynExpr, but converts literal values
+// to suit the given property type so that, for example, integers are never
+// written in exponent notation. The given path is used to identify the
+// value in error messages.
+//
+// Where only parts of a value are literal, such as a list that also
+// contains references, those parts are converted. Values of other kinds are
+// left for CloudFormation to convert, and a nil type disables conversion.
+func preparePropertyValue(expr eval.DynExpr, ty *schema.Type, path string) (interface{}, hcl.Diagnostics) {
+	if ty == nil {
+		return prepareDynExpr(expr)
+	}
+
+	switch te := expr.(type) {
+
+	case *eval.DynLiteral:
+		return prepareLiteralProperty(te.Value, ty, path, te.SrcExpr, te.SrcRange)
+
+	case *eval.DynList:
+		if ty.TypeName != "List" {
+			break
+		}
+		var diags hcl.Diagnostics
+		items := make([]interface{}, 0, len(te.Exprs))
+		for i, se := range te.Exprs {
+			subExpr, subDiags := preparePropertyValue(se, propertyItemType(ty), fmt.Sprintf("%s[%d]", path, i))
+			diags = append(diags, subDiags...)
+			items = append(items, subExpr)
+		}
+		return items, diags
+
+	case *eval.DynObject:
+		if ty.TypeName != "Map" && ty.PropertyType == nil {
+			break
+		}
+		var diags hcl.Diagnostics
+		attrs := make(map[string]interface{}, len(te.Attrs))
+		for name, se := range te.Attrs {
+			var subDiags hcl.Diagnostics
+			attrs[name], subDiags = preparePropertyValue(se, propertyAttrType(ty, name), path+"."+name)
+			diags = append(diags, subDiags...)
+		}
+		return attrs, diags
+
+	case *eval.DynIf:
+		var diags hcl.Diagnostics
+		ifRaw, subDiags := preparePropertyValue(te.If, ty, path)
+		diags = append(diags, subDiags...)
+		elseRaw, subDiags := preparePropertyValue(te.Else, ty, path)
+		diags = append(diags, subDiags...)
+		return prepareFuncCall("Fn::If", te.ConditionName, ifRaw, elseRaw), diags
+	}
+
+	return prepareDynExpr(expr)
+}
+
+// prepareLiteralProperty converts the given literal value to suit the given
+// property type, returning an error if that isn't possible.
+//
+// If the expression that produced the value is known then errors about
+// nested values point at the parts of it that produced them. Otherwise
+// they point at the given range, and only the path identifies the part.
+func prepareLiteralProperty(val cty.Value, ty *schema.Type, path string, expr hcl.Expression, rng hcl.Range) (interface{}, hcl.Diagnostics) {
+	if ty == nil || val.IsNull() || !val.IsKnown() {
+		return ctyjson.SimpleJSONValue{val}, nil
+	}
+
+	invalid := func(want string) hcl.Diagnostics {
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid property value",
+				Detail:   fmt.Sprintf("Property %s requires %s.", path, want),
+				Subject:  &rng,
+			},
+		}
+	}
+
+	switch {
+
+	case ty.PrimitiveType != "":
+		switch ty.PrimitiveType {
+
+		case schema.String, schema.Timestamp:
+			str, err := convert.Convert(val, cty.String)
+			if err != nil {
+				return nil, invalid("a string")
+			}
+			if ty.PrimitiveType == schema.Timestamp && !validTimestamp(str.AsString()) {
+				return nil, invalid("an ISO 8601 timestamp, such as \"2018-01-02T15:04:05Z\"")
+			}
+			return str.AsString(), nil
+
+		case schema.Integer, schema.Long:
+			num, err := convert.Convert(val, cty.Number)
+			if err != nil {
+				return nil, invalid("a whole number")
+			}
+			bf := num.AsBigFloat()
+			if !bf.IsInt() {
+				return nil, invalid("a whole number")
+			}
+			i, acc := bf.Int64()
+			switch {
+			case ty.PrimitiveType == schema.Integer && (acc != big.Exact || i < math.MinInt32 || i > math.MaxInt32):
+				return nil, invalid("a whole number between -2147483648 and 2147483647")
+			case acc != big.Exact:
+				return nil, invalid("a whole number between -9223372036854775808 and 9223372036854775807")
+			}
+			return json.Number(strconv.FormatInt(i, 10)), nil
+
+		case schema.Double:
+			num, err := convert.Convert(val, cty.Number)
+			if err != nil {
+				return nil, invalid("a number")
+			}
+			return json.Number(num.AsBigFloat().Text('f', -1)), nil
+
+		case schema.Boolean:
+			b, err := convert.Convert(val, cty.Bool)
+			if err != nil {
+				return nil, invalid("either true or false")
+			}
+			return b.True(), nil
+		}
+
+	case ty.TypeName == "List":
+		vty := val.Type()
+		if !(vty.IsListType() || vty.IsSetType() || vty.IsTupleType()) {
+			return nil, invalid("a list")
+		}
+		var diags hcl.Diagnostics
+		items := make([]interface{}, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			kv, ev := it.Element()
+			itemExpr, itemRng := literalPart(expr, rng, kv)
+			item, itemDiags := prepareLiteralProperty(ev, propertyItemType(ty), fmt.Sprintf("%s[%d]", path, len(items)), itemExpr, itemRng)
+			diags = append(diags, itemDiags...)
+			items = append(items, item)
+		}
+		return items, diags
+
+	case ty.TypeName == "Map" || ty.PropertyType != nil:
+		vty := val.Type()
+		if !(vty.IsMapType() || vty.IsObjectType()) {
+			return nil, invalid("an object")
+		}
+		var diags hcl.Diagnostics
+		attrs := map[string]interface{}{}
+		for it := val.ElementIterator(); it.Next(); {
+			kv, ev := it.Element()
+			name := kv.AsString()
+			attrExpr, attrRng := literalPart(expr, rng, kv)
+			var attrDiags hcl.Diagnostics
+			attrs[name], attrDiags = prepareLiteralProperty(ev, propertyAttrType(ty, name), path+"."+name, attrExpr, attrRng)
+			diags = append(diags, attrDiags...)
+		}
+		return attrs, diags
+	}
+
+	return ctyjson.SimpleJSONValue{val}, nil
+}
+
+// literalPart returns the expression that produced the element with the
+// given key of a literal value, along with its source range, given the
+// expression and range of the whole value.
+//
+// The result is nil and the range of the whole value if the value wasn't
+// written as a tuple or object constructor, such as when it is the result
+// of a function call.
+func literalPart(expr hcl.Expression, rng hcl.Range, key cty.Value) (hcl.Expression, hcl.Range) {
+	var part hcl.Expression
+
+	switch te := expr.(type) {
+
+	case *hclsyntax.TupleConsExpr:
+		if key.Type() != cty.Number {
+			break
+		}
+		i, acc := key.AsBigFloat().Int64()
+		if acc == big.Exact && i >= 0 && i < int64(len(te.Exprs)) {
+			part = te.Exprs[i]
+		}
+
+	case *hclsyntax.ObjectConsExpr:
+		if key.Type() != cty.String {
+			break
+		}
+		for _, item := range te.Items {
+			kv, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || kv.Type() != cty.String || !kv.IsKnown() || kv.IsNull() {
+				continue
+			}
+			if kv.AsString() == key.AsString() {
+				part = item.ValueExpr
+			}
+		}
+	}
+
+	if part == nil {
+		return nil, rng
+	}
+	return part, part.Range()
+}
+
+// propertyItemType returns the type of the elements of the given list or
+// map type, or nil if it is unknown.
+func propertyItemType(ty *schema.Type) *schema.Type {
+	switch {
+	case ty.ItemPrimitiveType != "":
+		return &schema.Type{PrimitiveType: ty.ItemPrimitiveType}
+	case ty.ItemPropertyType != nil:
+		return &schema.Type{TypeName: ty.ItemTypeName, PropertyType: ty.ItemPropertyType}
+	default:
+		return nil
+	}
+}
+
+// propertyAttrType returns the type of the given attribute of a value of the
+// given map or property type, or nil if it is unknown.
+func propertyAttrType(ty *schema.Type, name string) *schema.Type {
+	if ty.TypeName == "Map" {
+		return propertyItemType(ty)
+	}
+	if ty.PropertyType == nil {
+		return nil
+	}
+	if prop, exists := ty.PropertyType.Properties[name]; exists {
+		return &prop.Type
+	}
+	return nil
+}
+
+func validTimestamp(s string) bool {
+	for _, layout := range timestampLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
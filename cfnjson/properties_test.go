@@ -0,0 +1,255 @@
+package cfnjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+func TestPreparePropertyValue(t *testing.T) {
+	tests := map[string]struct {
+		Type       string
+		Properties string
+		Want       string
+	}{
+		"integer": {
+			"AWS::SQS::Queue",
+			`    DelaySeconds       = 1000
+    MaximumMessageSize = 1e5
+    VisibilityTimeout  = "30"
+`,
+			`{"DelaySeconds":1000,"MaximumMessageSize":100000,"VisibilityTimeout":30}`,
+		},
+		"long": {
+			"AWS::EC2::VPNGateway",
+			`    Type          = "ipsec.1"
+    AmazonSideAsn = 4294967294
+`,
+			`{"AmazonSideAsn":4294967294,"Type":"ipsec.1"}`,
+		},
+		"integer bounds": {
+			"AWS::SQS::Queue",
+			`    DelaySeconds       = 2147483647
+    MaximumMessageSize = -2147483648
+`,
+			`{"DelaySeconds":2147483647,"MaximumMessageSize":-2147483648}`,
+		},
+		"long upper bound": {
+			"AWS::EC2::VPNGateway",
+			`    Type          = "ipsec.1"
+    AmazonSideAsn = 9223372036854775807
+`,
+			`{"AmazonSideAsn":9223372036854775807,"Type":"ipsec.1"}`,
+		},
+		"long lower bound": {
+			"AWS::EC2::VPNGateway",
+			`    Type          = "ipsec.1"
+    AmazonSideAsn = -9223372036854775808
+`,
+			`{"AmazonSideAsn":-9223372036854775808,"Type":"ipsec.1"}`,
+		},
+		"double": {
+			"AWS::CloudWatch::Alarm",
+			`    ComparisonOperator = "GreaterThanThreshold"
+    EvaluationPeriods  = 1
+    MetricName         = "Errors"
+    Namespace          = "Example"
+    Period             = 60
+    Statistic          = "Sum"
+    Threshold          = 1234567890.123456789
+`,
+			`{"ComparisonOperator":"GreaterThanThreshold","EvaluationPeriods":1,"MetricName":"Errors","Namespace":"Example","Period":60,"Statistic":"Sum","Threshold":1234567890.123456789}`,
+		},
+		"boolean": {
+			"AWS::SQS::Queue",
+			`    FifoQueue                 = "true"
+    ContentBasedDeduplication = false
+`,
+			`{"ContentBasedDeduplication":false,"FifoQueue":true}`,
+		},
+		"timestamp": {
+			"AWS::S3::Bucket",
+			`    LifecycleConfiguration = {
+      Rules = [
+        { Status = "Enabled", ExpirationDate = "2018-01-02T15:04:05Z" },
+        { Status = "Enabled", ExpirationDate = "2018-01-02" },
+      ]
+    }
+`,
+			`{"LifecycleConfiguration":{"Rules":[{"ExpirationDate":"2018-01-02T15:04:05Z","Status":"Enabled"},{"ExpirationDate":"2018-01-02","Status":"Enabled"}]}}`,
+		},
+		"nested integer": {
+			"AWS::EC2::SecurityGroup",
+			`    GroupDescription = "example"
+    SecurityGroupIngress = [
+      { IpProtocol = "tcp", FromPort = "80", ToPort = 8e1 },
+    ]
+`,
+			`{"GroupDescription":"example","SecurityGroupIngress":[{"FromPort":80,"IpProtocol":"tcp","ToPort":80}]}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			props, diags := prepareTestProperties(t, test.Type, test.Properties)
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics: %s", diags.Error())
+			}
+			src, err := json.Marshal(props)
+			if err != nil {
+				t.Fatalf("failed to serialize properties: %s", err)
+			}
+			if got := string(src); got != test.Want {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestPreparePropertyValueErrors(t *testing.T) {
+	tests := map[string]struct {
+		Type       string
+		Properties string
+		Detail     string
+		Line       int
+	}{
+		"fractional integer": {
+			"AWS::SQS::Queue",
+			`    DelaySeconds = 1.5
+`,
+			"Property DelaySeconds requires a whole number.",
+			4,
+		},
+		"integer above range": {
+			"AWS::SQS::Queue",
+			`    DelaySeconds = 2147483648
+`,
+			"Property DelaySeconds requires a whole number between -2147483648 and 2147483647.",
+			4,
+		},
+		"integer below range": {
+			"AWS::SQS::Queue",
+			`    DelaySeconds = -2147483649
+`,
+			"Property DelaySeconds requires a whole number between -2147483648 and 2147483647.",
+			4,
+		},
+		"integer out of 64-bit range": {
+			"AWS::SQS::Queue",
+			`    DelaySeconds = 9223372036854775808
+`,
+			"Property DelaySeconds requires a whole number between -2147483648 and 2147483647.",
+			4,
+		},
+		"long above range": {
+			"AWS::EC2::VPNGateway",
+			`    Type          = "ipsec.1"
+    AmazonSideAsn = 9223372036854775808
+`,
+			"Property AmazonSideAsn requires a whole number between -9223372036854775808 and 9223372036854775807.",
+			5,
+		},
+		"long below range": {
+			"AWS::EC2::VPNGateway",
+			`    Type          = "ipsec.1"
+    AmazonSideAsn = -9223372036854775809
+`,
+			"Property AmazonSideAsn requires a whole number between -9223372036854775808 and 9223372036854775807.",
+			5,
+		},
+		"long out of range": {
+			"AWS::EC2::VPNGateway",
+			`    Type          = "ipsec.1"
+    AmazonSideAsn = -1e19
+`,
+			"Property AmazonSideAsn requires a whole number between -9223372036854775808 and 9223372036854775807.",
+			5,
+		},
+		"boolean": {
+			"AWS::SQS::Queue",
+			`    FifoQueue = "yes"
+`,
+			"Property FifoQueue requires either true or false.",
+			4,
+		},
+		"timestamp": {
+			"AWS::S3::Bucket",
+			`    LifecycleConfiguration = {
+      Rules = [
+        { Status = "Enabled", ExpirationDate = "2018-01-02" },
+        {
+          Status         = "Enabled"
+          ExpirationDate = "tomorrow"
+        },
+      ]
+    }
+`,
+			`Property LifecycleConfiguration.Rules[1].ExpirationDate requires an ISO 8601 timestamp, such as "2018-01-02T15:04:05Z".`,
+			9,
+		},
+		"nested integer": {
+			"AWS::EC2::SecurityGroup",
+			`    GroupDescription = "example"
+    SecurityGroupIngress = [
+      { IpProtocol = "tcp", FromPort = 80, ToPort = 80 },
+      { IpProtocol = "tcp", FromPort = 80,
+        ToPort = 80.5 },
+    ]
+`,
+			"Property SecurityGroupIngress[1].ToPort requires a whole number.",
+			8,
+		},
+		"nested without source": {
+			// The list is produced by a function call, so there's no
+			// expression for each element and the path alone identifies
+			// the invalid value.
+			"AWS::EC2::SecurityGroup",
+			`    GroupDescription = "example"
+    SecurityGroupIngress = element([
+      [
+        { IpProtocol = "tcp", FromPort = 80, ToPort = 80 },
+        { IpProtocol = "tcp", FromPort = 80, ToPort = 80.5 },
+      ],
+    ], 0)
+`,
+			"Property SecurityGroupIngress[1].ToPort requires a whole number.",
+			5,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, diags := prepareTestProperties(t, test.Type, test.Properties)
+			if len(diags) != 1 {
+				t.Fatalf("wrong number of diagnostics %d; want 1\n%s", len(diags), diags.Error())
+			}
+			diag := diags[0]
+			if got, want := diag.Summary, "Invalid property value"; got != want {
+				t.Errorf("wrong summary\ngot:  %s\nwant: %s", got, want)
+			}
+			if got, want := diag.Detail, test.Detail; got != want {
+				t.Errorf("wrong detail\ngot:  %s\nwant: %s", got, want)
+			}
+			if got, want := diag.Subject.Start.Line, test.Line; got != want {
+				t.Errorf("wrong line\ngot:  %d\nwant: %d", got, want)
+			}
+		})
+	}
+}
+
+// prepareTestProperties builds a template containing a single resource of
+// the given type with the given body for its Properties block, whose first
+// line is line 4 of the configuration, and returns its prepared properties.
+func prepareTestProperties(t *testing.T, typeName, properties string) (map[string]interface{}, hcl.Diagnostics) {
+	t.Helper()
+
+	template := buildTemplate(t, map[string]string{
+		"main.awsup": fmt.Sprintf("Resource \"Test\" {\n  Type = %q\n  Properties {\n%s  }\n}\n", typeName, properties),
+	})
+	raw, diags := PrepareStructure(template)
+	resource := raw["Resources"].(map[string]interface{})["Test"].(map[string]interface{})
+	props, _ := resource["Properties"].(map[string]interface{})
+	return props, diags
+}
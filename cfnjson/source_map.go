@@ -0,0 +1,341 @@
+package cfnjson
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// SourceMap describes the relationship between the objects in a template
+// produced by PrepareStructure and the configuration constructs that
+// produced them, so that generated identifiers and values can be traced back
+// to the source that created them.
+type SourceMap struct {
+	// LogicalIDs maps each logical id in the generated template to the
+	// configuration object it was produced from.
+	LogicalIDs map[string]*SourceMapEntry `json:"LogicalIDs"`
+
+	// Pointers maps JSON pointers (as defined in RFC 6901) into the generated
+	// template to the configuration construct that produced the value at
+	// that location.
+	Pointers map[string]*SourceMapEntry `json:"Pointers"`
+}
+
+// SourceMapEntry describes a single configuration construct within a
+// SourceMap.
+type SourceMapEntry struct {
+	// Module is the path of the module instance the construct belongs to,
+	// in the string form returned by addr.ModulePath.String. The root module
+	// is represented by an empty string.
+	Module string `json:"Module"`
+
+	// Address is the address of the object within its module, such as the
+	// name and ForEach key of a resource. This is empty for entries
+	// describing values nested inside an object.
+	Address string `json:"Address,omitempty"`
+
+	Range hcl.Range `json:"Range"`
+}
+
+// PrepareSourceMap produces a SourceMap for the template that PrepareStructure
+// would produce for the same FlatTemplate.
+//
+// Every location in the template below its top-level sections has an entry.
+// Locations that were not produced by an expression of their own, such as
+// the elements of a literal list or the name of a function, are attributed
+// to the nearest enclosing location that was.
+func PrepareSourceMap(template *eval.FlatTemplate) *SourceMap {
+	sm := &SourceMap{
+		LogicalIDs: map[string]*SourceMapEntry{},
+		Pointers:   map[string]*SourceMapEntry{},
+	}
+
+	if template.Description != "" {
+		sm.Pointers[jsonPointer("Description")] = &SourceMapEntry{
+			Range: template.DescriptionRange,
+		}
+	}
+
+	// A single transform is rendered as a string rather than a list, as in
+	// PrepareStructure. A list of transforms is attributed as a whole to the
+	// module that declared the first of them.
+	if len(template.TransformSources) != 0 {
+		sm.Pointers[jsonPointer("Transform")] = sourceEntry(template.TransformSources[0])
+	}
+	if len(template.TransformSources) > 1 {
+		for i, source := range template.TransformSources {
+			sm.Pointers[jsonPointer("Transform", strconv.Itoa(i))] = sourceEntry(source)
+		}
+	}
+
+	for key, source := range template.MetadataSources {
+		sm.Pointers[jsonPointer("Metadata", key)] = sourceEntry(source)
+	}
+
+	// Parameters can only be declared in the root module, so their names are
+	// used directly as their logical ids.
+	for name, param := range template.Parameters {
+		entry := &SourceMapEntry{
+			Address: name,
+			Range:   param.DeclRange,
+		}
+		sm.LogicalIDs[name] = entry
+		sm.Pointers[jsonPointer("Parameters", name)] = entry
+
+		for key, rng := range param.ValueRanges {
+			sm.Pointers[jsonPointer("Parameters", name, key)] = &SourceMapEntry{
+				Range: rng,
+			}
+		}
+	}
+
+	for name, source := range template.MappingSources {
+		sm.Pointers[jsonPointer("Mappings", name)] = sourceEntry(source)
+	}
+
+	for name, expr := range template.Conditions {
+		// Condition names are separate from the logical ids of parameters
+		// and resources, so conditions are recorded only by pointer.
+		source := template.ConditionSources[name]
+		ptr := jsonPointer("Conditions", name)
+		sm.mapDynExpr(expr, source.Addr.Module, ptr)
+		sm.Pointers[ptr] = sourceEntry(source)
+	}
+
+	for logicalID, resource := range template.Resources {
+		module := resource.Addr.Module
+		entry := &SourceMapEntry{
+			Module:  module.String(),
+			Address: addr.NameInModule{Name: resource.Addr.Name, Key: resource.Addr.Key}.String(),
+			Range:   resource.DeclRange,
+		}
+		sm.LogicalIDs[logicalID] = entry
+		sm.Pointers[jsonPointer("Resources", logicalID)] = entry
+
+		for name, expr := range resource.Properties {
+			sm.mapDynExpr(expr, module, jsonPointer("Resources", logicalID, "Properties", name))
+		}
+		for key, expr := range resource.Metadata {
+			sm.mapDynExpr(expr, module, jsonPointer("Resources", logicalID, "Metadata", key))
+		}
+		if resource.CreationPolicy != nil {
+			sm.mapDynExpr(resource.CreationPolicy, module, jsonPointer("Resources", logicalID, "CreationPolicy"))
+		}
+		if resource.UpdatePolicy != nil {
+			sm.mapDynExpr(resource.UpdatePolicy, module, jsonPointer("Resources", logicalID, "UpdatePolicy"))
+		}
+		if resource.Condition != "" {
+			sm.Pointers[jsonPointer("Resources", logicalID, "Condition")] = &SourceMapEntry{
+				Module: module.String(),
+				Range:  resource.ConditionRange,
+			}
+		}
+		for i, rng := range resource.DependsOnRanges {
+			sm.Pointers[jsonPointer("Resources", logicalID, "DependsOn", strconv.Itoa(i))] = &SourceMapEntry{
+				Module: module.String(),
+				Range:  rng,
+			}
+		}
+	}
+
+	for logicalID, rule := range template.Rules {
+		// Rule names are separate from the logical ids of parameters and
+		// resources, so rules are recorded only by pointer.
+		module := rule.Addr.Module
+		sm.Pointers[jsonPointer("Rules", logicalID)] = &SourceMapEntry{
+			Module:  module.String(),
+			Address: rule.Addr.Name,
+			Range:   rule.DeclRange,
+		}
+
+		if rule.Condition != nil {
+			sm.mapDynExpr(rule.Condition, module, jsonPointer("Rules", logicalID, "RuleCondition"))
+		}
+		for i, assertion := range rule.Assertions {
+			sm.mapDynExpr(assertion.Assert, module, jsonPointer("Rules", logicalID, "Assertions", strconv.Itoa(i), "Assert"))
+		}
+	}
+
+	for name, output := range template.Outputs {
+		// Output names are separate from the logical ids of parameters and
+		// resources, so an output may share its name with a resource and
+		// outputs are recorded only by pointer.
+		entry := &SourceMapEntry{
+			Address: name,
+			Range:   output.DeclRange,
+		}
+		ptr := jsonPointer("Outputs", name)
+		sm.Pointers[ptr] = entry
+		sm.mapDynExpr(output.Value, addr.RootModulePath, ptr+"/Value")
+		if output.ExportName != nil {
+			sm.mapDynExpr(output.ExportName, addr.RootModulePath, ptr+"/Export/Name")
+		}
+	}
+
+	// Errors are reported when the template itself is prepared, so we
+	// ignore them here and fill in as much as we can.
+	raw, _ := PrepareStructure(template)
+	if src, err := json.Marshal(raw); err == nil {
+		var generic interface{}
+		if err := json.Unmarshal(src, &generic); err == nil {
+			sm.fillPointers(generic, "", nil)
+		}
+	}
+
+	return sm
+}
+
+// sourceEntry returns the source map entry for the given source of a
+// template-level object.
+func sourceEntry(source eval.FlatSource) *SourceMapEntry {
+	return &SourceMapEntry{
+		Module:  source.Addr.Module.String(),
+		Address: source.Addr.Name,
+		Range:   source.DeclRange,
+	}
+}
+
+// fillPointers records an entry for each location within the given value,
+// which is part of a template decoded from JSON, that does not already have
+// one, using the entry for the nearest enclosing location that has one.
+//
+// Locations that have no enclosing entry, which are the template itself and
+// its top-level sections, are left without entries.
+func (sm *SourceMap) fillPointers(raw interface{}, ptr string, enclosing *SourceMapEntry) {
+	if entry, exists := sm.Pointers[ptr]; exists {
+		enclosing = entry
+	} else if enclosing != nil {
+		sm.Pointers[ptr] = &SourceMapEntry{
+			Module: enclosing.Module,
+			Range:  enclosing.Range,
+		}
+	}
+
+	switch tv := raw.(type) {
+	case map[string]interface{}:
+		for key, v := range tv {
+			sm.fillPointers(v, ptr+jsonPointer(key), enclosing)
+		}
+	case []interface{}:
+		for i, v := range tv {
+			sm.fillPointers(v, ptr+"/"+strconv.Itoa(i), enclosing)
+		}
+	}
+}
+
+// mapDynExpr records the source location of the given expression and of
+// any nested expressions within it, using the same structure as
+// prepareDynExpr uses to render it.
+func (sm *SourceMap) mapDynExpr(expr eval.DynExpr, module addr.ModulePath, ptr string) {
+	sm.Pointers[ptr] = &SourceMapEntry{
+		Module: module.String(),
+		Range:  expr.SourceRange(),
+	}
+
+	arg := func(fn string, i int) string {
+		return ptr + jsonPointer(fn, strconv.Itoa(i))
+	}
+
+	switch te := expr.(type) {
+
+	case *eval.DynJoin:
+		if te.List != nil {
+			sm.mapDynExpr(te.List, module, arg("Fn::Join", 1))
+		}
+		for i, se := range te.Exprs {
+			sm.mapDynExpr(se, module, arg("Fn::Join", 1)+"/"+strconv.Itoa(i))
+		}
+
+	case *eval.DynIf:
+		sm.mapDynExpr(te.If, module, arg("Fn::If", 1))
+		sm.mapDynExpr(te.Else, module, arg("Fn::If", 2))
+
+	case *eval.DynEquals:
+		sm.mapDynExpr(te.A, module, arg("Fn::Equals", 0))
+		sm.mapDynExpr(te.B, module, arg("Fn::Equals", 1))
+
+	case *eval.DynLogical:
+		fn := "Fn::And"
+		if te.Op == eval.DynLogicalOr {
+			fn = "Fn::Or"
+		}
+		for i, se := range te.Values {
+			sm.mapDynExpr(se, module, arg(fn, i))
+		}
+
+	case *eval.DynNot:
+		sm.mapDynExpr(te.Value, module, arg("Fn::Not", 0))
+
+	case *eval.DynList:
+		for i, se := range te.Exprs {
+			sm.mapDynExpr(se, module, ptr+"/"+strconv.Itoa(i))
+		}
+
+	case *eval.DynObject:
+		for name, se := range te.Attrs {
+			sm.mapDynExpr(se, module, ptr+jsonPointer(name))
+		}
+
+	case *eval.DynSplit:
+		sm.mapDynExpr(te.String, module, arg("Fn::Split", 1))
+
+	case *eval.DynIndex:
+		sm.mapDynExpr(te.Index, module, arg("Fn::Select", 0))
+		sm.mapDynExpr(te.List, module, arg("Fn::Select", 1))
+
+	case *eval.DynGetAttr:
+		for i, se := range te.Attrs {
+			sm.mapDynExpr(se, module, arg("Fn::GetAtt", i+1))
+		}
+
+	case *eval.DynMappingLookup:
+		sm.mapDynExpr(te.FirstKey, module, arg("Fn::FindInMap", 1))
+		sm.mapDynExpr(te.SecondKey, module, arg("Fn::FindInMap", 2))
+
+	case *eval.DynBase64:
+		sm.mapDynExpr(te.String, module, ptr+jsonPointer("Fn::Base64"))
+
+	case *eval.DynAccountAZs:
+		sm.mapDynExpr(te.RegionName, module, ptr+jsonPointer("Fn::GetAZs"))
+
+	case *eval.DynImportValue:
+		sm.mapDynExpr(te.Name, module, ptr+jsonPointer("Fn::ImportValue"))
+
+	case *eval.DynTransform:
+		sm.mapDynExpr(te.Parameters, module, ptr+jsonPointer("Fn::Transform", "Parameters"))
+
+	case *eval.DynContains:
+		sm.mapDynExpr(te.List, module, arg("Fn::Contains", 0))
+		sm.mapDynExpr(te.Value, module, arg("Fn::Contains", 1))
+
+	case *eval.DynEachMemberEquals:
+		sm.mapDynExpr(te.List, module, arg("Fn::EachMemberEquals", 0))
+		sm.mapDynExpr(te.Value, module, arg("Fn::EachMemberEquals", 1))
+
+	case *eval.DynEachMemberIn:
+		sm.mapDynExpr(te.List, module, arg("Fn::EachMemberIn", 0))
+		sm.mapDynExpr(te.Allowed, module, arg("Fn::EachMemberIn", 1))
+
+	default:
+		// All other expression types are leaves, so there's nothing more
+		// to record beyond the expression itself.
+
+	}
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonPointer returns a JSON pointer string, as defined in RFC 6901, for the
+// given sequence of reference tokens.
+func jsonPointer(tokens ...string) string {
+	var buf strings.Builder
+	for _, token := range tokens {
+		buf.WriteByte('/')
+		buf.WriteString(jsonPointerEscaper.Replace(token))
+	}
+	return buf.String()
+}
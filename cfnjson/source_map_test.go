@@ -0,0 +1,288 @@
+package cfnjson
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/apparentlymart/awsup/schema"
+)
+
+func TestPrepareSourceMap(t *testing.T) {
+	template := buildTemplate(t, map[string]string{
+		"main.awsup": `
+Description = "Source map test"
+Transform   = ["AWS::Serverless-2016-10-31", "Example::Macro"]
+
+Metadata {
+  Team = { Name = "platform", Members = ["a", "b"] }
+}
+
+UserInterface {
+  ParameterGroup {
+    Label      = "Environment"
+    Parameters = [Param.Env]
+  }
+}
+
+Parameter "Env" {
+  Type          = "String"
+  Description   = "The environment"
+  Default       = "dev"
+  AllowedValues = ["dev", "prod"]
+}
+
+Mappings {
+  Regions = {
+    "us-east-1" = { Ami = "ami-1" }
+  }
+}
+
+Conditions {
+  IsProd = Param.Env == "prod"
+  Either = Condition.IsProd || Param.Env == "dev"
+}
+
+Rule "Envs" {
+  Assert {
+    Assert      = contains(["dev", "prod"], Param.Env)
+    Description = "Must be dev or prod"
+  }
+}
+
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+  Properties {
+    TopicName = join("-", ["topic", Param.Env, AWS.Region])
+  }
+}
+
+Resource "Store" {
+  Type      = "AWS::S3::Bucket"
+  Condition = Param.Env != "dev"
+  DependsOn = [Resource.Topic]
+  Properties {
+    BucketName = Condition.IsProd ? "prod-store" : "dev-store"
+    Tags = [
+      { Key = "env", Value = Param.Env },
+      { Key = "ami", Value = Mapping.Regions[AWS.Region].Ami },
+    ]
+  }
+  Metadata {
+    Owner = { Name = "x", Ids = [1, 2] }
+  }
+}
+
+Module "child" {
+  Source = "./child"
+}
+
+Output "StoreArn" {
+  Value = Resource.Store.Arn
+  Export {
+    Name = "${AWS.StackName}-store"
+  }
+}
+`,
+		"child/child.awsup": `
+Conditions {
+  Always = true
+}
+
+Resource "Bucket" {
+  Type      = "AWS::S3::Bucket"
+  Condition = Condition.Always
+}
+`,
+	})
+
+	raw, diags := PrepareStructure(template)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Error())
+	}
+	sm := PrepareSourceMap(template)
+
+	// The names of objects in the child module include a hash of the
+	// module path, so we find them using the child resource's address.
+	var childBucket string
+	var childModule addr.ModulePath
+	for logicalID, resource := range template.Resources {
+		if resource.Addr.Name == "Bucket" {
+			childBucket = logicalID
+			childModule = resource.Addr.Module
+		}
+	}
+	childAlways := addr.NameInModule{Module: childModule, Name: "Always"}.ID()
+
+	// Every location below the top-level sections must have an entry.
+	var walk func(v interface{}, ptr string, depth int)
+	walk = func(v interface{}, ptr string, depth int) {
+		if depth > 1 || (depth == 1 && !isSection(ptr)) {
+			if _, exists := sm.Pointers[ptr]; !exists {
+				t.Errorf("no source map entry for %s", ptr)
+			}
+		}
+		switch tv := v.(type) {
+		case map[string]interface{}:
+			for k, ev := range tv {
+				walk(ev, ptr+jsonPointer(k), depth+1)
+			}
+		case []interface{}:
+			for i, ev := range tv {
+				walk(ev, ptr+"/"+strconv.Itoa(i), depth+1)
+			}
+		}
+	}
+	walk(jsonRoundTrip(t, raw), "", 0)
+
+	// Spot-check that the locations the review identified as missing have
+	// entries pointing at the constructs that produced them, rather than
+	// only at an enclosing object.
+	tests := []struct {
+		Ptr       string
+		Module    string
+		Address   string
+		StartLine int
+	}{
+		{"/Description", "", "", 2},
+		{"/Transform/0", "", "AWS::Serverless-2016-10-31", 3},
+		{"/Transform/1", "", "Example::Macro", 3},
+		{"/Metadata/Team", "", "Team", 6},
+		{"/Metadata/Team/Members/1", "", "", 6},
+		{"/Metadata/AWS::CloudFormation::Interface", "", "AWS::CloudFormation::Interface", 10},
+		{"/Parameters/Env/Type", "", "", 16},
+		{"/Parameters/Env/Description", "", "", 18},
+		{"/Parameters/Env/Default", "", "", 19},
+		{"/Parameters/Env/AllowedValues", "", "", 20},
+		{"/Parameters/Env/AllowedValues/1", "", "", 20},
+		{"/Mappings/Regions", "", "Regions", 24},
+		{"/Mappings/Regions/us-east-1/Ami", "", "", 24},
+		{"/Conditions/IsProd", "", "IsProd", 30},
+		{"/Conditions/IsProd/Fn::Equals/1", "", "", 30},
+		{"/Conditions/Either", "", "Either", 31},
+		{"/Conditions/Either/Fn::Or/0", "", "", 31},
+		{"/Conditions/" + childAlways, ".child", "Always", 3},
+		{"/Conditions/StoreCondition", "", "Store", 50},
+		{"/Resources/Store/Condition", "", "", 50},
+		{"/Resources/Store/DependsOn", "", "", 48},
+		{"/Resources/Store/DependsOn/0", "", "", 51},
+		{"/Resources/Store/Properties/Tags/1/Key", "", "", 56},
+		{"/Resources/" + childBucket + "/Condition", ".child", "", 8},
+		{"/Rules/Envs/Assertions/0/AssertDescription", "", "", 34},
+	}
+	for _, test := range tests {
+		entry, exists := sm.Pointers[test.Ptr]
+		if !exists {
+			t.Errorf("no source map entry for %s", test.Ptr)
+			continue
+		}
+		if entry.Module != test.Module || entry.Address != test.Address || entry.Range.Start.Line != test.StartLine {
+			t.Errorf(
+				"wrong entry for %s\ngot:  module %q, address %q, line %d\nwant: module %q, address %q, line %d",
+				test.Ptr,
+				entry.Module, entry.Address, entry.Range.Start.Line,
+				test.Module, test.Address, test.StartLine,
+			)
+		}
+	}
+}
+
+func TestPrepareSourceMapOutputNames(t *testing.T) {
+	// An output may have the same name as a resource, but its entry must not
+	// replace the resource's.
+	template := buildTemplate(t, map[string]string{
+		"main.awsup": `
+Resource "Bucket" {
+  Type = "AWS::S3::Bucket"
+}
+
+Output "Bucket" {
+  Value = Resource.Bucket.Arn
+}
+`,
+	})
+	sm := PrepareSourceMap(template)
+
+	tests := []struct {
+		Entry     *SourceMapEntry
+		Desc      string
+		StartLine int
+	}{
+		{sm.LogicalIDs["Bucket"], "logical id Bucket", 2},
+		{sm.Pointers["/Resources/Bucket"], "pointer /Resources/Bucket", 2},
+		{sm.Pointers["/Outputs/Bucket"], "pointer /Outputs/Bucket", 6},
+	}
+	for _, test := range tests {
+		if test.Entry == nil {
+			t.Errorf("no source map entry for %s", test.Desc)
+			continue
+		}
+		if got := test.Entry.Range.Start.Line; got != test.StartLine {
+			t.Errorf("wrong line for %s\ngot:  %d\nwant: %d", test.Desc, got, test.StartLine)
+		}
+	}
+}
+
+func isSection(ptr string) bool {
+	switch ptr {
+	case "/Metadata", "/Parameters", "/Mappings", "/Conditions", "/Resources", "/Rules", "/Outputs":
+		return true
+	default:
+		return false
+	}
+}
+
+// buildTemplate writes the given files into a temporary directory and then
+// builds a flat template from the module they describe, failing the test if
+// there are any errors.
+func buildTemplate(t *testing.T, files map[string]string) *eval.FlatTemplate {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "awsup-cfnjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, diags := eval.NewRootContext(config.NewParser(), dir, nil, schema.Builtin())
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+	}
+	template, diags := ctx.Build()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors building template: %s", diags.Error())
+	}
+	return template
+}
+
+// jsonRoundTrip returns the given prepared structure as it would be decoded
+// from its JSON serialization.
+func jsonRoundTrip(t *testing.T, raw interface{}) interface{} {
+	t.Helper()
+
+	src, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatalf("failed to serialize template: %s", err)
+	}
+	var ret interface{}
+	if err := json.Unmarshal(src, &ret); err != nil {
+		t.Fatalf("failed to decode template: %s", err)
+	}
+	return ret
+}
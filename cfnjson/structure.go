@@ -4,7 +4,9 @@ import (
 	"fmt"
 
 	"github.com/apparentlymart/awsup/eval"
+	"github.com/apparentlymart/awsup/schema"
 	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
 	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
@@ -16,12 +18,46 @@ func PrepareStructure(template *eval.FlatTemplate) (map[string]interface{}, hcl.
 		ret["Description"] = template.Description
 	}
 
+	switch len(template.Transform) {
+	case 0:
+	case 1:
+		ret["Transform"] = template.Transform[0]
+	default:
+		ret["Transform"] = template.Transform
+	}
+
+	if len(template.Metadata) != 0 {
+		ret["Metadata"] = prepareMetadata(template.Metadata)
+	}
+
 	if len(template.Parameters) != 0 {
 		var paramDiags hcl.Diagnostics
 		ret["Parameters"], paramDiags = prepareParameters(template.Parameters)
 		diags = append(diags, paramDiags...)
 	}
 
+	if len(template.Mappings) != 0 {
+		ret["Mappings"] = prepareMappings(template.Mappings)
+	}
+
+	if len(template.Conditions) != 0 {
+		var condDiags hcl.Diagnostics
+		ret["Conditions"], condDiags = prepareConditions(template.Conditions)
+		diags = append(diags, condDiags...)
+	}
+
+	if len(template.Resources) != 0 {
+		var resourceDiags hcl.Diagnostics
+		ret["Resources"], resourceDiags = prepareResources(template.Resources)
+		diags = append(diags, resourceDiags...)
+	}
+
+	if len(template.Rules) != 0 {
+		var ruleDiags hcl.Diagnostics
+		ret["Rules"], ruleDiags = prepareRules(template.Rules)
+		diags = append(diags, ruleDiags...)
+	}
+
 	if len(template.Outputs) != 0 {
 		var outputDiags hcl.Diagnostics
 		ret["Outputs"], outputDiags = prepareOutputs(template.Outputs)
@@ -42,6 +78,13 @@ func prepareParameters(params map[string]*eval.FlatParameter) (map[string]interf
 			raw["Type"] = param.Type
 		}
 
+		if param.Description != "" {
+			raw["Description"] = param.Description
+		}
+		if param.ConstraintDescription != "" {
+			raw["ConstraintDescription"] = param.ConstraintDescription
+		}
+
 		if !param.AllowedPattern.IsNull() {
 			raw["AllowedPattern"] = ctyjson.SimpleJSONValue{param.AllowedPattern}
 		}
@@ -81,6 +124,142 @@ func prepareParameters(params map[string]*eval.FlatParameter) (map[string]interf
 	return ret, diags
 }
 
+func prepareMetadata(metadata map[string]cty.Value) map[string]interface{} {
+	ret := map[string]interface{}{}
+
+	for key, val := range metadata {
+		ret[key] = ctyjson.SimpleJSONValue{val}
+	}
+
+	return ret
+}
+
+func prepareMappings(mappings map[string]map[string]cty.Value) map[string]interface{} {
+	ret := map[string]interface{}{}
+
+	for name, table := range mappings {
+		raw := map[string]interface{}{}
+		for key, val := range table {
+			raw[key] = ctyjson.SimpleJSONValue{val}
+		}
+		ret[name] = raw
+	}
+
+	return ret
+}
+
+func prepareConditions(conditions map[string]eval.DynExpr) (map[string]interface{}, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	ret := map[string]interface{}{}
+
+	for name, expr := range conditions {
+		var condDiags hcl.Diagnostics
+		ret[name], condDiags = prepareDynExpr(expr)
+		diags = append(diags, condDiags...)
+	}
+
+	return ret, diags
+}
+
+func prepareResources(resources map[string]*eval.FlatResource) (map[string]interface{}, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	ret := map[string]interface{}{}
+
+	for logicalID, resource := range resources {
+		raw := map[string]interface{}{
+			"Type": resource.Type,
+		}
+
+		if len(resource.Properties) != 0 {
+			props := map[string]interface{}{}
+			for name, expr := range resource.Properties {
+				var propType *schema.Type
+				if resource.Schema != nil {
+					if prop, exists := resource.Schema.Properties[name]; exists {
+						propType = &prop.Type
+					}
+				}
+				var propDiags hcl.Diagnostics
+				props[name], propDiags = preparePropertyValue(expr, propType, name)
+				diags = append(diags, propDiags...)
+			}
+			raw["Properties"] = props
+		}
+
+		if len(resource.Metadata) != 0 {
+			meta := map[string]interface{}{}
+			for key, expr := range resource.Metadata {
+				var metaDiags hcl.Diagnostics
+				meta[key], metaDiags = prepareDynExpr(expr)
+				diags = append(diags, metaDiags...)
+			}
+			raw["Metadata"] = meta
+		}
+
+		if resource.Condition != "" {
+			raw["Condition"] = resource.Condition
+		}
+
+		if len(resource.DependsOn) != 0 {
+			raw["DependsOn"] = resource.DependsOn
+		}
+
+		if resource.DeletionPolicy != "" {
+			raw["DeletionPolicy"] = resource.DeletionPolicy
+		}
+		if resource.UpdateReplacePolicy != "" {
+			raw["UpdateReplacePolicy"] = resource.UpdateReplacePolicy
+		}
+		if resource.CreationPolicy != nil {
+			var policyDiags hcl.Diagnostics
+			raw["CreationPolicy"], policyDiags = prepareDynExpr(resource.CreationPolicy)
+			diags = append(diags, policyDiags...)
+		}
+		if resource.UpdatePolicy != nil {
+			var policyDiags hcl.Diagnostics
+			raw["UpdatePolicy"], policyDiags = prepareDynExpr(resource.UpdatePolicy)
+			diags = append(diags, policyDiags...)
+		}
+
+		ret[logicalID] = raw
+	}
+
+	return ret, diags
+}
+
+func prepareRules(rules map[string]*eval.FlatRule) (map[string]interface{}, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	ret := map[string]interface{}{}
+
+	for name, rule := range rules {
+		raw := map[string]interface{}{}
+
+		if rule.Condition != nil {
+			var condDiags hcl.Diagnostics
+			raw["RuleCondition"], condDiags = prepareDynExpr(rule.Condition)
+			diags = append(diags, condDiags...)
+		}
+
+		assertions := make([]interface{}, 0, len(rule.Assertions))
+		for _, assertion := range rule.Assertions {
+			rawAssert, assertDiags := prepareDynExpr(assertion.Assert)
+			diags = append(diags, assertDiags...)
+			rawAssertion := map[string]interface{}{
+				"Assert": rawAssert,
+			}
+			if assertion.Description != "" {
+				rawAssertion["AssertDescription"] = assertion.Description
+			}
+			assertions = append(assertions, rawAssertion)
+		}
+		raw["Assertions"] = assertions
+
+		ret[name] = raw
+	}
+
+	return ret, diags
+}
+
 func prepareOutputs(outputs map[string]*eval.FlatOutput) (map[string]interface{}, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	ret := map[string]interface{}{}
@@ -88,6 +267,13 @@ func prepareOutputs(outputs map[string]*eval.FlatOutput) (map[string]interface{}
 	for name, output := range outputs {
 		raw := map[string]interface{}{}
 
+		if output.Description != "" {
+			raw["Description"] = output.Description
+		}
+		if output.Condition != "" {
+			raw["Condition"] = output.Condition
+		}
+
 		var valDiags hcl.Diagnostics
 		raw["Value"], valDiags = prepareDynExpr(output.Value)
 		diags = append(diags, valDiags...)
@@ -113,15 +299,18 @@ func prepareDynExpr(expr eval.DynExpr) (interface{}, hcl.Diagnostics) {
 		return ctyjson.SimpleJSONValue{te.Value}, nil
 
 	case *eval.DynJoin:
+		if te.List != nil {
+			listRaw, diags := prepareDynExpr(te.List)
+			return prepareFuncCall("Fn::Join", te.Delimiter, listRaw), diags
+		}
 		var diags hcl.Diagnostics
-		args := make([]interface{}, 0, len(te.Exprs)+1)
-		args = append(args, te.Delimiter)
+		parts := make([]interface{}, 0, len(te.Exprs))
 		for _, se := range te.Exprs {
 			subExpr, subDiags := prepareDynExpr(se)
 			diags = append(diags, subDiags...)
-			args = append(args, subExpr)
+			parts = append(parts, subExpr)
 		}
-		return prepareFuncCall("Fn::Join", args...), diags
+		return prepareFuncCall("Fn::Join", te.Delimiter, parts), diags
 
 	case *eval.DynIf:
 		var diags hcl.Diagnostics
@@ -129,7 +318,7 @@ func prepareDynExpr(expr eval.DynExpr) (interface{}, hcl.Diagnostics) {
 		diags = append(diags, subDiags...)
 		elseRaw, subDiags := prepareDynExpr(te.Else)
 		diags = append(diags, subDiags...)
-		return prepareFuncCall("Fn::If", ifRaw, elseRaw), diags
+		return prepareFuncCall("Fn::If", te.ConditionName, ifRaw, elseRaw), diags
 
 	case *eval.DynEquals:
 		var diags hcl.Diagnostics
@@ -140,10 +329,45 @@ func prepareDynExpr(expr eval.DynExpr) (interface{}, hcl.Diagnostics) {
 		return prepareFuncCall("Fn::Equals", aRaw, bRaw), diags
 
 	case *eval.DynLogical:
-		panic(fmt.Errorf("DynLogical rendering not yet implemented"))
+		var diags hcl.Diagnostics
+		args := make([]interface{}, 0, len(te.Values))
+		for _, se := range te.Values {
+			subExpr, subDiags := prepareDynExpr(se)
+			diags = append(diags, subDiags...)
+			args = append(args, subExpr)
+		}
+		name := "Fn::And"
+		if te.Op == eval.DynLogicalOr {
+			name = "Fn::Or"
+		}
+		return prepareFuncCall(name, args...), diags
 
 	case *eval.DynNot:
-		panic(fmt.Errorf("DynNot rendering not yet implemented"))
+		valRaw, diags := prepareDynExpr(te.Value)
+		return prepareFuncCall("Fn::Not", valRaw), diags
+
+	case *eval.DynConditionRef:
+		return prepareSingleArgFuncCall("Condition", te.ConditionName), nil
+
+	case *eval.DynList:
+		var diags hcl.Diagnostics
+		items := make([]interface{}, 0, len(te.Exprs))
+		for _, se := range te.Exprs {
+			subExpr, subDiags := prepareDynExpr(se)
+			diags = append(diags, subDiags...)
+			items = append(items, subExpr)
+		}
+		return items, diags
+
+	case *eval.DynObject:
+		var diags hcl.Diagnostics
+		attrs := make(map[string]interface{}, len(te.Attrs))
+		for name, se := range te.Attrs {
+			var subDiags hcl.Diagnostics
+			attrs[name], subDiags = prepareDynExpr(se)
+			diags = append(diags, subDiags...)
+		}
+		return attrs, diags
 
 	case *eval.DynSplit:
 		strRaw, diags := prepareDynExpr(te.String)
@@ -158,7 +382,7 @@ func prepareDynExpr(expr eval.DynExpr) (interface{}, hcl.Diagnostics) {
 		return prepareFuncCall("Fn::Select", indexRaw, listRaw), diags
 
 	case *eval.DynRef:
-		return prepareFuncCall("Ref", te.LogicalID), nil
+		return prepareSingleArgFuncCall("Ref", te.LogicalID), nil
 
 	case *eval.DynGetAttr:
 		var diags hcl.Diagnostics
@@ -181,11 +405,52 @@ func prepareDynExpr(expr eval.DynExpr) (interface{}, hcl.Diagnostics) {
 
 	case *eval.DynBase64:
 		strRaw, diags := prepareDynExpr(te.String)
-		return prepareFuncCall("Fn::Base64", strRaw), diags
+		return prepareSingleArgFuncCall("Fn::Base64", strRaw), diags
 
 	case *eval.DynAccountAZs:
 		regionRaw, diags := prepareDynExpr(te.RegionName)
-		return prepareFuncCall("Fn::GetAZs", regionRaw), diags
+		return prepareSingleArgFuncCall("Fn::GetAZs", regionRaw), diags
+
+	case *eval.DynImportValue:
+		nameRaw, diags := prepareDynExpr(te.Name)
+		return prepareSingleArgFuncCall("Fn::ImportValue", nameRaw), diags
+
+	case *eval.DynTransform:
+		paramsRaw, diags := prepareDynExpr(te.Parameters)
+		return prepareSingleArgFuncCall("Fn::Transform", map[string]interface{}{
+			"Name":       te.Name,
+			"Parameters": paramsRaw,
+		}), diags
+
+	case *eval.DynContains:
+		var diags hcl.Diagnostics
+		listRaw, subDiags := prepareDynExpr(te.List)
+		diags = append(diags, subDiags...)
+		valueRaw, subDiags := prepareDynExpr(te.Value)
+		diags = append(diags, subDiags...)
+		return prepareFuncCall("Fn::Contains", listRaw, valueRaw), diags
+
+	case *eval.DynEachMemberEquals:
+		var diags hcl.Diagnostics
+		listRaw, subDiags := prepareDynExpr(te.List)
+		diags = append(diags, subDiags...)
+		valueRaw, subDiags := prepareDynExpr(te.Value)
+		diags = append(diags, subDiags...)
+		return prepareFuncCall("Fn::EachMemberEquals", listRaw, valueRaw), diags
+
+	case *eval.DynEachMemberIn:
+		var diags hcl.Diagnostics
+		listRaw, subDiags := prepareDynExpr(te.List)
+		diags = append(diags, subDiags...)
+		allowedRaw, subDiags := prepareDynExpr(te.Allowed)
+		diags = append(diags, subDiags...)
+		return prepareFuncCall("Fn::EachMemberIn", listRaw, allowedRaw), diags
+
+	case *eval.DynValueOf:
+		return prepareFuncCall("Fn::ValueOf", te.ParameterName, te.Attribute), nil
+
+	case *eval.DynRefAll:
+		return prepareSingleArgFuncCall("Fn::RefAll", te.ParameterType), nil
 
 	default:
 		// Should never happen, since the above should be comprehensive
@@ -197,3 +462,10 @@ func prepareDynExpr(expr eval.DynExpr) (interface{}, hcl.Diagnostics) {
 func prepareFuncCall(name string, args ...interface{}) interface{} {
 	return map[string]interface{}{name: args}
 }
+
+// prepareSingleArgFuncCall is like prepareFuncCall but for the subset of
+// CloudFormation functions that take their single argument directly, rather
+// than wrapped in an array.
+func prepareSingleArgFuncCall(name string, arg interface{}) interface{} {
+	return map[string]interface{}{name: arg}
+}
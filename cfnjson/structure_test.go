@@ -0,0 +1,177 @@
+package cfnjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPrepareStructurePolicies(t *testing.T) {
+	template := buildTemplate(t, map[string]string{
+		"main.awsup": `
+Parameter "BatchSize" {
+  Type = "Number"
+}
+
+Resource "Group" {
+  Type = "AWS::AutoScaling::AutoScalingGroup"
+  Properties {
+    MinSize = "1"
+    MaxSize = "4"
+  }
+
+  DeletionPolicy      = "Retain"
+  UpdateReplacePolicy = "Delete"
+
+  CreationPolicy {
+    AutoScaling {
+      MinSuccessfulInstancesPercent = 50
+    }
+    Signal {
+      Count   = "2"
+      Timeout = "PT15M"
+    }
+  }
+
+  UpdatePolicy {
+    AutoScalingReplacingUpdate {
+      WillReplace = false
+    }
+    AutoScalingRollingUpdate {
+      MaxBatchSize          = Param.BatchSize
+      PauseTime             = "PT5M"
+      SuspendProcesses      = ["HealthCheck", "ReplaceUnhealthy"]
+      WaitOnResourceSignals = "true"
+    }
+    AutoScalingScheduledAction {
+      IgnoreUnmodifiedGroupSizeProperties = true
+    }
+  }
+}
+
+Resource "Cache" {
+  Type = "AWS::ElastiCache::ReplicationGroup"
+  Properties {
+    ReplicationGroupDescription = "cache"
+  }
+
+  DeletionPolicy = "Snapshot"
+
+  UpdatePolicy {
+    UseOnlineResharding = true
+  }
+}
+
+Resource "Alias" {
+  Type = "AWS::Lambda::Alias"
+  Properties {
+    FunctionName    = "example"
+    FunctionVersion = "1"
+    Name            = "live"
+  }
+
+  UpdatePolicy {
+    CodeDeployLambdaAliasUpdate {
+      ApplicationName     = "example"
+      DeploymentGroupName = "example-group"
+    }
+  }
+}
+
+Resource "Domain" {
+  Type = "AWS::Elasticsearch::Domain"
+
+  UpdatePolicy {
+    EnableVersionUpgrade = true
+  }
+}
+
+Resource "Roller" {
+  Type = "AWS::AutoScaling::AutoScalingGroup"
+  Properties {
+    MinSize = "1"
+    MaxSize = "1"
+  }
+
+  UpdatePolicy {
+    AutoScalingRollingUpdate {
+    }
+  }
+}
+
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+}
+`,
+	})
+
+	raw, diags := PrepareStructure(template)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diags.Error())
+	}
+	resources := jsonRoundTrip(t, raw).(map[string]interface{})["Resources"].(map[string]interface{})
+
+	want := map[string]string{
+		"Group": `{
+  "DeletionPolicy": "Retain",
+  "UpdateReplacePolicy": "Delete",
+  "CreationPolicy": {
+    "AutoScalingCreationPolicy": {"MinSuccessfulInstancesPercent": 50},
+    "ResourceSignal": {"Count": 2, "Timeout": "PT15M"}
+  },
+  "UpdatePolicy": {
+    "AutoScalingReplacingUpdate": {"WillReplace": false},
+    "AutoScalingRollingUpdate": {
+      "MaxBatchSize": {"Ref": "BatchSize"},
+      "PauseTime": "PT5M",
+      "SuspendProcesses": ["HealthCheck", "ReplaceUnhealthy"],
+      "WaitOnResourceSignals": true
+    },
+    "AutoScalingScheduledAction": {"IgnoreUnmodifiedGroupSizeProperties": true}
+  }
+}`,
+		"Cache": `{
+  "DeletionPolicy": "Snapshot",
+  "UpdatePolicy": {"UseOnlineResharding": true}
+}`,
+		"Alias": `{
+  "UpdatePolicy": {
+    "CodeDeployLambdaAliasUpdate": {
+      "ApplicationName": "example",
+      "DeploymentGroupName": "example-group"
+    }
+  }
+}`,
+		"Domain": `{
+  "UpdatePolicy": {"EnableVersionUpgrade": true}
+}`,
+		"Roller": `{
+  "UpdatePolicy": {"AutoScalingRollingUpdate": {}}
+}`,
+		"Topic": `{}`,
+	}
+
+	policyKeys := []string{"CreationPolicy", "DeletionPolicy", "UpdatePolicy", "UpdateReplacePolicy"}
+	for name, wantSrc := range want {
+		t.Run(name, func(t *testing.T) {
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(wantSrc), &want); err != nil {
+				t.Fatalf("invalid expected JSON: %s", err)
+			}
+			resource, ok := resources[name].(map[string]interface{})
+			if !ok {
+				t.Fatalf("no resource %s", name)
+			}
+			got := map[string]interface{}{}
+			for _, key := range policyKeys {
+				if v, exists := resource[key]; exists {
+					got[key] = v
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotSrc, _ := json.MarshalIndent(got, "", "  ")
+				t.Errorf("wrong policies\ngot:  %s\nwant: %s", gotSrc, wantSrc)
+			}
+		})
+	}
+}
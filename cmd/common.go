@@ -1,15 +1,50 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/schema"
 	"github.com/hashicorp/hcl2/hcl"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 var parser = config.NewParser()
 
+// loadRootConstants gathers the values of the root module's constants from
+// all of the sources the CLI supports.
+//
+// The args are those of the --constants flag, each of which is either a
+// values file or, if it contains "=", a constant given as name=value. These
+// constants are applied before those given by the --constant flags.
+func loadRootConstants(args, flags []string) (hcl.Attributes, hcl.Diagnostics) {
+	files, argFlags := config.SplitConstantArgs(args)
+	return parser.LoadConstants(os.Environ(), files, append(argFlags, flags...))
+}
+
+// loadSchema returns the builtin schema extended with the resource types
+// described in the given schema files, in the order given.
+func loadSchema(files []string) (*schema.Schema, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	schemas := []*schema.Schema{schema.Builtin()}
+	for _, filename := range files {
+		sch, err := schema.LoadFile(filename)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to load resource schema",
+				Detail:   fmt.Sprintf("There was an error loading the resource schema from %s: %s.", filename, err),
+			})
+			continue
+		}
+		schemas = append(schemas, sch)
+	}
+
+	return schema.Merge(schemas...), diags
+}
+
 func printDiagnostics(diags hcl.Diagnostics) {
 	if len(diags) == 0 {
 		return
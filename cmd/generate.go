@@ -3,22 +3,51 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 
 	"github.com/apparentlymart/awsup/cfnjson"
 	"github.com/apparentlymart/awsup/eval"
-	"github.com/apparentlymart/awsup/schema"
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/spf13/cobra"
 )
 
 var generateCmdConstantsFiles []string
+var generateCmdConstants []string
+var generateCmdSourceMapFile string
+var generateCmdSchemaFiles []string
 
 // generateCmd represents the generate command
 var generateCmd = &cobra.Command{
 	Use:   "generate [source-dir-or-file]",
 	Short: "Generate CloudFormation template JSON",
-	Long:  `Generate CloudFormation template JSON from awsup configuration`,
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Generate CloudFormation template JSON from awsup configuration.
+
+Values for the root module's constants can be set in several ways:
+
+  - Environment variables named AWSUP_CONST_ followed by a constant name.
+  - Values files given with --constants, in HCL, JSON (.json) or YAML
+    (.yaml or .yml) syntax.
+  - Individual flags like --constant name=value, or -c name=value. An
+    argument to -c or --constants that contains "=" is always taken as a
+    constant rather than a file name.
+
+Constants set by environment variables or flags are always strings.
+
+Where a constant is set by more than one of these, the environment variables
+have the lowest precedence, followed by the values files in the order given,
+and then the flags in the order given, with those given by -c or --constants
+applied before those given by --constant.
+
+Because -c and --constants also accept comma-separated lists of file names,
+a value that contains a comma must be given with --constant instead.
+
+Additional resource types can be described by schema files given with
+--schema, in either the CloudFormation resource specification format or the
+registry resource provider schema format. Types in these files replace any
+builtin types of the same name. A module can also list schema files, relative
+to its own directory, in its ResourceSchemas attribute.
+`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
 			args = []string{"."}
@@ -26,9 +55,11 @@ var generateCmd = &cobra.Command{
 
 		var diags hcl.Diagnostics
 
-		sch := schema.Builtin()
+		sch, schemaDiags := loadSchema(generateCmdSchemaFiles)
+		diags = append(diags, schemaDiags...)
+		exitIfErrors(diags)
 
-		inputConstants, constantsDiags := parser.ParseValuesFiles(generateCmdConstantsFiles...)
+		inputConstants, constantsDiags := loadRootConstants(generateCmdConstantsFiles, generateCmdConstants)
 		diags = append(diags, constantsDiags...)
 		exitIfErrors(diags)
 
@@ -44,6 +75,22 @@ var generateCmd = &cobra.Command{
 		diags = append(diags, prepDiags...)
 		exitIfErrors(diags)
 
+		// The source map is written first so that a failure to write it
+		// doesn't leave a template on stdout that appears to have succeeded.
+		if generateCmdSourceMapFile != "" {
+			sourceMap := cfnjson.PrepareSourceMap(template)
+			mapSrc, _ := json.MarshalIndent(sourceMap, "", "  ")
+			err := ioutil.WriteFile(generateCmdSourceMapFile, mapSrc, 0644)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to write source map",
+					Detail:   fmt.Sprintf("There was an error writing %s: %s.", generateCmdSourceMapFile, err),
+				})
+				exitIfErrors(diags)
+			}
+		}
+
 		jsonSrc, _ := json.MarshalIndent(rawTemplate, "", "  ")
 		fmt.Printf("%s\n", jsonSrc)
 
@@ -54,6 +101,9 @@ var generateCmd = &cobra.Command{
 }
 
 func init() {
-	generateCmd.Flags().StringSliceVarP(&generateCmdConstantsFiles, "constants", "c", nil, "pass constants from values files into the root module")
+	generateCmd.Flags().StringSliceVarP(&generateCmdConstantsFiles, "constants", "c", nil, "pass constants from values files, or individually as name=value, into the root module")
+	generateCmd.Flags().StringArrayVar(&generateCmdConstants, "constant", nil, "set a root module constant, given as name=value")
+	generateCmd.Flags().StringVar(&generateCmdSourceMapFile, "source-map", "", "write a source map relating the generated template to its configuration to the given file")
+	generateCmd.Flags().StringArrayVar(&generateCmdSchemaFiles, "schema", nil, "load additional resource types from the given schema file")
 	rootCmd.AddCommand(generateCmd)
 }
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/apparentlymart/awsup/cfnimport"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/spf13/cobra"
+)
+
+var importCmdForce bool
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import template-file [target-dir]",
+	Short: "Convert an existing CloudFormation template into configuration",
+	Long: `Convert an existing CloudFormation template, in either JSON or YAML syntax,
+into equivalent awsup configuration files.
+
+One file is written into the target directory for each top-level section of
+the template, such as parameters.awsup and resources.awsup. If no target
+directory is given, the files are written into the current directory.
+
+Intrinsic functions are rewritten as native expressions where possible, so
+for example Ref becomes a reference like Param.Name or Resource.Name and
+Fn::Sub becomes a string template. Any parts of the template that cannot be
+represented are reported as warnings and omitted.
+
+Existing files will not be overwritten unless --force is given.
+`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		targetDir := "."
+		if len(args) > 1 {
+			targetDir = args[1]
+		}
+
+		var diags hcl.Diagnostics
+
+		src, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read template",
+				Detail:   fmt.Sprintf("There was an error reading %s: %s.", args[0], err),
+			})
+			exitIfErrors(diags)
+		}
+
+		files, importDiags := cfnimport.Import(src, args[0])
+		diags = append(diags, importDiags...)
+		exitIfErrors(diags)
+
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if !importCmdForce {
+			for _, name := range names {
+				path := filepath.Join(targetDir, name)
+				if _, err := os.Stat(path); err == nil {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "File already exists",
+						Detail:   fmt.Sprintf("Import would overwrite %s. Use --force to overwrite existing files.", path),
+					})
+				}
+			}
+			exitIfErrors(diags)
+		}
+
+		err = os.MkdirAll(targetDir, 0755)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to create target directory",
+				Detail:   fmt.Sprintf("There was an error creating %s: %s.", targetDir, err),
+			})
+			exitIfErrors(diags)
+		}
+
+		for _, name := range names {
+			path := filepath.Join(targetDir, name)
+			err := ioutil.WriteFile(path, files[name], 0644)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to write configuration file",
+					Detail:   fmt.Sprintf("There was an error writing %s: %s.", path, err),
+				})
+				exitIfErrors(diags)
+			}
+		}
+
+		// If we didn't error out above then we might still have some warnings
+		// to print here.
+		printDiagnostics(diags)
+	},
+}
+
+func init() {
+	importCmd.Flags().BoolVar(&importCmdForce, "force", false, "overwrite existing files in the target directory")
+	rootCmd.AddCommand(importCmd)
+}
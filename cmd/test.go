@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apparentlymart/awsup/cfneval"
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/eval"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/spf13/cobra"
+)
+
+var testCmdConstantsFiles []string
+var testCmdConstants []string
+var testCmdSchemaFiles []string
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:   "test [source-dir-or-file]",
+	Short: "Run the tests for a module",
+	Long: `Run the tests for a module, which are given in files with the suffix
+.awsuptest alongside the module's configuration.
+
+Each test file gives the constants and parameter values to use, optionally
+along with stub values for pseudo parameters, resources and the exports of
+other stacks:
+
+    Constants {
+      Environment = "prod"
+    }
+
+    Parameters {
+      InstanceType = "t2.micro"
+    }
+
+    AWS {
+      Region = "eu-west-1"
+    }
+
+    Resource "Bucket" {
+      PhysicalId = "example-bucket"
+      Attributes = {
+        Arn = "arn:aws:s3:::example-bucket"
+      }
+    }
+
+    Imports = {
+      "network-VpcId" = "vpc-12345678"
+    }
+
+The module's template is generated and then evaluated locally, as
+CloudFormation would, and the Assert blocks in the file are checked against
+the result:
+
+    Assert {
+      Condition    = exists(Resource.Queue)
+      ErrorMessage = "The queue must be created in production."
+    }
+
+    Assert {
+      Condition = Output.BucketName == "example-bucket"
+    }
+
+Constants can also be set for all of the tests by environment variables,
+values files and flags, just as for the generate command. The Constants
+block of each test file takes precedence over all of these.
+
+Assertions can refer to Output.Name, Resource.LogicalId and Condition.Name.
+Each resource has the attributes Type, Properties, Metadata, DependsOn,
+DeletionPolicy, UpdateReplacePolicy, CreationPolicy and UpdatePolicy.
+Resources and outputs that would not be created are null, which can be
+tested using the exists function. The functions length and jsonencode are
+also available.
+
+The Rules of the template are checked against the parameter values too, and
+any assertion that does not hold causes the test to fail. Assertions that
+use Fn::ValueOf or Fn::RefAll depend on the resources in an AWS account, so
+they are skipped with a warning.
+
+Additional resource types can be described by schema files given with
+--schema, as for the generate command.
+
+The command exits with a non-zero status if any test fails.
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		rootPath := args[0]
+
+		testDir := rootPath
+		if info, err := os.Stat(rootPath); err == nil && !info.IsDir() {
+			testDir = filepath.Dir(rootPath)
+		}
+
+		filenames, diags := config.FindTestFiles(testDir)
+		exitIfErrors(diags)
+		if len(filenames) == 0 {
+			fmt.Printf("No test files found in %s.\n", testDir)
+			return
+		}
+
+		sch, schemaDiags := loadSchema(testCmdSchemaFiles)
+		diags = append(diags, schemaDiags...)
+		exitIfErrors(diags)
+
+		inputConstants, constantsDiags := loadRootConstants(testCmdConstantsFiles, testCmdConstants)
+		diags = append(diags, constantsDiags...)
+		exitIfErrors(diags)
+
+		failed := 0
+		for _, filename := range filenames {
+			testDiags := runTestFile(rootPath, filename, inputConstants, sch)
+			if testDiags.HasErrors() {
+				fmt.Printf("FAIL %s\n", filename)
+				failed++
+			} else {
+				fmt.Printf("PASS %s\n", filename)
+			}
+			printDiagnostics(testDiags)
+		}
+
+		fmt.Printf("\n%d passed, %d failed\n", len(filenames)-failed, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// runTestFile generates the template for the module at the given path using
+// the given constants, overridden by those from the given test file, and
+// then runs the test against it.
+func runTestFile(rootPath, filename string, inputConstants hcl.Attributes, sch *schema.Schema) hcl.Diagnostics {
+	test, diags := parser.ParseTestFile(filename)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	constants := config.MergeConstants(inputConstants, test.Constants)
+
+	ctx, ctxDiags := eval.NewRootContext(parser, rootPath, constants, sch)
+	diags = append(diags, ctxDiags...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	template, templateDiags := ctx.Build()
+	diags = append(diags, templateDiags...)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	diags = append(diags, cfneval.RunTest(template, test)...)
+	return diags
+}
+
+func init() {
+	testCmd.Flags().StringSliceVarP(&testCmdConstantsFiles, "constants", "c", nil, "pass constants from values files, or individually as name=value, into the root module")
+	testCmd.Flags().StringArrayVar(&testCmdConstants, "constant", nil, "set a root module constant, given as name=value")
+	testCmd.Flags().StringArrayVar(&testCmdSchemaFiles, "schema", nil, "load additional resource types from the given schema file")
+	rootCmd.AddCommand(testCmd)
+}
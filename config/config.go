@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type Module struct {
@@ -16,18 +17,23 @@ type Module struct {
 	Files    map[string]*File
 	FileASTs map[string]*hcl.File
 
-	Description   hcl.Expression
-	Conditions    map[string]*hcl.Attribute
-	Constants     map[string]*Constant
-	Locals        map[string]*hcl.Attribute
-	Mappings      map[string]*hcl.Attribute
-	Metadata      map[string]*hcl.Attribute
-	Modules       map[string]*ModuleCall
-	Outputs       map[string]*Output
-	Parameters    map[string]*Parameter
-	Resources     map[string]*Resource
-	UIParamGroups []*UIParamGroup
-	UIParamLabels map[string]*hcl.Attribute
+	Description     hcl.Expression
+	Transform       hcl.Expression
+	ResourceSchemas hcl.Expression
+	Conditions      map[string]*hcl.Attribute
+	Constants       map[string]*Constant
+	CustomResources map[string]*CustomResourceType
+	Locals          map[string]*hcl.Attribute
+	Mappings        map[string]*hcl.Attribute
+	Metadata        map[string]*hcl.Attribute
+	Modules         map[string]*ModuleCall
+	Moved           []*Moved
+	Outputs         map[string]*Output
+	Parameters      map[string]*Parameter
+	Resources       map[string]*Resource
+	Rules           map[string]*Rule
+	UIParamGroups   []*UIParamGroup
+	UIParamLabels   map[string]*hcl.Attribute
 }
 
 type File struct {
@@ -35,18 +41,23 @@ type File struct {
 	SourceAST  *hcl.File
 	Source     []byte
 
-	Description   *hcl.Attribute
-	Conditions    []*hcl.Attribute
-	Constants     []*Constant
-	Locals        []*hcl.Attribute
-	Mappings      []*hcl.Attribute
-	Metadata      []*hcl.Attribute
-	Modules       []*ModuleCall
-	Outputs       []*Output
-	Parameters    []*Parameter
-	Resources     []*Resource
-	UIParamGroups []*UIParamGroup
-	UIParamLabels []*hcl.Attribute
+	Description     *hcl.Attribute
+	Transform       *hcl.Attribute
+	ResourceSchemas *hcl.Attribute
+	Conditions      []*hcl.Attribute
+	Constants       []*Constant
+	CustomResources []*CustomResourceType
+	Locals          []*hcl.Attribute
+	Mappings        []*hcl.Attribute
+	Metadata        []*hcl.Attribute
+	Modules         []*ModuleCall
+	Moved           []*Moved
+	Outputs         []*Output
+	Parameters      []*Parameter
+	Resources       []*Resource
+	Rules           []*Rule
+	UIParamGroups   []*UIParamGroup
+	UIParamLabels   []*hcl.Attribute
 }
 
 type Constant struct {
@@ -54,6 +65,21 @@ type Constant struct {
 	DeclRange   hcl.Range
 	Description hcl.Expression
 	Default     hcl.Expression
+
+	// Type is the type constraint that the constant's value must conform
+	// to, which is cty.DynamicPseudoType if no type was given.
+	Type cty.Type
+
+	Validations []*ConstantValidation
+}
+
+// ConstantValidation is a rule that the value of a constant must satisfy.
+//
+// Condition and ErrorMessage may refer to any constants in the module,
+// including the one being validated.
+type ConstantValidation struct {
+	Condition    hcl.Expression
+	ErrorMessage hcl.Expression
 }
 
 type ModuleCall struct {
@@ -65,12 +91,30 @@ type ModuleCall struct {
 	ForEach    hcl.Expression
 }
 
+// Moved records that a resource previously declared at one address is now
+// declared at another, so that the new address can retain the logical id
+// generated for the old one.
+//
+// From and To are references to resources relative to the module containing
+// the Moved block, given either directly as a reference expression or as
+// a string containing one.
+type Moved struct {
+	DeclRange hcl.Range
+	From      hcl.Expression
+	To        hcl.Expression
+}
+
 type Output struct {
 	Name        string
 	DeclRange   hcl.Range
 	Description hcl.Expression
 	Value       hcl.Expression
 	Export      *OutputExport
+
+	// Condition decides whether CloudFormation produces the output. If it
+	// is not set, the output takes the conditions of any conditional
+	// resources it refers to.
+	Condition hcl.Expression
 }
 
 type OutputExport struct {
@@ -94,18 +138,39 @@ type Parameter struct {
 }
 
 type Resource struct {
-	LogicalID      string
-	Type           string
-	DeclRange      hcl.Range
-	Properties     hcl.Attributes
-	Metadata       hcl.Attributes
-	DependsOn      []hcl.Traversal
+	LogicalID  string
+	Type       string
+	DeclRange  hcl.Range
+	Properties hcl.Attributes
+	Metadata   hcl.Attributes
+	DependsOn  []hcl.Traversal
+	ForEach    hcl.Expression
+
+	// DeletionPolicy and UpdateReplacePolicy must be constant strings,
+	// because CloudFormation does not allow dynamic expressions for them.
+	DeletionPolicy      hcl.Expression
+	UpdateReplacePolicy hcl.Expression
+
+	// Condition is evaluated dynamically to decide whether CloudFormation
+	// creates the resource, while Enabled is a constant that decides whether
+	// the resource is included in the generated template at all.
+	Condition hcl.Expression
+	Enabled   hcl.Expression
+
+	// CreationPolicy and UpdatePolicy are nil if the corresponding block is
+	// not present.
 	CreationPolicy *ResourceCreationPolicy
-	DeletionPolicy hcl.Expression
 	UpdatePolicy   *ResourceUpdatePolicy
-	ForEach        hcl.Expression
+
+	// ExplicitLogicalID is the expression given in the optional LogicalId
+	// argument, which overrides the logical id that would otherwise be
+	// generated for the resource in the flattened template.
+	ExplicitLogicalID hcl.Expression
 }
 
+// ResourceCreationPolicy describes how CloudFormation should wait for a
+// resource to signal success before considering it created. Each of the
+// nested policies is nil if its block is not present.
 type ResourceCreationPolicy struct {
 	AutoScaling *ResourceCreationPolicyAutoScaling
 	Signal      *ResourceCreationPolicySignal
@@ -115,20 +180,102 @@ type ResourceCreationPolicyAutoScaling struct {
 	MinSuccessfulInstancesPercent hcl.Expression
 }
 
+// ResourceCreationPolicySignal is declared by a Signal block, which
+// corresponds to ResourceSignal in CloudFormation.
 type ResourceCreationPolicySignal struct {
 	Count   hcl.Expression
 	Timeout hcl.Expression
 }
 
+// ResourceUpdatePolicy describes how CloudFormation should update a resource.
+// Each of the nested policies is nil if its block is not present.
 type ResourceUpdatePolicy struct {
-	DeclRange   hcl.Range
-	AutoScaling *ResourceUpdatePolicyAutoScaling
+	AutoScalingReplacingUpdate  *ResourceUpdatePolicyReplacingUpdate
+	AutoScalingRollingUpdate    *ResourceUpdatePolicyRollingUpdate
+	AutoScalingScheduledAction  *ResourceUpdatePolicyScheduledAction
+	CodeDeployLambdaAliasUpdate *ResourceUpdatePolicyLambdaAliasUpdate
+	EnableVersionUpgrade        hcl.Expression
+	UseOnlineResharding         hcl.Expression
+}
+
+type ResourceUpdatePolicyReplacingUpdate struct {
+	WillReplace hcl.Expression
+}
+
+type ResourceUpdatePolicyRollingUpdate struct {
+	MaxBatchSize                  hcl.Expression
+	MinActiveInstancesPercent     hcl.Expression
+	MinInstancesInService         hcl.Expression
+	MinSuccessfulInstancesPercent hcl.Expression
+	PauseTime                     hcl.Expression
+	SuspendProcesses              hcl.Expression
+	WaitOnResourceSignals         hcl.Expression
 }
 
-type ResourceUpdatePolicyAutoScaling struct {
-	Replace hcl.Expression
+type ResourceUpdatePolicyScheduledAction struct {
+	IgnoreUnmodifiedGroupSizeProperties hcl.Expression
 }
 
+type ResourceUpdatePolicyLambdaAliasUpdate struct {
+	AfterAllowTrafficHook  hcl.Expression
+	ApplicationName        hcl.Expression
+	BeforeAllowTrafficHook hcl.Expression
+	DeploymentGroupName    hcl.Expression
+}
+
+// CustomResourceType declares the interface of a custom resource type, so
+// that the properties set on resources of that type and the references to
+// their attributes can be checked in the same way as for the resource types
+// in the schema.
+//
+// Every custom resource also has the required property ServiceToken, which
+// is not declared explicitly.
+type CustomResourceType struct {
+	Name       string
+	DeclRange  hcl.Range
+	Properties []*CustomResourceProperty
+	Attributes []*CustomResourceAttribute
+}
+
+type CustomResourceProperty struct {
+	Name      string
+	DeclRange hcl.Range
+	Type      cty.Type
+	Required  bool
+}
+
+type CustomResourceAttribute struct {
+	Name      string
+	DeclRange hcl.Range
+	Type      cty.Type
+}
+
+// Rule is a set of assertions about the parameter values given when a
+// stack is created or updated, which CloudFormation checks before making
+// any changes.
+//
+// If Condition is set, the assertions are checked only when it is true.
+type Rule struct {
+	Name       string
+	DeclRange  hcl.Range
+	Condition  hcl.Expression
+	Assertions []*RuleAssertion
+}
+
+type RuleAssertion struct {
+	DeclRange   hcl.Range
+	Assert      hcl.Expression
+	Description hcl.Expression
+}
+
+// UIParamGroup is a group of related parameters that the CloudFormation
+// console presents together, declared by a ParameterGroup block inside a
+// UserInterface block.
+//
+// Each of the Parameters is a reference of the form Param.Name, and the
+// parameters are presented in the order given.
 type UIParamGroup struct {
+	DeclRange  hcl.Range
+	Label      hcl.Expression
 	Parameters []hcl.Traversal
 }
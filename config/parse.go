@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/hashicorp/hcl2/ext/typeexpr"
 	"github.com/hashicorp/hcl2/gohcl"
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/hashicorp/hcl2/hclparse"
@@ -43,6 +44,8 @@ func (p *Parser) ParseFileSource(src []byte, filename string) (*File, hcl.Diagno
 	diags = append(diags, contentDiags...)
 
 	file.Description = content.Attributes["Description"]
+	file.Transform = content.Attributes["Transform"]
+	file.ResourceSchemas = content.Attributes["ResourceSchemas"]
 
 	for _, block := range content.Blocks {
 		switch block.Type {
@@ -60,6 +63,11 @@ func (p *Parser) ParseFileSource(src []byte, filename string) (*File, hcl.Diagno
 			diags = append(diags, decDiags...)
 			file.Constants = append(file.Constants, constant)
 
+		case "CustomResourceType":
+			crt, decDiags := decodeCustomResourceType(block)
+			diags = append(diags, decDiags...)
+			file.CustomResources = append(file.CustomResources, crt)
+
 		case "Locals":
 			attrs, attrsDiags := block.Body.JustAttributes()
 			diags = append(diags, attrsDiags...)
@@ -89,6 +97,11 @@ func (p *Parser) ParseFileSource(src []byte, filename string) (*File, hcl.Diagno
 			diags = append(diags, decDiags...)
 			file.Modules = append(file.Modules, module)
 
+		case "Moved":
+			moved, decDiags := decodeMoved(block)
+			diags = append(diags, decDiags...)
+			file.Moved = append(file.Moved, moved)
+
 		case "Output":
 			output, decDiags := decodeOutput(block)
 			diags = append(diags, decDiags...)
@@ -104,14 +117,16 @@ func (p *Parser) ParseFileSource(src []byte, filename string) (*File, hcl.Diagno
 			diags = append(diags, decDiags...)
 			file.Resources = append(file.Resources, resource)
 
+		case "Rule":
+			rule, decDiags := decodeRule(block)
+			diags = append(diags, decDiags...)
+			file.Rules = append(file.Rules, rule)
+
 		case "UserInterface":
-			// TODO
-			diags = append(diags, &hcl.Diagnostic{
-				Severity: hcl.DiagWarning,
-				Summary:  "UserInterface block is not yet supported",
-				Detail:   "This block is ignored by this version of awsup.",
-				Subject:  &block.DefRange,
-			})
+			groups, labels, decDiags := decodeUserInterface(block)
+			diags = append(diags, decDiags...)
+			file.UIParamGroups = append(file.UIParamGroups, groups...)
+			file.UIParamLabels = append(file.UIParamLabels, labels...)
 
 		default:
 			// Should never happen since the above cases should always cover
@@ -151,25 +166,30 @@ func NewModule(sourcePath, sourceDir string, files ...*File) (*Module, hcl.Diagn
 	var diags hcl.Diagnostics
 
 	module := &Module{
-		SourcePath:    filepath.Clean(sourcePath),
-		SourceDir:     filepath.Clean(sourceDir),
-		Files:         make(map[string]*File),
-		FileASTs:      make(map[string]*hcl.File),
-		Description:   nil, // Assigned in loop, or defaulted after loop if needed
-		Conditions:    make(map[string]*hcl.Attribute),
-		Constants:     make(map[string]*Constant),
-		Locals:        make(map[string]*hcl.Attribute),
-		Mappings:      make(map[string]*hcl.Attribute),
-		Metadata:      make(map[string]*hcl.Attribute),
-		Modules:       make(map[string]*ModuleCall),
-		Outputs:       make(map[string]*Output),
-		Parameters:    make(map[string]*Parameter),
-		Resources:     make(map[string]*Resource),
-		UIParamGroups: make([]*UIParamGroup, 0),
-		UIParamLabels: make(map[string]*hcl.Attribute),
-	}
-
-	var descriptionRange hcl.Range
+		SourcePath:      filepath.Clean(sourcePath),
+		SourceDir:       filepath.Clean(sourceDir),
+		Files:           make(map[string]*File),
+		FileASTs:        make(map[string]*hcl.File),
+		Description:     nil, // Assigned in loop, or defaulted after loop if needed
+		Transform:       nil, // Likewise
+		ResourceSchemas: nil, // Likewise
+		Conditions:      make(map[string]*hcl.Attribute),
+		Constants:       make(map[string]*Constant),
+		CustomResources: make(map[string]*CustomResourceType),
+		Locals:          make(map[string]*hcl.Attribute),
+		Mappings:        make(map[string]*hcl.Attribute),
+		Metadata:        make(map[string]*hcl.Attribute),
+		Modules:         make(map[string]*ModuleCall),
+		Moved:           make([]*Moved, 0),
+		Outputs:         make(map[string]*Output),
+		Parameters:      make(map[string]*Parameter),
+		Resources:       make(map[string]*Resource),
+		Rules:           make(map[string]*Rule),
+		UIParamGroups:   make([]*UIParamGroup, 0),
+		UIParamLabels:   make(map[string]*hcl.Attribute),
+	}
+
+	var descriptionRange, transformRange, schemasRange hcl.Range
 
 	for _, file := range files {
 		if file == nil {
@@ -204,6 +224,40 @@ func NewModule(sourcePath, sourceDir string, files ...*File) (*Module, hcl.Diagn
 			descriptionRange = file.Description.NameRange
 		}
 
+		if file.Transform != nil {
+			if module.Transform != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Multiple transforms",
+					Detail: fmt.Sprintf(
+						"Duplicate definition of module transforms, which were already defined at %s. To use more than one transform, give a list of their names.",
+						transformRange,
+					),
+					Subject: &file.Transform.NameRange,
+				})
+			} else {
+				module.Transform = file.Transform.Expr
+				transformRange = file.Transform.NameRange
+			}
+		}
+
+		if file.ResourceSchemas != nil {
+			if module.ResourceSchemas != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Multiple resource schema lists",
+					Detail: fmt.Sprintf(
+						"Duplicate definition of module resource schemas, which were already defined at %s. Give all of the schema files in a single list.",
+						schemasRange,
+					),
+					Subject: &file.ResourceSchemas.NameRange,
+				})
+			} else {
+				module.ResourceSchemas = file.ResourceSchemas.Expr
+				schemasRange = file.ResourceSchemas.NameRange
+			}
+		}
+
 		for _, def := range file.Conditions {
 			if _, conflict := module.Conditions[def.Name]; conflict {
 				diags = append(diags, &hcl.Diagnostic{
@@ -236,6 +290,22 @@ func NewModule(sourcePath, sourceDir string, files ...*File) (*Module, hcl.Diagn
 			module.Constants[def.Name] = def
 		}
 
+		for _, def := range file.CustomResources {
+			if _, conflict := module.CustomResources[def.Name]; conflict {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate custom resource type",
+					Detail: fmt.Sprintf(
+						"Duplicate definition of custom resource type %q, which was already defined at %s.",
+						def.Name, module.CustomResources[def.Name].DeclRange,
+					),
+					Subject: &def.DeclRange,
+				})
+				continue
+			}
+			module.CustomResources[def.Name] = def
+		}
+
 		for _, def := range file.Locals {
 			if _, conflict := module.Locals[def.Name]; conflict {
 				diags = append(diags, &hcl.Diagnostic{
@@ -269,10 +339,10 @@ func NewModule(sourcePath, sourceDir string, files ...*File) (*Module, hcl.Diagn
 		}
 
 		for _, def := range file.Metadata {
-			if _, conflict := module.Mappings[def.Name]; conflict {
+			if _, conflict := module.Metadata[def.Name]; conflict {
 				diags = append(diags, &hcl.Diagnostic{
 					Severity: hcl.DiagError,
-					Summary:  "Duplicate mapping",
+					Summary:  "Duplicate metadata field",
 					Detail: fmt.Sprintf(
 						"Duplicate definition of metadata field %q, which was already defined at %s.",
 						def.Name, module.Metadata[def.Name].NameRange,
@@ -300,6 +370,10 @@ func NewModule(sourcePath, sourceDir string, files ...*File) (*Module, hcl.Diagn
 			module.Modules[def.Name] = def
 		}
 
+		for _, def := range file.Moved {
+			module.Moved = append(module.Moved, def)
+		}
+
 		for _, def := range file.Outputs {
 			if _, conflict := module.Outputs[def.Name]; conflict {
 				diags = append(diags, &hcl.Diagnostic{
@@ -348,6 +422,22 @@ func NewModule(sourcePath, sourceDir string, files ...*File) (*Module, hcl.Diagn
 			module.Resources[def.LogicalID] = def
 		}
 
+		for _, def := range file.Rules {
+			if _, conflict := module.Rules[def.Name]; conflict {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate rule",
+					Detail: fmt.Sprintf(
+						"Duplicate definition of rule %q, which was already defined at %s.",
+						def.Name, module.Rules[def.Name].DeclRange,
+					),
+					Subject: &def.DeclRange,
+				})
+				continue
+			}
+			module.Rules[def.Name] = def
+		}
+
 		for _, def := range file.UIParamGroups {
 			module.UIParamGroups = append(module.UIParamGroups, def)
 		}
@@ -378,6 +468,12 @@ func NewModule(sourcePath, sourceDir string, files ...*File) (*Module, hcl.Diagn
 		// anyway.
 		module.Description = hcl.StaticExpr(cty.NullVal(cty.String), hcl.Range{})
 	}
+	if module.Transform == nil {
+		module.Transform = hcl.StaticExpr(cty.NullVal(cty.String), hcl.Range{})
+	}
+	if module.ResourceSchemas == nil {
+		module.ResourceSchemas = hcl.StaticExpr(cty.NullVal(cty.List(cty.String)), hcl.Range{})
+	}
 
 	return module, diags
 }
@@ -452,15 +548,123 @@ func decodeConstant(block *hcl.Block) (*Constant, hcl.Diagnostics) {
 	var b struct {
 		Description hcl.Expression `hcl:"Description"`
 		Default     hcl.Expression `hcl:"Default"`
+		Type        *hcl.Attribute `hcl:"Type"`
+		Validations []struct {
+			Condition    hcl.Expression `hcl:"Condition"`
+			ErrorMessage hcl.Expression `hcl:"ErrorMessage"`
+		} `hcl:"Validation,block"`
 	}
 	diags := gohcl.DecodeBody(block.Body, nil, &b)
 
-	return &Constant{
+	constant := &Constant{
 		Name:        block.Labels[0],
 		DeclRange:   block.DefRange,
 		Description: b.Description,
 		Default:     b.Default,
-	}, diags
+		Type:        cty.DynamicPseudoType,
+	}
+
+	if b.Type != nil {
+		ty, tyDiags := typeexpr.TypeConstraint(b.Type.Expr)
+		diags = append(diags, tyDiags...)
+		if !tyDiags.HasErrors() {
+			constant.Type = ty
+		}
+	}
+
+	for _, v := range b.Validations {
+		constant.Validations = append(constant.Validations, &ConstantValidation{
+			Condition:    v.Condition,
+			ErrorMessage: v.ErrorMessage,
+		})
+	}
+
+	return constant, diags
+}
+
+func decodeCustomResourceType(block *hcl.Block) (*CustomResourceType, hcl.Diagnostics) {
+	content, diags := block.Body.Content(customResourceTypeSchema)
+
+	crt := &CustomResourceType{
+		Name:      block.Labels[0],
+		DeclRange: block.DefRange,
+	}
+
+	declared := map[string]hcl.Range{}
+	for _, block := range content.Blocks {
+		name := block.Labels[0]
+		if prev, exists := declared[name]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate custom resource member",
+				Detail: fmt.Sprintf(
+					"Duplicate declaration of %q, which was already declared at %s.",
+					name, prev,
+				),
+				Subject: &block.DefRange,
+			})
+			continue
+		}
+		declared[name] = block.DefRange
+
+		if name == "ServiceToken" {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reserved custom resource member",
+				Detail:   "Every custom resource has the required property ServiceToken, so it must not be declared.",
+				Subject:  &block.DefRange,
+			})
+			continue
+		}
+
+		memberContent, memberDiags := block.Body.Content(customResourceMemberSchema)
+		diags = append(diags, memberDiags...)
+
+		switch block.Type {
+		case "Property":
+			prop := &CustomResourceProperty{
+				Name:      name,
+				DeclRange: block.DefRange,
+				Type:      cty.DynamicPseudoType,
+			}
+			if attr, isSet := memberContent.Attributes["Type"]; isSet {
+				ty, tyDiags := typeexpr.TypeConstraint(attr.Expr)
+				diags = append(diags, tyDiags...)
+				if !tyDiags.HasErrors() {
+					prop.Type = ty
+				}
+			}
+			if attr, isSet := memberContent.Attributes["Required"]; isSet {
+				diags = append(diags, gohcl.DecodeExpression(attr.Expr, nil, &prop.Required)...)
+			}
+			crt.Properties = append(crt.Properties, prop)
+
+		case "Attribute":
+			attr := &CustomResourceAttribute{
+				Name:      name,
+				DeclRange: block.DefRange,
+				Type:      cty.String,
+			}
+			if tyAttr, isSet := memberContent.Attributes["Type"]; isSet {
+				ty, tyDiags := typeexpr.TypeConstraint(tyAttr.Expr)
+				diags = append(diags, tyDiags...)
+				if !tyDiags.HasErrors() {
+					attr.Type = ty
+				}
+			}
+			if reqAttr, isSet := memberContent.Attributes["Required"]; isSet {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Unsupported argument",
+					Detail:   "Attributes of custom resources cannot be required.",
+					Subject:  &reqAttr.NameRange,
+				})
+			}
+			crt.Attributes = append(crt.Attributes, attr)
+		}
+	}
+
+	return crt, diags
 }
 
 func decodeModuleCall(block *hcl.Block) (*ModuleCall, hcl.Diagnostics) {
@@ -493,10 +697,25 @@ func decodeModuleCall(block *hcl.Block) (*ModuleCall, hcl.Diagnostics) {
 	return module, diags
 }
 
+func decodeMoved(block *hcl.Block) (*Moved, hcl.Diagnostics) {
+	var b struct {
+		From hcl.Expression `hcl:"From"`
+		To   hcl.Expression `hcl:"To"`
+	}
+	diags := gohcl.DecodeBody(block.Body, nil, &b)
+
+	return &Moved{
+		DeclRange: block.DefRange,
+		From:      b.From,
+		To:        b.To,
+	}, diags
+}
+
 func decodeOutput(block *hcl.Block) (*Output, hcl.Diagnostics) {
 	var b struct {
 		Description hcl.Expression `hcl:"Description"`
 		Value       hcl.Expression `hcl:"Value"`
+		Condition   hcl.Expression `hcl:"Condition"`
 		Export      *struct {
 			Name hcl.Expression `hcl:"Name"`
 		} `hcl:"Export,block"`
@@ -508,6 +727,7 @@ func decodeOutput(block *hcl.Block) (*Output, hcl.Diagnostics) {
 		DeclRange:   block.DefRange,
 		Description: b.Description,
 		Value:       b.Value,
+		Condition:   b.Condition,
 	}
 
 	if b.Export != nil {
@@ -554,34 +774,214 @@ func decodeParameter(block *hcl.Block) (*Parameter, hcl.Diagnostics) {
 
 func decodeResource(block *hcl.Block) (*Resource, hcl.Diagnostics) {
 	var b struct {
-		Type           string          `hcl:"Type"`
-		Parameters     *hcl.Attributes `hcl:"Parameters,block"`
-		Metadata       *hcl.Attributes `hcl:"Metadata,block"`
-		DependsOn      hcl.Expression  `hcl:"DependsOn"`
+		Type           string         `hcl:"Type"`
+		LogicalID      hcl.Expression `hcl:"LogicalId"`
+		Condition      hcl.Expression `hcl:"Condition"`
+		Enabled        hcl.Expression `hcl:"Enabled"`
+		Properties     *rawBody       `hcl:"Properties,block"`
+		Metadata       *rawBody       `hcl:"Metadata,block"`
+		DependsOn      *hcl.Attribute `hcl:"DependsOn"`
 		CreationPolicy *struct {
 			AutoScaling *struct {
 				MinSuccessfulInstancesPercent hcl.Expression `hcl:"MinSuccessfulInstancesPercent"`
-			} `hcl:"AutoScaling"`
+			} `hcl:"AutoScaling,block"`
 			Signal *struct {
 				Count   hcl.Expression `hcl:"Count"`
 				Timeout hcl.Expression `hcl:"Timeout"`
-			} `hcl:"AutoScaling"`
-		} `hcl:"CreationPolicy"`
-		DeletionPolicy hcl.Expression `hcl:"DeletionPolicy"`
-		UpdatePolicy   *struct {
-		} `hcl:"UpdatePolicy"`
+			} `hcl:"Signal,block"`
+		} `hcl:"CreationPolicy,block"`
+		DeletionPolicy      hcl.Expression `hcl:"DeletionPolicy"`
+		UpdateReplacePolicy hcl.Expression `hcl:"UpdateReplacePolicy"`
+		UpdatePolicy        *struct {
+			AutoScalingReplacingUpdate *struct {
+				WillReplace hcl.Expression `hcl:"WillReplace"`
+			} `hcl:"AutoScalingReplacingUpdate,block"`
+			AutoScalingRollingUpdate *struct {
+				MaxBatchSize                  hcl.Expression `hcl:"MaxBatchSize"`
+				MinActiveInstancesPercent     hcl.Expression `hcl:"MinActiveInstancesPercent"`
+				MinInstancesInService         hcl.Expression `hcl:"MinInstancesInService"`
+				MinSuccessfulInstancesPercent hcl.Expression `hcl:"MinSuccessfulInstancesPercent"`
+				PauseTime                     hcl.Expression `hcl:"PauseTime"`
+				SuspendProcesses              hcl.Expression `hcl:"SuspendProcesses"`
+				WaitOnResourceSignals         hcl.Expression `hcl:"WaitOnResourceSignals"`
+			} `hcl:"AutoScalingRollingUpdate,block"`
+			AutoScalingScheduledAction *struct {
+				IgnoreUnmodifiedGroupSizeProperties hcl.Expression `hcl:"IgnoreUnmodifiedGroupSizeProperties"`
+			} `hcl:"AutoScalingScheduledAction,block"`
+			CodeDeployLambdaAliasUpdate *struct {
+				AfterAllowTrafficHook  hcl.Expression `hcl:"AfterAllowTrafficHook"`
+				ApplicationName        hcl.Expression `hcl:"ApplicationName"`
+				BeforeAllowTrafficHook hcl.Expression `hcl:"BeforeAllowTrafficHook"`
+				DeploymentGroupName    hcl.Expression `hcl:"DeploymentGroupName"`
+			} `hcl:"CodeDeployLambdaAliasUpdate,block"`
+			EnableVersionUpgrade hcl.Expression `hcl:"EnableVersionUpgrade"`
+			UseOnlineResharding  hcl.Expression `hcl:"UseOnlineResharding"`
+		} `hcl:"UpdatePolicy,block"`
 		ForEach hcl.Expression `hcl:"ForEach"`
 	}
 	diags := gohcl.DecodeBody(block.Body, nil, &b)
 
 	resource := &Resource{
-		LogicalID: block.Labels[0],
-		DeclRange: block.DefRange,
+		LogicalID:           block.Labels[0],
+		Type:                b.Type,
+		ExplicitLogicalID:   b.LogicalID,
+		Condition:           b.Condition,
+		Enabled:             b.Enabled,
+		DeclRange:           block.DefRange,
+		DeletionPolicy:      b.DeletionPolicy,
+		UpdateReplacePolicy: b.UpdateReplacePolicy,
+		ForEach:             b.ForEach,
+	}
+
+	if cp := b.CreationPolicy; cp != nil {
+		resource.CreationPolicy = &ResourceCreationPolicy{
+			AutoScaling: (*ResourceCreationPolicyAutoScaling)(cp.AutoScaling),
+			Signal:      (*ResourceCreationPolicySignal)(cp.Signal),
+		}
+	}
+
+	if up := b.UpdatePolicy; up != nil {
+		// The nested structs above differ from our config types only in
+		// their tags, so we can convert them directly.
+		resource.UpdatePolicy = &ResourceUpdatePolicy{
+			AutoScalingReplacingUpdate:  (*ResourceUpdatePolicyReplacingUpdate)(up.AutoScalingReplacingUpdate),
+			AutoScalingRollingUpdate:    (*ResourceUpdatePolicyRollingUpdate)(up.AutoScalingRollingUpdate),
+			AutoScalingScheduledAction:  (*ResourceUpdatePolicyScheduledAction)(up.AutoScalingScheduledAction),
+			CodeDeployLambdaAliasUpdate: (*ResourceUpdatePolicyLambdaAliasUpdate)(up.CodeDeployLambdaAliasUpdate),
+			EnableVersionUpgrade:        up.EnableVersionUpgrade,
+			UseOnlineResharding:         up.UseOnlineResharding,
+		}
+	}
+
+	var jaDiags hcl.Diagnostics
+	resource.Properties, jaDiags = b.Properties.JustAttributes()
+	diags = append(diags, jaDiags...)
+	resource.Metadata, jaDiags = b.Metadata.JustAttributes()
+	diags = append(diags, jaDiags...)
+
+	if b.DependsOn != nil {
+		exprs, listDiags := hcl.ExprList(b.DependsOn.Expr)
+		diags = append(diags, listDiags...)
+		for _, expr := range exprs {
+			traversal, travDiags := hcl.AbsTraversalForExpr(expr)
+			diags = append(diags, travDiags...)
+			if travDiags.HasErrors() {
+				continue
+			}
+			resource.DependsOn = append(resource.DependsOn, traversal)
+		}
 	}
 
 	return resource, diags
 }
 
+func decodeRule(block *hcl.Block) (*Rule, hcl.Diagnostics) {
+	content, diags := block.Body.Content(ruleSchema)
+
+	rule := &Rule{
+		Name:      block.Labels[0],
+		DeclRange: block.DefRange,
+		Condition: hcl.StaticExpr(cty.NullVal(cty.Bool), block.DefRange),
+	}
+	if attr, isSet := content.Attributes["Condition"]; isSet {
+		rule.Condition = attr.Expr
+	}
+
+	for _, block := range content.Blocks {
+		assertContent, assertDiags := block.Body.Content(ruleAssertionSchema)
+		diags = append(diags, assertDiags...)
+		assertAttr := assertContent.Attributes["Assert"]
+		if assertAttr == nil {
+			// Missing, which Content has already reported.
+			continue
+		}
+
+		assertion := &RuleAssertion{
+			DeclRange:   block.DefRange,
+			Assert:      assertAttr.Expr,
+			Description: hcl.StaticExpr(cty.NullVal(cty.String), block.DefRange),
+		}
+		if attr, isSet := assertContent.Attributes["Description"]; isSet {
+			assertion.Description = attr.Expr
+		}
+		rule.Assertions = append(rule.Assertions, assertion)
+	}
+
+	if len(content.Blocks) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Rule without assertions",
+			Detail:   "A rule must contain at least one Assert block.",
+			Subject:  &rule.DeclRange,
+		})
+	}
+
+	return rule, diags
+}
+
+func decodeUserInterface(block *hcl.Block) ([]*UIParamGroup, []*hcl.Attribute, hcl.Diagnostics) {
+	var groups []*UIParamGroup
+	var labels []*hcl.Attribute
+
+	content, diags := block.Body.Content(userInterfaceSchema)
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+
+		case "ParameterGroup":
+			groupContent, groupDiags := block.Body.Content(uiParamGroupSchema)
+			diags = append(diags, groupDiags...)
+			paramsAttr := groupContent.Attributes["Parameters"]
+			if paramsAttr == nil {
+				// Missing, which Content has already reported.
+				continue
+			}
+
+			group := &UIParamGroup{
+				DeclRange: block.DefRange,
+				Label:     hcl.StaticExpr(cty.NullVal(cty.String), block.DefRange),
+			}
+			if attr, isSet := groupContent.Attributes["Label"]; isSet {
+				group.Label = attr.Expr
+			}
+			exprs, listDiags := hcl.ExprList(paramsAttr.Expr)
+			diags = append(diags, listDiags...)
+			for _, expr := range exprs {
+				traversal, travDiags := hcl.AbsTraversalForExpr(expr)
+				diags = append(diags, travDiags...)
+				if travDiags.HasErrors() {
+					continue
+				}
+				group.Parameters = append(group.Parameters, traversal)
+			}
+			if !listDiags.HasErrors() && len(exprs) == 0 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Empty parameter group",
+					Detail:   "A parameter group must contain at least one parameter.",
+					Subject:  paramsAttr.Expr.Range().Ptr(),
+				})
+			}
+			groups = append(groups, group)
+
+		case "ParameterLabels":
+			attrs, attrsDiags := block.Body.JustAttributes()
+			diags = append(diags, attrsDiags...)
+
+			for _, attr := range attrs {
+				labels = append(labels, attr)
+			}
+
+		default:
+			// Should never happen since the above cases should always cover
+			// all of the block types in our schema.
+			panic(fmt.Errorf("unhandled block type %q", block.Type))
+		}
+	}
+
+	return groups, labels, diags
+}
+
 type rawBody struct {
 	hcl.Body `hcl:",remain"`
 }
@@ -601,6 +1001,14 @@ var fileRootSchema = &hcl.BodySchema{
 			Name:     "Description",
 			Required: false,
 		},
+		{
+			Name:     "Transform",
+			Required: false,
+		},
+		{
+			Name:     "ResourceSchemas",
+			Required: false,
+		},
 	},
 	Blocks: []hcl.BlockHeaderSchema{
 		{
@@ -610,6 +1018,10 @@ var fileRootSchema = &hcl.BodySchema{
 			Type:       "Constant",
 			LabelNames: []string{"name"},
 		},
+		{
+			Type:       "CustomResourceType",
+			LabelNames: []string{"type name"},
+		},
 		{
 			Type: "Locals",
 		},
@@ -623,6 +1035,9 @@ var fileRootSchema = &hcl.BodySchema{
 			Type:       "Module",
 			LabelNames: []string{"name"},
 		},
+		{
+			Type: "Moved",
+		},
 		{
 			Type:       "Output",
 			LabelNames: []string{"name"},
@@ -635,8 +1050,89 @@ var fileRootSchema = &hcl.BodySchema{
 			Type:       "Resource",
 			LabelNames: []string{"logical id"},
 		},
+		{
+			Type:       "Rule",
+			LabelNames: []string{"name"},
+		},
 		{
 			Type: "UserInterface",
 		},
 	},
 }
+
+var customResourceTypeSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type:       "Property",
+			LabelNames: []string{"name"},
+		},
+		{
+			Type:       "Attribute",
+			LabelNames: []string{"name"},
+		},
+	},
+}
+
+var customResourceMemberSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "Type",
+			Required: false,
+		},
+		{
+			Name:     "Required",
+			Required: false,
+		},
+	},
+}
+
+var ruleSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "Condition",
+			Required: false,
+		},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type: "Assert",
+		},
+	},
+}
+
+var ruleAssertionSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "Assert",
+			Required: true,
+		},
+		{
+			Name:     "Description",
+			Required: false,
+		},
+	},
+}
+
+var userInterfaceSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type: "ParameterGroup",
+		},
+		{
+			Type: "ParameterLabels",
+		},
+	},
+}
+
+var uiParamGroupSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "Label",
+			Required: false,
+		},
+		{
+			Name:     "Parameters",
+			Required: true,
+		},
+	},
+}
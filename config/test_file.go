@@ -0,0 +1,247 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TestFile is a test case for a module, loaded from a file with the suffix
+// ".awsuptest".
+//
+// A test file gives the constants and parameter values to use when
+// generating and evaluating the module's template, along with stub values
+// for things that would normally be provided by CloudFormation, and then
+// a number of assertions about the result.
+type TestFile struct {
+	SourcePath string
+	SourceAST  *hcl.File
+
+	Constants        hcl.Attributes
+	Parameters       hcl.Attributes
+	PseudoParameters hcl.Attributes
+	Resources        map[string]*TestResource
+	Asserts          []*TestAssert
+
+	// Imports is an object giving the values of the exports of other stacks
+	// that are imported by the template, keyed by export name.
+	Imports hcl.Expression
+}
+
+// TestResource gives stub values for a resource in a test, for use in place
+// of the values that CloudFormation would determine when creating it.
+type TestResource struct {
+	LogicalID  string
+	DeclRange  hcl.Range
+	PhysicalID hcl.Expression
+	Attributes hcl.Expression
+}
+
+// TestAssert is a condition that must hold for a test to pass.
+type TestAssert struct {
+	DeclRange    hcl.Range
+	Condition    hcl.Expression
+	ErrorMessage hcl.Expression
+}
+
+// ParseTestFile parses the test case in the given file.
+func (p *Parser) ParseTestFile(filename string) (*TestFile, hcl.Diagnostics) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read test file",
+				Detail:   fmt.Sprintf("There was an error reading %s: %s.", filename, err),
+			},
+		}
+	}
+	return p.ParseTestFileSource(src, filename)
+}
+
+// ParseTestFileSource parses the test case in the given source code.
+func (p *Parser) ParseTestFileSource(src []byte, filename string) (*TestFile, hcl.Diagnostics) {
+	astFile, diags := p.HCLParser.ParseHCL(src, filename)
+
+	file := &TestFile{
+		SourcePath:       filepath.Clean(filename),
+		SourceAST:        astFile,
+		Constants:        make(hcl.Attributes),
+		Parameters:       make(hcl.Attributes),
+		PseudoParameters: make(hcl.Attributes),
+		Imports:          hcl.StaticExpr(cty.NullVal(cty.DynamicPseudoType), hcl.Range{Filename: filename}),
+		Resources:        make(map[string]*TestResource),
+	}
+	if astFile == nil {
+		return file, diags
+	}
+
+	content, contentDiags := astFile.Body.Content(testFileRootSchema)
+	diags = append(diags, contentDiags...)
+
+	if attr, exists := content.Attributes["Imports"]; exists {
+		file.Imports = attr.Expr
+	}
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+
+		case "AWS":
+			attrs, attrsDiags := block.Body.JustAttributes()
+			diags = append(diags, attrsDiags...)
+			for name, attr := range attrs {
+				file.PseudoParameters[name] = attr
+			}
+
+		case "Assert":
+			var b struct {
+				Condition    hcl.Expression `hcl:"Condition"`
+				ErrorMessage hcl.Expression `hcl:"ErrorMessage"`
+			}
+			decDiags := gohcl.DecodeBody(block.Body, nil, &b)
+			diags = append(diags, decDiags...)
+			file.Asserts = append(file.Asserts, &TestAssert{
+				DeclRange:    block.DefRange,
+				Condition:    b.Condition,
+				ErrorMessage: b.ErrorMessage,
+			})
+
+		case "Constants":
+			attrs, attrsDiags := block.Body.JustAttributes()
+			diags = append(diags, attrsDiags...)
+			for name, attr := range attrs {
+				file.Constants[name] = attr
+			}
+
+		case "Parameters":
+			attrs, attrsDiags := block.Body.JustAttributes()
+			diags = append(diags, attrsDiags...)
+			for name, attr := range attrs {
+				file.Parameters[name] = attr
+			}
+
+		case "Resource":
+			var b struct {
+				PhysicalID hcl.Expression `hcl:"PhysicalId"`
+				Attributes hcl.Expression `hcl:"Attributes"`
+			}
+			decDiags := gohcl.DecodeBody(block.Body, nil, &b)
+			diags = append(diags, decDiags...)
+
+			logicalID := block.Labels[0]
+			if existing, conflict := file.Resources[logicalID]; conflict {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate resource",
+					Detail: fmt.Sprintf(
+						"Duplicate stub for resource %q, which was already given at %s.",
+						logicalID, existing.DeclRange,
+					),
+					Subject: &block.DefRange,
+				})
+				continue
+			}
+			file.Resources[logicalID] = &TestResource{
+				LogicalID:  logicalID,
+				DeclRange:  block.DefRange,
+				PhysicalID: b.PhysicalID,
+				Attributes: b.Attributes,
+			}
+
+		default:
+			// Should never happen since the above cases should always cover
+			// all of the block types in our schema.
+			panic(fmt.Errorf("unhandled block type %q", block.Type))
+		}
+	}
+
+	if len(file.Asserts) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Test has no assertions",
+			Detail:   fmt.Sprintf("The test in %s has no Assert blocks, so it will always pass.", file.SourcePath),
+		})
+	}
+
+	return file, diags
+}
+
+// FindTestFiles returns the paths of the test files in the given directory,
+// in lexicographical order.
+func FindTestFiles(dir string) ([]string, hcl.Diagnostics) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, hcl.Diagnostics{
+				{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to read tests",
+					Detail:   fmt.Sprintf("The requested directory %s does not exist.", dir),
+				},
+			}
+		}
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read tests",
+				Detail:   fmt.Sprintf("There was an error reading %s: %s.", dir, err),
+			},
+		}
+	}
+
+	var ret []string
+	for _, info := range infos {
+		name := info.Name()
+
+		// As with configuration files, we filter out things that look like
+		// editor temporary files.
+		switch {
+		case info.IsDir():
+			continue
+		case !strings.HasSuffix(name, ".awsuptest"):
+			continue
+		case strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#"):
+			continue
+		case strings.HasPrefix(name, "."):
+			continue
+		}
+
+		ret = append(ret, filepath.Join(dir, name))
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+var testFileRootSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{
+			Name:     "Imports",
+			Required: false,
+		},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{
+			Type: "AWS",
+		},
+		{
+			Type: "Assert",
+		},
+		{
+			Type: "Constants",
+		},
+		{
+			Type: "Parameters",
+		},
+		{
+			Type:       "Resource",
+			LabelNames: []string{"logical id"},
+		},
+	},
+}
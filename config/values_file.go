@@ -4,10 +4,72 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+	yaml "gopkg.in/yaml.v3"
 )
 
+// ConstantEnvPrefix is the prefix of the names of the environment variables
+// that set root module constants.
+const ConstantEnvPrefix = "AWSUP_CONST_"
+
+// LoadConstants gathers the values of the root module's constants from the
+// given environment variables, in the form returned by os.Environ, values
+// files and name=value flags.
+//
+// Where a constant is set by more than one source, environment variables
+// have the lowest precedence, followed by the values files in the order
+// given, and then by the flags, with later flags overriding earlier ones.
+func (p *Parser) LoadConstants(environ, files, flags []string) (hcl.Attributes, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	envAttrs := ConstantsFromEnvironment(environ)
+
+	fileAttrs, fileDiags := p.ParseValuesFiles(files...)
+	diags = append(diags, fileDiags...)
+
+	flagAttrs, flagDiags := ParseConstantFlags(flags)
+	diags = append(diags, flagDiags...)
+
+	return MergeConstants(envAttrs, fileAttrs, flagAttrs), diags
+}
+
+// MergeConstants returns the constants from all of the given sets, with those
+// in later sets taking precedence over earlier ones.
+func MergeConstants(sets ...hcl.Attributes) hcl.Attributes {
+	ret := make(hcl.Attributes)
+	for _, attrs := range sets {
+		for name, attr := range attrs {
+			ret[name] = attr
+		}
+	}
+	return ret
+}
+
+// SplitConstantArgs separates the arguments of a flag that accepts both
+// values files and individual constants. Arguments containing "=" are
+// constants in the form name=value and all others are values file names.
+func SplitConstantArgs(args []string) (files, flags []string) {
+	for _, arg := range args {
+		if strings.Contains(arg, "=") {
+			flags = append(flags, arg)
+		} else {
+			files = append(files, arg)
+		}
+	}
+	return files, flags
+}
+
+// ParseValuesFiles parses the given values files and merges their contents,
+// with values in later files taking precedence over earlier ones.
+//
+// Files whose names end in ".json", ".yaml" or ".yml" are parsed as JSON or
+// YAML objects respectively. All others are parsed as HCL.
 func (p *Parser) ParseValuesFiles(filenames ...string) (hcl.Attributes, hcl.Diagnostics) {
 	attrs := make(hcl.Attributes)
 	var diags hcl.Diagnostics
@@ -33,7 +95,16 @@ func (p *Parser) ParseValuesFiles(filenames ...string) (hcl.Attributes, hcl.Diag
 				}
 			}
 		}
-		thisAttrs, thisDiags := p.ParseValuesSource(src, filename)
+		var thisAttrs hcl.Attributes
+		var thisDiags hcl.Diagnostics
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".json":
+			thisAttrs, thisDiags = p.ParseValuesJSONSource(src, filename)
+		case ".yaml", ".yml":
+			thisAttrs, thisDiags = ParseValuesYAMLSource(src, filename)
+		default:
+			thisAttrs, thisDiags = p.ParseValuesSource(src, filename)
+		}
 		diags = append(diags, thisDiags...)
 		for k, v := range thisAttrs {
 			attrs[k] = v
@@ -53,3 +124,222 @@ func (p *Parser) ParseValuesSource(src []byte, filename string) (hcl.Attributes,
 	diags = append(diags, decDiags...)
 	return attrs, diags
 }
+
+// ParseValuesJSONSource is like ParseValuesSource but expects the values to
+// be given as a JSON object.
+func (p *Parser) ParseValuesJSONSource(src []byte, filename string) (hcl.Attributes, hcl.Diagnostics) {
+	astFile, diags := p.HCLParser.ParseJSON(src, filename)
+	if astFile == nil {
+		return make(hcl.Attributes), diags
+	}
+
+	attrs, decDiags := astFile.Body.JustAttributes()
+	diags = append(diags, decDiags...)
+	return attrs, diags
+}
+
+// ParseValuesYAMLSource is like ParseValuesSource but expects the values to
+// be given as a YAML mapping.
+//
+// YAML is not an HCL syntax, so the resulting attributes have static
+// expressions whose ranges give the locations of the corresponding keys and
+// values in the source.
+func ParseValuesYAMLSource(src []byte, filename string) (hcl.Attributes, hcl.Diagnostics) {
+	attrs := make(hcl.Attributes)
+	var diags hcl.Diagnostics
+
+	var doc yaml.Node
+	err := yaml.Unmarshal(src, &doc)
+	if err != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid YAML values file",
+			Detail:   fmt.Sprintf("There was an error parsing %s: %s.", filename, err),
+			Subject:  &hcl.Range{Filename: filename},
+		})
+		return attrs, diags
+	}
+	if len(doc.Content) == 0 {
+		// An empty file sets no values.
+		return attrs, diags
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid YAML values file",
+			Detail:   fmt.Sprintf("The values file %s must contain a mapping from constant names to values.", filename),
+			Subject:  yamlNodeRange(filename, root).Ptr(),
+		})
+		return attrs, diags
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		keyNode, valNode := root.Content[i], root.Content[i+1]
+		name := keyNode.Value
+		nameRange := yamlNodeRange(filename, keyNode)
+		valRange := yamlNodeRange(filename, valNode)
+
+		if !hclsyntax.ValidIdentifier(name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid constant name",
+				Detail:   fmt.Sprintf("The name %q is not a valid constant name.", name),
+				Subject:  &nameRange,
+			})
+			continue
+		}
+		if existing, exists := attrs[name]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate constant value",
+				Detail:   fmt.Sprintf("A value for %q was already given at %s.", name, existing.NameRange),
+				Subject:  &nameRange,
+			})
+			continue
+		}
+
+		var raw interface{}
+		err := valNode.Decode(&raw)
+		var val cty.Value
+		if err == nil {
+			val, err = rawConstantValue(raw)
+		}
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid constant value",
+				Detail:   fmt.Sprintf("Unsuitable value for %q: %s.", name, err),
+				Subject:  &valRange,
+			})
+			continue
+		}
+
+		attrs[name] = &hcl.Attribute{
+			Name:      name,
+			Expr:      hcl.StaticExpr(val, valRange),
+			Range:     hcl.RangeBetween(nameRange, valRange),
+			NameRange: nameRange,
+		}
+	}
+
+	return attrs, diags
+}
+
+// ParseConstantFlags parses constant values given on the command line in the
+// form name=value. The values are always strings.
+//
+// Each resulting attribute has a synthetic range whose filename describes
+// the flag it came from, so that diagnostics can refer to it.
+func ParseConstantFlags(flags []string) (hcl.Attributes, hcl.Diagnostics) {
+	attrs := make(hcl.Attributes)
+	var diags hcl.Diagnostics
+
+	for _, flag := range flags {
+		eq := strings.Index(flag, "=")
+		if eq < 1 || !hclsyntax.ValidIdentifier(flag[:eq]) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid constant flag",
+				Detail:   fmt.Sprintf("The constant %q must be given as name=value, where name is a valid constant name.", flag),
+			})
+			continue
+		}
+		name, value := flag[:eq], flag[eq+1:]
+		attrs[name] = syntheticConstant(name, value, fmt.Sprintf("<command line flag --constant %s>", name))
+	}
+
+	return attrs, diags
+}
+
+// ConstantsFromEnvironment returns the constants set by the given environment
+// variables, in the form returned by os.Environ. Only variables whose names
+// start with ConstantEnvPrefix are used, and their values are always strings.
+func ConstantsFromEnvironment(environ []string) hcl.Attributes {
+	attrs := make(hcl.Attributes)
+
+	for _, pair := range environ {
+		if !strings.HasPrefix(pair, ConstantEnvPrefix) {
+			continue
+		}
+		eq := strings.Index(pair, "=")
+		if eq < 0 {
+			continue
+		}
+		varName, value := pair[:eq], pair[eq+1:]
+		name := varName[len(ConstantEnvPrefix):]
+		if !hclsyntax.ValidIdentifier(name) {
+			// Other variables may happen to share our prefix, so we'll just
+			// silently ignore any that can't be constants.
+			continue
+		}
+		attrs[name] = syntheticConstant(name, value, fmt.Sprintf("<environment variable %s>", varName))
+	}
+
+	return attrs
+}
+
+// syntheticConstant returns an attribute setting the named constant to the
+// given string, whose ranges use the given description as their filename.
+func syntheticConstant(name, value, desc string) *hcl.Attribute {
+	rng := hcl.Range{
+		Filename: desc,
+		Start:    hcl.Pos{Line: 1, Column: 1, Byte: 0},
+		End:      hcl.Pos{Line: 1, Column: 1, Byte: 0},
+	}
+	return &hcl.Attribute{
+		Name:      name,
+		Expr:      hcl.StaticExpr(cty.StringVal(value), rng),
+		Range:     rng,
+		NameRange: rng,
+	}
+}
+
+// rawConstantValue converts a value decoded from YAML into a cty value.
+func rawConstantValue(raw interface{}) (cty.Value, error) {
+	switch tv := raw.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case []interface{}:
+		if len(tv) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		elems := make([]cty.Value, len(tv))
+		for i, elem := range tv {
+			var err error
+			elems[i], err = rawConstantValue(elem)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+		}
+		return cty.TupleVal(elems), nil
+	case map[string]interface{}:
+		attrs := make(map[string]cty.Value, len(tv))
+		for name, attr := range tv {
+			var err error
+			attrs[name], err = rawConstantValue(attr)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+		}
+		return cty.ObjectVal(attrs), nil
+	case map[interface{}]interface{}:
+		return cty.DynamicVal, fmt.Errorf("mapping keys must be strings")
+	default:
+		ty, err := gocty.ImpliedType(raw)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		return gocty.ToCtyValue(raw, ty)
+	}
+}
+
+func yamlNodeRange(filename string, node *yaml.Node) hcl.Range {
+	pos := hcl.Pos{Line: node.Line, Column: node.Column}
+	return hcl.Range{
+		Filename: filename,
+		Start:    pos,
+		End:      pos,
+	}
+}
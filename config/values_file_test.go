@@ -0,0 +1,399 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParseConstantFlags(t *testing.T) {
+	tests := map[string]struct {
+		Flags []string
+		Want  map[string]cty.Value
+		Diags []string
+	}{
+		"none": {
+			nil,
+			map[string]cty.Value{},
+			nil,
+		},
+		"several": {
+			[]string{"Env=prod", "Count=3"},
+			map[string]cty.Value{
+				"Env":   cty.StringVal("prod"),
+				"Count": cty.StringVal("3"),
+			},
+			nil,
+		},
+		"later flag wins": {
+			[]string{"Env=dev", "Env=prod"},
+			map[string]cty.Value{"Env": cty.StringVal("prod")},
+			nil,
+		},
+		"empty value": {
+			[]string{"Env="},
+			map[string]cty.Value{"Env": cty.StringVal("")},
+			nil,
+		},
+		"value containing equals": {
+			[]string{"Filter=a=b=c"},
+			map[string]cty.Value{"Filter": cty.StringVal("a=b=c")},
+			nil,
+		},
+		"missing equals": {
+			[]string{"Env", "Count=3"},
+			map[string]cty.Value{"Count": cty.StringVal("3")},
+			[]string{"Invalid constant flag"},
+		},
+		"empty name": {
+			[]string{"=prod"},
+			map[string]cty.Value{},
+			[]string{"Invalid constant flag"},
+		},
+		"invalid name": {
+			[]string{"1Env=prod"},
+			map[string]cty.Value{},
+			[]string{"Invalid constant flag"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			attrs, diags := ParseConstantFlags(test.Flags)
+			checkDiagSummaries(t, diags, test.Diags)
+			checkConstantValues(t, attrs, test.Want)
+			for name, attr := range attrs {
+				if got, want := attr.Range.Filename, "<command line flag --constant "+name+">"; got != want {
+					t.Errorf("wrong range for %s\ngot:  %s\nwant: %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConstantsFromEnvironment(t *testing.T) {
+	tests := map[string]struct {
+		Environ []string
+		Want    map[string]cty.Value
+	}{
+		"none": {
+			[]string{"HOME=/root", "PATH=/bin"},
+			map[string]cty.Value{},
+		},
+		"prefixed": {
+			[]string{"HOME=/root", "AWSUP_CONST_Env=prod", "AWSUP_CONST_Filter=a=b"},
+			map[string]cty.Value{
+				"Env":    cty.StringVal("prod"),
+				"Filter": cty.StringVal("a=b"),
+			},
+		},
+		"prefix only": {
+			[]string{"AWSUP_CONST_=prod"},
+			map[string]cty.Value{},
+		},
+		"invalid name": {
+			[]string{"AWSUP_CONST_1Env=prod"},
+			map[string]cty.Value{},
+		},
+		"prefix is case sensitive": {
+			[]string{"awsup_const_Env=prod"},
+			map[string]cty.Value{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			attrs := ConstantsFromEnvironment(test.Environ)
+			checkConstantValues(t, attrs, test.Want)
+			for name, attr := range attrs {
+				if got, want := attr.Range.Filename, "<environment variable AWSUP_CONST_"+name+">"; got != want {
+					t.Errorf("wrong range for %s\ngot:  %s\nwant: %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseValuesFiles(t *testing.T) {
+	tests := map[string]struct {
+		Filename string
+		Src      string
+		Want     map[string]cty.Value
+		Diags    []string
+	}{
+		"hcl": {
+			"values.awsupvars",
+			`
+Env   = "prod"
+Count = 3
+`,
+			map[string]cty.Value{
+				"Env":   cty.StringVal("prod"),
+				"Count": cty.NumberIntVal(3),
+			},
+			nil,
+		},
+		"json": {
+			"values.json",
+			`{"Env": "prod", "Count": 3, "Zones": ["a", "b"]}`,
+			map[string]cty.Value{
+				"Env":   cty.StringVal("prod"),
+				"Count": cty.NumberIntVal(3),
+				"Zones": cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+			},
+			nil,
+		},
+		"json array root": {
+			"values.json",
+			`["prod"]`,
+			map[string]cty.Value{},
+			[]string{"Incorrect JSON value type"},
+		},
+		"yaml": {
+			"values.yaml",
+			`
+Env: prod
+Count: 3
+Enabled: true
+Zones: [a, b]
+Tags:
+  Team: core
+`,
+			map[string]cty.Value{
+				"Env":     cty.StringVal("prod"),
+				"Count":   cty.NumberIntVal(3),
+				"Enabled": cty.True,
+				"Zones":   cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+				"Tags":    cty.ObjectVal(map[string]cty.Value{"Team": cty.StringVal("core")}),
+			},
+			nil,
+		},
+		"yml": {
+			"values.yml",
+			`Env: prod`,
+			map[string]cty.Value{"Env": cty.StringVal("prod")},
+			nil,
+		},
+		"yaml empty": {
+			"values.yaml",
+			``,
+			map[string]cty.Value{},
+			nil,
+		},
+		"yaml sequence root": {
+			"values.yaml",
+			`[prod]`,
+			map[string]cty.Value{},
+			[]string{"Invalid YAML values file"},
+		},
+		"yaml scalar root": {
+			"values.yaml",
+			`prod`,
+			map[string]cty.Value{},
+			[]string{"Invalid YAML values file"},
+		},
+		"yaml syntax error": {
+			"values.yaml",
+			`Env: [prod`,
+			map[string]cty.Value{},
+			[]string{"Invalid YAML values file"},
+		},
+		"yaml invalid name": {
+			"values.yaml",
+			`
+1Env: prod
+Env: prod
+`,
+			map[string]cty.Value{"Env": cty.StringVal("prod")},
+			[]string{"Invalid constant name"},
+		},
+		"yaml duplicate name": {
+			"values.yaml",
+			`
+Env: dev
+Env: prod
+`,
+			map[string]cty.Value{"Env": cty.StringVal("dev")},
+			[]string{"Duplicate constant value"},
+		},
+		"yaml non-string keys": {
+			"values.yaml",
+			`
+Tags:
+  1: core
+`,
+			map[string]cty.Value{},
+			[]string{"Invalid constant value"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := testTempDir(t)
+			defer os.RemoveAll(dir)
+			filename := filepath.Join(dir, test.Filename)
+			writeTestFile(t, filename, test.Src)
+
+			attrs, diags := NewParser().ParseValuesFiles(filename)
+			checkDiagSummaries(t, diags, test.Diags)
+			checkConstantValues(t, attrs, test.Want)
+			for name, attr := range attrs {
+				if got, want := attr.NameRange.Filename, filename; got != want {
+					t.Errorf("wrong range for %s\ngot:  %s\nwant: %s", name, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		dir := testTempDir(t)
+		defer os.RemoveAll(dir)
+
+		_, diags := NewParser().ParseValuesFiles(filepath.Join(dir, "missing.json"))
+		checkDiagSummaries(t, diags, []string{"Failed to read values from file"})
+	})
+}
+
+func TestLoadConstants(t *testing.T) {
+	dir := testTempDir(t)
+	defer os.RemoveAll(dir)
+	first := filepath.Join(dir, "first.json")
+	second := filepath.Join(dir, "second.yaml")
+	writeTestFile(t, first, `{"FromFirst": "first", "FromSecond": "first", "FromFlag": "first"}`)
+	writeTestFile(t, second, "FromSecond: second\nFromFlag: second\n")
+
+	environ := []string{
+		"AWSUP_CONST_FromEnv=env",
+		"AWSUP_CONST_FromFirst=env",
+		"AWSUP_CONST_FromSecond=env",
+		"AWSUP_CONST_FromFlag=env",
+		"AWSUP_CONST_FromTest=env",
+	}
+	flags := []string{"FromFlag=flag", "FromTest=flag", "FromFlag=last"}
+
+	attrs, diags := NewParser().LoadConstants(environ, []string{first, second}, flags)
+	checkDiagSummaries(t, diags, nil)
+	checkConstantValues(t, attrs, map[string]cty.Value{
+		"FromEnv":    cty.StringVal("env"),
+		"FromFirst":  cty.StringVal("first"),
+		"FromSecond": cty.StringVal("second"),
+		"FromFlag":   cty.StringVal("last"),
+		"FromTest":   cty.StringVal("flag"),
+	})
+
+	// The constants of a test file take precedence over all of the others.
+	test, diags := NewParser().ParseTestFileSource([]byte(`
+Constants {
+  FromTest = "test"
+}
+
+Assert {
+  Condition = true
+}
+`), "test.awsuptest")
+	checkDiagSummaries(t, diags, nil)
+	merged := MergeConstants(attrs, test.Constants)
+	checkConstantValues(t, merged, map[string]cty.Value{
+		"FromEnv":    cty.StringVal("env"),
+		"FromFirst":  cty.StringVal("first"),
+		"FromSecond": cty.StringVal("second"),
+		"FromFlag":   cty.StringVal("last"),
+		"FromTest":   cty.StringVal("test"),
+	})
+	if got, want := merged["FromTest"].Range.Filename, "test.awsuptest"; got != want {
+		t.Errorf("wrong range for FromTest\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestSplitConstantArgs(t *testing.T) {
+	files, flags := SplitConstantArgs([]string{"a.json", "Env=prod", "b.hcl", "Filter=a=b"})
+	if got, want := files, []string{"a.json", "b.hcl"}; !equalStrings(got, want) {
+		t.Errorf("wrong files\ngot:  %q\nwant: %q", got, want)
+	}
+	if got, want := flags, []string{"Env=prod", "Filter=a=b"}; !equalStrings(got, want) {
+		t.Errorf("wrong flags\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func checkConstantValues(t *testing.T, attrs hcl.Attributes, want map[string]cty.Value) {
+	t.Helper()
+
+	var names []string
+	for name := range attrs {
+		names = append(names, name)
+	}
+	for name := range want {
+		if _, exists := attrs[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		attr, exists := attrs[name]
+		wantVal, wantExists := want[name]
+		switch {
+		case !exists:
+			t.Errorf("missing value for %s", name)
+		case !wantExists:
+			t.Errorf("unexpected value for %s", name)
+		default:
+			got, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				t.Errorf("unexpected errors evaluating %s: %s", name, diags.Error())
+				continue
+			}
+			if !got.RawEquals(wantVal) {
+				t.Errorf("wrong value for %s\ngot:  %#v\nwant: %#v", name, got, wantVal)
+			}
+		}
+	}
+}
+
+func checkDiagSummaries(t *testing.T, diags hcl.Diagnostics, want []string) {
+	t.Helper()
+
+	var got []string
+	for _, diag := range diags {
+		got = append(got, diag.Summary)
+	}
+	if !equalStrings(got, want) {
+		t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testTempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "awsup-config")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	return dir
+}
+
+func writeTestFile(t *testing.T, filename, src string) {
+	t.Helper()
+
+	err := ioutil.WriteFile(filename, []byte(src), 0644)
+	if err != nil {
+		t.Fatalf("failed to write %s: %s", filename, err)
+	}
+}
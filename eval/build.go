@@ -2,6 +2,7 @@ package eval
 
 import (
 	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/config"
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -14,15 +15,23 @@ func (ctx *RootContext) Build() (*FlatTemplate, hcl.Diagnostics) {
 		Mappings:   map[string]map[string]cty.Value{},
 		Conditions: map[string]DynExpr{},
 		Resources:  map[string]*FlatResource{},
+		Rules:      map[string]*FlatRule{},
 		Outputs:    map[string]*FlatOutput{},
+
+		MetadataSources:  map[string]FlatSource{},
+		MappingSources:   map[string]FlatSource{},
+		ConditionSources: map[string]FlatSource{},
 	}
 	root := ctx.RootModule
+	ret.Transform = ctx.Transforms
+	ret.TransformSources = ctx.TransformSources
 
 	{
 		descVal, descDiags := root.EvalConstant(root.Config.Description, cty.String, NoEachState)
 		diags = append(diags, descDiags...)
 		if descVal.IsKnown() && !descVal.IsNull() && descVal.Type() == cty.String {
 			ret.Description = descVal.AsString()
+			ret.DescriptionRange = root.Config.Description.Range()
 		}
 	}
 
@@ -37,9 +46,13 @@ func (ctx *RootContext) Build() (*FlatTemplate, hcl.Diagnostics) {
 		}
 
 		flat := &FlatParameter{
-			Type: param.Type,
+			Type:      param.Type,
+			DeclRange: param.DeclRange,
 		}
 
+		flat.Description = evalConstantStringWithDiags(root, param.Description, &diags)
+		flat.ConstraintDescription = evalConstantStringWithDiags(root, param.ConstraintDescription, &diags)
+
 		valType := paramTypeCtyType(param.Type)
 
 		flat.DefaultValue = evalConstantWithDiags(root, param.Default, valType, NoEachState, &diags)
@@ -47,8 +60,8 @@ func (ctx *RootContext) Build() (*FlatTemplate, hcl.Diagnostics) {
 		if valType != cty.String && !flat.AllowedPattern.IsNull() {
 			diags = append(diags, &hcl.Diagnostic{
 				Severity: hcl.DiagError,
-				Summary:  "Default value not permitted",
-				Detail:   "DefaultValue may be set only for parameters of string type.",
+				Summary:  "Pattern constraint not permitted",
+				Detail:   "AllowedPattern may be set only for parameters of string type.",
 				Subject:  param.AllowedPattern.Range().Ptr(),
 			})
 		}
@@ -100,29 +113,71 @@ func (ctx *RootContext) Build() (*FlatTemplate, hcl.Diagnostics) {
 
 		flat.NoEcho = evalConstantWithDiags(root, param.Obscure, cty.Bool, NoEachState, &diags)
 
+		diags = append(diags, checkParameterConstraints(param, flat)...)
+
+		flat.ValueRanges = parameterValueRanges(param, flat)
+
 		ret.Parameters[name] = flat
 	}
 
-	for name, output := range root.Config.Outputs {
-		if !addr.ValidName(name) {
-			diags = append(diags, &hcl.Diagnostic{
-				Severity: hcl.DiagError,
-				Summary:  "Invalid output name",
-				Detail:   "Output names may contain only alphanumeric characters.",
-				Subject:  &output.DeclRange,
-			})
-		}
+	// The declared conditions of all modules are added before any resources,
+	// so that the conditions hoisted from resource Condition arguments can
+	// never replace them, whatever order the modules are visited in.
+	ctx.VisitModules(func(mctx *ModuleContext) bool {
+		diags = append(diags, mctx.buildMetadata(ret)...)
+		diags = append(diags, mctx.buildConditions(ret)...)
+		diags = append(diags, mctx.buildMappings(ret)...)
+		return true
+	})
+	ctx.VisitModules(func(mctx *ModuleContext) bool {
+		diags = append(diags, mctx.buildResources(ret)...)
+		diags = append(diags, mctx.buildRules(ret)...)
+		diags = append(diags, mctx.buildUserInterface(ret)...)
+		return true
+	})
+	diags = append(diags, checkConditionalReferences(ret)...)
+
+	// Outputs are built last so that they can take the conditions of the
+	// resources they refer to.
+	diags = append(diags, root.buildOutputs(ret)...)
+	diags = append(diags, checkRuleOnlyFunctions(ret)...)
 
-		flat := &FlatOutput{}
-		flat.Value = evalDynamicWithDiags(root, output.Value, NoEachState, &diags)
-		if output.Export != nil {
-			flat.ExportName = evalDynamicWithDiags(root, output.Export.Name, NoEachState, &diags)
-		}
+	return ret, diags
+}
 
-		ret.Outputs[name] = flat
+// parameterValueRanges returns the source ranges of the expressions that
+// produced each of the values of the given flattened parameter that are set,
+// keyed by their names in the template. The parameter type is a plain string
+// in configuration, so it is attributed to the whole Parameter block.
+func parameterValueRanges(param *config.Parameter, flat *FlatParameter) map[string]hcl.Range {
+	ret := map[string]hcl.Range{
+		"Type": param.DeclRange,
 	}
 
-	return ret, diags
+	if flat.Description != "" {
+		ret["Description"] = param.Description.Range()
+	}
+	if flat.ConstraintDescription != "" {
+		ret["ConstraintDescription"] = param.ConstraintDescription.Range()
+	}
+	if len(flat.AllowedValues) != 0 {
+		ret["AllowedValues"] = param.AllowedValues.Range()
+	}
+
+	setIfNotNull := func(name string, expr hcl.Expression, val cty.Value) {
+		if !val.IsNull() {
+			ret[name] = expr.Range()
+		}
+	}
+	setIfNotNull("AllowedPattern", param.AllowedPattern, flat.AllowedPattern)
+	setIfNotNull("Default", param.Default, flat.DefaultValue)
+	setIfNotNull("MinLength", param.MinLength, flat.MinLength)
+	setIfNotNull("MaxLength", param.MaxLength, flat.MaxLength)
+	setIfNotNull("MinValue", param.MinValue, flat.MinValue)
+	setIfNotNull("MaxValue", param.MaxValue, flat.MaxValue)
+	setIfNotNull("NoEcho", param.Obscure, flat.NoEcho)
+
+	return ret
 }
 
 func evalConstantWithDiags(mctx *ModuleContext, expr hcl.Expression, ty cty.Type, each EachState, diags *hcl.Diagnostics) cty.Value {
@@ -131,6 +186,17 @@ func evalConstantWithDiags(mctx *ModuleContext, expr hcl.Expression, ty cty.Type
 	return val
 }
 
+// evalConstantStringWithDiags is like evalConstantWithDiags but for
+// optional string attributes, returning the empty string if the value is
+// null or invalid.
+func evalConstantStringWithDiags(mctx *ModuleContext, expr hcl.Expression, diags *hcl.Diagnostics) string {
+	val := evalConstantWithDiags(mctx, expr, cty.String, NoEachState, diags)
+	if !val.IsKnown() || val.IsNull() || val.Type() != cty.String {
+		return ""
+	}
+	return val.AsString()
+}
+
 func evalDynamicWithDiags(mctx *ModuleContext, expr hcl.Expression, each EachState, diags *hcl.Diagnostics) DynExpr {
 	dynExpr, newDiags := mctx.EvalDynamic(expr, each)
 	*diags = append(*diags, newDiags...)
@@ -0,0 +1,58 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// buildConditions adds the named conditions declared in the recieving module
+// to the given template.
+func (mctx *ModuleContext) buildConditions(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for name, attr := range mctx.Config.Conditions {
+		expr := evalDynamicWithDiags(mctx, attr.Expr, NoEachState, &diags)
+		id := moduleObjectID(mctx.Path, name)
+		ret.Conditions[id] = conditionExpr(expr)
+		ret.ConditionSources[id] = FlatSource{
+			Addr:      addr.NameInModule{Module: mctx.Path, Name: name},
+			DeclRange: attr.Range,
+		}
+	}
+
+	return diags
+}
+
+// conditionExpr adapts the given expression, if necessary, so that it is
+// acceptable as the definition of a named condition.
+//
+// CloudFormation requires each condition to be defined using one of its
+// condition functions, so any other expression (such as a constant, or a
+// reference to a parameter) is compared with the string "true", which is
+// how CloudFormation represents boolean values.
+func conditionExpr(expr DynExpr) DynExpr {
+	switch te := expr.(type) {
+	case *DynEquals, *DynLogical, *DynNot, *DynConditionRef:
+		return expr
+	default:
+		if lit, isLit := te.(*DynLiteral); isLit && lit.Value.Type() == cty.Bool && lit.Value.IsKnown() && !lit.Value.IsNull() {
+			// CloudFormation compares values as strings, so we'll convert
+			// constant booleans to match.
+			expr = &DynLiteral{
+				Value:    cty.StringVal(fmt.Sprintf("%t", lit.Value.True())),
+				SrcRange: lit.SrcRange,
+			}
+		}
+		return &DynEquals{
+			A: expr,
+			B: &DynLiteral{
+				Value:    cty.StringVal("true"),
+				SrcRange: expr.SourceRange(),
+			},
+			SrcRange: expr.SourceRange(),
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// interfaceMetadataKey is the template metadata key under which
+// CloudFormation expects the description of the console user interface.
+const interfaceMetadataKey = "AWS::CloudFormation::Interface"
+
+// buildUserInterface adds the parameter groups and labels declared in the
+// receiving module to the given template as AWS::CloudFormation::Interface
+// metadata.
+//
+// Only the parameters of the root module become template parameters, so the
+// UserInterface blocks in child modules are ignored with a warning.
+func (mctx *ModuleContext) buildUserInterface(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	cfg := mctx.Config
+
+	if len(cfg.UIParamGroups) == 0 && len(cfg.UIParamLabels) == 0 {
+		return diags
+	}
+
+	var subject *hcl.Range
+	if len(cfg.UIParamGroups) != 0 {
+		subject = &cfg.UIParamGroups[0].DeclRange
+	} else {
+		for _, attr := range cfg.UIParamLabels {
+			subject = &attr.NameRange
+			break
+		}
+	}
+
+	if mctx.Parent != nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "UserInterface in child module",
+			Detail:   fmt.Sprintf("The UserInterface settings for module %s are ignored, because only the parameters of the root module are presented to the user.", mctx.Path),
+			Subject:  subject,
+		})
+		return diags
+	}
+
+	meta := map[string]cty.Value{}
+
+	if len(cfg.UIParamGroups) != 0 {
+		groups := make([]cty.Value, 0, len(cfg.UIParamGroups))
+		grouped := map[string]hcl.Range{}
+		for _, group := range cfg.UIParamGroups {
+			var names []cty.Value
+			for _, traversal := range group.Parameters {
+				name, nameDiags := mctx.parameterNameForTraversal(traversal)
+				diags = append(diags, nameDiags...)
+				if nameDiags.HasErrors() {
+					continue
+				}
+				if prev, exists := grouped[name]; exists {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Parameter in multiple groups",
+						Detail:   fmt.Sprintf("Parameter %q was already placed in a group at %s. Each parameter may belong to only one group.", name, prev),
+						Subject:  traversal.SourceRange().Ptr(),
+					})
+					continue
+				}
+				grouped[name] = traversal.SourceRange()
+				names = append(names, cty.StringVal(name))
+			}
+			if len(names) == 0 {
+				continue
+			}
+
+			attrs := map[string]cty.Value{
+				"Parameters": cty.TupleVal(names),
+			}
+			if label := evalConstantStringWithDiags(mctx, group.Label, &diags); label != "" {
+				attrs["Label"] = interfaceLabel(label)
+			}
+			groups = append(groups, cty.ObjectVal(attrs))
+		}
+		if len(groups) != 0 {
+			meta["ParameterGroups"] = cty.TupleVal(groups)
+		}
+	}
+
+	if len(cfg.UIParamLabels) != 0 {
+		// Visit the labels in a predictable order so that our diagnostics
+		// are consistent between runs.
+		names := make([]string, 0, len(cfg.UIParamLabels))
+		for name := range cfg.UIParamLabels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		labels := map[string]cty.Value{}
+		for _, name := range names {
+			attr := cfg.UIParamLabels[name]
+			if _, exists := cfg.Parameters[name]; !exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Label for undeclared parameter",
+					Detail:   fmt.Sprintf("There is no parameter named %q in this module.", name),
+					Subject:  &attr.NameRange,
+				})
+				continue
+			}
+			if label := evalConstantStringWithDiags(mctx, attr.Expr, &diags); label != "" {
+				labels[name] = interfaceLabel(label)
+			}
+		}
+		if len(labels) != 0 {
+			meta["ParameterLabels"] = cty.ObjectVal(labels)
+		}
+	}
+
+	if len(meta) != 0 {
+		ret.Metadata[interfaceMetadataKey] = cty.ObjectVal(meta)
+		ret.MetadataSources[interfaceMetadataKey] = FlatSource{
+			Addr:      addr.NameInModule{Module: mctx.Path, Name: interfaceMetadataKey},
+			DeclRange: *subject,
+		}
+	}
+
+	return diags
+}
+
+// parameterNameForTraversal returns the name of the parameter referenced by
+// the given static traversal, which must be of the form Param.Name.
+func (mctx *ModuleContext) parameterNameForTraversal(traversal hcl.Traversal) (string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	var nameStep hcl.TraverseAttr
+	if len(traversal) == 2 {
+		nameStep, _ = traversal[1].(hcl.TraverseAttr)
+	}
+	if traversal.RootName() != "Param" || nameStep.Name == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid parameter reference",
+			Detail:   "A reference to a parameter must be of the form Param.Name.",
+			Subject:  traversal.SourceRange().Ptr(),
+		})
+		return "", diags
+	}
+
+	if _, exists := mctx.Config.Parameters[nameStep.Name]; !exists {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to undeclared parameter",
+			Detail:   fmt.Sprintf("There is no parameter named %q in this module.", nameStep.Name),
+			Subject:  &nameStep.SrcRange,
+		})
+		return "", diags
+	}
+
+	return nameStep.Name, diags
+}
+
+// interfaceLabel returns the representation CloudFormation expects for
+// the labels in AWS::CloudFormation::Interface metadata.
+func interfaceLabel(label string) cty.Value {
+	return cty.ObjectVal(map[string]cty.Value{
+		"default": cty.StringVal(label),
+	})
+}
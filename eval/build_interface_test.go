@@ -0,0 +1,169 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestBuildUserInterface(t *testing.T) {
+	params := `
+Parameter "Env" {
+  Type = "String"
+}
+
+Parameter "Size" {
+  Type = "Number"
+}
+`
+
+	tests := map[string]struct {
+		Files map[string]string
+		Want  cty.Value // the interface metadata, or cty.NilVal if none
+		Diags []string
+	}{
+		"groups and labels": {
+			map[string]string{
+				"main.awsup": params + `
+UserInterface {
+  ParameterGroup {
+    Label      = "Environment"
+    Parameters = [Param.Env]
+  }
+  ParameterGroup {
+    Parameters = [Param.Size]
+  }
+  ParameterLabels {
+    Size = "Cluster size"
+  }
+}
+`,
+			},
+			cty.ObjectVal(map[string]cty.Value{
+				"ParameterGroups": cty.TupleVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"Label":      interfaceLabel("Environment"),
+						"Parameters": cty.TupleVal([]cty.Value{cty.StringVal("Env")}),
+					}),
+					cty.ObjectVal(map[string]cty.Value{
+						"Parameters": cty.TupleVal([]cty.Value{cty.StringVal("Size")}),
+					}),
+				}),
+				"ParameterLabels": cty.ObjectVal(map[string]cty.Value{
+					"Size": interfaceLabel("Cluster size"),
+				}),
+			}),
+			nil,
+		},
+		"undeclared parameter in group": {
+			map[string]string{
+				"main.awsup": params + `
+UserInterface {
+  ParameterGroup {
+    Parameters = [Param.Env, Param.Missing]
+  }
+}
+`,
+			},
+			cty.NilVal,
+			[]string{"Reference to undeclared parameter"},
+		},
+		"parameter in multiple groups": {
+			map[string]string{
+				"main.awsup": params + `
+UserInterface {
+  ParameterGroup {
+    Parameters = [Param.Env, Param.Size]
+  }
+  ParameterGroup {
+    Parameters = [Param.Env]
+  }
+}
+`,
+			},
+			cty.NilVal,
+			[]string{"Parameter in multiple groups"},
+		},
+		"reference to other object": {
+			map[string]string{
+				"main.awsup": params + `
+UserInterface {
+  ParameterGroup {
+    Parameters = [Const.Env]
+  }
+}
+`,
+			},
+			cty.NilVal,
+			[]string{"Invalid parameter reference"},
+		},
+		"label for undeclared parameter": {
+			map[string]string{
+				"main.awsup": params + `
+UserInterface {
+  ParameterLabels {
+    Missing = "Missing"
+  }
+}
+`,
+			},
+			cty.NilVal,
+			[]string{"Label for undeclared parameter"},
+		},
+		"child module": {
+			map[string]string{
+				"main.awsup": `
+Module "child" {
+  Source = "./child"
+
+  Parameters {
+    Env  = "prod"
+    Size = 3
+  }
+}
+`,
+				"child/main.awsup": params + `
+UserInterface {
+  ParameterGroup {
+    Parameters = [Param.Env]
+  }
+}
+`,
+			},
+			cty.NilVal,
+			[]string{"UserInterface in child module"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, test.Files)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+			}
+			template, diags := ctx.Build()
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary)
+			}
+			if !equalStrings(got, test.Diags) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Diags)
+			}
+			if diags.HasErrors() {
+				return
+			}
+
+			meta, exists := template.Metadata[interfaceMetadataKey]
+			if test.Want == cty.NilVal {
+				if exists {
+					t.Errorf("unexpected interface metadata %#v", meta)
+				}
+				return
+			}
+			if !meta.RawEquals(test.Want) {
+				t.Errorf("wrong interface metadata\ngot:  %#v\nwant: %#v", meta, test.Want)
+			}
+		})
+	}
+}
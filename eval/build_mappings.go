@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// buildMappings adds the mappings declared in the recieving module to the
+// given template.
+func (mctx *ModuleContext) buildMappings(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for name, attr := range mctx.Config.Mappings {
+		val := evalConstantWithDiags(mctx, attr.Expr, cty.DynamicPseudoType, NoEachState, &diags)
+		if val.IsNull() {
+			continue
+		}
+
+		ty := val.Type()
+		if !(ty.IsObjectType() || ty.IsMapType()) {
+			diags = append(diags, invalidMappingDiagnostic(attr))
+			continue
+		}
+
+		table := map[string]cty.Value{}
+		valid := true
+		for it := val.ElementIterator(); it.Next(); {
+			key, inner := it.Element()
+			innerTy := inner.Type()
+			if inner.IsNull() || !(innerTy.IsObjectType() || innerTy.IsMapType()) {
+				valid = false
+				break
+			}
+			table[key.AsString()] = inner
+		}
+		if !valid {
+			diags = append(diags, invalidMappingDiagnostic(attr))
+			continue
+		}
+
+		id := moduleObjectID(mctx.Path, name)
+		ret.Mappings[id] = table
+		ret.MappingSources[id] = FlatSource{
+			Addr:      addr.NameInModule{Module: mctx.Path, Name: name},
+			DeclRange: attr.Range,
+		}
+	}
+
+	return diags
+}
+
+func invalidMappingDiagnostic(attr *hcl.Attribute) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid mapping",
+		Detail:   "A mapping must be an object whose attributes are themselves objects, giving the two levels of keys used to look up values.",
+		Subject:  attr.Expr.Range().Ptr(),
+	}
+}
@@ -0,0 +1,99 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// buildMetadata adds the template metadata declared in the receiving module
+// to the given template.
+//
+// Unlike most other objects, metadata keys are not namespaced by module, so
+// that modules can contribute to well-known keys that other tools look for.
+// When more than one module sets the same key, values that are both objects
+// are merged recursively, while any other values must be equal. Conflicts are
+// reported as errors, using the template's MetadataSources to find where
+// each key was first set.
+func (mctx *ModuleContext) buildMetadata(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for key, attr := range mctx.Config.Metadata {
+		val := evalConstantWithDiags(mctx, attr.Expr, cty.DynamicPseudoType, NoEachState, &diags)
+		if !val.IsWhollyKnown() || val.IsNull() {
+			continue
+		}
+
+		existing, exists := ret.Metadata[key]
+		if !exists {
+			ret.Metadata[key] = val
+			ret.MetadataSources[key] = FlatSource{
+				Addr:      addr.NameInModule{Module: mctx.Path, Name: key},
+				DeclRange: attr.Range,
+			}
+			continue
+		}
+
+		merged, path, ok := mergeMetadata(existing, val)
+		if !ok {
+			what := fmt.Sprintf("metadata field %q", key)
+			if path != "" {
+				what = fmt.Sprintf("attribute %s of metadata field %q", path, key)
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Conflicting metadata",
+				Detail: fmt.Sprintf(
+					"Module %s sets a value for the %s that conflicts with the one set at %s. Only objects can be merged, and any other values given for the same field must be equal.",
+					mctx.Path, what, ret.MetadataSources[key].DeclRange,
+				),
+				Subject: &attr.NameRange,
+			})
+			continue
+		}
+		ret.Metadata[key] = merged
+	}
+
+	return diags
+}
+
+// mergeMetadata merges the two given metadata values, returning false if
+// they conflict along with the path to the conflicting value.
+func mergeMetadata(a, b cty.Value) (cty.Value, string, bool) {
+	aTy, bTy := a.Type(), b.Type()
+	if !(aTy.IsObjectType() || aTy.IsMapType()) || !(bTy.IsObjectType() || bTy.IsMapType()) {
+		if a.RawEquals(b) {
+			return a, "", true
+		}
+		return cty.DynamicVal, "", false
+	}
+
+	attrs := map[string]cty.Value{}
+	for it := a.ElementIterator(); it.Next(); {
+		k, av := it.Element()
+		attrs[k.AsString()] = av
+	}
+	for it := b.ElementIterator(); it.Next(); {
+		k, bv := it.Element()
+		name := k.AsString()
+		av, exists := attrs[name]
+		if !exists || av.IsNull() {
+			attrs[name] = bv
+			continue
+		}
+		if bv.IsNull() {
+			continue
+		}
+		merged, path, ok := mergeMetadata(av, bv)
+		if !ok {
+			if path != "" {
+				return cty.DynamicVal, name + "." + path, false
+			}
+			return cty.DynamicVal, name, false
+		}
+		attrs[name] = merged
+	}
+	return cty.ObjectVal(attrs), "", true
+}
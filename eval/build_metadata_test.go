@@ -0,0 +1,165 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestBuildMetadata(t *testing.T) {
+	tests := map[string]struct {
+		Root    string
+		Child   string
+		Want    map[string]cty.Value
+		Sources map[string]string // module path of the source of each field
+		Detail  string            // part of the detail of the only diagnostic, if any
+	}{
+		"distinct keys": {
+			`Owner = "platform"`,
+			`Team = "storage"`,
+			map[string]cty.Value{
+				"Owner": cty.StringVal("platform"),
+				"Team":  cty.StringVal("storage"),
+			},
+			map[string]string{
+				"Owner": "",
+				"Team":  ".child",
+			},
+			"",
+		},
+		"equal values": {
+			`Owner = "platform"`,
+			`Owner = "platform"`,
+			map[string]cty.Value{
+				"Owner": cty.StringVal("platform"),
+			},
+			map[string]string{
+				"Owner": "",
+			},
+			"",
+		},
+		"merged objects": {
+			`
+Tools = {
+  Linter = { Version = "1" }
+  Deploy = { Region = "us-east-1" }
+}
+`,
+			`
+Tools = {
+  Linter = { Strict = true }
+  Tester = { Version = "2" }
+}
+`,
+			map[string]cty.Value{
+				"Tools": cty.ObjectVal(map[string]cty.Value{
+					"Linter": cty.ObjectVal(map[string]cty.Value{
+						"Version": cty.StringVal("1"),
+						"Strict":  cty.True,
+					}),
+					"Deploy": cty.ObjectVal(map[string]cty.Value{
+						"Region": cty.StringVal("us-east-1"),
+					}),
+					"Tester": cty.ObjectVal(map[string]cty.Value{
+						"Version": cty.StringVal("2"),
+					}),
+				}),
+			},
+			nil,
+			"",
+		},
+		"null attribute": {
+			`Tools = { Linter = null }`,
+			`Tools = { Linter = "strict" }`,
+			map[string]cty.Value{
+				"Tools": cty.ObjectVal(map[string]cty.Value{
+					"Linter": cty.StringVal("strict"),
+				}),
+			},
+			nil,
+			"",
+		},
+		"conflicting values": {
+			`Owner = "platform"`,
+			`Owner = "storage"`,
+			nil,
+			nil,
+			`Module .child sets a value for the metadata field "Owner" that conflicts with the one set at `,
+		},
+		"conflicting object and string": {
+			`Tools = { Linter = "strict" }`,
+			`Tools = "none"`,
+			nil,
+			nil,
+			`Module .child sets a value for the metadata field "Tools" that conflicts`,
+		},
+		"conflicting nested values": {
+			`Tools = { Deploy = { Region = "us-east-1" } }`,
+			`Tools = { Deploy = { Region = "eu-west-1" } }`,
+			nil,
+			nil,
+			`Module .child sets a value for the attribute Deploy.Region of metadata field "Tools" that conflicts`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{
+				"main.awsup": `
+Metadata {
+` + test.Root + `
+}
+
+Module "child" {
+  Source = "./child"
+}
+`,
+				"child/main.awsup": `
+Metadata {
+` + test.Child + `
+}
+`,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+			}
+			template, diags := ctx.Build()
+
+			if test.Detail != "" {
+				if len(diags) != 1 {
+					t.Fatalf("wrong number of diagnostics %d; want 1\n%s", len(diags), diags.Error())
+				}
+				if got, want := diags[0].Summary, "Conflicting metadata"; got != want {
+					t.Errorf("wrong summary\ngot:  %s\nwant: %s", got, want)
+				}
+				if !strings.Contains(diags[0].Detail, test.Detail) {
+					t.Errorf("wrong detail\ngot:  %s\nwant: …%s…", diags[0].Detail, test.Detail)
+				}
+				if got, want := diags[0].Subject.Filename, "child/main.awsup"; !strings.HasSuffix(got, want) {
+					t.Errorf("wrong subject\ngot:  %s\nwant: …%s", got, want)
+				}
+				return
+			}
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics: %s", diags.Error())
+			}
+
+			if len(template.Metadata) != len(test.Want) {
+				t.Errorf("wrong number of metadata fields %d; want %d", len(template.Metadata), len(test.Want))
+			}
+			// Each field is attributed to the first module that set it.
+			for key, want := range test.Sources {
+				if got := template.MetadataSources[key].Addr.Module.String(); got != want {
+					t.Errorf("wrong source module for %s\ngot:  %q\nwant: %q", key, got, want)
+				}
+			}
+			for key, want := range test.Want {
+				got := template.Metadata[key]
+				if got == cty.NilVal || !got.RawEquals(want) {
+					t.Errorf("wrong value for %s\ngot:  %#v\nwant: %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// maxLogicalValues is the largest number of conditions that CloudFormation
+// accepts in a single Fn::And or Fn::Or.
+const maxLogicalValues = 10
+
+// buildOutputs adds the outputs declared in the recieving module, which must
+// be the root module, to the given template.
+//
+// The resources of all modules must already have been added to the template,
+// so that outputs can take the conditions of the resources they refer to.
+func (mctx *ModuleContext) buildOutputs(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for name, output := range mctx.Config.Outputs {
+		if !addr.ValidName(name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid output name",
+				Detail:   "Output names may contain only alphanumeric characters.",
+				Subject:  &output.DeclRange,
+			})
+		}
+
+		flat := &FlatOutput{
+			DeclRange: output.DeclRange,
+		}
+		flat.Description = evalConstantStringWithDiags(mctx, output.Description, &diags)
+		flat.Value = evalDynamicWithDiags(mctx, output.Value, NoEachState, &diags)
+		if output.Export != nil {
+			flat.ExportName = evalDynamicWithDiags(mctx, output.Export.Name, NoEachState, &diags)
+		}
+
+		var condDiags hcl.Diagnostics
+		flat.Condition, condDiags = mctx.outputCondition(name, flat, ret)
+		diags = append(diags, condDiags...)
+
+		ret.Outputs[name] = flat
+	}
+
+	return diags
+}
+
+// outputCondition returns the name of the condition that decides whether
+// the given output is produced, or an empty string if it is always produced.
+//
+// If the output sets the Condition argument then it is used, hoisting it into
+// a new named condition if necessary, and references to resources that have
+// some other condition produce warnings. Otherwise, the output takes the
+// conditions of the conditional resources it refers to, so that it is not
+// produced when they are not created. If there are several such conditions,
+// a new condition is added that requires all of them.
+func (mctx *ModuleContext) outputCondition(name string, flat *FlatOutput, ret *FlatTemplate) (string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	output := mctx.Config.Outputs[name]
+	condName := name + "OutputCondition"
+
+	refs := map[string]hcl.Range{}
+	var targets []*FlatResource
+	for _, expr := range []DynExpr{flat.Value, flat.ExportName} {
+		conditionalReferences(expr, ret, func(target *FlatResource, rng hcl.Range) {
+			if _, exists := refs[target.Condition]; !exists {
+				refs[target.Condition] = rng
+				targets = append(targets, target)
+			}
+		})
+	}
+
+	if val, valDiags := output.Condition.Value(nil); valDiags.HasErrors() || !val.IsNull() {
+		cond := evalDynamicWithDiags(mctx, output.Condition, NoEachState, &diags)
+		if diags.HasErrors() {
+			return "", diags
+		}
+
+		explicit := ""
+		if ref, isRef := cond.(*DynConditionRef); isRef {
+			explicit = ref.ConditionName
+		} else {
+			var hoistDiags hcl.Diagnostics
+			explicit, hoistDiags = hoistOutputCondition(name, condName, conditionExpr(cond), output.Condition.Range(), ret)
+			diags = append(diags, hoistDiags...)
+		}
+
+		for _, target := range targets {
+			if target.Condition == explicit {
+				continue
+			}
+			rng := refs[target.Condition]
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Reference to conditional resource",
+				Detail: fmt.Sprintf(
+					"Output %q refers to resource %s, which is created only when the condition %q is true, but the output has a different condition. Unless the reference is used only when that condition is true, the template will be invalid when it is false.",
+					name, target.Addr, target.Condition,
+				),
+				Subject: &rng,
+			})
+		}
+		return explicit, diags
+	}
+
+	switch len(refs) {
+	case 0:
+		return "", diags
+	case 1:
+		return targets[0].Condition, diags
+	}
+
+	names := make([]string, 0, len(refs))
+	for cond := range refs {
+		names = append(names, cond)
+	}
+	sort.Strings(names)
+	return hoistOutputCondition(name, condName, allConditions(names, output.DeclRange), output.DeclRange, ret)
+}
+
+// hoistOutputCondition adds the given condition to the given template under
+// the given name, returning that name, or returns an error if there is
+// already a condition of that name.
+func hoistOutputCondition(outputName, condName string, cond DynExpr, rng hcl.Range, ret *FlatTemplate) (string, hcl.Diagnostics) {
+	if _, exists := ret.Conditions[condName]; exists {
+		return "", hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Conflicting condition name",
+				Detail: fmt.Sprintf(
+					"The condition for output %q must be given the name %q in the template, but a condition of that name already exists. Rename that condition, or declare the output's condition in the Conditions block and refer to it by name.",
+					outputName, condName,
+				),
+				Subject: &rng,
+			},
+		}
+	}
+	ret.Conditions[condName] = cond
+	ret.ConditionSources[condName] = FlatSource{
+		Addr:      addr.NameInModule{Module: addr.RootModulePath, Name: outputName},
+		DeclRange: rng,
+	}
+	return condName, nil
+}
+
+// allConditions returns a condition expression that is true only if all of
+// the named conditions are true.
+func allConditions(names []string, rng hcl.Range) DynExpr {
+	values := make([]DynExpr, len(names))
+	for i, name := range names {
+		values[i] = &DynConditionRef{
+			ConditionName: name,
+			SrcRange:      rng,
+		}
+	}
+	return allValues(values, rng)
+}
+
+// allValues returns an Fn::And of the given condition expressions, nesting
+// them as necessary to stay within the limit on the number of conditions
+// that a single Fn::And may test.
+func allValues(values []DynExpr, rng hcl.Range) DynExpr {
+	if len(values) > maxLogicalValues {
+		rest := allValues(values[maxLogicalValues-1:], rng)
+		values = append(values[:maxLogicalValues-1:maxLogicalValues-1], rest)
+	}
+	return &DynLogical{
+		Op:       DynLogicalAnd,
+		Values:   values,
+		SrcRange: rng,
+	}
+}
@@ -0,0 +1,175 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestOutputConditions(t *testing.T) {
+	resources := `
+Parameter "Env" {
+  Type = "String"
+}
+
+Conditions {
+  IsProd               = Param.Env == "prod"
+  IsEast               = AWS.Region == "us-east-1"
+  ClashOutputCondition = Param.Env == "clash"
+}
+
+Resource "Store" {
+  Type      = "AWS::S3::Bucket"
+  Condition = Condition.IsProd
+}
+
+Resource "Queue" {
+  Type      = "AWS::SQS::Queue"
+  Condition = Condition.IsEast
+}
+
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+}
+`
+
+	tests := map[string]struct {
+		Output    string
+		Condition string
+		All       []string // conditions required by a hoisted condition
+		Want      []string
+	}{
+		"unconditional": {
+			`
+Output "Name" {
+  Value = Resource.Topic
+}
+`,
+			"",
+			nil,
+			nil,
+		},
+		"explicit": {
+			`
+Output "Name" {
+  Condition = Condition.IsProd
+  Value     = Resource.Store.Arn
+}
+`,
+			"IsProd",
+			nil,
+			nil,
+		},
+		"explicit inline": {
+			`
+Output "Name" {
+  Condition = Param.Env != "dev"
+  Value     = Resource.Topic
+}
+`,
+			"NameOutputCondition",
+			nil,
+			nil,
+		},
+		"explicit with other condition": {
+			`
+Output "Name" {
+  Condition = Condition.IsEast
+  Value     = Resource.Store.Arn
+}
+`,
+			"IsEast",
+			nil,
+			[]string{"Reference to conditional resource"},
+		},
+		"inferred": {
+			`
+Output "Name" {
+  Value = Resource.Store.Arn
+}
+`,
+			"IsProd",
+			nil,
+			nil,
+		},
+		"inferred from export": {
+			`
+Output "Name" {
+  Value = Resource.Topic
+  Export {
+    Name = Resource.Queue.QueueName
+  }
+}
+`,
+			"IsEast",
+			nil,
+			nil,
+		},
+		"inferred from several": {
+			`
+Output "Name" {
+  Value = join(",", [Resource.Store.Arn, Resource.Queue.Arn, Resource.Store.DomainName])
+}
+`,
+			"NameOutputCondition",
+			[]string{"IsEast", "IsProd"},
+			nil,
+		},
+		"conflicting name": {
+			`
+Output "Clash" {
+  Value = join(",", [Resource.Store.Arn, Resource.Queue.Arn])
+}
+`,
+			"",
+			nil,
+			[]string{"Conflicting condition name"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{
+				"main.awsup": resources + test.Output,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+			}
+			template, diags := ctx.Build()
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary)
+			}
+			if !equalStrings(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+			if diags.HasErrors() {
+				return
+			}
+
+			var output *FlatOutput
+			for _, o := range template.Outputs {
+				output = o
+			}
+			if got, want := output.Condition, test.Condition; got != want {
+				t.Fatalf("wrong condition\ngot:  %q\nwant: %q", got, want)
+			}
+			if test.All == nil {
+				return
+			}
+
+			and, ok := template.Conditions[output.Condition].(*DynLogical)
+			if !ok || and.Op != DynLogicalAnd {
+				t.Fatalf("wrong hoisted condition %#v", template.Conditions[output.Condition])
+			}
+			var all []string
+			for _, v := range and.Values {
+				if ref, ok := v.(*DynConditionRef); ok {
+					all = append(all, ref.ConditionName)
+				}
+			}
+			if !equalStrings(all, test.All) {
+				t.Errorf("wrong conditions in hoisted condition\ngot:  %q\nwant: %q", all, test.All)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// buildResources adds flattened versions of all of the resource instances in
+// the recieving module to the given template.
+func (mctx *ModuleContext) buildResources(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	// Resources and their instances are visited in a stable order, so that
+	// it's always the same declaration that is reported as a duplicate when
+	// two of them have the same logical id.
+	names := make([]string, 0, len(mctx.Resources))
+	for name := range mctx.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		each := mctx.Resources[name]
+		rcfg := mctx.Config.Resources[name]
+		if !addr.ValidName(name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid resource name",
+				Detail:   "Resource names may contain only alphanumeric characters.",
+				Subject:  &rcfg.DeclRange,
+			})
+		}
+		diags = append(diags, mctx.checkResourceSchema(rcfg)...)
+		customDecl := mctx.Global.CustomResourceTypes[rcfg.Type]
+
+		keys := make([]addr.EachIndex, 0, len(each.Instances))
+		for key := range each.Instances {
+			keys = append(keys, key)
+		}
+		sortEachIndexes(keys)
+
+		for _, key := range keys {
+			inst := each.Instances[key]
+			if inst.Disabled {
+				continue
+			}
+
+			flat := &FlatResource{
+				Type:       rcfg.Type,
+				Properties: map[string]DynExpr{},
+				Metadata:   map[string]DynExpr{},
+				Addr:       inst.Addr,
+				DeclRange:  rcfg.DeclRange,
+			}
+			flat.Schema, _ = mctx.Global.Schema.LookupResourceType(rcfg.Type)
+
+			for propName, attr := range rcfg.Properties {
+				flat.Properties[propName] = evalDynamicWithDiags(mctx, attr.Expr, inst.Each, &diags)
+				if customDecl != nil {
+					diags = append(diags, mctx.checkCustomProperty(customDecl, propName, attr.Expr, inst.Each)...)
+				}
+			}
+
+			for key, attr := range rcfg.Metadata {
+				flat.Metadata[key] = evalDynamicWithDiags(mctx, attr.Expr, inst.Each, &diags)
+			}
+
+			var condDiags hcl.Diagnostics
+			flat.Condition, condDiags = mctx.resourceCondition(inst, ret)
+			diags = append(diags, condDiags...)
+			if flat.Condition != "" {
+				flat.ConditionRange = rcfg.Condition.Range()
+			}
+
+			flat.DeletionPolicy = mctx.resourcePolicy(rcfg, "DeletionPolicy", rcfg.DeletionPolicy, deletionPolicies, inst.Each, &diags)
+			flat.UpdateReplacePolicy = mctx.resourcePolicy(rcfg, "UpdateReplacePolicy", rcfg.UpdateReplacePolicy, updateReplacePolicies, inst.Each, &diags)
+
+			var policyDiags hcl.Diagnostics
+			flat.CreationPolicy, policyDiags = mctx.buildCreationPolicy(rcfg, inst.Each)
+			diags = append(diags, policyDiags...)
+			flat.UpdatePolicy, policyDiags = mctx.buildUpdatePolicy(rcfg, inst.Each)
+			diags = append(diags, policyDiags...)
+
+			for _, traversal := range rcfg.DependsOn {
+				dep, depDiags := mctx.resourceInstanceForTraversal(traversal)
+				diags = append(diags, depDiags...)
+				if dep == nil {
+					continue
+				}
+				flat.DependsOn = append(flat.DependsOn, dep.LogicalID)
+				flat.DependsOnRanges = append(flat.DependsOnRanges, traversal.SourceRange())
+			}
+
+			if existing, exists := ret.Resources[inst.LogicalID]; exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate logical id",
+					Detail: fmt.Sprintf(
+						"Resource %s has the logical id %q, which is already used by resource %s declared at %s. Each resource in the flattened module tree must have a distinct logical id.",
+						inst.Addr, inst.LogicalID, existing.Addr, existing.DeclRange,
+					),
+					Subject: logicalIDSubject(rcfg),
+				})
+				continue
+			}
+			if existing, exists := ret.Parameters[inst.LogicalID]; exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate logical id",
+					Detail: fmt.Sprintf(
+						"Resource %s has the logical id %q, which is already used by the parameter declared at %s.",
+						inst.Addr, inst.LogicalID, existing.DeclRange,
+					),
+					Subject: logicalIDSubject(rcfg),
+				})
+				continue
+			}
+
+			ret.Resources[inst.LogicalID] = flat
+		}
+	}
+
+	return diags
+}
+
+// resourceCondition evaluates the Condition argument for the given resource
+// instance, returning the name of the condition that decides whether the
+// instance is created or an empty string if the argument is not set.
+//
+// CloudFormation requires resource conditions to be named, so any expression
+// other than a direct reference to a named condition is hoisted into a new
+// condition named after the instance, which is added to the given template.
+func (mctx *ModuleContext) resourceCondition(inst *ResourceInstance, ret *FlatTemplate) (string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	expr := inst.Config.Condition
+	if val, valDiags := expr.Value(nil); !valDiags.HasErrors() && val.IsNull() {
+		return "", diags
+	}
+
+	cond := evalDynamicWithDiags(mctx, expr, inst.Each, &diags)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	if ref, isRef := cond.(*DynConditionRef); isRef {
+		return ref.ConditionName, diags
+	}
+
+	name := addr.NameInModule{
+		Module: inst.Addr.Module,
+		Name:   inst.Addr.Name + "Condition",
+		Key:    inst.Addr.Key,
+	}.ID()
+	if _, exists := ret.Conditions[name]; exists {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting condition name",
+			Detail: fmt.Sprintf(
+				"The condition for resource %s must be given the name %q in the template, but a condition of that name already exists. Rename that condition, or declare this one in the Conditions block and refer to it by name.",
+				inst.Addr, name,
+			),
+			Subject: expr.Range().Ptr(),
+		})
+		return "", diags
+	}
+	ret.Conditions[name] = conditionExpr(cond)
+	ret.ConditionSources[name] = FlatSource{
+		Addr:      inst.Addr,
+		DeclRange: expr.Range(),
+	}
+	return name, diags
+}
+
+// checkConditionalReferences produces warnings for unconditional resources
+// in the given template that refer to conditional ones.
+//
+// When the condition of the referenced resource is false, CloudFormation
+// rejects the template because the reference cannot be resolved, so such
+// references are usually mistakes unless they are guarded by an Fn::If that
+// tests the same condition.
+func checkConditionalReferences(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	// We visit everything in a consistent order so that the warnings are
+	// always reported in the same order.
+	logicalIDs := make([]string, 0, len(ret.Resources))
+	for logicalID := range ret.Resources {
+		logicalIDs = append(logicalIDs, logicalID)
+	}
+	sort.Strings(logicalIDs)
+
+	for _, logicalID := range logicalIDs {
+		flat := ret.Resources[logicalID]
+		if flat.Condition != "" {
+			continue
+		}
+
+		check := func(target *FlatResource, rng hcl.Range) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Reference to conditional resource",
+				Detail: fmt.Sprintf(
+					"Resource %s is always created, but refers to resource %s, which is created only when the condition %q is true. Unless the reference is used only when that condition is true, the template will be invalid when it is false.",
+					flat.Addr, target.Addr, target.Condition,
+				),
+				Subject: &rng,
+			})
+		}
+
+		var exprs []DynExpr
+		for _, name := range sortedDynExprKeys(flat.Properties) {
+			exprs = append(exprs, flat.Properties[name])
+		}
+		for _, name := range sortedDynExprKeys(flat.Metadata) {
+			exprs = append(exprs, flat.Metadata[name])
+		}
+		exprs = append(exprs, flat.CreationPolicy, flat.UpdatePolicy)
+		for _, expr := range exprs {
+			conditionalReferences(expr, ret, check)
+		}
+		for i, dep := range flat.DependsOn {
+			if target, exists := ret.Resources[dep]; exists && target.Condition != "" {
+				check(target, flat.DependsOnRanges[i])
+			}
+		}
+	}
+
+	return diags
+}
+
+// sortedDynExprKeys returns the keys of the given map in lexicographical
+// order.
+func sortedDynExprKeys(m map[string]DynExpr) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// conditionalReferences calls the given function for each reference in the
+// given expression to a conditional resource in the given template.
+//
+// References within the true result of an Fn::If are skipped if the Fn::If
+// tests the same condition as the referenced resource, since they are
+// resolved only when that resource exists.
+func conditionalReferences(expr DynExpr, ret *FlatTemplate, cb func(target *FlatResource, rng hcl.Range)) {
+	var visit func(expr DynExpr, guards map[string]bool)
+	visit = func(expr DynExpr, guards map[string]bool) {
+		walkDynExpr(expr, func(expr DynExpr) bool {
+			var logicalID string
+			var rng hcl.Range
+			switch te := expr.(type) {
+			case *DynIf:
+				inner := map[string]bool{te.ConditionName: true}
+				for name := range guards {
+					inner[name] = true
+				}
+				visit(te.If, inner)
+				visit(te.Else, guards)
+				return false
+			case *DynRef:
+				logicalID, rng = te.LogicalID, te.SrcRange
+			case *DynGetAttr:
+				logicalID, rng = te.LogicalID, te.SrcRange
+			default:
+				return true
+			}
+			target, exists := ret.Resources[logicalID]
+			if exists && target.Condition != "" && !guards[target.Condition] {
+				cb(target, rng)
+			}
+			return true
+		})
+	}
+	visit(expr, nil)
+}
+
+// logicalIDSubject returns the range to use as the subject of diagnostics
+// about the logical id of the given resource, which is the LogicalId
+// argument when it is set or the resource block header otherwise.
+func logicalIDSubject(rcfg *config.Resource) *hcl.Range {
+	if val, diags := rcfg.ExplicitLogicalID.Value(nil); diags.HasErrors() || !val.IsNull() {
+		return rcfg.ExplicitLogicalID.Range().Ptr()
+	}
+	return &rcfg.DeclRange
+}
+
+// checkResourceSchema verifies that the given resource configuration uses
+// a resource type that is known to the schema and that the properties it
+// sets are consistent with that resource type.
+func (mctx *ModuleContext) checkResourceSchema(rcfg *config.Resource) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	rsch, exists := mctx.Global.Schema.LookupResourceType(rcfg.Type)
+	if !exists {
+		detail := fmt.Sprintf("There is no resource type named %q.", rcfg.Type)
+		if strings.HasPrefix(rcfg.Type, "AWS::Serverless::") {
+			detail = fmt.Sprintf("There is no resource type named %q. The AWS SAM resource types are available only when the transform %q is declared.", rcfg.Type, schema.ServerlessTransform)
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported resource type",
+			Detail:   detail,
+			Subject:  &rcfg.DeclRange,
+		})
+		return diags
+	}
+
+	for name, attr := range rcfg.Properties {
+		if _, exists := rsch.Properties[name]; !exists && !rsch.AdditionalProperties {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported property",
+				Detail:   fmt.Sprintf("Resource type %s does not have a property named %q.", rcfg.Type, name),
+				Subject:  &attr.NameRange,
+			})
+		}
+	}
+
+	for name, prop := range rsch.Properties {
+		if !prop.Required {
+			continue
+		}
+		if _, isSet := rcfg.Properties[name]; !isSet {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing required property",
+				Detail:   fmt.Sprintf("Resource type %s requires a value for the property %q.", rcfg.Type, name),
+				Subject:  &rcfg.DeclRange,
+			})
+		}
+	}
+
+	return diags
+}
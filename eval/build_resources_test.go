@@ -0,0 +1,295 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCheckConditionalReferences(t *testing.T) {
+	ctx, diags := testRootContext(t, map[string]string{
+		"main.awsup": `
+Parameter "Env" {
+  Type = "String"
+}
+
+Conditions {
+  IsProd = Param.Env == "prod"
+}
+
+Resource "Store" {
+  Type      = "AWS::S3::Bucket"
+  Condition = Condition.IsProd
+}
+
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  DependsOn = [
+    Resource.Store,
+  ]
+  Properties {
+    TopicName   = Resource.Store
+    DisplayName = Resource.Store.Arn
+  }
+}
+
+Resource "Another" {
+  Type = "AWS::SNS::Topic"
+  Properties {
+    TopicName = Condition.IsProd ? Resource.Store.Arn : AWS.NoValue
+  }
+  Metadata {
+    Store = Resource.Store
+  }
+}
+
+Resource "Guarded" {
+  Type      = "AWS::SNS::Topic"
+  Condition = Condition.IsProd
+  DependsOn = [Resource.Store]
+  Properties {
+    TopicName = Resource.Store
+  }
+}
+`,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+	}
+	_, diags = ctx.Build()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors building template: %s", diags.Error())
+	}
+
+	// The warnings must be in order of logical id and then property name,
+	// and must point at the references themselves.
+	var got []string
+	for _, diag := range diags {
+		got = append(got, fmt.Sprintf("%s at line %d", diag.Summary, diag.Subject.Start.Line))
+	}
+	want := []string{
+		"Reference to conditional resource at line 32",
+		"Reference to conditional resource at line 22",
+		"Reference to conditional resource at line 21",
+		"Reference to conditional resource at line 18",
+	}
+	if !equalStrings(got, want) {
+		t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestResourceConditions(t *testing.T) {
+	tests := map[string]struct {
+		Config     string
+		Conditions map[string]string // logical id to condition name
+		Want       []string
+	}{
+		"named": {
+			`
+Resource "Store" {
+  Type      = "AWS::S3::Bucket"
+  Condition = Condition.IsProd
+}
+`,
+			map[string]string{"Store": "IsProd"},
+			nil,
+		},
+		"inline": {
+			`
+Resource "Store" {
+  Type      = "AWS::S3::Bucket"
+  Condition = Param.Env != "dev"
+}
+`,
+			map[string]string{"Store": "StoreCondition"},
+			nil,
+		},
+		"conflicting name": {
+			`
+Resource "Clash" {
+  Type      = "AWS::S3::Bucket"
+  Condition = Param.Env != "dev"
+}
+`,
+			nil,
+			[]string{"Conflicting condition name"},
+		},
+		"disabled": {
+			`
+Resource "Store" {
+  Type    = "AWS::S3::Bucket"
+  Enabled = false
+}
+
+Resource "Topic" {
+  Type    = "AWS::SNS::Topic"
+  Enabled = Param.Env == "dev"
+}
+`,
+			map[string]string{},
+			[]string{"Illegal use of non-constant value"},
+		},
+		"reference to disabled": {
+			`
+Resource "Store" {
+  Type    = "AWS::S3::Bucket"
+  Enabled = false
+}
+
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+  Properties {
+    TopicName = Resource.Store
+  }
+}
+`,
+			nil,
+			[]string{"Reference to disabled resource"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{
+				"main.awsup": `
+Parameter "Env" {
+  Type = "String"
+}
+
+Conditions {
+  IsProd         = Param.Env == "prod"
+  ClashCondition = Param.Env == "clash"
+}
+` + test.Config,
+			})
+			if !diags.HasErrors() {
+				template, buildDiags := ctx.Build()
+				diags = append(diags, buildDiags...)
+				if !buildDiags.HasErrors() {
+					got := map[string]string{}
+					for id, resource := range template.Resources {
+						got[id] = resource.Condition
+					}
+					if fmt.Sprint(got) != fmt.Sprint(test.Conditions) {
+						t.Errorf("wrong resource conditions\ngot:  %v\nwant: %v", got, test.Conditions)
+					}
+					for _, cond := range got {
+						if _, exists := template.Conditions[cond]; !exists {
+							t.Errorf("no condition named %q in the template", cond)
+						}
+					}
+				}
+			}
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary)
+			}
+			if !equalStrings(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestResourceConditionsInChildModule(t *testing.T) {
+	ctx, diags := testRootContext(t, map[string]string{
+		"main.awsup": `
+Module "child" {
+  Source = "./child"
+}
+
+Resource "Store" {
+  Type      = "AWS::S3::Bucket"
+  Condition = AWS.Region == "us-east-1"
+}
+`,
+		"child/main.awsup": `
+Conditions {
+  StoreCondition = AWS.Region == "eu-west-1"
+}
+
+Resource "Store" {
+  Type      = "AWS::S3::Bucket"
+  Condition = AWS.Region != "eu-west-1"
+}
+`,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+	}
+	template, diags := ctx.Build()
+
+	// The child's declared condition must be reported as conflicting with
+	// the one hoisted from its resource, rather than being replaced by it.
+	var got []string
+	for _, diag := range diags {
+		got = append(got, diag.Summary)
+	}
+	if want := []string{"Conflicting condition name"}; !equalStrings(got, want) {
+		t.Fatalf("wrong diagnostics\ngot:  %q\nwant: %q", got, want)
+	}
+
+	for id, source := range template.ConditionSources {
+		if source.Addr.Module.IsRoot() {
+			continue
+		}
+		if got, want := source.DeclRange.Start.Line, 3; got != want {
+			t.Errorf("condition %s comes from line %d; want %d", id, got, want)
+		}
+	}
+	if got, want := template.Resources["Store"].Condition, "StoreCondition"; got != want {
+		t.Errorf("wrong condition for Store\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestDuplicateLogicalIDsStable(t *testing.T) {
+	files := map[string]string{
+		"main.awsup": `
+Resource "C" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "Shared"
+}
+
+Resource "B" {
+  Type      = "AWS::SNS::Topic"
+  ForEach   = ["x", "y", "z"]
+  LogicalId = "Shared"
+}
+
+Resource "A" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "Shared"
+}
+`,
+	}
+
+	// The first declaration in order of name and then key keeps the logical
+	// id, and the others are reported as duplicates of it. Map iteration
+	// order varies, so we build several times to be sure of that.
+	want := []string{
+		`Resource B[0] has the logical id "Shared", which is already used by resource A declared at %s. Each resource in the flattened module tree must have a distinct logical id.`,
+		`Resource B[1] has the logical id "Shared", which is already used by resource A declared at %s. Each resource in the flattened module tree must have a distinct logical id.`,
+		`Resource B[2] has the logical id "Shared", which is already used by resource A declared at %s. Each resource in the flattened module tree must have a distinct logical id.`,
+		`Resource C has the logical id "Shared", which is already used by resource A declared at %s. Each resource in the flattened module tree must have a distinct logical id.`,
+	}
+	for i := 0; i < 10; i++ {
+		ctx, diags := testRootContext(t, files)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+		}
+		_, diags = ctx.Build()
+
+		declRange := ctx.RootModule.Config.Resources["A"].DeclRange
+		var got []string
+		for _, diag := range diags {
+			got = append(got, diag.Detail)
+		}
+		var wantDetails []string
+		for _, w := range want {
+			wantDetails = append(wantDetails, fmt.Sprintf(w, declRange))
+		}
+		if !equalStrings(got, wantDetails) {
+			t.Fatalf("wrong diagnostics on build %d\ngot:  %q\nwant: %q", i, got, wantDetails)
+		}
+	}
+}
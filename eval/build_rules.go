@@ -0,0 +1,196 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// buildRules adds the rules declared in the recieving module to the given
+// template.
+//
+// Rules are checked before CloudFormation creates or updates anything, so
+// they may refer only to parameters. The parameters of the template must
+// already have been added to the given template.
+func (mctx *ModuleContext) buildRules(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for name, rule := range mctx.Config.Rules {
+		if !addr.ValidName(name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid rule name",
+				Detail:   "Rule names may contain only alphanumeric characters.",
+				Subject:  &rule.DeclRange,
+			})
+		}
+
+		flat := &FlatRule{
+			Addr: addr.NameInModule{
+				Module: mctx.Path,
+				Name:   name,
+			},
+			DeclRange: rule.DeclRange,
+		}
+
+		if val, valDiags := rule.Condition.Value(nil); valDiags.HasErrors() || !val.IsNull() {
+			var condDiags hcl.Diagnostics
+			flat.Condition, condDiags = mctx.EvalDynamic(rule.Condition, NoEachState)
+			diags = append(diags, condDiags...)
+			if !condDiags.HasErrors() {
+				diags = append(diags, checkRuleExpr(flat.Condition, ret)...)
+			}
+		}
+
+		for _, assertion := range rule.Assertions {
+			assert, assertDiags := mctx.EvalDynamic(assertion.Assert, NoEachState)
+			diags = append(diags, assertDiags...)
+			if !assertDiags.HasErrors() {
+				diags = append(diags, checkRuleExpr(assert, ret)...)
+			}
+			flat.Assertions = append(flat.Assertions, &FlatRuleAssertion{
+				Assert:      assert,
+				Description: evalConstantStringWithDiags(mctx, assertion.Description, &diags),
+			})
+		}
+
+		ret.Rules[moduleObjectID(mctx.Path, name)] = flat
+	}
+
+	return diags
+}
+
+// checkRuleExpr verifies that the given expression, which is the condition
+// or an assertion of a rule, uses only the subset of the CloudFormation
+// language that is supported in rules.
+func checkRuleExpr(expr DynExpr, ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	switch expr.(type) {
+	case *DynEquals, *DynLogical, *DynNot, *DynContains, *DynEachMemberEquals, *DynEachMemberIn:
+	default:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid rule expression",
+			Detail:   "The condition and assertions of a rule must each be a comparison, a logical operation, or a call to one of the functions contains, each_member_equals or each_member_in.",
+			Subject:  expr.SourceRange().Ptr(),
+		})
+		return diags
+	}
+
+	walkDynExpr(expr, func(expr DynExpr) bool {
+		rng := expr.SourceRange()
+		switch te := expr.(type) {
+		case *DynLiteral, *DynList, *DynEquals, *DynLogical, *DynNot:
+		case *DynContains, *DynEachMemberEquals, *DynEachMemberIn, *DynRefAll:
+		case *DynRef:
+			if !isRuleReference(te.LogicalID, ret) {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid reference in rule",
+					Detail:   "Rules can refer only to parameters, because CloudFormation checks them before creating any resources.",
+					Subject:  &rng,
+				})
+			}
+		case *DynValueOf:
+			if _, exists := ret.Parameters[te.ParameterName]; !exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid function argument",
+					Detail:   "The first argument to value_of must be a reference to a parameter, such as Param.VpcId.",
+					Subject:  &rng,
+				})
+			}
+		default:
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported expression in rule",
+				Detail:   "CloudFormation supports only parameter references, comparisons, logical operators and the rule functions in rules.",
+				Subject:  &rng,
+			})
+			return false
+		}
+		return true
+	})
+
+	return diags
+}
+
+// isRuleReference returns true if the given logical id may be referenced
+// in a rule, which is the case only for parameters and pseudo parameters.
+func isRuleReference(logicalID string, ret *FlatTemplate) bool {
+	if _, isParam := ret.Parameters[logicalID]; isParam {
+		return true
+	}
+	return strings.HasPrefix(logicalID, "AWS::")
+}
+
+// checkRuleOnlyFunctions returns an error for each call to a function that
+// CloudFormation supports only in rules that appears anywhere else in the
+// given template.
+func checkRuleOnlyFunctions(ret *FlatTemplate) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	// We visit everything in a consistent order so that the errors are
+	// always reported in the same order.
+	var exprs []DynExpr
+	for _, name := range sortedDynExprKeys(ret.Conditions) {
+		exprs = append(exprs, ret.Conditions[name])
+	}
+	logicalIDs := make([]string, 0, len(ret.Resources))
+	for logicalID := range ret.Resources {
+		logicalIDs = append(logicalIDs, logicalID)
+	}
+	sort.Strings(logicalIDs)
+	for _, logicalID := range logicalIDs {
+		flat := ret.Resources[logicalID]
+		for _, name := range sortedDynExprKeys(flat.Properties) {
+			exprs = append(exprs, flat.Properties[name])
+		}
+		for _, name := range sortedDynExprKeys(flat.Metadata) {
+			exprs = append(exprs, flat.Metadata[name])
+		}
+		exprs = append(exprs, flat.CreationPolicy, flat.UpdatePolicy)
+	}
+	outputNames := make([]string, 0, len(ret.Outputs))
+	for name := range ret.Outputs {
+		outputNames = append(outputNames, name)
+	}
+	sort.Strings(outputNames)
+	for _, name := range outputNames {
+		flat := ret.Outputs[name]
+		exprs = append(exprs, flat.Value, flat.ExportName)
+	}
+
+	for _, expr := range exprs {
+		walkDynExpr(expr, func(expr DynExpr) bool {
+			var name string
+			switch expr.(type) {
+			case *DynContains:
+				name = "contains"
+			case *DynEachMemberEquals:
+				name = "each_member_equals"
+			case *DynEachMemberIn:
+				name = "each_member_in"
+			case *DynValueOf:
+				name = "value_of"
+			case *DynRefAll:
+				name = "ref_all"
+			default:
+				return true
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Rule function outside of rule",
+				Detail:   fmt.Sprintf("The function %q can be used only in the condition and assertions of a rule.", name),
+				Subject:  expr.SourceRange().Ptr(),
+			})
+			return false
+		})
+	}
+
+	return diags
+}
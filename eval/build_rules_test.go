@@ -0,0 +1,142 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCheckRuleOnlyFunctions(t *testing.T) {
+	tests := map[string]struct {
+		Config string
+		Want   []string
+	}{
+		"in rule": {
+			`
+Rule "Subnets" {
+  Condition = contains(["prod", "staging"], Param.Env)
+  Assert {
+    Assert      = each_member_in(value_of(Param.Subnets, "VpcId"), ref_all("AWS::EC2::VPC::Id"))
+    Description = "All subnets must be in one of the account's VPCs."
+  }
+  Assert {
+    Assert = each_member_equals(value_of(Param.Subnets, "VpcId"), Param.Vpc)
+  }
+}
+`,
+			nil,
+		},
+		"contains in condition": {
+			`
+Conditions {
+  IsKnown = contains(["prod", "staging"], Param.Env)
+}
+`,
+			[]string{`Rule function outside of rule: The function "contains" can be used only in the condition and assertions of a rule. (line 19)`},
+		},
+		"value_of in resource property": {
+			`
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+  Properties {
+    TopicName = join("-", value_of(Param.Subnets, "VpcId"))
+  }
+}
+`,
+			[]string{`Rule function outside of rule: The function "value_of" can be used only in the condition and assertions of a rule. (line 21)`},
+		},
+		"ref_all in resource metadata": {
+			`
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+  Metadata {
+    Vpcs = ref_all("AWS::EC2::VPC::Id")
+  }
+}
+`,
+			[]string{`Rule function outside of rule: The function "ref_all" can be used only in the condition and assertions of a rule. (line 21)`},
+		},
+		"each_member_equals in output": {
+			`
+Output "Same" {
+  Value = each_member_equals(Param.Subnets, Param.Vpc)
+}
+`,
+			[]string{`Rule function outside of rule: The function "each_member_equals" can be used only in the condition and assertions of a rule. (line 19)`},
+		},
+		"each_member_in in output export": {
+			`
+Output "Vpc" {
+  Value = Param.Vpc
+  Export {
+    Name = each_member_in(Param.Subnets, [Param.Vpc])
+  }
+}
+`,
+			[]string{`Rule function outside of rule: The function "each_member_in" can be used only in the condition and assertions of a rule. (line 21)`},
+		},
+		"several": {
+			`
+Output "B" {
+  Value = contains(["prod"], Param.Env)
+}
+
+Output "A" {
+  Value = contains(["prod"], Param.Env)
+}
+
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+  Properties {
+    TopicName = contains(["prod"], Param.Env)
+  }
+}
+
+Conditions {
+  IsKnown = contains(["prod"], Param.Env)
+}
+`,
+			[]string{
+				`Rule function outside of rule: The function "contains" can be used only in the condition and assertions of a rule. (line 34)`,
+				`Rule function outside of rule: The function "contains" can be used only in the condition and assertions of a rule. (line 29)`,
+				`Rule function outside of rule: The function "contains" can be used only in the condition and assertions of a rule. (line 23)`,
+				`Rule function outside of rule: The function "contains" can be used only in the condition and assertions of a rule. (line 19)`,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{
+				"main.awsup": `
+Parameter "Env" {
+  Type = "String"
+}
+
+Parameter "Subnets" {
+  Type = "List<AWS::EC2::Subnet::Id>"
+}
+
+Parameter "Vpc" {
+  Type = "AWS::EC2::VPC::Id"
+}
+
+Resource "Queue" {
+  Type = "AWS::SQS::Queue"
+}
+` + test.Config,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+			}
+			_, diags = ctx.Build()
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, fmt.Sprintf("%s: %s (line %d)", diag.Summary, diag.Detail, diag.Subject.Start.Line))
+			}
+			if !equalStrings(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package eval
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/apparentlymart/awsup/addr"
 	"github.com/apparentlymart/awsup/config"
@@ -18,6 +19,18 @@ type RootContext struct {
 	// AWS to describe the available resource types and their properties and
 	// attributes.
 	Schema *schema.Schema
+
+	// Transforms are the names of the transforms that CloudFormation must
+	// apply to the generated template, as declared by any of the modules.
+	// TransformSources records where each of them was first declared.
+	Transforms       []string
+	TransformSources []FlatSource
+
+	// CustomResourceTypes are the custom resource types declared by any of
+	// the modules, keyed by type name. Their properties and attributes are
+	// also described in Schema, but only the declarations here give the
+	// exact types of their properties.
+	CustomResourceTypes map[string]*config.CustomResourceType
 }
 
 // NewRootContext creates a RootContext by loading a module configuration
@@ -35,6 +48,14 @@ func NewRootContext(parser *config.Parser, rootPath string, constants hcl.Attrib
 	}
 	rootModule, diags := newModuleContext(rctx, parser, rootPath, addr.RootModulePath, NoEachState, constants, nil, nil, hcl.Range{})
 	rctx.RootModule = rootModule
+	if diags.HasErrors() {
+		return rctx, diags
+	}
+
+	diags = append(diags, rctx.applyMoves()...)
+	diags = append(diags, rctx.loadTransforms()...)
+	diags = append(diags, rctx.loadSchemas()...)
+	diags = append(diags, rctx.loadCustomResourceTypes()...)
 	return rctx, diags
 }
 
@@ -73,6 +94,19 @@ type ModuleContext struct {
 	// Constants is a map of values of all of the named constants
 	// for the module.
 	Constants map[string]cty.Value
+
+	// CallParameters are the expressions given for the module's parameters
+	// in the Module block that called it, which must be evaluated in the
+	// parent module using CallEach. These are nil for the root module, whose
+	// parameters become parameters of the generated template.
+	CallParameters hcl.Attributes
+	CallEach       EachState
+
+	// Resources contains the instances of each of the resources declared
+	// in the module, keyed by the resource name given in configuration.
+	// Since a single Resource block can fan out to many instances with
+	// ForEach, the instances are accessed through a ResourceEach.
+	Resources map[string]*ResourceEach
 }
 
 func (mctx *ModuleContext) IsRootModule() bool {
@@ -87,14 +121,41 @@ func (mctx *ModuleContext) VisitModules(cb ModuleVisitor) {
 	mctx.VisitDownstreamModules(cb)
 }
 
+// VisitDownstreamModules calls the given visitor for each of the descendents
+// of the receiving module, in a stable order.
 func (mctx *ModuleContext) VisitDownstreamModules(cb ModuleVisitor) {
-	for _, eacher := range mctx.Children {
-		for _, childCtx := range eacher.Modules {
-			childCtx.VisitModules(cb)
+	names := make([]string, 0, len(mctx.Children))
+	for name := range mctx.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		eacher := mctx.Children[name]
+		keys := make([]addr.EachIndex, 0, len(eacher.Modules))
+		for key := range eacher.Modules {
+			keys = append(keys, key)
+		}
+		sortEachIndexes(keys)
+		for _, key := range keys {
+			eacher.Modules[key].VisitModules(cb)
 		}
 	}
 }
 
+// sortEachIndexes sorts the given indexes of the instances of a single
+// resource or module, ordering integer indexes numerically.
+func sortEachIndexes(keys []addr.EachIndex) {
+	sort.Slice(keys, func(i, j int) bool {
+		ii, iIsInt := keys[i].(addr.EachInt)
+		ji, jIsInt := keys[j].(addr.EachInt)
+		if iIsInt && jIsInt {
+			return ii < ji
+		}
+		return keys[i].String() < keys[j].String()
+	})
+}
+
 // ModuleEach represents either a single child ModuleContext or the multiple
 // indexed ModuleContexts created when ForEach is used in a module block.
 //
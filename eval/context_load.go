@@ -3,12 +3,14 @@ package eval
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/apparentlymart/awsup/addr"
 	"github.com/apparentlymart/awsup/config"
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 )
 
 func newModuleContext(rctx *RootContext, parser *config.Parser, srcPath string, path addr.ModulePath, each EachState, inputConstants hcl.Attributes, root, parent *ModuleContext, callRange hcl.Range) (*ModuleContext, hcl.Diagnostics) {
@@ -47,6 +49,8 @@ func newModuleContext(rctx *RootContext, parser *config.Parser, srcPath string,
 		mctx.Parent = parent
 	}
 
+	diags = append(diags, checkParameterTypes(cfg)...)
+
 	constants, constsDiags := buildConstantsTable(cfg.Constants, inputConstants, parent, each, callRange)
 	diags = append(diags, constsDiags...)
 	mctx.Constants = constants
@@ -54,6 +58,12 @@ func newModuleContext(rctx *RootContext, parser *config.Parser, srcPath string,
 	// Now that mctx.Constants is set, we can safely use mctx.EvalConstant from
 	// this point forward.
 
+	if !constsDiags.HasErrors() {
+		validateDiags := mctx.validateConstants(inputConstants)
+		diags = append(diags, validateDiags...)
+		constsDiags = append(constsDiags, validateDiags...)
+	}
+
 	children := make(map[string]*ModuleEach)
 	if constsDiags.HasErrors() {
 		// We won't proceed further if we encountered errors building the
@@ -62,74 +72,33 @@ func newModuleContext(rctx *RootContext, parser *config.Parser, srcPath string,
 		// required constants being absent from the table.
 		return mctx, diags
 	}
+
+	resources, resourcesDiags := mctx.expandResources()
+	diags = append(diags, resourcesDiags...)
+	mctx.Resources = resources
+
 	for name, mcfg := range cfg.Modules {
-		forEachVal, valDiags := mctx.EvalConstant(mcfg.ForEach, cty.DynamicPseudoType, NoEachState)
-		diags = append(diags, valDiags...)
-		if valDiags.HasErrors() {
+		eachType, eachStates, forEachDiags := mctx.evalForEach(mcfg.ForEach)
+		diags = append(diags, forEachDiags...)
+		if forEachDiags.HasErrors() {
 			// Can't process any further if we can't evaluate ForEach
 			continue
 		}
-		forEachType := forEachVal.Type()
-
-		path := path.AppendName(name)
 
-		switch {
-		case forEachVal.IsNull():
-			children[name] = newModuleEach(addr.NoEach)
-			childCtx, childDiags := mctx.childModuleContext(parser, path, mcfg, NoEachState)
+		children[name] = newModuleEach(eachType)
+		for _, each := range eachStates {
+			path := path.AppendName(name)
+			if each.Enabled() {
+				path = path.AppendIndex(each.Key)
+			}
+			childCtx, childDiags := mctx.childModuleContext(parser, path, mcfg, each)
 			diags = append(diags, childDiags...)
-			children[name].Modules[addr.NoEachIndex] = childCtx
-		case forEachType.IsSetType():
-			diags = append(diags, &hcl.Diagnostic{
-				Severity: hcl.DiagError,
-				Summary:  "Incorrect value type",
-				Detail:   "A set value cannot be used as a ForEach interator.",
-				Subject:  mcfg.ForEach.StartRange().Ptr(),
-			})
-			continue
-		case forEachType.IsCollectionType() || forEachType.IsObjectType() || forEachType.IsTupleType():
-			switch {
-			case forEachType.IsListType() || forEachType.IsTupleType():
-				children[name] = newModuleEach(addr.EachTypeInt)
-			case forEachType.IsMapType() || forEachType.IsObjectType():
-				children[name] = newModuleEach(addr.EachTypeString)
-			default:
-				// should never happen since we've now covered all of the
-				// collection types
-				diags = append(diags, &hcl.Diagnostic{
-					Severity: hcl.DiagError,
-					Summary:  "Incorrect value type",
-					Detail:   fmt.Sprintf("A %s value cannot be used as a ForEach interator.", forEachType.FriendlyName()),
-					Subject:  mcfg.ForEach.StartRange().Ptr(),
-				})
+			if childCtx == nil {
+				// The content of the config block was so broken that we
+				// weren't able to construct any context.
 				continue
 			}
-
-			for it := forEachVal.ElementIterator(); it.Next(); {
-				keyVal, val := it.Element()
-				key := addr.MakeEachIndex(keyVal)
-				path := path.AppendIndex(key)
-				each := EachState{
-					Key:   key,
-					Value: val,
-				}
-				childCtx, childDiags := mctx.childModuleContext(parser, path, mcfg, each)
-				diags = append(diags, childDiags...)
-				if childCtx == nil {
-					// The content of the config block was so broken that we
-					// weren't able to construct any context.
-					continue
-				}
-				children[name].Modules[key] = childCtx
-			}
-		default:
-			diags = append(diags, &hcl.Diagnostic{
-				Severity: hcl.DiagError,
-				Summary:  "Incorrect value type",
-				Detail:   fmt.Sprintf("A %s value cannot be used as a ForEach interator.", forEachType.FriendlyName()),
-				Subject:  mcfg.ForEach.StartRange().Ptr(),
-			})
-			continue
+			children[name].Modules[each.Key] = childCtx
 		}
 	}
 
@@ -191,9 +160,51 @@ func (mctx *ModuleContext) childModuleContext(parser *config.Parser, path addr.M
 
 	childCtx, childDiags := newModuleContext(mctx.Global, parser, srcPath, path, each, cfg.Constants, mctx.Root, mctx, cfg.DeclRange)
 	diags = append(diags, childDiags...)
+	if childDiags.HasErrors() {
+		return childCtx, diags
+	}
+
+	childCtx.CallParameters = cfg.Parameters
+	childCtx.CallEach = each
+	diags = append(diags, childCtx.checkCallParameters(cfg)...)
 	return childCtx, diags
 }
 
+// checkCallParameters verifies that the parameters set in the given module
+// call are consistent with those declared by the module being called.
+func (mctx *ModuleContext) checkCallParameters(call *config.ModuleCall) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for name, param := range mctx.Config.Parameters {
+		if _, isSet := call.Parameters[name]; isSet {
+			continue
+		}
+		def, defDiags := mctx.EvalConstant(param.Default, cty.DynamicPseudoType, NoEachState)
+		diags = append(diags, defDiags...)
+		if !defDiags.HasErrors() && def.IsNull() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing required parameter for module",
+				Detail:   fmt.Sprintf("This module requires a value for its parameter %q.", name),
+				Subject:  &call.DeclRange,
+			})
+		}
+	}
+
+	for name, attr := range call.Parameters {
+		if _, isAllowed := mctx.Config.Parameters[name]; !isAllowed {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported module parameter",
+				Detail:   fmt.Sprintf("This child module does not expect a parameter named %q.", name),
+				Subject:  &attr.NameRange,
+			})
+		}
+	}
+
+	return diags
+}
+
 func buildConstantsTable(cfgs map[string]*config.Constant, input hcl.Attributes, parent *ModuleContext, each EachState, callRange hcl.Range) (map[string]cty.Value, hcl.Diagnostics) {
 	table := map[string]cty.Value{}
 	var diags hcl.Diagnostics
@@ -214,7 +225,7 @@ func buildConstantsTable(cfgs map[string]*config.Constant, input hcl.Attributes,
 					diags = append(diags, &hcl.Diagnostic{
 						Severity: hcl.DiagError,
 						Summary:  "Required root constant not set",
-						Detail:   fmt.Sprintf("The root module requires a value for its named constant %q. Set it in a file passed with the --constants argument.", name),
+						Detail:   fmt.Sprintf("The root module requires a value for its named constant %q. Set it using the -c option, a file passed with the --constants option, or the environment variable %s%s.", name, config.ConstantEnvPrefix, name),
 					})
 				} else {
 					diags = append(diags, &hcl.Diagnostic{
@@ -224,6 +235,10 @@ func buildConstantsTable(cfgs map[string]*config.Constant, input hcl.Attributes,
 						Subject:  &callRange,
 					})
 				}
+			} else {
+				var convDiags hcl.Diagnostics
+				val, convDiags = convertConstant(val, cfg, cfg.Default.Range())
+				diags = append(diags, convDiags...)
 			}
 			table[name] = val
 			continue
@@ -247,6 +262,11 @@ func buildConstantsTable(cfgs map[string]*config.Constant, input hcl.Attributes,
 		if !val.IsKnown() {
 			val = cty.NullVal(val.Type())
 		}
+		if !valDiags.HasErrors() {
+			var convDiags hcl.Diagnostics
+			val, convDiags = convertConstant(val, cfg, attr.Expr.Range())
+			diags = append(diags, convDiags...)
+		}
 		table[name] = val
 	}
 
@@ -273,3 +293,84 @@ func buildConstantsTable(cfgs map[string]*config.Constant, input hcl.Attributes,
 
 	return table, diags
 }
+
+// convertConstant converts the given value for a constant to the constant's
+// type, returning an error diagnostic with the given subject if it is not
+// suitable.
+func convertConstant(val cty.Value, cfg *config.Constant, rng hcl.Range) (cty.Value, hcl.Diagnostics) {
+	if cfg.Type == cty.DynamicPseudoType {
+		return val, nil
+	}
+	converted, err := convert.Convert(val, cfg.Type)
+	if err != nil {
+		return cty.NullVal(cfg.Type), hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for constant",
+				Detail:   fmt.Sprintf("Unsuitable value for constant %q: %s.", cfg.Name, err),
+				Subject:  &rng,
+			},
+		}
+	}
+	return converted, nil
+}
+
+// validateConstants checks the values of the receiving module's constants
+// against the validation rules in their declarations.
+//
+// This must be called only once the constants table has been built, since
+// the validation conditions are evaluated as constant expressions. Failures
+// are reported against the expression that set the constant, if any, and
+// otherwise against the constant's default.
+func (mctx *ModuleContext) validateConstants(input hcl.Attributes) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	names := make([]string, 0, len(mctx.Config.Constants))
+	for name := range mctx.Config.Constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := mctx.Config.Constants[name]
+		rng := cfg.Default.Range()
+		if attr, isSet := input[name]; isSet {
+			rng = attr.Expr.Range()
+		}
+
+		for _, v := range cfg.Validations {
+			result, resultDiags := mctx.EvalConstant(v.Condition, cty.Bool, NoEachState)
+			diags = append(diags, resultDiags...)
+			if resultDiags.HasErrors() {
+				continue
+			}
+			if result.IsNull() || !result.IsKnown() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid validation condition",
+					Detail:   "The condition for a constant validation rule must be either true or false.",
+					Subject:  v.Condition.Range().Ptr(),
+				})
+				continue
+			}
+			if result.True() {
+				continue
+			}
+
+			detail := fmt.Sprintf("The value for constant %q does not satisfy the validation rule at %s.", name, v.Condition.Range())
+			msg, msgDiags := mctx.EvalConstant(v.ErrorMessage, cty.String, NoEachState)
+			diags = append(diags, msgDiags...)
+			if !msgDiags.HasErrors() && !msg.IsNull() && msg.IsKnown() {
+				detail = msg.AsString()
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for constant",
+				Detail:   detail,
+				Subject:  &rng,
+			})
+		}
+	}
+
+	return diags
+}
@@ -0,0 +1,202 @@
+package eval
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestValidateConstants(t *testing.T) {
+	type wantDiag struct {
+		Summary string
+		Detail  string // prefix of the detail
+		Subject string // base filename and line
+	}
+
+	tests := map[string]struct {
+		Config string
+		Input  map[string]cty.Value
+		Want   []wantDiag
+	}{
+		"valid": {
+			`
+Constant "Env" {
+  Default = "dev"
+  Validation {
+    Condition = Const.Env == "dev" || Const.Env == "prod"
+  }
+}
+`,
+			map[string]cty.Value{"Env": cty.StringVal("prod")},
+			nil,
+		},
+		"invalid input": {
+			`
+Constant "Env" {
+  Default = "dev"
+  Validation {
+    Condition = Const.Env == "dev" || Const.Env == "prod"
+  }
+}
+`,
+			map[string]cty.Value{"Env": cty.StringVal("test")},
+			[]wantDiag{
+				{"Invalid value for constant", `The value for constant "Env" does not satisfy the validation rule at `, "<input>:1"},
+			},
+		},
+		"invalid default": {
+			`
+Constant "Env" {
+  Default = "test"
+  Validation {
+    Condition = Const.Env == "dev" || Const.Env == "prod"
+  }
+}
+`,
+			nil,
+			[]wantDiag{
+				{"Invalid value for constant", `The value for constant "Env" does not satisfy the validation rule at `, "main.awsup:3"},
+			},
+		},
+		"custom error message": {
+			`
+Constant "Env" {
+  Default = "dev"
+  Validation {
+    Condition    = Const.Env == "dev" || Const.Env == "prod"
+    ErrorMessage = "Env must be dev or prod, not ${Const.Env}."
+  }
+}
+`,
+			map[string]cty.Value{"Env": cty.StringVal("test")},
+			[]wantDiag{
+				{"Invalid value for constant", "Env must be dev or prod, not test.", "<input>:1"},
+			},
+		},
+		"several rules": {
+			`
+Constant "Count" {
+  Type = number
+  Validation {
+    Condition    = Const.Count > 0
+    ErrorMessage = "Count must be positive."
+  }
+  Validation {
+    Condition    = Const.Count < 10
+    ErrorMessage = "Count must be less than ten."
+  }
+}
+`,
+			map[string]cty.Value{"Count": cty.NumberIntVal(-1)},
+			[]wantDiag{
+				{"Invalid value for constant", "Count must be positive.", "<input>:1"},
+			},
+		},
+		"several constants": {
+			`
+Constant "Zone" {
+  Default = "z"
+  Validation {
+    Condition    = Const.Zone != "z"
+    ErrorMessage = "Zone is invalid."
+  }
+}
+
+Constant "Env" {
+  Default = "e"
+  Validation {
+    Condition    = Const.Env != "e"
+    ErrorMessage = "Env is invalid."
+  }
+}
+
+Constant "Region" {
+  Default = "r"
+  Validation {
+    Condition    = Const.Region != "r"
+    ErrorMessage = "Region is invalid."
+  }
+}
+`,
+			nil,
+			[]wantDiag{
+				{"Invalid value for constant", "Env is invalid.", "main.awsup:11"},
+				{"Invalid value for constant", "Region is invalid.", "main.awsup:19"},
+				{"Invalid value for constant", "Zone is invalid.", "main.awsup:3"},
+			},
+		},
+		"type mismatch": {
+			`
+Constant "Count" {
+  Type = number
+  Validation {
+    Condition = Const.Count > 0
+  }
+}
+`,
+			map[string]cty.Value{"Count": cty.StringVal("many")},
+			[]wantDiag{
+				{"Invalid value for constant", `Unsuitable value for constant "Count": `, "<input>:1"},
+			},
+		},
+		"null condition": {
+			`
+Constant "Env" {
+  Default = "dev"
+  Validation {
+    Condition = null
+  }
+}
+`,
+			nil,
+			[]wantDiag{
+				{"Invalid validation condition", "The condition for a constant validation rule must be either true or false.", "main.awsup:5"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := make(hcl.Attributes)
+			for name, val := range test.Input {
+				rng := hcl.Range{
+					Filename: "<input>",
+					Start:    hcl.Pos{Line: 1, Column: 1},
+					End:      hcl.Pos{Line: 1, Column: 1},
+				}
+				input[name] = &hcl.Attribute{
+					Name:      name,
+					Expr:      hcl.StaticExpr(val, rng),
+					Range:     rng,
+					NameRange: rng,
+				}
+			}
+
+			_, diags := testRootContextWithConstants(t, map[string]string{"main.awsup": test.Config}, input)
+
+			if len(diags) != len(test.Want) {
+				t.Fatalf("wrong number of diagnostics %d; want %d\n%s", len(diags), len(test.Want), diags.Error())
+			}
+			for i, want := range test.Want {
+				diag := diags[i]
+				if diag.Summary != want.Summary {
+					t.Errorf("wrong summary for diagnostic %d\ngot:  %s\nwant: %s", i, diag.Summary, want.Summary)
+				}
+				if !strings.HasPrefix(diag.Detail, want.Detail) {
+					t.Errorf("wrong detail for diagnostic %d\ngot:  %s\nwant: %s…", i, diag.Detail, want.Detail)
+				}
+				var subject string
+				if diag.Subject != nil {
+					subject = fmt.Sprintf("%s:%d", filepath.Base(diag.Subject.Filename), diag.Subject.Start.Line)
+				}
+				if subject != want.Subject {
+					t.Errorf("wrong subject for diagnostic %d\ngot:  %s\nwant: %s", i, subject, want.Subject)
+				}
+			}
+		})
+	}
+}
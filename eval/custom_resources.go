@@ -0,0 +1,193 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// loadCustomResourceTypes adds the custom resource types declared by all of
+// the modules in the tree to the schema of the reciever, so that they can be
+// used by all modules.
+//
+// Custom resource types that are not declared anywhere are still accepted,
+// but without any checking of their properties or attributes beyond the
+// required ServiceToken property.
+func (ctx *RootContext) loadCustomResourceTypes() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	declared := map[string]*config.CustomResourceType{}
+	custom := &schema.Schema{
+		ResourceTypes: map[string]*schema.ResourceType{},
+		PropertyTypes: map[string]*schema.PropertyType{},
+	}
+
+	ctx.VisitModules(func(mctx *ModuleContext) bool {
+		for name, decl := range mctx.Config.CustomResources {
+			if prev, exists := declared[name]; exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate custom resource type",
+					Detail: fmt.Sprintf(
+						"Duplicate definition of custom resource type %q, which was already defined at %s. Custom resource types are shared by all modules, so each must be declared only once.",
+						name, prev.DeclRange,
+					),
+					Subject: &decl.DeclRange,
+				})
+				continue
+			}
+			declared[name] = decl
+
+			rsch, rschDiags := customResourceSchema(decl)
+			diags = append(diags, rschDiags...)
+			custom.ResourceTypes[name] = rsch
+		}
+		return true
+	})
+
+	if len(declared) != 0 {
+		ctx.Schema = schema.Merge(ctx.Schema, custom)
+	}
+	ctx.CustomResourceTypes = declared
+
+	return diags
+}
+
+// customResourceSchema returns the description of the resource type that
+// is declared by the given custom resource type configuration.
+func customResourceSchema(decl *config.CustomResourceType) (*schema.ResourceType, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	if !strings.HasPrefix(decl.Name, "Custom::") || len(decl.Name) == len("Custom::") {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid custom resource type name",
+			Detail:   "The name of a custom resource type must be of the form Custom::Name.",
+			Subject:  &decl.DeclRange,
+		})
+	}
+
+	rsch := schema.NewCustomResourceType(decl.Name)
+	rsch.AdditionalProperties = false
+	rsch.AdditionalAttributes = false
+
+	for _, prop := range decl.Properties {
+		rsch.Properties[prop.Name] = &schema.Property{
+			Name:          prop.Name,
+			Documentation: rsch.Documentation,
+			Required:      prop.Required,
+			UpdateType:    schema.Mutable,
+			Type:          schema.TypeForCty(prop.Type),
+		}
+	}
+
+	for _, attr := range decl.Attributes {
+		ty := schema.TypeForCty(attr.Type)
+		if ty.PrimitiveType == "" || ty.PrimitiveType == schema.Json {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported attribute type",
+				Detail:   "The attributes of a custom resource must be of type string, number or bool.",
+				Subject:  &attr.DeclRange,
+			})
+			continue
+		}
+		rsch.Attributes[attr.Name] = &schema.Attribute{
+			Name: attr.Name,
+			Type: ty,
+		}
+	}
+
+	return rsch, diags
+}
+
+// checkCustomProperty verifies that the given expression, which sets the
+// property of the given name for a resource of the given declared custom
+// resource type, produces a value of the property's declared type.
+//
+// The schema can't describe all of the types that a declaration can, such
+// as objects, so we check against the declared type itself.
+func (mctx *ModuleContext) checkCustomProperty(decl *config.CustomResourceType, name string, expr hcl.Expression, each EachState) hcl.Diagnostics {
+	want := cty.NilType
+	for _, prop := range decl.Properties {
+		if prop.Name == name {
+			want = prop.Type
+			break
+		}
+	}
+	if want == cty.NilType {
+		return nil
+	}
+
+	// Any errors in the expression itself are reported when it is
+	// evaluated, so we don't report them again here.
+	got, _ := mctx.TypeCheck(expr, each)
+	if typeConforms(got, want) {
+		return nil
+	}
+	return hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid property value",
+			Detail:   fmt.Sprintf("Unsuitable value for property %q of custom resource type %s: %s required.", name, decl.Name, withArticle(want.FriendlyName())),
+			Subject:  expr.Range().Ptr(),
+		},
+	}
+}
+
+// typeConforms returns true if values of the first given type can be
+// converted to the second. Unlike the conversions in package convert, this
+// permits converting between object types and from object types to maps,
+// which are the usual types of literal values given for structural types.
+func typeConforms(got, want cty.Type) bool {
+	switch {
+	case got == cty.DynamicPseudoType || want == cty.DynamicPseudoType:
+		return true
+
+	case want.IsObjectType():
+		for name, wantAttr := range want.AttributeTypes() {
+			var gotAttr cty.Type
+			switch {
+			case got.IsObjectType() && got.HasAttribute(name):
+				gotAttr = got.AttributeType(name)
+			case got.IsMapType():
+				gotAttr = got.ElementType()
+			default:
+				return false
+			}
+			if !typeConforms(gotAttr, wantAttr) {
+				return false
+			}
+		}
+		return true
+
+	case want.IsMapType() && got.IsObjectType():
+		for _, gotAttr := range got.AttributeTypes() {
+			if !typeConforms(gotAttr, want.ElementType()) {
+				return false
+			}
+		}
+		return true
+
+	case (want.IsListType() || want.IsSetType()) && got.IsTupleType():
+		for _, gotElem := range got.TupleElementTypes() {
+			if !typeConforms(gotElem, want.ElementType()) {
+				return false
+			}
+		}
+		return true
+
+	case (want.IsListType() || want.IsSetType() || want.IsMapType()) && (got.IsListType() || got.IsSetType() || got.IsMapType()):
+		if want.IsMapType() != got.IsMapType() {
+			return false
+		}
+		return typeConforms(got.ElementType(), want.ElementType())
+
+	default:
+		return got.Equals(want) || convert.GetConversionUnsafe(got, want) != nil
+	}
+}
@@ -0,0 +1,126 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestCustomResourcePropertyTypes(t *testing.T) {
+	decl := `
+Parameter "Count" {
+  Type = "Number"
+}
+
+Parameter "Names" {
+  Type = "CommaDelimitedList"
+}
+
+CustomResourceType "Custom::Example" {
+  Property "Name" {
+    Type     = string
+    Required = true
+  }
+  Property "Count" {
+    Type = number
+  }
+  Property "Names" {
+    Type = list(string)
+  }
+  Property "Settings" {
+    Type = object({ Enabled = bool, Tags = map(string) })
+  }
+  Property "Anything" {
+  }
+  Attribute "Url" {
+  }
+}
+
+Resource "Source" {
+  Type = "Custom::Example"
+  Properties {
+    ServiceToken = "arn:aws:lambda:us-east-1:123456789012:function:example"
+    Name         = "source"
+  }
+}
+`
+
+	tests := map[string]struct {
+		Properties string
+		Want       []string
+	}{
+		"literals": {
+			`
+    Name     = "example"
+    Count    = 2
+    Names    = ["a", "b"]
+    Settings = { Enabled = true, Tags = { a = "b" } }
+    Anything = [{ a = 1 }, "b"]
+`,
+			nil,
+		},
+		"references": {
+			`
+    Name     = Resource.Source.Url
+    Count    = Param.Count
+    Names    = Param.Names
+    Settings = { Enabled = Param.Count == 1, Tags = { Name = Resource.Source.Url } }
+`,
+			nil,
+		},
+		"conversions": {
+			`
+    Name  = Param.Count
+    Count = "2"
+`,
+			nil,
+		},
+		"wrong literal types": {
+			`
+    Name     = "example"
+    Names    = "a"
+    Settings = { Enabled = "yes please" }
+`,
+			[]string{"Invalid property value", "Invalid property value"},
+		},
+		"wrong reference types": {
+			`
+    Name     = Param.Names
+    Count    = Param.Names
+    Names    = Param.Count
+    Settings = { Enabled = true, Tags = ["a"] }
+`,
+			[]string{"Invalid property value", "Invalid property value", "Invalid property value", "Invalid property value"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{
+				"main.awsup": decl + `
+Resource "Example" {
+  Type = "Custom::Example"
+  Properties {
+    ServiceToken = "arn:aws:lambda:us-east-1:123456789012:function:example"
+` + test.Properties + `
+  }
+}
+`,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+			}
+			_, buildDiags := ctx.Build()
+			diags = append(diags, buildDiags...)
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary)
+			}
+			if !equalStrings(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+				for _, diag := range diags {
+					t.Logf("- %s", diag.Error())
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package eval
 
 import (
+	"fmt"
+
 	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -15,3 +18,54 @@ func (s EachState) Enabled() bool {
 }
 
 var NoEachState EachState
+
+// evalForEach evaluates the given ForEach expression and returns the type
+// of index it implies along with an EachState for each of the instances
+// it calls for.
+//
+// If the expression is null then ForEach is not in use, and so the result
+// is addr.NoEach along with a single NoEachState. If error diagnostics are
+// returned then the returned states are not meaningful.
+func (mctx *ModuleContext) evalForEach(expr hcl.Expression) (addr.EachType, []EachState, hcl.Diagnostics) {
+	forEachVal, diags := mctx.EvalConstant(expr, cty.DynamicPseudoType, NoEachState)
+	if diags.HasErrors() {
+		return addr.NoEach, nil, diags
+	}
+	forEachType := forEachVal.Type()
+
+	var eachType addr.EachType
+	switch {
+	case forEachVal.IsNull():
+		return addr.NoEach, []EachState{NoEachState}, diags
+	case forEachType.IsSetType():
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Incorrect value type",
+			Detail:   "A set value cannot be used as a ForEach interator.",
+			Subject:  expr.StartRange().Ptr(),
+		})
+		return addr.NoEach, nil, diags
+	case forEachType.IsListType() || forEachType.IsTupleType():
+		eachType = addr.EachTypeInt
+	case forEachType.IsMapType() || forEachType.IsObjectType():
+		eachType = addr.EachTypeString
+	default:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Incorrect value type",
+			Detail:   fmt.Sprintf("A %s value cannot be used as a ForEach interator.", forEachType.FriendlyName()),
+			Subject:  expr.StartRange().Ptr(),
+		})
+		return addr.NoEach, nil, diags
+	}
+
+	var states []EachState
+	for it := forEachVal.ElementIterator(); it.Next(); {
+		keyVal, val := it.Element()
+		states = append(states, EachState{
+			Key:   addr.MakeEachIndex(keyVal),
+			Value: val,
+		})
+	}
+	return eachType, states, diags
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/convert"
 )
@@ -27,7 +28,7 @@ func (mctx *ModuleContext) EvalConstant(expr hcl.Expression, ty cty.Type, each E
 	scope := make(map[string]cty.Value)
 	locals := make(map[string]cty.Value)
 
-	traversals := expr.Variables()
+	traversals := exprVariables(expr)
 	for _, traversal := range traversals {
 		rootName := traversal.RootName()
 		switch rootName {
@@ -107,10 +108,7 @@ func (mctx *ModuleContext) EvalConstant(expr hcl.Expression, ty cty.Type, each E
 
 	ectx := &hcl.EvalContext{
 		Variables: scope,
-		// TODO: Once we have some functions, we should expose constant-friendly
-		// versions of them in here. We will probably also have some functions
-		// that are _only_ supported with constants, due to CloudFormation's
-		// rather limited repertoire of dynamic functions.
+		Functions: constantFunctions,
 	}
 
 	val, valDiags := expr.Value(ectx)
@@ -144,7 +142,7 @@ func (mctx *ModuleContext) EvalConstant(expr hcl.Expression, ty cty.Type, each E
 // they transitively refer to variables.
 func (mctx *ModuleContext) DetectVariables(expr hcl.Expression) []hcl.Traversal {
 	var ret []hcl.Traversal
-	traversals := expr.Variables()
+	traversals := exprVariables(expr)
 	for _, traversal := range traversals {
 		switch traversal.RootName() {
 		case "Const", "Each":
@@ -189,7 +187,7 @@ func (mctx *ModuleContext) DetectVariables(expr hcl.Expression) []hcl.Traversal
 // traversals.
 func DetectVariables(expr hcl.Expression) []hcl.Traversal {
 	var ret []hcl.Traversal
-	traversals := expr.Variables()
+	traversals := exprVariables(expr)
 	for _, traversal := range traversals {
 		switch traversal.RootName() {
 		case "Const", "Each":
@@ -216,3 +214,25 @@ func eachObject(each EachState) cty.Value {
 		}))
 	}
 }
+
+// exprVariables is like expr.Variables, except that it also finds variables
+// used in the source expression of a relative traversal, such as the
+// arguments in split(",", Param.List)[0], which HCL itself does not visit.
+func exprVariables(expr hcl.Expression) []hcl.Traversal {
+	node, ok := expr.(hclsyntax.Node)
+	if !ok {
+		return expr.Variables()
+	}
+
+	var ret []hcl.Traversal
+	hclsyntax.VisitAll(node, func(node hclsyntax.Node) hcl.Diagnostics {
+		switch tn := node.(type) {
+		case *hclsyntax.ScopeTraversalExpr:
+			ret = append(ret, tn.Traversal)
+		case *hclsyntax.RelativeTraversalExpr:
+			ret = append(ret, exprVariables(tn.Source)...)
+		}
+		return nil
+	})
+	return ret
+}
@@ -16,16 +16,34 @@ import (
 func (mctx *ModuleContext) EvalDynamic(expr hcl.Expression, each EachState) (DynExpr, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 
-	switch te := expr.(type) {
-
-	case *hclsyntax.LiteralValueExpr:
+	if mctx.isConstant(expr) {
+		// Anything that doesn't depend on dynamic values can just be
+		// evaluated as a constant, which means that the full language can
+		// be used for constants even though only a small subset of it can
+		// be used for dynamic values.
+		val, valDiags := mctx.EvalConstant(expr, cty.DynamicPseudoType, each)
+		diags = append(diags, valDiags...)
 		return &DynLiteral{
-			Value:    te.Val,
-			SrcRange: te.SrcRange,
+			Value:    val,
+			SrcExpr:  expr,
+			SrcRange: expr.Range(),
 		}, diags
+	}
 
-	case *hclsyntax.ScopeTraversalExpr:
-		return mctx.evalVariableDynamic(te, each)
+	if root, steps, ok, stepsDiags := mctx.referenceSteps(expr, each); ok {
+		diags = append(diags, stepsDiags...)
+		if stepsDiags.HasErrors() {
+			return &DynLiteral{
+				Value:    cty.DynamicVal,
+				SrcRange: expr.Range(),
+			}, diags
+		}
+		ret, refDiags := mctx.evalReferenceDynamic(root, steps, expr.Range(), each)
+		diags = append(diags, refDiags...)
+		return ret, diags
+	}
+
+	switch te := expr.(type) {
 
 	case *hclsyntax.RelativeTraversalExpr:
 		start, startDiags := mctx.EvalDynamic(te.Source, each)
@@ -50,6 +68,9 @@ func (mctx *ModuleContext) EvalDynamic(expr hcl.Expression, each EachState) (Dyn
 			SrcRange:  te.SrcRange,
 		}, diags
 
+	case *hclsyntax.TemplateWrapExpr:
+		return mctx.EvalDynamic(te.Wrapped, each)
+
 	case *hclsyntax.IndexExpr:
 		// TODO: Verify that the collection is a list and error if not,
 		// since CloudFormation only supports indexing of lists.
@@ -65,6 +86,90 @@ func (mctx *ModuleContext) EvalDynamic(expr hcl.Expression, each EachState) (Dyn
 			SrcRange: te.SrcRange,
 		}, diags
 
+	case *hclsyntax.FunctionCallExpr:
+		return mctx.evalFunctionCallDynamic(te, each)
+
+	case *hclsyntax.TupleConsExpr:
+		exprs := make([]DynExpr, len(te.Exprs))
+		for i, itemExpr := range te.Exprs {
+			exprs[i] = evalDynamicWithDiags(mctx, itemExpr, each, &diags)
+		}
+		return &DynList{
+			Exprs:    exprs,
+			SrcRange: te.SrcRange,
+		}, diags
+
+	case *hclsyntax.ObjectConsExpr:
+		attrs := make(map[string]DynExpr, len(te.Items))
+		for _, item := range te.Items {
+			// CloudFormation has no way to compute object keys dynamically,
+			// so our keys must always be constant.
+			key := evalConstantWithDiags(mctx, item.KeyExpr, cty.String, each, &diags)
+			if key.IsNull() {
+				continue
+			}
+			attrs[key.AsString()] = evalDynamicWithDiags(mctx, item.ValueExpr, each, &diags)
+		}
+		return &DynObject{
+			Attrs:    attrs,
+			SrcRange: te.SrcRange,
+		}, diags
+
+	case *hclsyntax.ConditionalExpr:
+		if mctx.isConstant(te.Condition) {
+			// If only the results are dynamic then we can choose between
+			// them here, without involving CloudFormation at all.
+			cond := evalConstantWithDiags(mctx, te.Condition, cty.Bool, each, &diags)
+			if cond.IsNull() {
+				return &DynLiteral{
+					Value:    cty.DynamicVal,
+					SrcRange: te.SrcRange,
+				}, diags
+			}
+			if cond.True() {
+				return mctx.EvalDynamic(te.TrueResult, each)
+			}
+			return mctx.EvalDynamic(te.FalseResult, each)
+		}
+
+		// CloudFormation's Fn::If can only test named conditions, so our
+		// condition must be a direct reference to one.
+		cond, condDiags := mctx.EvalDynamic(te.Condition, each)
+		diags = append(diags, condDiags...)
+		condRef, isCondRef := cond.(*DynConditionRef)
+		if !isCondRef {
+			if !condDiags.HasErrors() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Unsupported conditional expression",
+					Detail:   "A conditional expression with a non-constant condition must use a reference to a named condition as its condition, such as Condition.Example.",
+					Subject:  te.Condition.Range().Ptr(),
+				})
+			}
+			return &DynLiteral{
+				Value:    cty.DynamicVal,
+				SrcRange: te.SrcRange,
+			}, diags
+		}
+
+		trueResult := evalDynamicWithDiags(mctx, te.TrueResult, each, &diags)
+		falseResult := evalDynamicWithDiags(mctx, te.FalseResult, each, &diags)
+		return &DynIf{
+			ConditionName: condRef.ConditionName,
+			If:            trueResult,
+			Else:          falseResult,
+			SrcRange:      te.SrcRange,
+		}, diags
+
+	case *hclsyntax.UnaryOpExpr:
+		if te.Op == hclsyntax.OpLogicalNot {
+			val := evalDynamicWithDiags(mctx, te.Val, each, &diags)
+			return &DynNot{
+				Value:    val,
+				SrcRange: te.SrcRange,
+			}, diags
+		}
+
 	case *hclsyntax.BinaryOpExpr:
 		switch te.Op {
 		case hclsyntax.OpLogicalAnd, hclsyntax.OpLogicalOr:
@@ -93,7 +198,7 @@ func (mctx *ModuleContext) EvalDynamic(expr hcl.Expression, each EachState) (Dyn
 			if trhs, ok := rhs.(*DynLogical); ok && trhs.Op == op {
 				values = append(values, trhs.Values...)
 			} else {
-				values = append(values, lhs)
+				values = append(values, rhs)
 			}
 
 			return &DynLogical{
@@ -129,120 +234,35 @@ func (mctx *ModuleContext) EvalDynamic(expr hcl.Expression, each EachState) (Dyn
 	}
 
 	// If we encounter an expression we don't know how to deal with then
-	// we'll fall out here and try to evaluate it as a constant to see if
-	// we can make a DynLiteral to represent it. This means that the full
-	// language can be used for constants, even though only a small subset of
-	// it can be used for dynamic values, at the expense of a more
-	// confusing user experience as we force the user to puzzle out
-	// the relationship between an unsupported operation and a
-	// deeply-nested refence to a variable.
-
+	// it must refer to at least one dynamic value, since otherwise we'd have
+	// evaluated it as a constant above. We return a specialized error here
+	// that marks the whole expression as problematic, as a small way to try
+	// to help the user understand what's going on and how to address it,
+	// since otherwise we force the user to puzzle out the relationship
+	// between an unsupported operation and a deeply-nested refence to a
+	// variable.
 	variables := mctx.DetectVariables(expr)
+	detail := "This expression type is not supported by CloudFormation, so only constant values are permitted and the result value will be hard-coded into the generated template."
 	if len(variables) != 0 {
-		// We return a specialized error here that marks the whole
-		// expression as problematic, as a small way to try to help the
-		// user understand what's going on and how to address it.
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Illegal use of non-constant value",
-			Detail:   fmt.Sprintf("This expression type is not supported by CloudFormation, so only constant values are permitted and the result value will be hard-coded into the generated template. A non-constant value is referenced at %s.", variables[0].SourceRange()),
-			Subject:  expr.Range().Ptr(), // Intentionally the whole expression rather than just the erroneous traversal
-		})
-		return &DynLiteral{
-			Value:    cty.NullVal(cty.DynamicPseudoType),
-			SrcRange: expr.Range(),
-		}, diags
+		detail += fmt.Sprintf(" A non-constant value is referenced at %s.", variables[0].SourceRange())
 	}
-
-	val, valDiags := mctx.EvalConstant(expr, cty.DynamicPseudoType, each)
-	diags = append(diags, valDiags...)
+	diags = append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Illegal use of non-constant value",
+		Detail:   detail,
+		Subject:  expr.Range().Ptr(), // Intentionally the whole expression rather than just the erroneous traversal
+	})
 	return &DynLiteral{
-		Value:    val,
+		Value:    cty.NullVal(cty.DynamicPseudoType),
 		SrcRange: expr.Range(),
 	}, diags
-
 }
 
-func (mctx *ModuleContext) evalVariableDynamic(expr *hclsyntax.ScopeTraversalExpr, each EachState) (DynExpr, hcl.Diagnostics) {
-	traversal := expr.Traversal
-	var diags hcl.Diagnostics
-	switch traversal.RootName() {
-
-	case "Const", "Each":
-		val, valDiags := mctx.EvalConstant(expr, cty.DynamicPseudoType, each)
-		diags = append(diags, valDiags...)
-		return &DynLiteral{
-			Value:    val,
-			SrcRange: expr.SrcRange,
-		}, diags
-
-	case "Local":
-		var nameStepI hcl.Traverser
-		if len(traversal) >= 2 {
-			nameStepI = traversal[1]
-		}
-		nameStep, ok := nameStepI.(hcl.TraverseAttr)
-		if !ok {
-			if len(traversal) < 2 {
-				diags = append(diags, &hcl.Diagnostic{
-					Severity: hcl.DiagError,
-					Summary:  "Illegal use of Local object",
-					Detail:   "The Local object requires an attribute to select a specific named local value.",
-					Subject:  traversal.SourceRange().Ptr(),
-				})
-				return &DynLiteral{
-					Value:    cty.DynamicVal,
-					SrcRange: traversal.SourceRange(),
-				}, diags
-			}
-		}
-
-		name := nameStep.Name
-		local, exists := mctx.Config.Locals[name]
-		if !exists {
-			diags = append(diags, &hcl.Diagnostic{
-				Severity: hcl.DiagError,
-				Summary:  "Unknown local value",
-				Detail:   fmt.Sprintf("There is no local value named %q.", name),
-				Subject:  &nameStep.SrcRange,
-			})
-			return &DynLiteral{
-				Value:    cty.DynamicVal,
-				SrcRange: nameStep.SrcRange,
-			}, diags
-		}
-
-		subExpr := local.Expr
-		vars := mctx.DetectVariables(subExpr)
-		if len(vars) == 0 {
-			// If the local value is constant-only then we'll evaluate it here
-			// and return its literal value.
-			val, valDiags := mctx.EvalConstant(subExpr, cty.DynamicPseudoType, each)
-			diags = append(diags, valDiags...)
-			return &DynLiteral{
-				Value:    val,
-				SrcRange: expr.SrcRange,
-			}, diags
-		}
-
-		// If the value contains dynamic-only constructs then we'll fall out
-		// here and try to incorporate its expression int ours.
-		dynExpr, dynDiags := mctx.EvalDynamic(subExpr, each)
-		diags = append(diags, dynDiags...)
-		return dynExpr, diags
-
-	default:
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Unknown object",
-			Detail:   fmt.Sprintf("There is no object named %q.", traversal.RootName()),
-			Subject:  traversal[0].SourceRange().Ptr(),
-		})
-		return &DynLiteral{
-			Value:    cty.DynamicVal,
-			SrcRange: traversal[0].SourceRange(),
-		}, diags
-	}
+// isConstant returns true if the given expression can be evaluated using
+// EvalConstant, because it refers to no dynamic values and calls no functions
+// whose results are known only to CloudFormation.
+func (mctx *ModuleContext) isConstant(expr hcl.Expression) bool {
+	return len(mctx.DetectVariables(expr)) == 0 && !callsDynamicOnlyFunction(expr)
 }
 
 func (mctx *ModuleContext) evalTraversalDynamic(start DynExpr, traversal hcl.Traversal, each EachState) (DynExpr, hcl.Diagnostics) {
@@ -254,16 +274,68 @@ Steps:
 		case hcl.TraverseRoot:
 			panic("can't use absolute traversal with evalTraversalDynamic")
 		case hcl.TraverseIndex:
+			if lit, isLit := expr.(*DynLiteral); isLit {
+				val, stepDiags := step.TraversalStep(lit.Value)
+				diags = append(diags, stepDiags...)
+				expr = &DynLiteral{
+					Value:    val,
+					SrcRange: hcl.RangeBetween(lit.SrcRange, step.SrcRange),
+				}
+				if stepDiags.HasErrors() {
+					break Steps
+				}
+				continue
+			}
+			if list, isList := expr.(*DynList); isList {
+				if idx, ok := staticListIndex(step.Key); ok && idx < len(list.Exprs) {
+					expr = list.Exprs[idx]
+					continue
+				}
+			}
 			expr = &DynIndex{
 				List: expr,
 				Index: &DynLiteral{
 					Value:    step.Key,
 					SrcRange: step.SrcRange,
 				},
+				SrcRange: hcl.RangeBetween(expr.SourceRange(), step.SrcRange),
 			}
 		case hcl.TraverseAttr:
-			// For variables that _do_ have attributes we'll handle them
-			// in evalVariableDynamic before we pass off the remaining
+			// Attributes of objects constructed in configuration can be
+			// resolved statically, since CloudFormation itself has no
+			// way to access them.
+			switch te := expr.(type) {
+			case *DynLiteral:
+				val, stepDiags := step.TraversalStep(te.Value)
+				diags = append(diags, stepDiags...)
+				expr = &DynLiteral{
+					Value:    val,
+					SrcRange: hcl.RangeBetween(te.SrcRange, step.SrcRange),
+				}
+				if stepDiags.HasErrors() {
+					break Steps
+				}
+				continue
+			case *DynObject:
+				if attr, exists := te.Attrs[step.Name]; exists {
+					expr = attr
+					continue
+				}
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Unsupported attribute",
+					Detail:   fmt.Sprintf("This object does not have an attribute named %q.", step.Name),
+					Subject:  &step.SrcRange,
+				})
+				expr = &DynLiteral{
+					Value:    cty.DynamicVal,
+					SrcRange: step.SrcRange,
+				}
+				break Steps
+			}
+
+			// For references that _do_ have attributes we'll handle them
+			// in evalReferenceDynamic before we pass off the remaining
 			// traversal to this function, so this is always an error here.
 			diags = append(diags, &hcl.Diagnostic{
 				Severity: hcl.DiagError,
@@ -306,3 +378,17 @@ Steps:
 	}
 	return expr, diags
 }
+
+// staticListIndex returns the given index key as an int if it is a known,
+// whole, non-negative number.
+func staticListIndex(key cty.Value) (int, bool) {
+	if !key.IsKnown() || key.IsNull() || key.Type() != cty.Number {
+		return 0, false
+	}
+	bf := key.AsBigFloat()
+	if !bf.IsInt() || bf.Sign() < 0 {
+		return 0, false
+	}
+	idx, _ := bf.Int64()
+	return int(idx), true
+}
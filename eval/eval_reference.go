@@ -0,0 +1,573 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// pseudoParameters maps the attributes of the "AWS" object to the names of
+// the CloudFormation pseudo parameters they refer to.
+var pseudoParameters = map[string]string{
+	"AccountId":        "AWS::AccountId",
+	"NotificationARNs": "AWS::NotificationARNs",
+	"NoValue":          "AWS::NoValue",
+	"Partition":        "AWS::Partition",
+	"Region":           "AWS::Region",
+	"StackId":          "AWS::StackId",
+	"StackName":        "AWS::StackName",
+	"URLSuffix":        "AWS::URLSuffix",
+}
+
+// refStep is a single step in a reference expression. Steps whose keys are
+// known statically are represented as traversal steps, while index steps
+// whose keys depend on dynamic values retain their key expression so that
+// it can be lowered separately.
+type refStep struct {
+	// Exactly one of Static and Key is set.
+	Static hcl.Traverser
+	Key    hcl.Expression
+}
+
+func (s refStep) SourceRange() hcl.Range {
+	if s.Key != nil {
+		return s.Key.Range()
+	}
+	return s.Static.SourceRange()
+}
+
+// referenceSteps attempts to interpret the given expression as a reference
+// to one of the top-level objects, followed by zero or more attribute and
+// index steps. Index keys that are constant are evaluated so that they can
+// be returned as static steps.
+//
+// If the expression is not of that form then ok is false, and the other
+// results are not meaningful.
+func (mctx *ModuleContext) referenceSteps(expr hcl.Expression, each EachState) (root hcl.TraverseRoot, steps []refStep, ok bool, diags hcl.Diagnostics) {
+	switch te := expr.(type) {
+
+	case *hclsyntax.ScopeTraversalExpr:
+		root, ok = te.Traversal[0].(hcl.TraverseRoot)
+		for _, step := range te.Traversal[1:] {
+			steps = append(steps, refStep{Static: step})
+		}
+		return root, steps, ok, diags
+
+	case *hclsyntax.RelativeTraversalExpr:
+		root, steps, ok, diags = mctx.referenceSteps(te.Source, each)
+		for _, step := range te.Traversal {
+			steps = append(steps, refStep{Static: step})
+		}
+		return root, steps, ok, diags
+
+	case *hclsyntax.IndexExpr:
+		root, steps, ok, diags = mctx.referenceSteps(te.Collection, each)
+		if !ok {
+			return root, steps, ok, diags
+		}
+		if !mctx.isConstant(te.Key) {
+			steps = append(steps, refStep{Key: te.Key})
+			return root, steps, ok, diags
+		}
+		key := evalConstantWithDiags(mctx, te.Key, cty.DynamicPseudoType, each, &diags)
+		steps = append(steps, refStep{
+			Static: hcl.TraverseIndex{
+				Key:      key,
+				SrcRange: te.Key.Range(),
+			},
+		})
+		return root, steps, ok, diags
+
+	default:
+		return root, nil, false, diags
+	}
+}
+
+// evalReferenceDynamic lowers a reference to one of the top-level objects,
+// as returned by referenceSteps, into a DynExpr. rng is the source range of
+// the entire reference expression.
+func (mctx *ModuleContext) evalReferenceDynamic(root hcl.TraverseRoot, steps []refStep, rng hcl.Range, each EachState) (DynExpr, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	placeholder := &DynLiteral{
+		Value:    cty.DynamicVal,
+		SrcRange: rng,
+	}
+
+	// All of the top-level objects other than "Each" require an attribute
+	// to select one of their members.
+	var nameStep hcl.TraverseAttr
+	if root.Name != "Each" {
+		var ok bool
+		if len(steps) > 0 {
+			nameStep, ok = steps[0].Static.(hcl.TraverseAttr)
+		}
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Illegal use of %s object", root.Name),
+				Detail:   fmt.Sprintf("The top-level object %q requires an attribute to specify which member to access.", root.Name),
+				Subject:  &rng,
+			})
+			return placeholder, diags
+		}
+	}
+	name := nameStep.Name
+	nameRange := hcl.RangeBetween(root.SrcRange, nameStep.SrcRange)
+
+	switch root.Name {
+
+	case "Const", "Each":
+		// The static prefix of the reference is constant, so we can evaluate
+		// it directly and then apply any dynamic steps that remain.
+		traversal := hcl.Traversal{root}
+		for len(steps) > 0 && steps[0].Static != nil {
+			traversal = append(traversal, steps[0].Static)
+			steps = steps[1:]
+		}
+		val := evalConstantWithDiags(mctx, &hclsyntax.ScopeTraversalExpr{
+			Traversal: traversal,
+			SrcRange:  traversal.SourceRange(),
+		}, cty.DynamicPseudoType, each, &diags)
+		start := &DynLiteral{
+			Value:    val,
+			SrcRange: traversal.SourceRange(),
+		}
+		return mctx.applyRefSteps(start, steps, each, diags)
+
+	case "Local":
+		local, exists := mctx.Config.Locals[name]
+		if !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unknown local value",
+				Detail:   fmt.Sprintf("There is no local value named %q.", name),
+				Subject:  &nameStep.SrcRange,
+			})
+			return placeholder, diags
+		}
+
+		// Locals are incorporated directly into the expression that refers
+		// to them, since CloudFormation has no equivalent concept.
+		start := evalDynamicWithDiags(mctx, local.Expr, NoEachState, &diags)
+		return mctx.applyRefSteps(start, steps[1:], each, diags)
+
+	case "Param":
+		param, exists := mctx.Config.Parameters[name]
+		if !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to undeclared parameter",
+				Detail:   fmt.Sprintf("There is no parameter named %q in this module.", name),
+				Subject:  &nameStep.SrcRange,
+			})
+			return placeholder, diags
+		}
+
+		if len(steps) > 1 {
+			if _, isAttr := steps[1].Static.(hcl.TraverseAttr); isAttr || !paramTypeCtyType(param.Type).IsListType() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid parameter reference",
+					Detail:   fmt.Sprintf("Parameter %q has type %s, so its value has no elements or attributes. Only parameters of list types can be indexed.", name, param.Type),
+					Subject:  &nameRange,
+				})
+				return placeholder, diags
+			}
+		}
+
+		var start DynExpr
+		switch {
+		case mctx.IsRootModule():
+			start = &DynRef{
+				LogicalID: name,
+				SrcRange:  nameRange,
+			}
+		case mctx.CallParameters[name] != nil:
+			// Parameters of child modules are not parameters of the
+			// flattened template, so we instead substitute the expression
+			// given for the parameter in the calling module.
+			attr := mctx.CallParameters[name]
+			start = evalDynamicWithDiags(mctx.Parent, attr.Expr, mctx.CallEach, &diags)
+		default:
+			// If the parameter isn't set then it must have a default,
+			// since otherwise we would've reported an error while loading
+			// the module.
+			val := evalConstantWithDiags(mctx, param.Default, paramTypeCtyType(param.Type), NoEachState, &diags)
+			start = &DynLiteral{
+				Value:    val,
+				SrcRange: nameRange,
+			}
+		}
+		return mctx.applyRefSteps(start, steps[1:], each, diags)
+
+	case "AWS":
+		logicalID, exists := pseudoParameters[name]
+		if !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported pseudo parameter",
+				Detail:   fmt.Sprintf("The AWS object has no attribute named %q.", name),
+				Subject:  &nameStep.SrcRange,
+			})
+			return placeholder, diags
+		}
+		start := &DynRef{
+			LogicalID: logicalID,
+			SrcRange:  nameRange,
+		}
+		return mctx.applyRefSteps(start, steps[1:], each, diags)
+
+	case "Condition":
+		if _, exists := mctx.Config.Conditions[name]; !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to undeclared condition",
+				Detail:   fmt.Sprintf("There is no condition named %q in this module.", name),
+				Subject:  &nameStep.SrcRange,
+			})
+			return placeholder, diags
+		}
+		start := &DynConditionRef{
+			ConditionName: moduleObjectID(mctx.Path, name),
+			SrcRange:      nameRange,
+		}
+		return mctx.applyRefSteps(start, steps[1:], each, diags)
+
+	case "Mapping":
+		if _, exists := mctx.Config.Mappings[name]; !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to undeclared mapping",
+				Detail:   fmt.Sprintf("There is no mapping named %q in this module.", name),
+				Subject:  &nameStep.SrcRange,
+			})
+			return placeholder, diags
+		}
+		keys := steps[1:]
+		if len(keys) < 2 {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Incomplete mapping lookup",
+				Detail:   fmt.Sprintf("A mapping lookup requires two keys, as in Mapping.%s[first][second].", name),
+				Subject:  &rng,
+			})
+			return placeholder, diags
+		}
+		start := &DynMappingLookup{
+			MappingName: moduleObjectID(mctx.Path, name),
+			FirstKey:    mctx.mappingKeyDynamic(keys[0], each, &diags),
+			SecondKey:   mctx.mappingKeyDynamic(keys[1], each, &diags),
+			SrcRange:    hcl.RangeBetween(root.SrcRange, keys[1].SourceRange()),
+		}
+		return mctx.applyRefSteps(start, keys[2:], each, diags)
+
+	case "Resource":
+		var static hcl.Traversal
+		static = append(static, root)
+		for _, step := range steps {
+			if step.Static == nil {
+				break
+			}
+			static = append(static, step.Static)
+		}
+		inst, instDiags := mctx.resourceInstanceForTraversal(static)
+		diags = append(diags, instDiags...)
+		if inst == nil {
+			return placeholder, diags
+		}
+
+		rest := steps[1:]
+		if mctx.Resources[name].IsForEach() {
+			rest = rest[1:]
+		}
+		instRange := hcl.RangeBetween(root.SrcRange, static[len(steps)-len(rest)].SourceRange())
+
+		attrStep, isAttr := hcl.TraverseAttr{}, false
+		if len(rest) > 0 {
+			attrStep, isAttr = rest[0].Static.(hcl.TraverseAttr)
+		}
+		if !isAttr {
+			start := &DynRef{
+				LogicalID: inst.LogicalID,
+				SrcRange:  instRange,
+			}
+			return mctx.applyRefSteps(start, rest, each, diags)
+		}
+
+		attrName, attrSteps := attrStep.Name, 1
+		if rsch, exists := mctx.Global.Schema.LookupResourceType(inst.Config.Type); exists {
+			var attrDiags hcl.Diagnostics
+			attrName, attrSteps, attrDiags = resourceAttrName(rsch, rest)
+			diags = append(diags, attrDiags...)
+			if attrDiags.HasErrors() {
+				return placeholder, diags
+			}
+		}
+		attrRange := hcl.RangeBetween(attrStep.SrcRange, rest[attrSteps-1].SourceRange())
+		start := &DynGetAttr{
+			LogicalID: inst.LogicalID,
+			Attrs: []DynExpr{
+				&DynLiteral{
+					Value:    cty.StringVal(attrName),
+					SrcRange: attrRange,
+				},
+			},
+			SrcRange: hcl.RangeBetween(instRange, attrRange),
+		}
+		return mctx.applyRefSteps(start, rest[attrSteps:], each, diags)
+
+	case "Module":
+		childEach, exists := mctx.Children[name]
+		if !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to undeclared module",
+				Detail:   fmt.Sprintf("There is no module named %q in this module.", name),
+				Subject:  &nameStep.SrcRange,
+			})
+			return placeholder, diags
+		}
+
+		rest := steps[1:]
+		var child *ModuleContext
+		if childEach.IsForEach() {
+			var keyStep hcl.TraverseIndex
+			var hasKey bool
+			if len(rest) > 0 {
+				keyStep, hasKey = rest[0].Static.(hcl.TraverseIndex)
+			}
+			if !hasKey {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Missing module instance key",
+					Detail:   fmt.Sprintf("Module %q has ForEach set, so a particular instance must be selected by a constant key.", name),
+					Subject:  &rng,
+				})
+				return placeholder, diags
+			}
+			key := addr.MakeEachIndex(keyStep.Key)
+			if key == addr.NoEachIndex || key.EachType() != childEach.EachType {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid module instance key",
+					Detail:   fmt.Sprintf("The key for an instance of module %q must be a %s.", name, eachTypeFriendlyName(childEach.EachType)),
+					Subject:  &keyStep.SrcRange,
+				})
+				return placeholder, diags
+			}
+			child = childEach.Index(key)
+			if child == nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Reference to undeclared module instance",
+					Detail:   fmt.Sprintf("Module %q has no instance with the key %s.", name, key),
+					Subject:  &keyStep.SrcRange,
+				})
+				return placeholder, diags
+			}
+			rest = rest[1:]
+		} else {
+			child = childEach.Single()
+		}
+
+		var outputStep hcl.TraverseAttr
+		var hasOutput bool
+		if len(rest) > 0 {
+			outputStep, hasOutput = rest[0].Static.(hcl.TraverseAttr)
+		}
+		if !hasOutput {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing module output name",
+				Detail:   "A reference to a module must select one of its outputs by name.",
+				Subject:  &rng,
+			})
+			return placeholder, diags
+		}
+		output, exists := child.Config.Outputs[outputStep.Name]
+		if !exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to undeclared module output",
+				Detail:   fmt.Sprintf("Module %q has no output named %q.", name, outputStep.Name),
+				Subject:  &outputStep.SrcRange,
+			})
+			return placeholder, diags
+		}
+
+		start := evalDynamicWithDiags(child, output.Value, NoEachState, &diags)
+		return mctx.applyRefSteps(start, rest[1:], each, diags)
+
+	default:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown object",
+			Detail:   fmt.Sprintf("There is no object named %q.", root.Name),
+			Subject:  &root.SrcRange,
+		})
+		return &DynLiteral{
+			Value:    cty.DynamicVal,
+			SrcRange: root.SrcRange,
+		}, diags
+	}
+}
+
+// applyRefSteps applies the given reference steps to the given start
+// expression, appending any diagnostics to the given diagnostics and
+// returning them along with the result.
+func (mctx *ModuleContext) applyRefSteps(start DynExpr, steps []refStep, each EachState, diags hcl.Diagnostics) (DynExpr, hcl.Diagnostics) {
+	expr := start
+	for _, step := range steps {
+		if step.Static != nil {
+			var stepDiags hcl.Diagnostics
+			expr, stepDiags = mctx.evalTraversalDynamic(expr, hcl.Traversal{step.Static}, each)
+			diags = append(diags, stepDiags...)
+			if stepDiags.HasErrors() {
+				break
+			}
+			continue
+		}
+
+		index := evalDynamicWithDiags(mctx, step.Key, each, &diags)
+		expr = &DynIndex{
+			List:     expr,
+			Index:    index,
+			SrcRange: hcl.RangeBetween(expr.SourceRange(), step.Key.Range()),
+		}
+	}
+	return expr, diags
+}
+
+// resourceAttrName finds the attribute of the given resource type that is
+// selected by the leading attribute steps of the given traversal steps,
+// returning its name and the number of steps it consumes.
+//
+// Some attribute names contain dots, such as Endpoint.Address, which are
+// written as nested attribute accesses. Where more than one attribute could
+// match, the one with the longest name is selected.
+func resourceAttrName(rsch *schema.ResourceType, steps []refStep) (string, int, hcl.Diagnostics) {
+	var names []string
+	for _, step := range steps {
+		attrStep, isAttr := step.Static.(hcl.TraverseAttr)
+		if !isAttr {
+			break
+		}
+		names = append(names, attrStep.Name)
+	}
+
+	for n := len(names); n > 1; n-- {
+		name := strings.Join(names[:n], ".")
+		if _, exists := rsch.Attributes[name]; exists {
+			return name, n, nil
+		}
+	}
+	if _, exists := rsch.LookupAttribute(names[0]); exists {
+		return names[0], 1, nil
+	}
+
+	// If the leading steps name a group of nested attributes then we can
+	// give a more helpful error message.
+	prefix := 0
+	var example string
+	for prefix < len(names) {
+		nested := nestedAttrNames(rsch, strings.Join(names[:prefix+1], "."))
+		if len(nested) == 0 {
+			break
+		}
+		example = nested[0]
+		prefix++
+	}
+
+	var detail string
+	switch {
+	case prefix == len(names):
+		detail = fmt.Sprintf(
+			"Resource type %s does not have an attribute named %q, but it has nested attributes such as %s.",
+			rsch.Name, strings.Join(names, "."), example,
+		)
+		prefix--
+	default:
+		detail = fmt.Sprintf(
+			"Resource type %s does not have an attribute named %q.",
+			rsch.Name, strings.Join(names[:prefix+1], "."),
+		)
+	}
+	return "", 0, hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Unsupported attribute",
+			Detail:   detail,
+			Subject:  hcl.RangeBetween(steps[0].SourceRange(), steps[prefix].SourceRange()).Ptr(),
+		},
+	}
+}
+
+// nestedAttrNames returns the sorted names of the attributes of the given
+// resource type that are nested inside the given name.
+func nestedAttrNames(rsch *schema.ResourceType, name string) []string {
+	var ret []string
+	for attrName := range rsch.Attributes {
+		if strings.HasPrefix(attrName, name+".") {
+			ret = append(ret, attrName)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// mappingKeyDynamic lowers one of the key steps of a mapping lookup.
+// Attribute steps are interpreted as literal keys, as with object attributes.
+func (mctx *ModuleContext) mappingKeyDynamic(step refStep, each EachState, diags *hcl.Diagnostics) DynExpr {
+	switch ts := step.Static.(type) {
+	case hcl.TraverseAttr:
+		return &DynLiteral{
+			Value:    cty.StringVal(ts.Name),
+			SrcRange: ts.SrcRange,
+		}
+	case hcl.TraverseIndex:
+		key, err := convert.Convert(ts.Key, cty.String)
+		if err != nil {
+			*diags = append(*diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid mapping key",
+				Detail:   fmt.Sprintf("Mapping keys must be strings: %s.", err),
+				Subject:  &ts.SrcRange,
+			})
+			key = cty.DynamicVal
+		}
+		return &DynLiteral{
+			Value:    key,
+			SrcRange: ts.SrcRange,
+		}
+	case nil:
+		return evalDynamicWithDiags(mctx, step.Key, each, diags)
+	default:
+		*diags = append(*diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid mapping key",
+			Detail:   "Each key of a mapping lookup must be given either as an attribute or an index.",
+			Subject:  step.Static.SourceRange().Ptr(),
+		})
+		return &DynLiteral{
+			Value:    cty.DynamicVal,
+			SrcRange: step.Static.SourceRange(),
+		}
+	}
+}
+
+// moduleObjectID returns the identifier to use in the flattened template for
+// a named object, such as a condition or mapping, declared in the module
+// with the given path.
+func moduleObjectID(path addr.ModulePath, name string) string {
+	return addr.NameInModule{
+		Module: path,
+		Name:   name,
+	}.ID()
+}
@@ -0,0 +1,182 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+)
+
+func TestResourceAttrName(t *testing.T) {
+	rsch := &schema.ResourceType{
+		Name: "Example::Service::Widget",
+		Attributes: map[string]*schema.Attribute{
+			"Arn":              {Name: "Arn"},
+			"Endpoint.Address": {Name: "Endpoint.Address"},
+			"Endpoint.Port":    {Name: "Endpoint.Port"},
+			"Config":           {Name: "Config"},
+			"Config.Name":      {Name: "Config.Name"},
+			"Deep.Nested.Name": {Name: "Deep.Nested.Name"},
+		},
+	}
+
+	tests := map[string]struct {
+		Name  string
+		Steps int    // the number of steps consumed, or covered by the error
+		Err   string // the detail of the expected error, if any
+	}{
+		"Arn": {
+			"Arn", 1, "",
+		},
+		"Arn.Extra": {
+			"Arn", 1, "",
+		},
+		"Endpoint.Address": {
+			"Endpoint.Address", 2, "",
+		},
+		"Endpoint.Address.Extra": {
+			"Endpoint.Address", 2, "",
+		},
+		"Endpoint.Port[0]": {
+			"Endpoint.Port", 2, "",
+		},
+		"Config": {
+			"Config", 1, "",
+		},
+		"Config.Name": {
+			"Config.Name", 2, "",
+		},
+		"Config.Other": {
+			"Config", 1, "",
+		},
+		"Deep.Nested.Name": {
+			"Deep.Nested.Name", 3, "",
+		},
+		"Arn[0].Extra": {
+			"Arn", 1, "",
+		},
+		"Endpoint": {
+			"", 1, `Resource type Example::Service::Widget does not have an attribute named "Endpoint", but it has nested attributes such as Endpoint.Address.`,
+		},
+		"Deep.Nested": {
+			"", 2, `Resource type Example::Service::Widget does not have an attribute named "Deep.Nested", but it has nested attributes such as Deep.Nested.Name.`,
+		},
+		"Endpoint.Host": {
+			"", 2, `Resource type Example::Service::Widget does not have an attribute named "Endpoint.Host".`,
+		},
+		"Deep.Other.Name": {
+			"", 2, `Resource type Example::Service::Widget does not have an attribute named "Deep.Other".`,
+		},
+		"Missing": {
+			"", 1, `Resource type Example::Service::Widget does not have an attribute named "Missing".`,
+		},
+	}
+
+	for src, test := range tests {
+		t.Run(src, func(t *testing.T) {
+			traversal, diags := hclsyntax.ParseTraversalAbs([]byte("Resource.Widget."+src), "test.awsup", hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors parsing traversal: %s", diags.Error())
+			}
+			var steps []refStep
+			for _, step := range traversal[2:] {
+				steps = append(steps, refStep{Static: step})
+			}
+
+			name, n, diags := resourceAttrName(rsch, steps)
+			if test.Err != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("succeeded; want error %q", test.Err)
+				}
+				if got := diags[0].Detail; got != test.Err {
+					t.Errorf("wrong error\ngot:  %s\nwant: %s", got, test.Err)
+				}
+				wantRng := hcl.RangeBetween(steps[0].SourceRange(), steps[test.Steps-1].SourceRange())
+				if got := *diags[0].Subject; got != wantRng {
+					t.Errorf("wrong error range\ngot:  %s\nwant: %s", got, wantRng)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors: %s", diags.Error())
+			}
+			if name != test.Name || n != test.Steps {
+				t.Errorf("wrong result\ngot:  %q, %d\nwant: %q, %d", name, n, test.Name, test.Steps)
+			}
+		})
+	}
+}
+
+func TestNestedGetAttr(t *testing.T) {
+	ctx, diags := testRootContext(t, map[string]string{
+		"main.awsup": `
+Resource "Db" {
+  Type = "AWS::RDS::DBInstance"
+  Properties {
+    DBInstanceClass = "db.t3.micro"
+  }
+}
+`,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+	}
+
+	tests := map[string]struct {
+		Want string
+		Err  string
+	}{
+		"Resource.Db.Endpoint.Address": {
+			`GetAtt(Db, "Endpoint.Address")`,
+			"",
+		},
+		"Resource.Db.Endpoint.Port": {
+			`GetAtt(Db, "Endpoint.Port")`,
+			"",
+		},
+		"Resource.Db.Endpoint": {
+			"",
+			`Unsupported attribute: Resource type AWS::RDS::DBInstance does not have an attribute named "Endpoint", but it has nested attributes such as Endpoint.Address.`,
+		},
+		"Resource.Db.Endpoint.Host": {
+			"",
+			`Unsupported attribute: Resource type AWS::RDS::DBInstance does not have an attribute named "Endpoint.Host".`,
+		},
+	}
+
+	for src, test := range tests {
+		t.Run(src, func(t *testing.T) {
+			expr, diags := hclsyntax.ParseExpression([]byte(src), "test.awsup", hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors parsing expression: %s", diags.Error())
+			}
+
+			got, diags := ctx.RootModule.EvalDynamic(expr, NoEachState)
+			if test.Err != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("succeeded; want error %q", test.Err)
+				}
+				if got := diags[0].Summary + ": " + diags[0].Detail; got != test.Err {
+					t.Errorf("wrong error\ngot:  %s\nwant: %s", got, test.Err)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors: %s", diags.Error())
+			}
+			getAttr, ok := got.(*DynGetAttr)
+			if !ok || len(getAttr.Attrs) != 1 {
+				t.Fatalf("wrong result %#v", got)
+			}
+			lit, ok := getAttr.Attrs[0].(*DynLiteral)
+			if !ok {
+				t.Fatalf("wrong attribute %#v", getAttr.Attrs[0])
+			}
+			if got := fmt.Sprintf("GetAtt(%s, %q)", getAttr.LogicalID, lit.Value.AsString()); got != test.Want {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got, test.Want)
+			}
+		})
+	}
+}
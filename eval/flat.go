@@ -1,42 +1,118 @@
 package eval
 
 import (
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
 	"github.com/zclconf/go-cty/cty"
 )
 
 type FlatTemplate struct {
 	Description string
+	Transform   []string
 	Metadata    map[string]cty.Value
 	Parameters  map[string]*FlatParameter
 	Mappings    map[string]map[string]cty.Value
 	Conditions  map[string]DynExpr
 	Resources   map[string]*FlatResource
+	Rules       map[string]*FlatRule
 	Outputs     map[string]*FlatOutput
+
+	// The remaining fields record the configuration that the template-level
+	// objects above without flat types of their own were produced from, for
+	// use in source maps. TransformSources has an element for each element
+	// of Transform, and the others are keyed by the name of the object. A
+	// transform or metadata key declared by several modules is attributed
+	// to the first of them.
+	DescriptionRange hcl.Range
+	TransformSources []FlatSource
+	MetadataSources  map[string]FlatSource
+	MappingSources   map[string]FlatSource
+	ConditionSources map[string]FlatSource
+}
+
+// FlatSource describes the configuration construct that a template-level
+// object was produced from.
+type FlatSource struct {
+	Addr      addr.NameInModule
+	DeclRange hcl.Range
 }
 
 type FlatParameter struct {
-	Type           string
-	Description    string
-	DefaultValue   cty.Value
-	AllowedPattern cty.Value
-	AllowedValues  []cty.Value
-	MinLength      cty.Value
-	MaxLength      cty.Value
-	MinValue       cty.Value
-	MaxValue       cty.Value
-	NoEcho         cty.Value
+	Type                  string
+	Description           string
+	ConstraintDescription string
+	DefaultValue          cty.Value
+	AllowedPattern        cty.Value
+	AllowedValues         []cty.Value
+	MinLength             cty.Value
+	MaxLength             cty.Value
+	MinValue              cty.Value
+	MaxValue              cty.Value
+	NoEcho                cty.Value
+
+	// ValueRanges gives the source range of the expression that produced
+	// each of the above that is set, keyed by its name in the template.
+	ValueRanges map[string]hcl.Range
+
+	DeclRange hcl.Range
 }
 
 type FlatResource struct {
 	Type       string
-	Properties map[string]*DynExpr
-	Metadata   map[string]cty.Value
+	Properties map[string]DynExpr
+	Metadata   map[string]DynExpr
 	DependsOn  []string
 
-	// TODO: CreationPolicy, DeletionPolicy, UpdatePolicy
+	// Condition is the name of the condition that decides whether the
+	// resource is created, or empty if it is always created.
+	Condition string
+
+	// ConditionRange and DependsOnRanges give the source ranges of the
+	// expressions that produced Condition and each element of DependsOn.
+	ConditionRange  hcl.Range
+	DependsOnRanges []hcl.Range
+
+	// DeletionPolicy and UpdateReplacePolicy are empty if not set, and
+	// CreationPolicy and UpdatePolicy are nil if not set.
+	DeletionPolicy      string
+	UpdateReplacePolicy string
+	CreationPolicy      DynExpr
+	UpdatePolicy        DynExpr
+
+	// Schema describes the resource type, or is nil if the type is not
+	// known to the schema.
+	Schema *schema.ResourceType
+
+	// Addr is the address of the resource instance in the module tree that
+	// this flat resource was produced from.
+	Addr      addr.NameInModule
+	DeclRange hcl.Range
+}
+
+type FlatRule struct {
+	// Condition is nil if the assertions are always checked.
+	Condition  DynExpr
+	Assertions []*FlatRuleAssertion
+
+	// Addr is the address of the rule in the module tree.
+	Addr      addr.NameInModule
+	DeclRange hcl.Range
+}
+
+type FlatRuleAssertion struct {
+	Assert      DynExpr
+	Description string
 }
 
 type FlatOutput struct {
-	Value      DynExpr
-	ExportName DynExpr
+	Description string
+	Value       DynExpr
+	ExportName  DynExpr
+
+	// Condition is the name of the condition that decides whether the
+	// output is produced, or empty if it is always produced.
+	Condition string
+
+	DeclRange hcl.Range
 }
@@ -0,0 +1,519 @@
+package eval
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// constantFunctions is the table of functions available when evaluating
+// constant expressions.
+//
+// Each of the functions that CloudFormation can also evaluate dynamically
+// is lowered to its CloudFormation equivalent by evalFunctionCallDynamic
+// when called with non-constant arguments, so the two must be kept in sync.
+var constantFunctions = map[string]function.Function{
+	"base64encode": base64EncodeFunc,
+	"element":      elementFunc,
+	"join":         joinFunc,
+	"split":        splitFunc,
+
+	"azs":          dynamicOnlyFunc("azs"),
+	"import_value": dynamicOnlyFunc("import_value"),
+	"transform":    dynamicOnlyFunc("transform"),
+
+	"contains":           ruleOnlyFunc("contains"),
+	"each_member_equals": ruleOnlyFunc("each_member_equals"),
+	"each_member_in":     ruleOnlyFunc("each_member_in"),
+	"ref_all":            ruleOnlyFunc("ref_all"),
+	"value_of":           ruleOnlyFunc("value_of"),
+}
+
+// dynamicOnlyFunctions are the functions whose results can be known only
+// once CloudFormation applies the template, and so which always produce
+// dynamic expressions even when their arguments are constant.
+var dynamicOnlyFunctions = map[string]bool{
+	"azs":          true,
+	"import_value": true,
+	"transform":    true,
+
+	"contains":           true,
+	"each_member_equals": true,
+	"each_member_in":     true,
+	"ref_all":            true,
+	"value_of":           true,
+}
+
+var base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+var elementFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "index",
+			Type: cty.Number,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		listTy := args[0].Type()
+		switch {
+		case listTy.IsListType():
+			return listTy.ElementType(), nil
+		case listTy.IsTupleType():
+			// The result type depends on which element is selected, which
+			// we can know only if the index is known.
+			if !args[1].IsKnown() {
+				return cty.DynamicPseudoType, nil
+			}
+			idx, err := elementIndex(args[1], len(listTy.TupleElementTypes()))
+			if err != nil {
+				return cty.NilType, err
+			}
+			return listTy.TupleElementType(idx), nil
+		default:
+			return cty.NilType, fmt.Errorf("a list is required")
+		}
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		idx, err := elementIndex(args[1], args[0].LengthInt())
+		if err != nil {
+			return cty.UnknownVal(retType), err
+		}
+		return args[0].Index(cty.NumberIntVal(int64(idx))), nil
+	},
+})
+
+// elementIndex returns the given index as an int, or an error if it is not
+// a valid index for a list of the given length.
+func elementIndex(index cty.Value, length int) (int, error) {
+	var idx int
+	if err := gocty.FromCtyValue(index, &idx); err != nil {
+		return 0, fmt.Errorf("invalid index: %s", err)
+	}
+	// Unlike some other languages, CloudFormation's Fn::Select does not
+	// wrap around at the end of the list, so we don't either.
+	if idx < 0 || idx >= length {
+		return 0, fmt.Errorf("index %d is out of range for a list of %d elements", idx, length)
+	}
+	return idx, nil
+}
+
+var joinFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "delimiter",
+			Type: cty.String,
+		},
+		{
+			Name: "list",
+			Type: cty.List(cty.String),
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var parts []string
+		if err := gocty.FromCtyValue(args[1], &parts); err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		return cty.StringVal(strings.Join(parts, args[0].AsString())), nil
+	},
+})
+
+var splitFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "delimiter",
+			Type: cty.String,
+		},
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		parts := strings.Split(args[1].AsString(), args[0].AsString())
+		vals := make([]cty.Value, len(parts))
+		for i, part := range parts {
+			vals[i] = cty.StringVal(part)
+		}
+		return cty.ListVal(vals), nil
+	},
+})
+
+// dynamicOnlyFunc returns a placeholder function for use in constant
+// expressions, which always fails with an explanatory error.
+func dynamicOnlyFunc(name string) function.Function {
+	return function.New(&function.Spec{
+		VarParam: &function.Parameter{
+			Name: "args",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return cty.NilType, fmt.Errorf("%s can be used only in dynamic expressions, such as resource properties", name)
+		},
+	})
+}
+
+// ruleOnlyFunc is like dynamicOnlyFunc but for the functions that
+// CloudFormation supports only in the assertions of rules.
+func ruleOnlyFunc(name string) function.Function {
+	return function.New(&function.Spec{
+		VarParam: &function.Parameter{
+			Name: "args",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return cty.NilType, fmt.Errorf("%s can be used only in rules", name)
+		},
+	})
+}
+
+// callsDynamicOnlyFunction returns true if the given expression contains
+// a call to any of the functions in dynamicOnlyFunctions.
+func callsDynamicOnlyFunction(expr hcl.Expression) bool {
+	node, ok := expr.(hclsyntax.Node)
+	if !ok {
+		return false
+	}
+
+	found := false
+	hclsyntax.VisitAll(node, func(node hclsyntax.Node) hcl.Diagnostics {
+		switch tn := node.(type) {
+		case *hclsyntax.FunctionCallExpr:
+			if dynamicOnlyFunctions[tn.Name] {
+				found = true
+			}
+		case *hclsyntax.RelativeTraversalExpr:
+			// HCL doesn't visit the source of a relative traversal itself.
+			if callsDynamicOnlyFunction(tn.Source) {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// parameterNameForExpr returns the name of the parameter that the given
+// expression refers to, if it is a reference of the form Param.Name.
+func parameterNameForExpr(expr hcl.Expression) (string, bool) {
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() || len(traversal) != 2 || traversal.RootName() != "Param" {
+		return "", false
+	}
+	step, isAttr := traversal[1].(hcl.TraverseAttr)
+	if !isAttr {
+		return "", false
+	}
+	return step.Name, true
+}
+
+// evalFunctionCallDynamic lowers a call to one of the functions that have
+// an equivalent in the CloudFormation language into a DynExpr.
+func (mctx *ModuleContext) evalFunctionCallDynamic(call *hclsyntax.FunctionCallExpr, each EachState) (DynExpr, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	rng := call.Range()
+	placeholder := &DynLiteral{
+		Value:    cty.DynamicVal,
+		SrcRange: rng,
+	}
+
+	if call.ExpandFinal {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Illegal use of non-constant value",
+			Detail:   "Arguments can be expanded with \"...\" only when calling a function with constant values.",
+			Subject:  &rng,
+		})
+		return placeholder, diags
+	}
+
+	wantArgs := func(min, max int) bool {
+		if len(call.Args) >= min && len(call.Args) <= max {
+			return true
+		}
+		var detail string
+		switch {
+		case min == max:
+			detail = fmt.Sprintf("Function %q expects %d argument(s).", call.Name, min)
+		default:
+			detail = fmt.Sprintf("Function %q expects between %d and %d arguments.", call.Name, min, max)
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Incorrect number of function arguments",
+			Detail:   detail,
+			Subject:  &rng,
+		})
+		return false
+	}
+
+	switch call.Name {
+
+	case "base64encode":
+		if !wantArgs(1, 1) {
+			return placeholder, diags
+		}
+		str := evalDynamicWithDiags(mctx, call.Args[0], each, &diags)
+		return &DynBase64{
+			String:   str,
+			SrcRange: rng,
+		}, diags
+
+	case "element":
+		if !wantArgs(2, 2) {
+			return placeholder, diags
+		}
+		if name, isParam := parameterNameForExpr(call.Args[0]); isParam {
+			// A parameter's value is known only to CloudFormation, so we
+			// must check its declared type instead.
+			if param, exists := mctx.Config.Parameters[name]; exists && !paramTypeCtyType(param.Type).IsListType() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid function argument",
+					Detail:   fmt.Sprintf("Parameter %q has type %s, so its value is not a list. Only parameters of list types can be used with element.", name, param.Type),
+					Subject:  call.Args[0].Range().Ptr(),
+				})
+				return placeholder, diags
+			}
+		}
+		list := evalDynamicWithDiags(mctx, call.Args[0], each, &diags)
+		index := evalDynamicWithDiags(mctx, call.Args[1], each, &diags)
+		if lit, isLit := index.(*DynLiteral); isLit && lit.Value.IsKnown() && !lit.Value.IsNull() {
+			// With a constant index we may be able to select the element
+			// statically, just as for the index operator.
+			ret, stepDiags := mctx.evalTraversalDynamic(list, hcl.Traversal{
+				hcl.TraverseIndex{
+					Key:      lit.Value,
+					SrcRange: lit.SrcRange,
+				},
+			}, each)
+			diags = append(diags, stepDiags...)
+			return ret, diags
+		}
+		return &DynIndex{
+			List:     list,
+			Index:    index,
+			SrcRange: rng,
+		}, diags
+
+	case "join":
+		if !wantArgs(2, 2) {
+			return placeholder, diags
+		}
+		delim := evalConstantWithDiags(mctx, call.Args[0], cty.String, each, &diags)
+		if delim.IsNull() {
+			return placeholder, diags
+		}
+		ret := &DynJoin{
+			Delimiter: delim.AsString(),
+			SrcRange:  rng,
+		}
+		list := evalDynamicWithDiags(mctx, call.Args[1], each, &diags)
+		if tl, isList := list.(*DynList); isList {
+			ret.Exprs = tl.Exprs
+		} else {
+			ret.List = list
+		}
+		return ret, diags
+
+	case "split":
+		if !wantArgs(2, 2) {
+			return placeholder, diags
+		}
+		delim := evalConstantWithDiags(mctx, call.Args[0], cty.String, each, &diags)
+		if delim.IsNull() {
+			return placeholder, diags
+		}
+		str := evalDynamicWithDiags(mctx, call.Args[1], each, &diags)
+		return &DynSplit{
+			Delimiter: delim.AsString(),
+			String:    str,
+			SrcRange:  rng,
+		}, diags
+
+	case "azs":
+		if !wantArgs(0, 1) {
+			return placeholder, diags
+		}
+		// An empty region name selects the region where the template is
+		// being applied.
+		var region DynExpr = &DynLiteral{
+			Value:    cty.StringVal(""),
+			SrcRange: rng,
+		}
+		if len(call.Args) == 1 {
+			region = evalDynamicWithDiags(mctx, call.Args[0], each, &diags)
+		}
+		return &DynAccountAZs{
+			RegionName: region,
+			SrcRange:   rng,
+		}, diags
+
+	case "import_value":
+		if !wantArgs(1, 1) {
+			return placeholder, diags
+		}
+		name := evalDynamicWithDiags(mctx, call.Args[0], each, &diags)
+		return &DynImportValue{
+			Name:     name,
+			SrcRange: rng,
+		}, diags
+
+	case "transform":
+		if !wantArgs(2, 2) {
+			return placeholder, diags
+		}
+		name := evalConstantWithDiags(mctx, call.Args[0], cty.String, each, &diags)
+		params := evalDynamicWithDiags(mctx, call.Args[1], each, &diags)
+		if diags.HasErrors() || name.IsNull() {
+			return placeholder, diags
+		}
+		if name.AsString() == "AWS::Include" && !dynObjectHasAttr(params, "Location") {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid function argument",
+				Detail:   "The AWS::Include transform requires a parameter named Location, giving the Amazon S3 URI of the snippet to include.",
+				Subject:  call.Args[1].Range().Ptr(),
+			})
+			return placeholder, diags
+		}
+		return &DynTransform{
+			Name:       name.AsString(),
+			Parameters: params,
+			SrcRange:   rng,
+		}, diags
+
+	case "contains", "each_member_equals":
+		if !wantArgs(2, 2) {
+			return placeholder, diags
+		}
+		list := evalDynamicWithDiags(mctx, call.Args[0], each, &diags)
+		value := evalDynamicWithDiags(mctx, call.Args[1], each, &diags)
+		if call.Name == "contains" {
+			return &DynContains{
+				List:     list,
+				Value:    value,
+				SrcRange: rng,
+			}, diags
+		}
+		return &DynEachMemberEquals{
+			List:     list,
+			Value:    value,
+			SrcRange: rng,
+		}, diags
+
+	case "each_member_in":
+		if !wantArgs(2, 2) {
+			return placeholder, diags
+		}
+		list := evalDynamicWithDiags(mctx, call.Args[0], each, &diags)
+		allowed := evalDynamicWithDiags(mctx, call.Args[1], each, &diags)
+		return &DynEachMemberIn{
+			List:     list,
+			Allowed:  allowed,
+			SrcRange: rng,
+		}, diags
+
+	case "value_of":
+		if !wantArgs(2, 2) {
+			return placeholder, diags
+		}
+		param := evalDynamicWithDiags(mctx, call.Args[0], each, &diags)
+		attr := evalConstantWithDiags(mctx, call.Args[1], cty.String, each, &diags)
+		if diags.HasErrors() || attr.IsNull() {
+			return placeholder, diags
+		}
+		ref, isRef := param.(*DynRef)
+		if !isRef {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid function argument",
+				Detail:   "The first argument to value_of must be a reference to a parameter, such as Param.VpcId.",
+				Subject:  call.Args[0].Range().Ptr(),
+			})
+			return placeholder, diags
+		}
+		return &DynValueOf{
+			ParameterName: ref.LogicalID,
+			Attribute:     attr.AsString(),
+			SrcRange:      rng,
+		}, diags
+
+	case "ref_all":
+		if !wantArgs(1, 1) {
+			return placeholder, diags
+		}
+		ty := evalConstantWithDiags(mctx, call.Args[0], cty.String, each, &diags)
+		if diags.HasErrors() || ty.IsNull() {
+			return placeholder, diags
+		}
+		if _, isAWS := awsSpecificParamTypes[ty.AsString()]; !isAWS {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid function argument",
+				Detail:   fmt.Sprintf("The argument to ref_all must be an AWS-specific parameter type, such as \"AWS::EC2::VPC::Id\", but %q is not.", ty.AsString()),
+				Subject:  call.Args[0].Range().Ptr(),
+			})
+			return placeholder, diags
+		}
+		return &DynRefAll{
+			ParameterType: ty.AsString(),
+			SrcRange:      rng,
+		}, diags
+
+	default:
+		if _, isConstFunc := constantFunctions[call.Name]; isConstFunc {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Illegal use of non-constant value",
+				Detail:   fmt.Sprintf("CloudFormation has no equivalent of the function %q, so it can be called only with constant arguments.", call.Name),
+				Subject:  &rng,
+			})
+			return placeholder, diags
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Call to unknown function",
+			Detail:   fmt.Sprintf("There is no function named %q.", call.Name),
+			Subject:  &call.NameRange,
+		})
+		return placeholder, diags
+	}
+}
+
+// dynObjectHasAttr returns true if the given expression is an object that
+// has an attribute of the given name.
+func dynObjectHasAttr(expr DynExpr, name string) bool {
+	switch te := expr.(type) {
+	case *DynObject:
+		_, exists := te.Attrs[name]
+		return exists
+	case *DynLiteral:
+		ty := te.Value.Type()
+		return (ty.IsObjectType() && ty.HasAttribute(name)) || (ty.IsMapType() && te.Value.IsKnown() && !te.Value.IsNull() && te.Value.HasIndex(cty.StringVal(name)).True())
+	default:
+		return false
+	}
+}
@@ -0,0 +1,243 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// resolvedMove is a Moved block whose addresses have been resolved to
+// absolute resource addresses.
+type resolvedMove struct {
+	From, To  addr.NameInModule
+	DeclRange hcl.Range
+}
+
+// applyMoves resolves all of the Moved blocks throughout the module tree
+// and updates the logical ids of the resource instances they target so that
+// each retains the id it had at its original address.
+//
+// This must be called only once the whole module tree has been loaded, since
+// a move may refer to resources in any descendent of the module that
+// declares it.
+func (ctx *RootContext) applyMoves() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	instances := map[string]*ResourceInstance{}
+	var moves []*resolvedMove
+	ctx.VisitModules(func(mctx *ModuleContext) bool {
+		for _, each := range mctx.Resources {
+			for _, inst := range each.Instances {
+				instances[inst.Addr.String()] = inst
+			}
+		}
+		for _, mcfg := range mctx.Config.Moved {
+			from, fromDiags := mctx.movedAddr(mcfg.From, "From", mcfg.DeclRange)
+			diags = append(diags, fromDiags...)
+			to, toDiags := mctx.movedAddr(mcfg.To, "To", mcfg.DeclRange)
+			diags = append(diags, toDiags...)
+			if fromDiags.HasErrors() || toDiags.HasErrors() {
+				continue
+			}
+			moves = append(moves, &resolvedMove{
+				From:      from,
+				To:        to,
+				DeclRange: mcfg.DeclRange,
+			})
+		}
+		return true
+	})
+
+	// Modules are visited in no particular order, so we sort the moves by
+	// their location in order that diagnostics are reported consistently.
+	sort.SliceStable(moves, func(i, j int) bool {
+		a, b := moves[i].DeclRange, moves[j].DeclRange
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Start.Byte < b.Start.Byte
+	})
+
+	byFrom := map[string]*resolvedMove{}
+	byTo := map[string]*resolvedMove{}
+	var valid []*resolvedMove
+	for _, move := range moves {
+		fromKey, toKey := move.From.String(), move.To.String()
+		if fromKey == toKey {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Redundant move",
+				Detail:   fmt.Sprintf("This block moves %s to itself.", move.From),
+				Subject:  move.DeclRange.Ptr(),
+			})
+			continue
+		}
+		if other, exists := byFrom[fromKey]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Conflicting moves",
+				Detail:   fmt.Sprintf("Resource %s was already moved to %s by the block at %s.", move.From, other.To, other.DeclRange),
+				Subject:  move.DeclRange.Ptr(),
+			})
+			continue
+		}
+		if other, exists := byTo[toKey]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Conflicting moves",
+				Detail:   fmt.Sprintf("Resource %s was already moved from %s by the block at %s.", move.To, other.From, other.DeclRange),
+				Subject:  move.DeclRange.Ptr(),
+			})
+			continue
+		}
+		if _, exists := instances[fromKey]; exists {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Moved resource still exists",
+				Detail:   fmt.Sprintf("Resource %s is still declared, so it cannot also be moved to %s.", move.From, move.To),
+				Subject:  move.DeclRange.Ptr(),
+			})
+			continue
+		}
+		byFrom[fromKey] = move
+		byTo[toKey] = move
+		valid = append(valid, move)
+	}
+
+	// The addresses in a cycle of moves need not exist at all, so cycles
+	// are detected by following the moves alone. Each move has at most one
+	// successor, so a move is in a cycle if following its successors leads
+	// back to it.
+	inCycle := map[*resolvedMove]bool{}
+	for _, move := range valid {
+		if inCycle[move] {
+			continue
+		}
+		next := byFrom[move.To.String()]
+		for i := 0; next != nil && next != move && i < len(valid); i++ {
+			next = byFrom[next.To.String()]
+		}
+		if next != move {
+			continue
+		}
+		for {
+			inCycle[next] = true
+			next = byFrom[next.To.String()]
+			if next == move {
+				break
+			}
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Cyclic moves",
+			Detail:   fmt.Sprintf("The move from %s to %s is part of a cycle of moves that leads back to %s.", move.From, move.To, move.From),
+			Subject:  move.DeclRange.Ptr(),
+		})
+	}
+
+	for _, move := range valid {
+		if inCycle[move] {
+			continue
+		}
+		toKey := move.To.String()
+		inst, exists := instances[toKey]
+		if exists && inst.explicitID {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Move overridden by explicit logical id",
+				Detail:   fmt.Sprintf("Resource %s sets LogicalId, which takes precedence over the logical id of %s.", move.To, move.From),
+				Subject:  move.DeclRange.Ptr(),
+			})
+			continue
+		}
+		if !exists {
+			if _, chained := byFrom[toKey]; !chained {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Move targets nothing",
+					Detail:   fmt.Sprintf("There is no resource %s, so this block has no effect.", move.To),
+					Subject:  move.DeclRange.Ptr(),
+				})
+			}
+			continue
+		}
+
+		// Follow the chain of moves back to the original address, so that
+		// a resource moved several times keeps the id from its first
+		// location. Moves that are not in a cycle can't be preceded by one,
+		// so this always terminates.
+		orig := move
+		for {
+			prev, exists := byTo[orig.From.String()]
+			if !exists {
+				break
+			}
+			orig = prev
+		}
+
+		inst.LogicalID = orig.From.ID()
+	}
+
+	return diags
+}
+
+// movedAddr resolves an address expression from a Moved block into an
+// absolute resource address. The expression may be either a direct reference
+// or a string containing one, the latter being needed to select ForEach
+// instances by key.
+func (mctx *ModuleContext) movedAddr(expr hcl.Expression, argName string, declRange hcl.Range) (addr.NameInModule, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	if len(expr.Variables()) == 0 {
+		val, valDiags := expr.Value(nil)
+		diags = append(diags, valDiags...)
+		if valDiags.HasErrors() {
+			return addr.NameInModule{}, diags
+		}
+		if val.IsNull() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing required argument",
+				Detail:   fmt.Sprintf("A Moved block requires the argument %q.", argName),
+				Subject:  declRange.Ptr(),
+			})
+			return addr.NameInModule{}, diags
+		}
+		if val.Type() != cty.String {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid resource address",
+				Detail:   "A resource address must be given either as a reference or as a string containing one.",
+				Subject:  expr.Range().Ptr(),
+			})
+			return addr.NameInModule{}, diags
+		}
+
+		start := expr.Range().Start
+		if _, isTemplate := expr.(*hclsyntax.TemplateExpr); isTemplate {
+			start.Column++ // skip the opening quote
+			start.Byte++
+		}
+		traversal, travDiags := hclsyntax.ParseTraversalAbs([]byte(val.AsString()), expr.Range().Filename, start)
+		diags = append(diags, travDiags...)
+		if travDiags.HasErrors() {
+			return addr.NameInModule{}, diags
+		}
+		ret, addrDiags := addr.ParseResourceNameInModule(mctx.Path, traversal)
+		diags = append(diags, addrDiags...)
+		return ret, diags
+	}
+
+	traversal, travDiags := hcl.AbsTraversalForExpr(expr)
+	diags = append(diags, travDiags...)
+	if travDiags.HasErrors() {
+		return addr.NameInModule{}, diags
+	}
+	ret, addrDiags := addr.ParseResourceNameInModule(mctx.Path, traversal)
+	diags = append(diags, addrDiags...)
+	return ret, diags
+}
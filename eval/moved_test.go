@@ -0,0 +1,276 @@
+package eval
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/config"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+func TestApplyMoves(t *testing.T) {
+	tests := map[string]struct {
+		Config    string
+		WantIDs   map[string]string
+		WantDiags []string
+	}{
+		"single move": {
+			`
+Resource "New" {
+  Type = "AWS::SNS::Topic"
+}
+
+Moved {
+  From = Resource.Old
+  To   = Resource.New
+}
+`,
+			map[string]string{"New": "Old"},
+			nil,
+		},
+		"chained moves": {
+			`
+Resource "Third" {
+  Type = "AWS::SNS::Topic"
+}
+
+Moved {
+  From = Resource.Second
+  To   = Resource.Third
+}
+
+Moved {
+  From = Resource.First
+  To   = Resource.Second
+}
+`,
+			map[string]string{"Third": "First"},
+			nil,
+		},
+		"move given as a string": {
+			`
+Resource "New" {
+  Type    = "AWS::SNS::Topic"
+  ForEach = { a = "x" }
+}
+
+Moved {
+  From = "Resource.Old"
+  To   = "Resource.New[\"a\"]"
+}
+`,
+			map[string]string{`New["a"]`: "Old"},
+			nil,
+		},
+		"cycle of addresses that don't exist": {
+			`
+Resource "Other" {
+  Type = "AWS::SNS::Topic"
+}
+
+Moved {
+  From = Resource.A
+  To   = Resource.B
+}
+
+Moved {
+  From = Resource.B
+  To   = Resource.A
+}
+`,
+			map[string]string{"Other": "Other"},
+			[]string{"Cyclic moves"},
+		},
+		"cycle through an existing resource": {
+			`
+Resource "C" {
+  Type = "AWS::SNS::Topic"
+}
+
+Moved {
+  From = Resource.A
+  To   = Resource.B
+}
+
+Moved {
+  From = Resource.B
+  To   = Resource.C
+}
+
+Moved {
+  From = Resource.C
+  To   = Resource.A
+}
+`,
+			// The move away from C is rejected, which leaves a chain of moves
+			// rather than a cycle.
+			map[string]string{"C": "A"},
+			[]string{"Moved resource still exists"},
+		},
+		"overridden by explicit logical id": {
+			`
+Resource "New" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "Explicit"
+}
+
+Moved {
+  From = Resource.Old
+  To   = Resource.New
+}
+`,
+			map[string]string{"New": "Explicit"},
+			[]string{"Move overridden by explicit logical id"},
+		},
+		"target does not exist": {
+			`
+Moved {
+  From = Resource.Old
+  To   = Resource.New
+}
+`,
+			map[string]string{},
+			[]string{"Move targets nothing"},
+		},
+		"redundant": {
+			`
+Resource "A" {
+  Type = "AWS::SNS::Topic"
+}
+
+Moved {
+  From = Resource.A
+  To   = Resource.A
+}
+`,
+			map[string]string{"A": "A"},
+			[]string{"Redundant move"},
+		},
+		"conflicting": {
+			`
+Resource "New" {
+  Type = "AWS::SNS::Topic"
+}
+
+Moved {
+  From = Resource.Old
+  To   = Resource.New
+}
+
+Moved {
+  From = Resource.Older
+  To   = Resource.New
+}
+`,
+			map[string]string{"New": "Old"},
+			[]string{"Conflicting moves"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{"main.awsup": test.Config})
+
+			var gotDiags []string
+			for _, diag := range diags {
+				gotDiags = append(gotDiags, diag.Summary)
+			}
+			if !equalStrings(gotDiags, test.WantDiags) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", gotDiags, test.WantDiags)
+			}
+
+			gotIDs := map[string]string{}
+			ctx.VisitModules(func(mctx *ModuleContext) bool {
+				for _, each := range mctx.Resources {
+					for _, inst := range each.Instances {
+						gotIDs[inst.Addr.String()] = inst.LogicalID
+					}
+				}
+				return true
+			})
+			if len(gotIDs) != len(test.WantIDs) {
+				t.Errorf("wrong logical ids\ngot:  %#v\nwant: %#v", gotIDs, test.WantIDs)
+			}
+			for key, want := range test.WantIDs {
+				if got := gotIDs[key]; got != want {
+					t.Errorf("wrong logical id for %s\ngot:  %s\nwant: %s", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyMovesChildModule(t *testing.T) {
+	ctx, diags := testRootContext(t, map[string]string{
+		"main.awsup": `
+Module "child" {
+  Source = "./child"
+}
+
+Moved {
+  From = Resource.Bucket
+  To   = Module.child.Resource.Bucket
+}
+`,
+		"child/child.awsup": `
+Resource "Bucket" {
+  Type = "AWS::S3::Bucket"
+}
+`,
+	})
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %s", diags.Error())
+	}
+
+	inst := ctx.RootModule.Children["child"].Modules[addr.NoEachIndex].Resources["Bucket"].Instances[addr.NoEachIndex]
+	if got, want := inst.LogicalID, "Bucket"; got != want {
+		t.Errorf("wrong logical id\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+// testRootContext writes the given files into a temporary directory and then
+// loads the module they describe, returning the result along with any
+// diagnostics.
+func testRootContext(t *testing.T, files map[string]string) (*RootContext, hcl.Diagnostics) {
+	t.Helper()
+
+	return testRootContextWithConstants(t, files, nil)
+}
+
+func testRootContextWithConstants(t *testing.T, files map[string]string, constants hcl.Attributes) (*RootContext, hcl.Diagnostics) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "awsup-eval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewRootContext(config.NewParser(), dir, constants, schema.Builtin())
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
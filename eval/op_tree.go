@@ -13,6 +13,10 @@ import (
 // instances are produced by translating hclsyntax.Expression nodes that
 // have analogs in the CloudFormation language.
 type DynExpr interface {
+	// SourceRange returns the range of the source expression that the
+	// recieving node was produced from.
+	SourceRange() hcl.Range
+
 	dynamicExpr() isDynamicExpr
 }
 
@@ -24,6 +28,11 @@ type DynExpr interface {
 type DynLiteral struct {
 	Value cty.Value
 
+	// SrcExpr is the expression that the value was evaluated from, if it
+	// was a constant expression in the configuration, or nil otherwise.
+	// It allows callers to find the source ranges of parts of the value.
+	SrcExpr hcl.Expression
+
 	SrcRange hcl.Range
 	isDynamicExpr
 }
@@ -33,6 +42,11 @@ type DynJoin struct {
 	Delimiter string
 	Exprs     []DynExpr
 
+	// List is set instead of Exprs when the list of values to join is
+	// itself produced by a dynamic expression, such as a reference to
+	// a list parameter.
+	List DynExpr
+
 	SrcRange hcl.Range
 	isDynamicExpr
 }
@@ -86,6 +100,33 @@ type DynNot struct {
 	isDynamicExpr
 }
 
+// DynConditionRef is a boolean expression (to be used in named conditionals
+// only) that returns the result of another named condition.
+type DynConditionRef struct {
+	ConditionName string
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynList constructs a list from a sequence of expressions, at least one of
+// which is not a literal.
+type DynList struct {
+	Exprs []DynExpr
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynObject constructs a JSON object from a set of expressions, at least one
+// of which is not a literal.
+type DynObject struct {
+	Attrs map[string]DynExpr
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
 // DynSplit splits a string by a given delimiter to produce a list.
 type DynSplit struct {
 	Delimiter string
@@ -155,6 +196,225 @@ type DynAccountAZs struct {
 	isDynamicExpr
 }
 
+// DynImportValue returns the value of an output exported by another stack.
+type DynImportValue struct {
+	// Name may not use DynRef or DynGetAttr that refer to resources.
+	Name DynExpr
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynTransform asks CloudFormation to replace it with the result of
+// processing the given parameters with a named macro, such as AWS::Include.
+type DynTransform struct {
+	Name       string
+	Parameters DynExpr
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynContains is a boolean expression (to be used in rules only) that
+// returns true if a list of strings contains a given string.
+type DynContains struct {
+	List, Value DynExpr
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynEachMemberEquals is a boolean expression (to be used in rules only)
+// that returns true if every string in a list is equal to a given string.
+type DynEachMemberEquals struct {
+	List, Value DynExpr
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynEachMemberIn is a boolean expression (to be used in rules only) that
+// returns true if every string in a list is also in a second list.
+type DynEachMemberIn struct {
+	List, Allowed DynExpr
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynValueOf (to be used in rules only) returns the value of an attribute
+// of the AWS object identified by the value of a parameter, such as the
+// value of a tag on a VPC.
+type DynValueOf struct {
+	ParameterName string
+	Attribute     string
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+// DynRefAll (to be used in rules only) returns a list of all of the values
+// that exist in the account and region for a given AWS-specific parameter
+// type.
+type DynRefAll struct {
+	ParameterType string
+
+	SrcRange hcl.Range
+	isDynamicExpr
+}
+
+func (e *DynLiteral) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynJoin) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynIf) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynEquals) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynLogical) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynNot) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynSplit) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynIndex) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynRef) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynGetAttr) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynMappingLookup) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynBase64) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynAccountAZs) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+func (e *DynConditionRef) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynList) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynObject) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynImportValue) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynTransform) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynContains) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynEachMemberEquals) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynEachMemberIn) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynValueOf) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+func (e *DynRefAll) SourceRange() hcl.Range {
+	return e.SrcRange
+}
+
+// walkDynExpr calls the given function for the given expression and then
+// for each of its descendents, depth-first. The descendents of an expression
+// are skipped if the function returns false for it.
+func walkDynExpr(expr DynExpr, cb func(DynExpr) bool) {
+	if expr == nil {
+		return
+	}
+	if !cb(expr) {
+		return
+	}
+
+	switch te := expr.(type) {
+	case *DynJoin:
+		walkDynExpr(te.List, cb)
+		for _, se := range te.Exprs {
+			walkDynExpr(se, cb)
+		}
+	case *DynIf:
+		walkDynExpr(te.If, cb)
+		walkDynExpr(te.Else, cb)
+	case *DynEquals:
+		walkDynExpr(te.A, cb)
+		walkDynExpr(te.B, cb)
+	case *DynLogical:
+		for _, se := range te.Values {
+			walkDynExpr(se, cb)
+		}
+	case *DynNot:
+		walkDynExpr(te.Value, cb)
+	case *DynList:
+		for _, se := range te.Exprs {
+			walkDynExpr(se, cb)
+		}
+	case *DynObject:
+		for _, name := range sortedDynExprKeys(te.Attrs) {
+			walkDynExpr(te.Attrs[name], cb)
+		}
+	case *DynSplit:
+		walkDynExpr(te.String, cb)
+	case *DynIndex:
+		walkDynExpr(te.List, cb)
+		walkDynExpr(te.Index, cb)
+	case *DynGetAttr:
+		for _, se := range te.Attrs {
+			walkDynExpr(se, cb)
+		}
+	case *DynMappingLookup:
+		walkDynExpr(te.FirstKey, cb)
+		walkDynExpr(te.SecondKey, cb)
+	case *DynBase64:
+		walkDynExpr(te.String, cb)
+	case *DynAccountAZs:
+		walkDynExpr(te.RegionName, cb)
+	case *DynImportValue:
+		walkDynExpr(te.Name, cb)
+	case *DynTransform:
+		walkDynExpr(te.Parameters, cb)
+	case *DynContains:
+		walkDynExpr(te.List, cb)
+		walkDynExpr(te.Value, cb)
+	case *DynEachMemberEquals:
+		walkDynExpr(te.List, cb)
+		walkDynExpr(te.Value, cb)
+	case *DynEachMemberIn:
+		walkDynExpr(te.List, cb)
+		walkDynExpr(te.Allowed, cb)
+	}
+}
+
 type isDynamicExpr struct {
 	// embed this to mark a struct as being a DynamicExpr
 }
@@ -0,0 +1,128 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apparentlymart/awsup/config"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// awsSpecificParamTypes are the AWS-specific parameter types, whose values
+// are strings that CloudFormation validates against existing objects in the
+// account.
+//
+// The value for each is true if CloudFormation also supports a List<...>
+// parameter type for it.
+var awsSpecificParamTypes = map[string]bool{
+	"AWS::EC2::AvailabilityZone::Name":   true,
+	"AWS::EC2::Image::Id":                true,
+	"AWS::EC2::Instance::Id":             true,
+	"AWS::EC2::KeyPair::KeyName":         false,
+	"AWS::EC2::SecurityGroup::GroupName": true,
+	"AWS::EC2::SecurityGroup::Id":        true,
+	"AWS::EC2::Subnet::Id":               true,
+	"AWS::EC2::Volume::Id":               true,
+	"AWS::EC2::VPC::Id":                  true,
+	"AWS::Route53::HostedZone::Id":       true,
+}
+
+// parameterType returns the type of the values of parameters with the given
+// CloudFormation parameter type, and whether the type is valid at all.
+//
+// CloudFormation represents all parameter values as strings or lists of
+// strings, but we use cty.Number for numeric parameters to avoid quirky
+// results when they are used in contexts that expect numbers. We expect
+// CloudFormation to convert stringified numbers back as needed.
+func parameterType(name string) (cty.Type, bool) {
+	switch name {
+
+	case "String":
+		return cty.String, true
+
+	case "Number":
+		return cty.Number, true
+
+	case "List<Number>":
+		return cty.List(cty.Number), true
+
+	case "CommaDelimitedList":
+		return cty.List(cty.String), true
+
+	case "AWS::SSM::Parameter::Name":
+		return cty.String, true
+
+	}
+
+	if ty, isAWS := awsSpecificParamType(name); isAWS {
+		return ty, true
+	}
+
+	// Parameters whose values are taken from the Systems Manager parameter
+	// store have the type of the value they refer to.
+	if inner, isSSM := typeArg(name, "AWS::SSM::Parameter::Value"); isSSM {
+		switch inner {
+		case "String":
+			return cty.String, true
+		case "List<String>", "CommaDelimitedList":
+			return cty.List(cty.String), true
+		}
+		if ty, isAWS := awsSpecificParamType(inner); isAWS {
+			return ty, true
+		}
+	}
+
+	return cty.NilType, false
+}
+
+// awsSpecificParamType returns the type of the values of the given
+// AWS-specific parameter type, or of the list type for one, and whether the
+// given name is such a type.
+func awsSpecificParamType(name string) (cty.Type, bool) {
+	if _, isAWS := awsSpecificParamTypes[name]; isAWS {
+		return cty.String, true
+	}
+	if inner, isList := typeArg(name, "List"); isList {
+		if hasList := awsSpecificParamTypes[inner]; hasList {
+			return cty.List(cty.String), true
+		}
+	}
+	return cty.NilType, false
+}
+
+// paramTypeCtyType is like parameterType but returns cty.String for invalid
+// types, for situations where any errors have already been reported.
+func paramTypeCtyType(name string) cty.Type {
+	ty, valid := parameterType(name)
+	if !valid {
+		return cty.String
+	}
+	return ty
+}
+
+// typeArg returns the argument of a parameter type string of the form
+// prefix<arg>, if the given name has that form.
+func typeArg(name, prefix string) (string, bool) {
+	if !strings.HasPrefix(name, prefix+"<") || !strings.HasSuffix(name, ">") {
+		return "", false
+	}
+	return name[len(prefix)+1 : len(name)-1], true
+}
+
+// checkParameterTypes returns an error diagnostic for each of the parameters
+// in the given module whose type is not one that CloudFormation supports.
+func checkParameterTypes(cfg *config.Module) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for name, param := range cfg.Parameters {
+		if _, valid := parameterType(param.Type); !valid {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported parameter type",
+				Detail:   fmt.Sprintf("Parameter %q has type %q, which is not a parameter type supported by CloudFormation.", name, param.Type),
+				Subject:  &param.DeclRange,
+			})
+		}
+	}
+	return diags
+}
@@ -0,0 +1,268 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParameterType(t *testing.T) {
+	tests := map[string]cty.Type{
+		"String":             cty.String,
+		"Number":             cty.Number,
+		"List<Number>":       cty.List(cty.Number),
+		"CommaDelimitedList": cty.List(cty.String),
+
+		"AWS::EC2::Subnet::Id":         cty.String,
+		"List<AWS::EC2::Subnet::Id>":   cty.List(cty.String),
+		"AWS::EC2::KeyPair::KeyName":   cty.String,
+		"AWS::Route53::HostedZone::Id": cty.String,
+
+		"AWS::SSM::Parameter::Name":                                     cty.String,
+		"AWS::SSM::Parameter::Value<String>":                            cty.String,
+		"AWS::SSM::Parameter::Value<List<String>>":                      cty.List(cty.String),
+		"AWS::SSM::Parameter::Value<CommaDelimitedList>":                cty.List(cty.String),
+		"AWS::SSM::Parameter::Value<AWS::EC2::Image::Id>":               cty.String,
+		"AWS::SSM::Parameter::Value<List<AWS::EC2::SecurityGroup::Id>>": cty.List(cty.String),
+
+		// Invalid types are represented by cty.NilType.
+		"string":                             cty.NilType,
+		"List<String>":                       cty.NilType,
+		"List<AWS::EC2::KeyPair::KeyName>":   cty.NilType,
+		"AWS::EC2::Subnet::Name":             cty.NilType,
+		"AWS::SSM::Parameter::Value<Number>": cty.NilType,
+		"AWS::SSM::Parameter::Value<AWS::SSM::Parameter::Name>": cty.NilType,
+		"List<AWS::EC2::Subnet::Id":                             cty.NilType,
+	}
+
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, valid := parameterType(name)
+			if wantValid := want != cty.NilType; valid != wantValid {
+				t.Fatalf("wrong validity %t; want %t", valid, wantValid)
+			}
+			if !valid {
+				return
+			}
+			if !got.Equals(want) {
+				t.Errorf("wrong type\ngot:  %#v\nwant: %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckParameterTypes(t *testing.T) {
+	_, diags := testRootContext(t, map[string]string{
+		"main.awsup": `
+Parameter "Subnets" {
+  Type = "List<AWS::EC2::Subnet::Id>"
+}
+
+Parameter "Widget" {
+  Type = "AWS::Example::Widget::Id"
+}
+`,
+	})
+
+	var got []string
+	for _, diag := range diags {
+		got = append(got, diag.Summary+": "+diag.Detail)
+	}
+	want := []string{
+		`Unsupported parameter type: Parameter "Widget" has type "AWS::Example::Widget::Id", which is not a parameter type supported by CloudFormation.`,
+	}
+	if !equalStrings(got, want) {
+		t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestElementFunc(t *testing.T) {
+	list := cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")})
+	tuple := cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.True})
+
+	tests := map[string]struct {
+		List  cty.Value
+		Index cty.Value
+		Want  cty.Value
+		Err   string
+	}{
+		"list": {
+			list,
+			cty.NumberIntVal(1),
+			cty.StringVal("b"),
+			"",
+		},
+		"tuple": {
+			tuple,
+			cty.NumberIntVal(1),
+			cty.True,
+			"",
+		},
+		"tuple with unknown index": {
+			tuple,
+			cty.UnknownVal(cty.Number),
+			cty.DynamicVal,
+			"",
+		},
+		"out of range": {
+			list,
+			cty.NumberIntVal(2),
+			cty.NilVal,
+			"index 2 is out of range for a list of 2 elements",
+		},
+		"negative": {
+			list,
+			cty.NumberIntVal(-1),
+			cty.NilVal,
+			"index -1 is out of range for a list of 2 elements",
+		},
+		"tuple out of range": {
+			tuple,
+			cty.NumberIntVal(2),
+			cty.NilVal,
+			"index 2 is out of range for a list of 2 elements",
+		},
+		"fractional": {
+			list,
+			cty.NumberFloatVal(0.5),
+			cty.NilVal,
+			"invalid index: value must be a whole number, between -9223372036854775808 and 9223372036854775807",
+		},
+		"not a list": {
+			cty.StringVal("a"),
+			cty.NumberIntVal(0),
+			cty.NilVal,
+			"a list is required",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := elementFunc.Call([]cty.Value{test.List, test.Index})
+			if test.Err != "" {
+				if err == nil {
+					t.Fatalf("succeeded; want error %q", test.Err)
+				}
+				if got := err.Error(); got != test.Err {
+					t.Errorf("wrong error\ngot:  %s\nwant: %s", got, test.Err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !got.RawEquals(test.Want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestElementDynamic(t *testing.T) {
+	ctx, diags := testRootContext(t, map[string]string{
+		"main.awsup": `
+Parameter "Subnets" {
+  Type = "List<AWS::EC2::Subnet::Id>"
+}
+
+Parameter "Images" {
+  Type = "AWS::SSM::Parameter::Value<List<AWS::EC2::Image::Id>>"
+}
+
+Parameter "Subnet" {
+  Type = "AWS::EC2::Subnet::Id"
+}
+
+Parameter "Index" {
+  Type = "Number"
+}
+`,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+	}
+
+	tests := map[string]struct {
+		Expr string
+		Want string
+		Err  string
+	}{
+		"element": {
+			`element(Param.Subnets, 1)`,
+			`Index(Ref(Subnets), 1)`,
+			"",
+		},
+		"element with dynamic index": {
+			`element(Param.Subnets, Param.Index)`,
+			`Index(Ref(Subnets), Ref(Index))`,
+			"",
+		},
+		"index operator": {
+			`Param.Subnets[0]`,
+			`Index(Ref(Subnets), 0)`,
+			"",
+		},
+		"parameter store list": {
+			`element(Param.Images, 0)`,
+			`Index(Ref(Images), 0)`,
+			"",
+		},
+		"element of a string": {
+			`element(Param.Subnet, 0)`,
+			"",
+			"Invalid function argument",
+		},
+		"index of a string": {
+			`Param.Subnet[0]`,
+			"",
+			"Invalid parameter reference",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expr, diags := hclsyntax.ParseExpression([]byte(test.Expr), "test.awsup", hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors parsing expression: %s", diags.Error())
+			}
+
+			got, diags := ctx.RootModule.EvalDynamic(expr, NoEachState)
+			if test.Err != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("succeeded; want error %q", test.Err)
+				}
+				if got := diags[0].Summary; got != test.Err {
+					t.Errorf("wrong error\ngot:  %s\nwant: %s", got, test.Err)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors: %s", diags.Error())
+			}
+			if got := describeDynExpr(got); got != test.Want {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got, test.Want)
+			}
+		})
+	}
+}
+
+// describeDynExpr returns a short description of the given expression, for
+// comparison in tests.
+func describeDynExpr(expr DynExpr) string {
+	switch te := expr.(type) {
+	case *DynIndex:
+		return fmt.Sprintf("Index(%s, %s)", describeDynExpr(te.List), describeDynExpr(te.Index))
+	case *DynRef:
+		return fmt.Sprintf("Ref(%s)", te.LogicalID)
+	case *DynLiteral:
+		if te.Value.Type() == cty.Number {
+			return te.Value.AsBigFloat().String()
+		}
+		return fmt.Sprintf("%#v", te.Value)
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
@@ -0,0 +1,207 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/apparentlymart/awsup/config"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// checkParameterConstraints verifies that the constraints given for a
+// parameter are consistent with one another and that its default value, if
+// any, satisfies them.
+//
+// CloudFormation itself checks these only when a stack is created or
+// updated, so catching problems here saves a round-trip.
+func checkParameterConstraints(param *config.Parameter, flat *FlatParameter) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	var pattern *regexp.Regexp
+	if known(flat.AllowedPattern) && flat.AllowedPattern.Type() == cty.String {
+		var patternDiags hcl.Diagnostics
+		pattern, patternDiags = compileAllowedPattern(flat.AllowedPattern.AsString(), param.AllowedPattern.Range())
+		diags = append(diags, patternDiags...)
+	}
+
+	if known(flat.MinLength) && known(flat.MaxLength) && flat.MinLength.GreaterThan(flat.MaxLength).True() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Inconsistent length constraints",
+			Detail:   "MinLength must not be greater than MaxLength.",
+			Subject:  param.MinLength.Range().Ptr(),
+		})
+	}
+	if known(flat.MinValue) && known(flat.MaxValue) && flat.MinValue.GreaterThan(flat.MaxValue).True() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Inconsistent value constraints",
+			Detail:   "MinValue must not be greater than MaxValue.",
+			Subject:  param.MinValue.Range().Ptr(),
+		})
+	}
+
+	def := flat.DefaultValue
+	if !known(def) {
+		return diags
+	}
+	defRange := param.Default.Range().Ptr()
+
+	if len(flat.AllowedValues) != 0 {
+		allowed := false
+		for _, val := range flat.AllowedValues {
+			if eq := def.Equals(val); eq.IsKnown() && eq.True() {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Default value not allowed",
+				Detail:   "The default value is not one of the values given in AllowedValues.",
+				Subject:  defRange,
+			})
+		}
+	}
+
+	switch def.Type() {
+	case cty.String:
+		str := def.AsString()
+		if pattern != nil && !pattern.MatchString(str) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Default value not allowed",
+				Detail:   fmt.Sprintf("The default value does not match the AllowedPattern %q.", flat.AllowedPattern.AsString()),
+				Subject:  defRange,
+			})
+		}
+		length := cty.NumberIntVal(int64(utf8.RuneCountInString(str)))
+		if known(flat.MinLength) && length.LessThan(flat.MinLength).True() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Default value not allowed",
+				Detail:   "The default value is shorter than MinLength.",
+				Subject:  defRange,
+			})
+		}
+		if known(flat.MaxLength) && length.GreaterThan(flat.MaxLength).True() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Default value not allowed",
+				Detail:   "The default value is longer than MaxLength.",
+				Subject:  defRange,
+			})
+		}
+
+	case cty.Number:
+		if known(flat.MinValue) && def.LessThan(flat.MinValue).True() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Default value not allowed",
+				Detail:   "The default value is less than MinValue.",
+				Subject:  defRange,
+			})
+		}
+		if known(flat.MaxValue) && def.GreaterThan(flat.MaxValue).True() {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Default value not allowed",
+				Detail:   "The default value is greater than MaxValue.",
+				Subject:  defRange,
+			})
+		}
+	}
+
+	return diags
+}
+
+// compileAllowedPattern compiles the given AllowedPattern so that values
+// can be checked against it.
+//
+// AllowedPattern is an ECMAScript regular expression. Go's syntax is
+// largely the same, but ECMAScript has some features that Go lacks, such as
+// lookaround assertions, backreferences and larger repetition counts. We
+// can't check values against patterns using those, so we return nil with a
+// warning in that case. Other syntax errors, such as unbalanced parentheses
+// or nested repetition operators, are reported as errors since ECMAScript
+// rejects them too.
+func compileAllowedPattern(pattern string, rng hcl.Range) (*regexp.Regexp, hcl.Diagnostics) {
+	// CloudFormation requires the pattern to match the whole value.
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err == nil {
+		return re, nil
+	}
+
+	if serr, ok := err.(*syntax.Error); ok && ecmaScriptOnly(serr) {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagWarning,
+				Summary:  "Unsupported AllowedPattern syntax",
+				Detail:   fmt.Sprintf("This pattern uses syntax (%s) that awsup cannot interpret, so values cannot be checked against it until the stack is created. Make sure the pattern is valid for CloudFormation.", serr.Expr),
+				Subject:  &rng,
+			},
+		}
+	}
+
+	return nil, hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid AllowedPattern",
+			Detail:   fmt.Sprintf("The pattern is not a valid regular expression: %s.", err),
+			Subject:  &rng,
+		},
+	}
+}
+
+// repeatCountPattern matches the repetition counts reported in errors of
+// type syntax.ErrInvalidRepeatSize.
+var repeatCountPattern = regexp.MustCompile(`^\{(\d+)(?:(,)(\d*))?\}$`)
+
+// ecmaScriptOnly returns true if the given error was caused by syntax that
+// is valid in ECMAScript regular expressions but not supported by Go.
+func ecmaScriptOnly(err *syntax.Error) bool {
+	switch err.Code {
+
+	case syntax.ErrInvalidPerlOp:
+		// Lookahead and lookbehind assertions, like (?=a) and (?<!a).
+		return true
+
+	case syntax.ErrInvalidNamedCapture:
+		// Some versions of Go parse lookbehind assertions as malformed
+		// named groups.
+		return strings.HasPrefix(err.Expr, "(?<=") || strings.HasPrefix(err.Expr, "(?<!")
+
+	case syntax.ErrInvalidEscape:
+		// Backreferences like \1 and \k<name>, control characters like \cJ
+		// and Unicode escapes like \u00e9.
+		return true
+
+	case syntax.ErrInvalidRepeatSize:
+		// Go does not allow counts greater than 1000, but ECMAScript has no
+		// such limit. A minimum greater than the maximum is invalid in both.
+		m := repeatCountPattern.FindStringSubmatch(err.Expr)
+		if m == nil {
+			return false
+		}
+		min, _ := strconv.Atoi(m[1])
+		if m[2] == "" || m[3] == "" {
+			return true
+		}
+		max, _ := strconv.Atoi(m[3])
+		return min <= max
+
+	default:
+		return false
+	}
+}
+
+// known returns true if the given value is known and not null.
+func known(val cty.Value) bool {
+	return val.IsKnown() && !val.IsNull()
+}
@@ -0,0 +1,189 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+func TestCompileAllowedPattern(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Want    hcl.DiagnosticSeverity // hcl.DiagInvalid if there should be no diagnostic
+		Match   string
+		NoMatch string
+	}{
+		{`[a-z]+`, hcl.DiagInvalid, "abc", "abc1"},
+		{`a|b`, hcl.DiagInvalid, "b", "ab"},
+		{`\d{3}-\d{4}`, hcl.DiagInvalid, "555-1234", "x555-1234"},
+		{`a{1000}`, hcl.DiagInvalid, "", ""},
+
+		// Valid in ECMAScript, but not supported by Go.
+		{`(?=a)a`, hcl.DiagWarning, "", ""},
+		{`(?!a)b`, hcl.DiagWarning, "", ""},
+		{`(?<=a)b`, hcl.DiagWarning, "", ""},
+		{`(?<!a)b`, hcl.DiagWarning, "", ""},
+		{`(a)\1`, hcl.DiagWarning, "", ""},
+		{`(?<n>a)\k<n>`, hcl.DiagWarning, "", ""},
+		{`\cJ`, hcl.DiagWarning, "", ""},
+		{`\u00e9`, hcl.DiagWarning, "", ""},
+		{`a{1001}`, hcl.DiagWarning, "", ""},
+		{`a{2000,}`, hcl.DiagWarning, "", ""},
+		{`a{1,2000}`, hcl.DiagWarning, "", ""},
+
+		// Invalid in ECMAScript too.
+		{`a{2000,1}`, hcl.DiagError, "", ""},
+		{`a**`, hcl.DiagError, "", ""},
+		{`a*+`, hcl.DiagError, "", ""},
+		{`*a`, hcl.DiagError, "", ""},
+		{`[z-a]`, hcl.DiagError, "", ""},
+		{`(a`, hcl.DiagError, "", ""},
+		{`a)`, hcl.DiagError, "", ""},
+		{`[a`, hcl.DiagError, "", ""},
+		{`a\`, hcl.DiagError, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Pattern, func(t *testing.T) {
+			re, diags := compileAllowedPattern(test.Pattern, hcl.Range{})
+
+			got := hcl.DiagInvalid
+			if len(diags) > 0 {
+				got = diags[0].Severity
+			}
+			if len(diags) > 1 || got != test.Want {
+				t.Fatalf("wrong diagnostics\ngot:  %#v\nwant severity %#v", diags, test.Want)
+			}
+			if got != hcl.DiagInvalid {
+				if re != nil {
+					t.Errorf("got a compiled pattern despite diagnostics")
+				}
+				return
+			}
+
+			if test.Match != "" && !re.MatchString(test.Match) {
+				t.Errorf("pattern does not match %q", test.Match)
+			}
+			if test.NoMatch != "" && re.MatchString(test.NoMatch) {
+				t.Errorf("pattern matches %q", test.NoMatch)
+			}
+		})
+	}
+}
+
+func TestCheckParameterConstraints(t *testing.T) {
+	tests := map[string]struct {
+		Config string
+		Want   []string
+	}{
+		"valid": {
+			`
+Parameter "Name" {
+  Type           = "String"
+  Default        = "abc"
+  AllowedPattern = "[a-z]+"
+  AllowedValues  = ["abc", "def"]
+  MinLength      = 1
+  MaxLength      = 3
+}
+
+Parameter "Size" {
+  Type     = "Number"
+  Default  = 2
+  MinValue = 1
+  MaxValue = 2
+}
+`,
+			nil,
+		},
+		"default does not match pattern": {
+			`
+Parameter "Name" {
+  Type           = "String"
+  Default        = "abc1"
+  AllowedPattern = "[a-z]+"
+}
+`,
+			[]string{"Default value not allowed"},
+		},
+		"default not in allowed values": {
+			`
+Parameter "Name" {
+  Type          = "String"
+  Default       = "ghi"
+  AllowedValues = ["abc", "def"]
+}
+`,
+			[]string{"Default value not allowed"},
+		},
+		"default too long": {
+			`
+Parameter "Name" {
+  Type      = "String"
+  Default   = "abcd"
+  MaxLength = 3
+}
+`,
+			[]string{"Default value not allowed"},
+		},
+		"default too small": {
+			`
+Parameter "Size" {
+  Type     = "Number"
+  Default  = 0
+  MinValue = 1
+}
+`,
+			[]string{"Default value not allowed"},
+		},
+		"inconsistent lengths": {
+			`
+Parameter "Name" {
+  Type      = "String"
+  MinLength = 4
+  MaxLength = 3
+}
+`,
+			[]string{"Inconsistent length constraints"},
+		},
+		"inconsistent values": {
+			`
+Parameter "Size" {
+  Type     = "Number"
+  MinValue = 4
+  MaxValue = 3
+}
+`,
+			[]string{"Inconsistent value constraints"},
+		},
+		"unsupported pattern": {
+			`
+Parameter "Name" {
+  Type           = "String"
+  Default        = "abc"
+  AllowedPattern = "(?!x)[a-z]+"
+}
+`,
+			[]string{"Unsupported AllowedPattern syntax"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{"main.awsup": test.Config})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+			}
+			_, buildDiags := ctx.Build()
+			diags = append(diags, buildDiags...)
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary)
+			}
+			if !equalStrings(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+		})
+	}
+}
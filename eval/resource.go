@@ -0,0 +1,294 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/config"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ResourceEach represents the one or more instances of a resource that are
+// created by a single Resource block, depending on whether ForEach is set.
+//
+// This is the resource equivalent of ModuleEach, and follows the same
+// conventions for how instances are indexed.
+type ResourceEach struct {
+	// EachType is the type of index being used for ForEach on this collection
+	// of resource instances, or addr.NoEach if ForEach is not in use.
+	EachType addr.EachType
+
+	// Instances contains a reference to the ResourceInstance for each known
+	// index. If not in ForEach mode, this map contains only a single member
+	// whose key is addr.NoEachIndex.
+	Instances map[addr.EachIndex]*ResourceInstance
+}
+
+// ResourceInstance represents a single instance of a resource, which will
+// become a single resource in the flattened CloudFormation template.
+type ResourceInstance struct {
+	// Addr is the fully-qualified address of the resource instance within
+	// the module tree.
+	Addr addr.NameInModule
+
+	// LogicalID is the identifier that will be used for this instance in
+	// the generated template.
+	LogicalID string
+
+	// Each is the EachState to use when evaluating expressions in the
+	// resource configuration for this instance.
+	Each EachState
+
+	// Config is the configuration block that this instance was created from.
+	// This is shared between all of the instances of a particular resource.
+	Config *config.Resource
+
+	// Disabled is true if the Enabled argument for this instance is false,
+	// in which case the instance is omitted from the generated template and
+	// must not be referenced.
+	Disabled bool
+
+	// explicitID is true if LogicalID was set by the LogicalId argument in
+	// configuration, in which case it must not be overridden by Moved blocks.
+	explicitID bool
+}
+
+func newResourceEach(ty addr.EachType) *ResourceEach {
+	return &ResourceEach{
+		EachType:  ty,
+		Instances: make(map[addr.EachIndex]*ResourceInstance),
+	}
+}
+
+// IsForEach returns true if ForEach is in use for the recieving resource.
+func (e *ResourceEach) IsForEach() bool {
+	return e.EachType != addr.NoEach
+}
+
+func (e *ResourceEach) Single() *ResourceInstance {
+	if e.IsForEach() {
+		panic("can't use Single on a ResourceEach for a ForEach resource block")
+	}
+	return e.Instances[addr.NoEachIndex]
+}
+
+func (e *ResourceEach) Index(key addr.EachIndex) *ResourceInstance {
+	if !e.IsForEach() {
+		panic("can't use Index on a ResourceEach for a non-ForEach resource block")
+	}
+	if key.EachType() != e.EachType {
+		panic(fmt.Errorf("this ResourceEach requires %s, but given %s", e.EachType, key.EachType()))
+	}
+	return e.Instances[key]
+}
+
+// expandResources evaluates the ForEach expressions for all of the resources
+// in the module and produces the table of resource instances that will be
+// assigned to mctx.Resources.
+func (mctx *ModuleContext) expandResources() (map[string]*ResourceEach, hcl.Diagnostics) {
+	// This method is called while mctx is still being constructed, so
+	// mctx.Config, mctx.Path and mctx.Constants are the only fields safe
+	// to access.
+
+	var diags hcl.Diagnostics
+	ret := make(map[string]*ResourceEach)
+
+	for name, rcfg := range mctx.Config.Resources {
+		eachType, eachStates, forEachDiags := mctx.evalForEach(rcfg.ForEach)
+		diags = append(diags, forEachDiags...)
+		if forEachDiags.HasErrors() {
+			continue
+		}
+
+		ret[name] = newResourceEach(eachType)
+		for _, each := range eachStates {
+			instAddr := addr.NameInModule{
+				Module: mctx.Path,
+				Name:   name,
+				Key:    each.Key,
+			}
+			inst := &ResourceInstance{
+				Addr:      instAddr,
+				LogicalID: instAddr.ID(),
+				Each:      each,
+				Config:    rcfg,
+			}
+
+			enabled, enabledDiags := mctx.EvalConstant(rcfg.Enabled, cty.Bool, each)
+			diags = append(diags, enabledDiags...)
+			if !enabledDiags.HasErrors() && enabled.IsKnown() && !enabled.IsNull() {
+				inst.Disabled = enabled.False()
+			}
+
+			explicitID, idDiags := mctx.explicitLogicalID(rcfg, each)
+			diags = append(diags, idDiags...)
+			if explicitID != "" {
+				inst.LogicalID = explicitID
+				inst.explicitID = true
+			}
+
+			ret[name].Instances[each.Key] = inst
+		}
+	}
+
+	return ret, diags
+}
+
+// explicitLogicalID evaluates the LogicalId argument of the given resource
+// configuration for a particular instance, returning an empty string if
+// the argument is not set or if it is invalid.
+func (mctx *ModuleContext) explicitLogicalID(rcfg *config.Resource, each EachState) (string, hcl.Diagnostics) {
+	expr := rcfg.ExplicitLogicalID
+	val, diags := mctx.EvalConstant(expr, cty.String, each)
+	if diags.HasErrors() || val.IsNull() {
+		return "", diags
+	}
+
+	id := val.AsString()
+	switch {
+	case id == "":
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid logical id",
+			Detail:   "LogicalId must not be empty.",
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	case !addr.ValidName(id):
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid logical id",
+			Detail:   fmt.Sprintf("The logical id %q is not valid: logical ids may contain only alphanumeric characters.", id),
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	case len(id) > addr.MaxIDLength:
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid logical id",
+			Detail:   fmt.Sprintf("Logical ids may be at most %d characters long.", addr.MaxIDLength),
+			Subject:  expr.Range().Ptr(),
+		})
+		return "", diags
+	}
+
+	return id, diags
+}
+
+// resourceInstanceForTraversal finds the resource instance that is referenced
+// by the given static traversal, which must be of the form Resource.Name for
+// resources that do not use ForEach, or Resource.Name[key] for those that do.
+//
+// Any traversal steps after the ones that identify the instance are ignored.
+// If the traversal is invalid then error diagnostics are returned and the
+// returned instance is nil.
+func (mctx *ModuleContext) resourceInstanceForTraversal(traversal hcl.Traversal) (*ResourceInstance, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	if traversal.RootName() != "Resource" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid resource reference",
+			Detail:   "A reference to a resource must begin with \"Resource.\".",
+			Subject:  traversal.SourceRange().Ptr(),
+		})
+		return nil, diags
+	}
+
+	var nameStep hcl.TraverseAttr
+	if len(traversal) >= 2 {
+		nameStep, _ = traversal[1].(hcl.TraverseAttr)
+	}
+	if nameStep.Name == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Illegal use of Resource object",
+			Detail:   "The top-level object \"Resource\" requires an attribute to specify which resource to access.",
+			Subject:  traversal.SourceRange().Ptr(),
+		})
+		return nil, diags
+	}
+
+	each, exists := mctx.Resources[nameStep.Name]
+	if !exists {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to undeclared resource",
+			Detail:   fmt.Sprintf("There is no resource named %q in this module.", nameStep.Name),
+			Subject:  &nameStep.SrcRange,
+		})
+		return nil, diags
+	}
+
+	if !each.IsForEach() {
+		return checkResourceEnabled(each.Single(), traversal.SourceRange())
+	}
+
+	var keyStep hcl.TraverseIndex
+	var hasKey bool
+	if len(traversal) >= 3 {
+		keyStep, hasKey = traversal[2].(hcl.TraverseIndex)
+	}
+	if !hasKey {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing resource instance key",
+			Detail:   fmt.Sprintf("Resource %q has ForEach set, so a particular instance must be selected by its key.", nameStep.Name),
+			Subject:  traversal.SourceRange().Ptr(),
+		})
+		return nil, diags
+	}
+
+	key := addr.MakeEachIndex(keyStep.Key)
+	if key == addr.NoEachIndex || key.EachType() != each.EachType {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid resource instance key",
+			Detail:   fmt.Sprintf("The key for an instance of resource %q must be a %s.", nameStep.Name, eachTypeFriendlyName(each.EachType)),
+			Subject:  &keyStep.SrcRange,
+		})
+		return nil, diags
+	}
+
+	inst := each.Index(key)
+	if inst == nil {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to undeclared resource instance",
+			Detail:   fmt.Sprintf("Resource %q has no instance with the key %s.", nameStep.Name, key),
+			Subject:  &keyStep.SrcRange,
+		})
+		return nil, diags
+	}
+
+	return checkResourceEnabled(inst, traversal.SourceRange())
+}
+
+// checkResourceEnabled returns the given instance unless it is disabled, in
+// which case it returns nil and an error diagnostic with the given range as
+// its subject.
+func checkResourceEnabled(inst *ResourceInstance, rng hcl.Range) (*ResourceInstance, hcl.Diagnostics) {
+	if !inst.Disabled {
+		return inst, nil
+	}
+	return nil, hcl.Diagnostics{
+		{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to disabled resource",
+			Detail:   fmt.Sprintf("Resource %s is not included in the template, because its Enabled argument is false.", inst.Addr),
+			Subject:  &rng,
+		},
+	}
+}
+
+func eachTypeFriendlyName(ty addr.EachType) string {
+	switch ty {
+	case addr.EachTypeInt:
+		return "number"
+	case addr.EachTypeString:
+		return "string"
+	default:
+		return "nothing"
+	}
+}
@@ -0,0 +1,356 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apparentlymart/awsup/config"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// deletionPolicies and updateReplacePolicies are the values permitted for
+// the DeletionPolicy and UpdateReplacePolicy arguments respectively.
+var deletionPolicies = []string{"Delete", "Retain", "RetainExceptOnCreate", "Snapshot"}
+var updateReplacePolicies = []string{"Delete", "Retain", "Snapshot"}
+
+// snapshotResourceTypes are the resource types that support the Snapshot
+// deletion and replacement policies.
+var snapshotResourceTypes = map[string]bool{
+	"AWS::DocDB::DBCluster":              true,
+	"AWS::EC2::Volume":                   true,
+	"AWS::ElastiCache::CacheCluster":     true,
+	"AWS::ElastiCache::ReplicationGroup": true,
+	"AWS::Neptune::DBCluster":            true,
+	"AWS::RDS::DBCluster":                true,
+	"AWS::RDS::DBInstance":               true,
+	"AWS::Redshift::Cluster":             true,
+}
+
+// resourcePolicy evaluates the DeletionPolicy or UpdateReplacePolicy (given
+// as name) for the given resource, returning the empty string if it is not
+// set.
+func (mctx *ModuleContext) resourcePolicy(rcfg *config.Resource, name string, expr hcl.Expression, allowed []string, each EachState, diags *hcl.Diagnostics) string {
+	val := evalConstantWithDiags(mctx, expr, cty.String, each, diags)
+	if !val.IsKnown() || val.IsNull() || val.Type() != cty.String {
+		return ""
+	}
+	policy := val.AsString()
+
+	valid := false
+	for _, candidate := range allowed {
+		if policy == candidate {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		*diags = append(*diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s", name),
+			Detail:   fmt.Sprintf("%s must be %s.", name, quotedAlternatives(allowed)),
+			Subject:  expr.Range().Ptr(),
+		})
+		return ""
+	}
+
+	if policy == "Snapshot" && !snapshotResourceTypes[rcfg.Type] {
+		*diags = append(*diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  fmt.Sprintf("Unsupported %s", name),
+			Detail:   fmt.Sprintf("CloudFormation does not support snapshots for resources of type %s, and so may reject the Snapshot policy.", rcfg.Type),
+			Subject:  expr.Range().Ptr(),
+		})
+	}
+
+	return policy
+}
+
+// signalResourceTypes are the resource types that can send the success
+// signals that a CreationPolicy waits for.
+var signalResourceTypes = map[string]bool{
+	"AWS::AutoScaling::AutoScalingGroup": true,
+	"AWS::CloudFormation::WaitCondition": true,
+	"AWS::EC2::Instance":                 true,
+}
+
+// buildCreationPolicy evaluates the given creation policy, returning nil if
+// none of its arguments are set.
+func (mctx *ModuleContext) buildCreationPolicy(rcfg *config.Resource, each EachState) (DynExpr, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	policy := rcfg.CreationPolicy
+	if policy == nil {
+		return nil, diags
+	}
+	rng := rcfg.DeclRange
+	attrs := map[string]DynExpr{}
+
+	if !signalResourceTypes[rcfg.Type] {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Unsupported CreationPolicy",
+			Detail:   fmt.Sprintf("Resources of type %s cannot send the signals that a CreationPolicy waits for, so CloudFormation may wait until the timeout expires and then fail.", rcfg.Type),
+			Subject:  &rng,
+		})
+	}
+
+	if block := policy.AutoScaling; block != nil {
+		setPolicyAttr(attrs, "AutoScalingCreationPolicy", policyObject(rng, map[string]DynExpr{
+			"MinSuccessfulInstancesPercent": mctx.policyValue(block.MinSuccessfulInstancesPercent, "MinSuccessfulInstancesPercent", cty.Number, each, &diags),
+		}))
+	}
+
+	if block := policy.Signal; block != nil {
+		count := mctx.policyValue(block.Count, "Count", cty.Number, each, &diags)
+		if lit, isLit := count.(*DynLiteral); isLit {
+			if bf := lit.Value.AsBigFloat(); !bf.IsInt() || bf.Sign() < 1 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid value for Count",
+					Detail:   "The number of signals to wait for must be a whole number greater than zero.",
+					Subject:  block.Count.Range().Ptr(),
+				})
+			}
+		}
+		timeout := mctx.policyValue(block.Timeout, "Timeout", cty.String, each, &diags)
+		diags = append(diags, checkPolicyDuration(timeout, "Timeout", 12*time.Hour, block.Timeout.Range())...)
+
+		setPolicyAttr(attrs, "ResourceSignal", policyObject(rng, map[string]DynExpr{
+			"Count":   count,
+			"Timeout": timeout,
+		}))
+	}
+
+	if len(attrs) == 0 {
+		return nil, diags
+	}
+	return policyObject(rng, attrs), diags
+}
+
+// buildUpdatePolicy evaluates the given update policy, returning nil if none
+// of its arguments are set.
+//
+// CloudFormation accepts dynamic expressions throughout UpdatePolicy, such as
+// references to parameters giving batch sizes, but it checks their values
+// only when the resource is updated. We therefore type-check each argument
+// here, so that mistakes are caught before they can break an update.
+func (mctx *ModuleContext) buildUpdatePolicy(rcfg *config.Resource, each EachState) (DynExpr, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	policy := rcfg.UpdatePolicy
+	if policy == nil {
+		return nil, diags
+	}
+	rng := rcfg.DeclRange
+	attrs := map[string]DynExpr{}
+
+	if block := policy.AutoScalingReplacingUpdate; block != nil {
+		setPolicyAttr(attrs, "AutoScalingReplacingUpdate", policyObject(rng, map[string]DynExpr{
+			"WillReplace": mctx.policyValue(block.WillReplace, "WillReplace", cty.Bool, each, &diags),
+		}))
+	}
+
+	if block := policy.AutoScalingRollingUpdate; block != nil {
+		pauseTime := mctx.policyValue(block.PauseTime, "PauseTime", cty.String, each, &diags)
+		diags = append(diags, checkPolicyDuration(pauseTime, "PauseTime", time.Hour, block.PauseTime.Range())...)
+		setPolicyAttr(attrs, "AutoScalingRollingUpdate", policyObject(rng, map[string]DynExpr{
+			"MaxBatchSize":                  mctx.policyValue(block.MaxBatchSize, "MaxBatchSize", cty.Number, each, &diags),
+			"MinActiveInstancesPercent":     mctx.policyValue(block.MinActiveInstancesPercent, "MinActiveInstancesPercent", cty.Number, each, &diags),
+			"MinInstancesInService":         mctx.policyValue(block.MinInstancesInService, "MinInstancesInService", cty.Number, each, &diags),
+			"MinSuccessfulInstancesPercent": mctx.policyValue(block.MinSuccessfulInstancesPercent, "MinSuccessfulInstancesPercent", cty.Number, each, &diags),
+			"PauseTime":                     pauseTime,
+			"SuspendProcesses":              mctx.policyValue(block.SuspendProcesses, "SuspendProcesses", cty.List(cty.String), each, &diags),
+			"WaitOnResourceSignals":         mctx.policyValue(block.WaitOnResourceSignals, "WaitOnResourceSignals", cty.Bool, each, &diags),
+		}))
+	}
+
+	if block := policy.AutoScalingScheduledAction; block != nil {
+		setPolicyAttr(attrs, "AutoScalingScheduledAction", policyObject(rng, map[string]DynExpr{
+			"IgnoreUnmodifiedGroupSizeProperties": mctx.policyValue(block.IgnoreUnmodifiedGroupSizeProperties, "IgnoreUnmodifiedGroupSizeProperties", cty.Bool, each, &diags),
+		}))
+	}
+
+	if block := policy.CodeDeployLambdaAliasUpdate; block != nil {
+		update := map[string]DynExpr{
+			"AfterAllowTrafficHook":  mctx.policyValue(block.AfterAllowTrafficHook, "AfterAllowTrafficHook", cty.String, each, &diags),
+			"ApplicationName":        mctx.policyValue(block.ApplicationName, "ApplicationName", cty.String, each, &diags),
+			"BeforeAllowTrafficHook": mctx.policyValue(block.BeforeAllowTrafficHook, "BeforeAllowTrafficHook", cty.String, each, &diags),
+			"DeploymentGroupName":    mctx.policyValue(block.DeploymentGroupName, "DeploymentGroupName", cty.String, each, &diags),
+		}
+		required := map[string]hcl.Expression{
+			"ApplicationName":     block.ApplicationName,
+			"DeploymentGroupName": block.DeploymentGroupName,
+		}
+		for name, expr := range required {
+			if val, valDiags := expr.Value(nil); !valDiags.HasErrors() && val.IsNull() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Missing required argument",
+					Detail:   fmt.Sprintf("CodeDeployLambdaAliasUpdate requires a value for %s.", name),
+					Subject:  &rng,
+				})
+			}
+		}
+		setPolicyAttr(attrs, "CodeDeployLambdaAliasUpdate", policyObject(rng, update))
+	}
+
+	setPolicyAttr(attrs, "EnableVersionUpgrade", mctx.policyValue(policy.EnableVersionUpgrade, "EnableVersionUpgrade", cty.Bool, each, &diags))
+	setPolicyAttr(attrs, "UseOnlineResharding", mctx.policyValue(policy.UseOnlineResharding, "UseOnlineResharding", cty.Bool, each, &diags))
+
+	if len(attrs) == 0 {
+		return nil, diags
+	}
+	return policyObject(rng, attrs), diags
+}
+
+// policyValue evaluates a single argument of a resource policy, returning nil
+// if it is not set.
+//
+// Literal values are converted to the given type, so that (for example) a
+// number given as a string is rendered as a number. Dynamic values are only
+// checked for a compatible type, since CloudFormation will convert them.
+func (mctx *ModuleContext) policyValue(expr hcl.Expression, name string, ty cty.Type, each EachState, diags *hcl.Diagnostics) DynExpr {
+	dyn := evalDynamicWithDiags(mctx, expr, each, diags)
+
+	if lit, isLit := dyn.(*DynLiteral); isLit {
+		if lit.Value.IsNull() {
+			return nil
+		}
+		if !lit.Value.IsWhollyKnown() {
+			// Errors were already reported during evaluation.
+			return nil
+		}
+		val, err := convert.Convert(lit.Value, ty)
+		if err != nil {
+			*diags = append(*diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid value for %s", name),
+				Detail:   fmt.Sprintf("Unsuitable value for %s: %s.", name, err),
+				Subject:  expr.Range().Ptr(),
+			})
+			return nil
+		}
+		return &DynLiteral{
+			Value:    val,
+			SrcRange: lit.SrcRange,
+		}
+	}
+
+	gotTy, _ := mctx.TypeCheck(expr, each)
+	if !gotTy.Equals(ty) && convert.GetConversionUnsafe(gotTy, ty) == nil {
+		*diags = append(*diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid value for %s", name),
+			Detail:   fmt.Sprintf("Unsuitable value for %s: %s required.", name, withArticle(ty.FriendlyName())),
+			Subject:  expr.Range().Ptr(),
+		})
+	}
+	return dyn
+}
+
+// policyDurationPattern matches the subset of ISO 8601 durations that
+// CloudFormation accepts in policies.
+var policyDurationPattern = regexp.MustCompile(`^PT(?:([0-9]+)H)?(?:([0-9]+)M)?(?:([0-9]+)S)?$`)
+
+// checkPolicyDuration verifies that the given policy value, if it is a
+// literal, is an ISO 8601 duration no longer than the given maximum, which
+// must be a whole number of hours.
+func checkPolicyDuration(expr DynExpr, name string, max time.Duration, rng hcl.Range) hcl.Diagnostics {
+	lit, isLit := expr.(*DynLiteral)
+	if !isLit {
+		// Dynamic values can be checked only by CloudFormation itself.
+		return nil
+	}
+
+	str := lit.Value.AsString()
+	match := policyDurationPattern.FindStringSubmatch(str)
+	if match == nil || str == "PT" {
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid value for %s", name),
+				Detail:   fmt.Sprintf("%s must be an ISO 8601 duration in hours, minutes and seconds, such as \"PT1H30M\" or \"PT45S\".", name),
+				Subject:  &rng,
+			},
+		}
+	}
+
+	var dur time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			// Only possible if the number is too big for an int, in which case
+			// it's certainly over the maximum.
+			n = int(max/unit) + 1
+		}
+		dur += time.Duration(n) * unit
+	}
+	if dur > max {
+		return hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  fmt.Sprintf("Invalid value for %s", name),
+				Detail:   fmt.Sprintf("%s must be no longer than PT%dH.", name, int(max.Hours())),
+				Subject:  &rng,
+			},
+		}
+	}
+	return nil
+}
+
+// policyObject returns an object expression with the given attributes,
+// omitting any that are nil.
+func policyObject(rng hcl.Range, attrs map[string]DynExpr) DynExpr {
+	ret := map[string]DynExpr{}
+	for name, expr := range attrs {
+		setPolicyAttr(ret, name, expr)
+	}
+	if len(ret) == 0 {
+		// An empty block is still meaningful for some policies, such as
+		// AutoScalingRollingUpdate, which then uses CloudFormation's
+		// defaults.
+		return &DynLiteral{
+			Value:    cty.EmptyObjectVal,
+			SrcRange: rng,
+		}
+	}
+	return &DynObject{
+		Attrs:    ret,
+		SrcRange: rng,
+	}
+}
+
+// setPolicyAttr sets the given attribute if its expression is not nil.
+func setPolicyAttr(attrs map[string]DynExpr, name string, expr DynExpr) {
+	if expr != nil {
+		attrs[name] = expr
+	}
+}
+
+// withArticle prefixes the given type name with "a" or "an" as appropriate.
+func withArticle(name string) string {
+	if strings.ContainsAny(name[:1], "aeiou") {
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// quotedAlternatives returns the given strings quoted and joined into a list
+// of alternatives, like "a", "b" or "c".
+func quotedAlternatives(strs []string) string {
+	quoted := make([]string, len(strs))
+	for i, str := range strs {
+		quoted[i] = fmt.Sprintf("%q", str)
+	}
+	last := len(quoted) - 1
+	if last < 1 {
+		return strings.Join(quoted, "")
+	}
+	return strings.Join(quoted[:last], ", ") + " or " + quoted[last]
+}
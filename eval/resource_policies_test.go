@@ -0,0 +1,296 @@
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestResourcePolicyDiagnostics(t *testing.T) {
+	params := `
+Parameter "Size" {
+  Type = "Number"
+}
+`
+
+	tests := map[string]struct {
+		Resource string
+		Want     []string
+	}{
+		"valid": {
+			`
+Resource "Group" {
+  Type = "AWS::AutoScaling::AutoScalingGroup"
+  Properties {
+    MinSize = "1"
+    MaxSize = "2"
+  }
+
+  DeletionPolicy = "RetainExceptOnCreate"
+
+  CreationPolicy {
+    Signal {
+      Count   = Param.Size
+      Timeout = "PT12H"
+    }
+  }
+
+  UpdatePolicy {
+    AutoScalingRollingUpdate {
+      MaxBatchSize = Param.Size
+      PauseTime    = "PT59M60S"
+    }
+  }
+}
+`,
+			nil,
+		},
+		"invalid DeletionPolicy": {
+			`
+Resource "Topic" {
+  Type           = "AWS::SNS::Topic"
+  DeletionPolicy = "Keep"
+}
+`,
+			[]string{`Invalid DeletionPolicy: DeletionPolicy must be "Delete", "Retain", "RetainExceptOnCreate" or "Snapshot".`},
+		},
+		"invalid UpdateReplacePolicy": {
+			`
+Resource "Topic" {
+  Type                = "AWS::SNS::Topic"
+  UpdateReplacePolicy = "RetainExceptOnCreate"
+}
+`,
+			[]string{`Invalid UpdateReplacePolicy: UpdateReplacePolicy must be "Delete", "Retain" or "Snapshot".`},
+		},
+		"unsupported Snapshot": {
+			`
+Resource "Topic" {
+  Type                = "AWS::SNS::Topic"
+  DeletionPolicy      = "Snapshot"
+  UpdateReplacePolicy = "Snapshot"
+}
+`,
+			[]string{
+				"Unsupported DeletionPolicy: CloudFormation does not support snapshots for resources of type AWS::SNS::Topic, and so may reject the Snapshot policy.",
+				"Unsupported UpdateReplacePolicy: CloudFormation does not support snapshots for resources of type AWS::SNS::Topic, and so may reject the Snapshot policy.",
+			},
+		},
+		"CreationPolicy without signals": {
+			`
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+
+  CreationPolicy {
+    Signal {
+      Count = 1
+    }
+  }
+}
+`,
+			[]string{"Unsupported CreationPolicy: Resources of type AWS::SNS::Topic cannot send the signals that a CreationPolicy waits for, so CloudFormation may wait until the timeout expires and then fail."},
+		},
+		"zero Count": {
+			`
+Resource "Instance" {
+  Type = "AWS::EC2::Instance"
+  Properties {
+    ImageId = "ami-12345678"
+  }
+
+  CreationPolicy {
+    Signal {
+      Count = 0
+    }
+  }
+}
+`,
+			[]string{"Invalid value for Count: The number of signals to wait for must be a whole number greater than zero."},
+		},
+		"fractional Count": {
+			`
+Resource "Instance" {
+  Type = "AWS::EC2::Instance"
+  Properties {
+    ImageId = "ami-12345678"
+  }
+
+  CreationPolicy {
+    Signal {
+      Count = 1.5
+    }
+  }
+}
+`,
+			[]string{"Invalid value for Count: The number of signals to wait for must be a whole number greater than zero."},
+		},
+		"Timeout too long": {
+			`
+Resource "Instance" {
+  Type = "AWS::EC2::Instance"
+  Properties {
+    ImageId = "ami-12345678"
+  }
+
+  CreationPolicy {
+    Signal {
+      Timeout = "PT12H1S"
+    }
+  }
+}
+`,
+			[]string{"Invalid value for Timeout: Timeout must be no longer than PT12H."},
+		},
+		"PauseTime too long": {
+			`
+Resource "Group" {
+  Type = "AWS::AutoScaling::AutoScalingGroup"
+  Properties {
+    MinSize = "1"
+    MaxSize = "2"
+  }
+
+  UpdatePolicy {
+    AutoScalingRollingUpdate {
+      PauseTime = "PT61M"
+    }
+  }
+}
+`,
+			[]string{"Invalid value for PauseTime: PauseTime must be no longer than PT1H."},
+		},
+		"unsuitable literal": {
+			`
+Resource "Group" {
+  Type = "AWS::AutoScaling::AutoScalingGroup"
+  Properties {
+    MinSize = "1"
+    MaxSize = "2"
+  }
+
+  UpdatePolicy {
+    AutoScalingReplacingUpdate {
+      WillReplace = "maybe"
+    }
+  }
+}
+`,
+			[]string{"Invalid value for WillReplace: Unsuitable value for WillReplace: a bool is required."},
+		},
+		"unsuitable dynamic value": {
+			`
+Resource "Group" {
+  Type = "AWS::AutoScaling::AutoScalingGroup"
+  Properties {
+    MinSize = "1"
+    MaxSize = "2"
+  }
+
+  UpdatePolicy {
+    AutoScalingRollingUpdate {
+      SuspendProcesses = Param.Size
+    }
+  }
+}
+`,
+			[]string{"Invalid value for SuspendProcesses: Unsuitable value for SuspendProcesses: a list of string required."},
+		},
+		"missing required argument": {
+			`
+Resource "Alias" {
+  Type = "AWS::Lambda::Alias"
+  Properties {
+    FunctionName    = "example"
+    FunctionVersion = "1"
+    Name            = "live"
+  }
+
+  UpdatePolicy {
+    CodeDeployLambdaAliasUpdate {
+      ApplicationName = "example"
+    }
+  }
+}
+`,
+			[]string{"Missing required argument: CodeDeployLambdaAliasUpdate requires a value for DeploymentGroupName."},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{
+				"main.awsup": params + test.Resource,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors loading configuration: %s", diags.Error())
+			}
+			_, diags = ctx.Build()
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary+": "+diag.Detail)
+			}
+			if !equalStrings(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestCheckPolicyDuration(t *testing.T) {
+	tests := map[string]string{
+		"PT1H":                    "",
+		"PT30M":                   "",
+		"PT45S":                   "",
+		"PT0H59M59S":              "",
+		"PT0H60M":                 "",
+		"PT3600S":                 "",
+		"PT1H1S":                  "Invalid value for PauseTime: PauseTime must be no longer than PT1H.",
+		"PT61M":                   "Invalid value for PauseTime: PauseTime must be no longer than PT1H.",
+		"PT1H30M":                 "Invalid value for PauseTime: PauseTime must be no longer than PT1H.",
+		"PT99999999999999999999H": "Invalid value for PauseTime: PauseTime must be no longer than PT1H.",
+		"PT":                      `Invalid value for PauseTime: PauseTime must be an ISO 8601 duration in hours, minutes and seconds, such as "PT1H30M" or "PT45S".`,
+		"P1D":                     `Invalid value for PauseTime: PauseTime must be an ISO 8601 duration in hours, minutes and seconds, such as "PT1H30M" or "PT45S".`,
+		"PT30M1H":                 `Invalid value for PauseTime: PauseTime must be an ISO 8601 duration in hours, minutes and seconds, such as "PT1H30M" or "PT45S".`,
+		"30 minutes":              `Invalid value for PauseTime: PauseTime must be an ISO 8601 duration in hours, minutes and seconds, such as "PT1H30M" or "PT45S".`,
+	}
+
+	for str, want := range tests {
+		t.Run(str, func(t *testing.T) {
+			expr := &DynLiteral{Value: cty.StringVal(str)}
+			diags := checkPolicyDuration(expr, "PauseTime", time.Hour, hcl.Range{})
+
+			var got string
+			if len(diags) != 0 {
+				got = diags[0].Summary + ": " + diags[0].Detail
+			}
+			if got != want {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got, want)
+			}
+		})
+	}
+
+	t.Run("dynamic", func(t *testing.T) {
+		expr := &DynRef{LogicalID: "PauseTime"}
+		if diags := checkPolicyDuration(expr, "PauseTime", time.Hour, hcl.Range{}); len(diags) != 0 {
+			t.Errorf("unexpected diagnostics: %s", diags.Error())
+		}
+	})
+}
+
+func TestQuotedAlternatives(t *testing.T) {
+	tests := map[string][]string{
+		``:                nil,
+		`"a"`:             {"a"},
+		`"a" or "b"`:      {"a", "b"},
+		`"a", "b" or "c"`: {"a", "b", "c"},
+	}
+
+	for want, strs := range tests {
+		if got := quotedAlternatives(strs); got != want {
+			t.Errorf("wrong result for %q\ngot:  %s\nwant: %s", strs, got, want)
+		}
+	}
+}
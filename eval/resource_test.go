@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplicitLogicalID(t *testing.T) {
+	tests := map[string]struct {
+		Config string
+		IDs    map[string]string // resource name to logical id
+		Want   []string
+	}{
+		"valid": {
+			`
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "Notifications"
+}
+`,
+			map[string]string{"Topic": "Notifications"},
+			nil,
+		},
+		"per instance": {
+			`
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  ForEach   = { a = "First", b = "Second" }
+  LogicalId = "${Each.Value}Topic"
+}
+`,
+			map[string]string{`Topic["a"]`: "FirstTopic", `Topic["b"]`: "SecondTopic"},
+			nil,
+		},
+		"empty": {
+			`
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = ""
+}
+`,
+			map[string]string{"Topic": "Topic"},
+			[]string{"Invalid logical id"},
+		},
+		"invalid characters": {
+			`
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "my-topic"
+}
+`,
+			map[string]string{"Topic": "Topic"},
+			[]string{"Invalid logical id"},
+		},
+		"too long": {
+			`
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "` + strings.Repeat("a", 256) + `"
+}
+`,
+			map[string]string{"Topic": "Topic"},
+			[]string{"Invalid logical id"},
+		},
+		"longest allowed": {
+			`
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "` + strings.Repeat("a", 255) + `"
+}
+`,
+			map[string]string{"Topic": strings.Repeat("a", 255)},
+			nil,
+		},
+		"collides with generated id": {
+			`
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+}
+
+Resource "Other" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "Topic"
+}
+`,
+			nil,
+			[]string{"Duplicate logical id"},
+		},
+		"collides with parameter": {
+			`
+Parameter "Env" {
+  Type = "String"
+}
+
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "Env"
+}
+`,
+			nil,
+			[]string{"Duplicate logical id"},
+		},
+		"overrides move": {
+			`
+Resource "Topic" {
+  Type      = "AWS::SNS::Topic"
+  LogicalId = "Notifications"
+}
+
+Moved {
+  From = Resource.Old
+  To   = Resource.Topic
+}
+`,
+			map[string]string{"Topic": "Notifications"},
+			[]string{"Move overridden by explicit logical id"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, map[string]string{"main.awsup": test.Config})
+			if !diags.HasErrors() {
+				template, buildDiags := ctx.Build()
+				diags = append(diags, buildDiags...)
+				if !buildDiags.HasErrors() {
+					got := map[string]string{}
+					for id, resource := range template.Resources {
+						got[resource.Addr.String()] = id
+					}
+					if len(got) != len(test.IDs) {
+						t.Errorf("wrong number of resources %d; want %d", len(got), len(test.IDs))
+					}
+					for addr, want := range test.IDs {
+						if got[addr] != want {
+							t.Errorf("wrong logical id for %s\ngot:  %q\nwant: %q", addr, got[addr], want)
+						}
+					}
+				}
+			}
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary)
+			}
+			if !equalStrings(got, test.Want) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Want)
+			}
+		})
+	}
+}
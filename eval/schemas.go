@@ -0,0 +1,66 @@
+package eval
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// loadSchemas loads the resource schema files listed by all of the modules
+// in the tree and merges them into the schema of the reciever.
+//
+// Each file may be either in the resource specification format or in the
+// registry resource provider schema format, and its path is relative to the
+// directory of the module that lists it. Types described by these files
+// replace any builtin types of the same name, for use by all modules.
+func (ctx *RootContext) loadSchemas() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	seen := map[string]bool{}
+	var loaded []*schema.Schema
+
+	ctx.VisitModules(func(mctx *ModuleContext) bool {
+		expr := mctx.Config.ResourceSchemas
+		val := evalConstantWithDiags(mctx, expr, cty.List(cty.String), NoEachState, &diags)
+		if !val.IsWhollyKnown() || val.IsNull() {
+			return true
+		}
+
+		for it := val.ElementIterator(); it.Next(); {
+			_, pathVal := it.Element()
+			if pathVal.IsNull() {
+				continue
+			}
+			path := pathVal.AsString()
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(mctx.Config.SourceDir, path)
+			}
+			path = filepath.Clean(path)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			sch, err := schema.LoadFile(path)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Failed to load resource schema",
+					Detail:   fmt.Sprintf("There was an error loading the resource schema from %s: %s.", path, err),
+					Subject:  expr.Range().Ptr(),
+				})
+				continue
+			}
+			loaded = append(loaded, sch)
+		}
+		return true
+	})
+
+	if len(loaded) != 0 {
+		ctx.Schema = schema.Merge(append([]*schema.Schema{ctx.Schema}, loaded...)...)
+	}
+
+	return diags
+}
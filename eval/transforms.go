@@ -0,0 +1,67 @@
+package eval
+
+import (
+	"github.com/apparentlymart/awsup/addr"
+	"github.com/apparentlymart/awsup/schema"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// loadTransforms evaluates the transforms declared by all of the modules in
+// the tree, recording them in the Transforms field of the reciever.
+//
+// Transforms apply to the whole template, so those declared by different
+// modules are combined, keeping the first occurrence of each. If any module
+// declares schema.ServerlessTransform then the schema is extended with the
+// AWS SAM resource types, for use by all modules.
+func (ctx *RootContext) loadTransforms() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	seen := map[string]bool{}
+
+	ctx.VisitModules(func(mctx *ModuleContext) bool {
+		expr := mctx.Config.Transform
+		val := evalConstantWithDiags(mctx, expr, cty.DynamicPseudoType, NoEachState, &diags)
+		if !val.IsWhollyKnown() || val.IsNull() {
+			return true
+		}
+
+		if val.Type() == cty.String {
+			val = cty.ListVal([]cty.Value{val})
+		}
+		names, err := convert.Convert(val, cty.List(cty.String))
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid transform",
+				Detail:   "Transform must be the name of a transform or a list of names.",
+				Subject:  expr.Range().Ptr(),
+			})
+			return true
+		}
+
+		for it := names.ElementIterator(); it.Next(); {
+			_, nameVal := it.Element()
+			if nameVal.IsNull() {
+				continue
+			}
+			name := nameVal.AsString()
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			ctx.Transforms = append(ctx.Transforms, name)
+			ctx.TransformSources = append(ctx.TransformSources, FlatSource{
+				Addr:      addr.NameInModule{Module: mctx.Path, Name: name},
+				DeclRange: expr.Range(),
+			})
+		}
+		return true
+	})
+
+	if seen[schema.ServerlessTransform] {
+		ctx.Schema = schema.Merge(ctx.Schema, schema.Serverless())
+	}
+
+	return diags
+}
@@ -0,0 +1,148 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	function := `
+Resource "Function" {
+  Type = "AWS::Serverless::Function"
+  Properties {
+    Handler = "index.handler"
+    Runtime = "nodejs18.x"
+    CodeUri = "s3://example/function.zip"
+  }
+}
+`
+
+	tests := map[string]struct {
+		Files map[string]string
+		Want  []string // the template's transforms
+		Diags []string // summary and detail of each diagnostic
+	}{
+		"none": {
+			map[string]string{
+				"main.awsup": `
+Resource "Topic" {
+  Type = "AWS::SNS::Topic"
+}
+`,
+			},
+			nil,
+			nil,
+		},
+		"serverless": {
+			map[string]string{
+				"main.awsup": `
+Transform = "AWS::Serverless-2016-10-31"
+` + function,
+			},
+			[]string{"AWS::Serverless-2016-10-31"},
+			nil,
+		},
+		"serverless in child module": {
+			map[string]string{
+				"main.awsup": `
+Module "child" {
+  Source = "./child"
+}
+` + function,
+				"child/main.awsup": `
+Transform = ["AWS::Serverless-2016-10-31"]
+`,
+			},
+			[]string{"AWS::Serverless-2016-10-31"},
+			nil,
+		},
+		"combined": {
+			map[string]string{
+				"main.awsup": `
+Transform = ["AWS::Serverless-2016-10-31", "AWS::LanguageExtensions"]
+
+Module "child" {
+  Source = "./child"
+}
+`,
+				"child/main.awsup": `
+Transform = ["AWS::LanguageExtensions", "AWS::CodeDeployBlueGreen"]
+`,
+			},
+			[]string{"AWS::Serverless-2016-10-31", "AWS::LanguageExtensions", "AWS::CodeDeployBlueGreen"},
+			nil,
+		},
+		"serverless type without transform": {
+			map[string]string{
+				"main.awsup": function,
+			},
+			nil,
+			[]string{`Unsupported resource type: There is no resource type named "AWS::Serverless::Function". The AWS SAM resource types are available only when the transform "AWS::Serverless-2016-10-31" is declared.`},
+		},
+		"serverless type with other transform": {
+			map[string]string{
+				"main.awsup": `
+Transform = "AWS::LanguageExtensions"
+` + function,
+			},
+			nil,
+			[]string{`Unsupported resource type: There is no resource type named "AWS::Serverless::Function". The AWS SAM resource types are available only when the transform "AWS::Serverless-2016-10-31" is declared.`},
+		},
+		"serverless property validation": {
+			map[string]string{
+				"main.awsup": `
+Transform = "AWS::Serverless-2016-10-31"
+
+Resource "Function" {
+  Type = "AWS::Serverless::Function"
+  Properties {
+    Handlr = "index.handler"
+  }
+}
+`,
+			},
+			nil,
+			[]string{`Unsupported property: Resource type AWS::Serverless::Function does not have a property named "Handlr".`},
+		},
+		"unknown type": {
+			map[string]string{
+				"main.awsup": `
+Resource "Widget" {
+  Type = "AWS::Example::Widget"
+}
+`,
+			},
+			nil,
+			[]string{`Unsupported resource type: There is no resource type named "AWS::Example::Widget".`},
+		},
+		"invalid transform": {
+			map[string]string{
+				"main.awsup": `
+Transform = { Name = "AWS::Serverless-2016-10-31" }
+`,
+			},
+			nil,
+			[]string{"Invalid transform: Transform must be the name of a transform or a list of names."},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, diags := testRootContext(t, test.Files)
+			if !diags.HasErrors() {
+				template, buildDiags := ctx.Build()
+				diags = append(diags, buildDiags...)
+				if !buildDiags.HasErrors() && !equalStrings(template.Transform, test.Want) {
+					t.Errorf("wrong transforms\ngot:  %q\nwant: %q", template.Transform, test.Want)
+				}
+			}
+
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Summary+": "+diag.Detail)
+			}
+			if !equalStrings(got, test.Diags) {
+				t.Errorf("wrong diagnostics\ngot:  %q\nwant: %q", got, test.Diags)
+			}
+		})
+	}
+}
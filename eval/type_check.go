@@ -1,6 +1,8 @@
 package eval
 
 import (
+	"strings"
+
 	"github.com/apparentlymart/awsup/addr"
 	"github.com/apparentlymart/awsup/config"
 	"github.com/apparentlymart/awsup/schema"
@@ -177,7 +179,7 @@ func (mctx *ModuleContext) TypeCheck(expr hcl.Expression, each EachState) (cty.T
 			}
 
 			typeName := rcfg.Type
-			rsch, exists := mctx.Global.Schema.ResourceTypes[typeName]
+			rsch, exists := mctx.Global.Schema.LookupResourceType(typeName)
 			if !exists {
 				// We'll assume that a separate explicit check will detect
 				// and report references to non-existant types, so for our
@@ -248,11 +250,43 @@ func (mctx *ModuleContext) TypeCheck(expr hcl.Expression, each EachState) (cty.T
 }
 
 func resourceObjectPlaceholder(rsch *schema.ResourceType) cty.Value {
-	attrs := map[string]cty.Value{}
-	for name, attr := range rsch.Attributes {
-		attrs[name] = cty.UnknownVal(attr.CtyType())
+	if rsch.AdditionalAttributes {
+		// We can't know which attributes a custom resource will return, so
+		// we allow any attribute name, as a string.
+		return cty.UnknownVal(cty.Map(cty.String))
 	}
-	return cty.ObjectVal(attrs)
+
+	return attributesPlaceholder(rsch.Attributes, "")
+}
+
+// attributesPlaceholder returns an object with an unknown value for each of
+// the given attributes whose name starts with the given prefix.
+//
+// Attribute names containing dots, such as Endpoint.Address, are placed in
+// nested objects so that they can be accessed as written. In the rare case
+// where an attribute also has nested attributes, only the attribute itself
+// is included.
+func attributesPlaceholder(attrs map[string]*schema.Attribute, prefix string) cty.Value {
+	vals := map[string]cty.Value{}
+	nested := map[string]bool{}
+	for name, attr := range attrs {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = name[len(prefix):]
+		if dot := strings.Index(name, "."); dot != -1 {
+			nested[name[:dot]] = true
+			continue
+		}
+		vals[name] = cty.UnknownVal(attr.CtyType())
+	}
+	for name := range nested {
+		if _, isAttr := vals[name]; isAttr {
+			continue
+		}
+		vals[name] = attributesPlaceholder(attrs, prefix+name+".")
+	}
+	return cty.ObjectVal(vals)
 }
 
 func moduleObjectPlaceholder(mctx *ModuleContext) cty.Value {
@@ -271,36 +305,3 @@ func moduleObjectPlaceholder(mctx *ModuleContext) cty.Value {
 func paramPlaceholder(param *config.Parameter) cty.Value {
 	return cty.UnknownVal(paramTypeCtyType(param.Type))
 }
-
-func paramTypeCtyType(name string) cty.Type {
-	// Parameters support a weird assortment of special type strings, along
-	// with a number of service-specific types that seem to all just be
-	// strings of a specific syntax. Therefore we'll cover the weird special
-	// ones and then just treat everything else as a string.
-	switch name {
-
-	case "String":
-		return cty.String
-
-	case "Number":
-		// CloudFormation actually converts numbers to strings when returning
-		// them, but we'll say Number here to avoid quirky results when
-		// we try to use number params in contexts where HCL really expects
-		// a number. We expect CloudFormation to be able to convert the
-		// stringified number back into a number when needed anyway.
-		return cty.Number
-
-	case "List<Number>":
-		// Again this actually comes out as a list of strings on the other side,
-		// but we treat it as cty number for the same reason as for "Number"
-		// above.
-		return cty.List(cty.Number)
-
-	case "CommaDelimitedList":
-		return cty.List(cty.String)
-
-	default:
-		return cty.String
-
-	}
-}
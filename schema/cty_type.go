@@ -11,34 +11,109 @@ var ctyPrimitiveTypes = map[PrimitiveType]cty.Type{
 	Double:    cty.Number,
 	Boolean:   cty.Bool,
 	Timestamp: cty.String,
+	Json:      cty.DynamicPseudoType,
 }
 
+// CtyType returns the cty type of values of the recieving type.
+//
+// Values of the Json primitive type may be of any type, so it is mapped to
+// cty.DynamicPseudoType, as are any primitive types we don't know.
 func (t *Type) CtyType() cty.Type {
+	return t.ctyType(map[*PropertyType]bool{})
+}
+
+// CtyType returns the cty type of values of the recieving property type,
+// which is an object type with an attribute for each of its properties.
+//
+// Some property types refer to themselves, directly or indirectly, which a
+// cty type cannot. Where a property type refers back to one that encloses
+// it, the nested value has cty.DynamicPseudoType instead.
+//
+// The result is cached, so the schema must not be modified after this
+// method is first called.
+func (pt *PropertyType) CtyType() cty.Type {
+	if pt.ctyTypeCache == cty.NilType {
+		pt.ctyTypeCache = pt.ctyType(map[*PropertyType]bool{})
+	}
+	return pt.ctyTypeCache
+}
+
+func (t *Type) ctyType(enclosing map[*PropertyType]bool) cty.Type {
 	if t.PrimitiveType != "" {
-		return ctyPrimitiveTypes[t.PrimitiveType]
+		return primitiveCtyType(t.PrimitiveType)
 	}
 
 	switch t.TypeName {
 	case "List":
-		if t.ItemPrimitiveType != "" {
-			return cty.List(ctyPrimitiveTypes[t.PrimitiveType])
-		}
-		return cty.List(t.ItemPropertyType.CtyType())
-
+		return cty.List(t.itemCtyType(enclosing))
 	case "Map":
-		if t.ItemPrimitiveType != "" {
-			return cty.Map(ctyPrimitiveTypes[t.PrimitiveType])
-		}
-		return cty.Map(t.ItemPropertyType.CtyType())
+		return cty.Map(t.itemCtyType(enclosing))
 	}
 
-	return t.PropertyType.CtyType()
+	if t.PropertyType == nil {
+		return cty.DynamicPseudoType
+	}
+	return t.PropertyType.ctyType(enclosing)
 }
 
-func (pt *PropertyType) CtyType() cty.Type {
+func (t *Type) itemCtyType(enclosing map[*PropertyType]bool) cty.Type {
+	switch {
+	case t.ItemPrimitiveType != "":
+		return primitiveCtyType(t.ItemPrimitiveType)
+	case t.ItemPropertyType != nil:
+		return t.ItemPropertyType.ctyType(enclosing)
+	default:
+		return cty.DynamicPseudoType
+	}
+}
+
+// ctyType is the implementation of CtyType, which doesn't use the cache
+// because the result for a nested property type depends on which property
+// types enclose it.
+func (pt *PropertyType) ctyType(enclosing map[*PropertyType]bool) cty.Type {
+	if enclosing[pt] {
+		return cty.DynamicPseudoType
+	}
+	enclosing[pt] = true
+	defer delete(enclosing, pt)
+
 	atys := map[string]cty.Type{}
 	for name, prop := range pt.Properties {
-		atys[name] = prop.CtyType()
+		atys[name] = prop.ctyType(enclosing)
 	}
 	return cty.Object(atys)
 }
+
+func primitiveCtyType(pt PrimitiveType) cty.Type {
+	if ty, known := ctyPrimitiveTypes[pt]; known {
+		return ty
+	}
+	return cty.DynamicPseudoType
+}
+
+// TypeForCty returns the type that best describes values of the given cty
+// type, which is the Json primitive type for values that the resource
+// specification format cannot describe, such as objects.
+func TypeForCty(ty cty.Type) Type {
+	for _, pt := range []PrimitiveType{String, Double, Boolean} {
+		if ty.Equals(ctyPrimitiveTypes[pt]) {
+			return Type{PrimitiveType: pt}
+		}
+	}
+
+	var ret Type
+	switch {
+	case ty.IsListType() || ty.IsSetType():
+		ret.TypeName = "List"
+	case ty.IsMapType():
+		ret.TypeName = "Map"
+	default:
+		return Type{PrimitiveType: Json}
+	}
+	item := TypeForCty(ty.ElementType())
+	if item.PrimitiveType == "" || item.PrimitiveType == Json {
+		return Type{PrimitiveType: Json}
+	}
+	ret.ItemPrimitiveType = item.PrimitiveType
+	return ret
+}
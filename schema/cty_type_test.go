@@ -0,0 +1,166 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestCtyTypeBuiltin(t *testing.T) {
+	schemas := map[string]*Schema{
+		"builtin":    Builtin(),
+		"serverless": Serverless(),
+	}
+
+	for name, sch := range schemas {
+		t.Run(name, func(t *testing.T) {
+			for typeName, rsch := range sch.ResourceTypes {
+				for attrName, attr := range rsch.Attributes {
+					checkCtyType(t, typeName+" attribute "+attrName, &attr.Type)
+				}
+				for propName, prop := range rsch.Properties {
+					checkCtyType(t, typeName+" property "+propName, &prop.Type)
+				}
+			}
+			for typeName, pt := range sch.PropertyTypes {
+				ty := pt.CtyType()
+				if !ty.IsObjectType() {
+					t.Errorf("property type %s has cty type %#v; want an object type", typeName, ty)
+					continue
+				}
+				for propName, prop := range pt.Properties {
+					checkCtyType(t, typeName+" property "+propName, &prop.Type)
+				}
+			}
+		})
+	}
+}
+
+// checkCtyType verifies that the cty type of the given type is consistent
+// with its description in the schema.
+func checkCtyType(t *testing.T, desc string, st *Type) {
+	t.Helper()
+
+	ty := st.CtyType()
+	switch {
+	case ty == cty.NilType:
+		t.Errorf("%s has no cty type", desc)
+
+	case st.PrimitiveType != "":
+		if want := ctyPrimitiveTypes[st.PrimitiveType]; want == cty.NilType || !ty.Equals(want) {
+			t.Errorf("%s of primitive type %s has cty type %#v", desc, st.PrimitiveType, ty)
+		}
+
+	case st.TypeName == "List" || st.TypeName == "Map":
+		if st.TypeName == "List" && !ty.IsListType() || st.TypeName == "Map" && !ty.IsMapType() {
+			t.Errorf("%s of type %s has cty type %#v", desc, st.TypeName, ty)
+			return
+		}
+		switch {
+		case st.ItemPrimitiveType != "":
+			if want := ctyPrimitiveTypes[st.ItemPrimitiveType]; want == cty.NilType || !ty.ElementType().Equals(want) {
+				t.Errorf("%s has items of primitive type %s, but cty type %#v", desc, st.ItemPrimitiveType, ty)
+			}
+		case st.ItemPropertyType != nil:
+			if ety := ty.ElementType(); !ety.IsObjectType() && ety != cty.DynamicPseudoType {
+				t.Errorf("%s has items of type %s, but cty type %#v", desc, st.ItemTypeName, ty)
+			}
+		default:
+			t.Errorf("%s has no item type", desc)
+		}
+
+	case st.PropertyType == nil:
+		t.Errorf("%s has unknown type %q", desc, st.TypeName)
+
+	case !ty.IsObjectType():
+		t.Errorf("%s of type %s has cty type %#v", desc, st.TypeName, ty)
+	}
+}
+
+func TestCtyTypeJson(t *testing.T) {
+	tests := map[string]Type{
+		"primitive": {PrimitiveType: Json},
+		"list":      {TypeName: "List", ItemPrimitiveType: Json},
+		"map":       {TypeName: "Map", ItemPrimitiveType: Json},
+	}
+	wants := map[string]cty.Type{
+		"primitive": cty.DynamicPseudoType,
+		"list":      cty.List(cty.DynamicPseudoType),
+		"map":       cty.Map(cty.DynamicPseudoType),
+	}
+
+	for name, ty := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, want := ty.CtyType(), wants[name]; !got.Equals(want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestCtyTypeRecursive(t *testing.T) {
+	// Configuration refers to itself through a list, and Rule and Statement
+	// refer to one another.
+	config := &PropertyType{
+		Name:       "Configuration",
+		Properties: map[string]*Property{},
+	}
+	config.Properties["Classification"] = &Property{Type: Type{PrimitiveType: String}}
+	config.Properties["Configurations"] = &Property{Type: Type{TypeName: "List", ItemTypeName: "Configuration", ItemPropertyType: config}}
+
+	rule := &PropertyType{Name: "Rule", Properties: map[string]*Property{}}
+	statement := &PropertyType{Name: "Statement", Properties: map[string]*Property{}}
+	rule.Properties["Statement"] = &Property{Type: Type{TypeName: "Statement", PropertyType: statement}}
+	statement.Properties["Rules"] = &Property{Type: Type{TypeName: "Map", ItemTypeName: "Rule", ItemPropertyType: rule}}
+
+	tests := map[string]struct {
+		Got  cty.Type
+		Want cty.Type
+	}{
+		"self": {
+			config.CtyType(),
+			cty.Object(map[string]cty.Type{
+				"Classification": cty.String,
+				"Configurations": cty.List(cty.DynamicPseudoType),
+			}),
+		},
+		"mutual": {
+			rule.CtyType(),
+			cty.Object(map[string]cty.Type{
+				"Statement": cty.Object(map[string]cty.Type{
+					"Rules": cty.Map(cty.DynamicPseudoType),
+				}),
+			}),
+		},
+		"list of self": {
+			(&Type{TypeName: "List", ItemTypeName: "Configuration", ItemPropertyType: config}).CtyType(),
+			cty.List(cty.Object(map[string]cty.Type{
+				"Classification": cty.String,
+				"Configurations": cty.List(cty.DynamicPseudoType),
+			})),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if !test.Got.Equals(test.Want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", test.Got, test.Want)
+			}
+		})
+	}
+}
+
+func TestLoadPrimitiveItemType(t *testing.T) {
+	sch := Builtin()
+	rsch, exists := sch.ResourceTypes["AWS::EC2::Instance"]
+	if !exists {
+		t.Fatal("no resource type AWS::EC2::Instance")
+	}
+	prop, exists := rsch.Properties["SecurityGroups"]
+	if !exists {
+		t.Fatal("AWS::EC2::Instance has no property SecurityGroups")
+	}
+	if got, want := prop.CtyType(), cty.List(cty.String); !got.Equals(want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"strings"
+)
+
+// CustomResourceType is the name of the generic resource type for custom
+// resources, which can also be given type names of the form Custom::Name.
+const CustomResourceType = "AWS::CloudFormation::CustomResource"
+
+const customResourceDocumentation = "http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/aws-resource-cfn-customresource.html"
+
+// IsCustomResourceType returns true if the given resource type name is that
+// of a custom resource.
+func IsCustomResourceType(name string) bool {
+	return name == CustomResourceType || strings.HasPrefix(name, "Custom::")
+}
+
+// NewCustomResourceType returns a description of the custom resource type
+// of the given name that requires only the ServiceToken property, accepting
+// any other properties and allowing any attribute to be retrieved.
+func NewCustomResourceType(name string) *ResourceType {
+	return &ResourceType{
+		Name:          name,
+		Documentation: customResourceDocumentation,
+		Attributes:    map[string]*Attribute{},
+		Properties: map[string]*Property{
+			"ServiceToken": {
+				Name:          "ServiceToken",
+				Documentation: customResourceDocumentation + "#cfn-customresource-servicetoken",
+				Required:      true,
+				UpdateType:    Immutable,
+				Type:          Type{PrimitiveType: String},
+			},
+		},
+		AdditionalProperties: true,
+		AdditionalAttributes: true,
+	}
+}
+
+// LookupResourceType returns the description of the resource type of the
+// given name, and whether it exists.
+//
+// Custom resource types that are not described by the schema exist, with
+// the description returned by NewCustomResourceType.
+func (s *Schema) LookupResourceType(name string) (*ResourceType, bool) {
+	rsch, exists := s.ResourceTypes[name]
+	if IsCustomResourceType(name) && (!exists || name == CustomResourceType) {
+		return NewCustomResourceType(name), true
+	}
+	return rsch, exists
+}
+
+// LookupAttribute returns the description of the attribute of the given
+// name, and whether it exists. Resource types that allow additional
+// attributes have any attribute that is not declared, of type String.
+func (rsch *ResourceType) LookupAttribute(name string) (*Attribute, bool) {
+	attr, exists := rsch.Attributes[name]
+	if !exists && rsch.AdditionalAttributes {
+		return &Attribute{
+			Name: name,
+			Type: Type{PrimitiveType: String},
+		}, true
+	}
+	return attr, exists
+}
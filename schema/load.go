@@ -1,12 +1,36 @@
 package schema
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 )
 
+// LoadFile reads a schema from the given file, which may be either in the
+// resource specification format read by Load or in the registry resource
+// provider schema format read by LoadRegistry.
+func LoadFile(filename string) (*Schema, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var probe struct {
+		TypeName *string `json:"typeName"`
+	}
+	err = json.Unmarshal(src, &probe)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %s", err)
+	}
+	if probe.TypeName != nil {
+		return LoadRegistry(bytes.NewReader(src))
+	}
+	return Load(bytes.NewReader(src))
+}
+
 func Load(r io.Reader) (*Schema, error) {
 	dec := json.NewDecoder(r)
 	var ret Schema
@@ -0,0 +1,27 @@
+package schema
+
+// Merge returns a new schema that describes all of the types in the given
+// schemas.
+//
+// Where more than one of the schemas describes a type of the same name, the
+// description from the later schema is used, so that additional schemas can
+// replace the builtin descriptions of types that have changed since the
+// builtin schema was generated.
+func Merge(schemas ...*Schema) *Schema {
+	ret := &Schema{
+		ResourceTypes: map[string]*ResourceType{},
+		PropertyTypes: map[string]*PropertyType{},
+	}
+	for _, sch := range schemas {
+		if ret.ResourceSpecVersion == "" {
+			ret.ResourceSpecVersion = sch.ResourceSpecVersion
+		}
+		for name, rsch := range sch.ResourceTypes {
+			ret.ResourceTypes[name] = rsch
+		}
+		for name, psch := range sch.PropertyTypes {
+			ret.PropertyTypes[name] = psch
+		}
+	}
+	return ret
+}
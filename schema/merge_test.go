@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	oldQueue := &ResourceType{Name: "AWS::SQS::Queue"}
+	newQueue := &ResourceType{Name: "AWS::SQS::Queue"}
+	topic := &ResourceType{Name: "AWS::SNS::Topic"}
+	widget := &ResourceType{Name: "Example::Service::Widget"}
+	oldTag := &PropertyType{Name: "Tag"}
+	newTag := &PropertyType{Name: "Tag"}
+
+	got := Merge(
+		&Schema{
+			ResourceTypes: map[string]*ResourceType{"Example::Service::Widget": widget},
+		},
+		&Schema{
+			ResourceSpecVersion: "2.0.0",
+			ResourceTypes: map[string]*ResourceType{
+				"AWS::SQS::Queue": oldQueue,
+				"AWS::SNS::Topic": topic,
+			},
+			PropertyTypes: map[string]*PropertyType{"Tag": oldTag},
+		},
+		&Schema{
+			ResourceSpecVersion: "3.0.0",
+			ResourceTypes:       map[string]*ResourceType{"AWS::SQS::Queue": newQueue},
+			PropertyTypes:       map[string]*PropertyType{"Tag": newTag},
+		},
+	)
+
+	if got, want := got.ResourceSpecVersion, "2.0.0"; got != want {
+		t.Errorf("wrong ResourceSpecVersion\ngot:  %s\nwant: %s", got, want)
+	}
+	wantResourceTypes := map[string]*ResourceType{
+		"AWS::SQS::Queue":          newQueue,
+		"AWS::SNS::Topic":          topic,
+		"Example::Service::Widget": widget,
+	}
+	if len(got.ResourceTypes) != len(wantResourceTypes) {
+		t.Errorf("wrong number of resource types %d; want %d", len(got.ResourceTypes), len(wantResourceTypes))
+	}
+	for name, want := range wantResourceTypes {
+		if got.ResourceTypes[name] != want {
+			t.Errorf("wrong description of resource type %s", name)
+		}
+	}
+	if len(got.PropertyTypes) != 1 || got.PropertyTypes["Tag"] != newTag {
+		t.Errorf("wrong property types %#v", got.PropertyTypes)
+	}
+}
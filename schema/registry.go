@@ -0,0 +1,354 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// registrySchema is the subset of the CloudFormation registry resource
+// provider schema format that we use to describe a resource type.
+type registrySchema struct {
+	TypeName             string                 `json:"typeName"`
+	SourceURL            string                 `json:"sourceUrl"`
+	DocumentationURL     string                 `json:"documentationUrl"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	ReadOnlyProperties   []string               `json:"readOnlyProperties"`
+	CreateOnlyProperties []string               `json:"createOnlyProperties"`
+}
+
+// jsonSchema is the subset of JSON Schema that we use to find the types of
+// properties in a registry resource provider schema.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 json.RawMessage        `json:"type"`
+	Format               string                 `json:"format"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	Items                *jsonSchema            `json:"items"`
+	PatternProperties    map[string]*jsonSchema `json:"patternProperties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+}
+
+// LoadRegistry reads a resource type described in the CloudFormation
+// registry resource provider schema format, which is the format used for
+// private and third-party registry types, and returns a schema containing
+// only that type.
+//
+// The provider schema format uses JSON Schema, which can describe values
+// that the resource specification format cannot, such as values that may be
+// of several different types. Such properties have the Json primitive type.
+func LoadRegistry(r io.Reader) (*Schema, error) {
+	dec := json.NewDecoder(r)
+	var raw registrySchema
+	err := dec.Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+	if raw.TypeName == "" {
+		return nil, fmt.Errorf("resource provider schema does not specify typeName")
+	}
+
+	doc := raw.DocumentationURL
+	if doc == "" {
+		doc = raw.SourceURL
+	}
+
+	ret := &Schema{
+		ResourceTypes: map[string]*ResourceType{},
+		PropertyTypes: map[string]*PropertyType{},
+	}
+	rsch := &ResourceType{
+		Name:          raw.TypeName,
+		Documentation: doc,
+		Attributes:    map[string]*Attribute{},
+		Properties:    map[string]*Property{},
+	}
+	ret.ResourceTypes[raw.TypeName] = rsch
+
+	c := &registryConverter{
+		raw:       &raw,
+		schema:    ret,
+		resource:  rsch,
+		names:     map[*jsonSchema]string{},
+		resolving: map[string]bool{},
+	}
+
+	readOnly := map[string]bool{}
+	for _, ptr := range raw.ReadOnlyProperties {
+		readOnly[ptr] = true
+	}
+	createOnly := map[string]bool{}
+	for _, ptr := range raw.CreateOnlyProperties {
+		createOnly[ptr] = true
+	}
+
+	// Reserve the names of the definitions first, so that objects declared
+	// inline are given names that don't conflict with them.
+	for name, def := range raw.Definitions {
+		c.names[def] = name
+	}
+
+	for _, name := range sortedSchemaKeys(raw.Properties) {
+		ptr := "/properties/" + name
+		if readOnly[ptr] {
+			continue
+		}
+		prop := &Property{
+			Name:          name,
+			Documentation: doc,
+			Required:      stringInList(name, raw.Required),
+			UpdateType:    Mutable,
+			Type:          c.typeFor(raw.Properties[name], name),
+		}
+		if createOnly[ptr] {
+			prop.UpdateType = Immutable
+		}
+		rsch.Properties[name] = prop
+	}
+
+	for _, ptr := range raw.ReadOnlyProperties {
+		if !strings.HasPrefix(ptr, "/properties/") {
+			continue
+		}
+		steps := strings.Split(strings.TrimPrefix(ptr, "/properties/"), "/")
+		ty, ok := c.attributeType(steps)
+		if !ok {
+			// Attributes of other types can't be retrieved with Fn::GetAtt,
+			// although their nested attributes often can.
+			continue
+		}
+		name := strings.Join(steps, ".")
+		rsch.Attributes[name] = &Attribute{
+			Name: name,
+			Type: ty,
+		}
+	}
+
+	return ret, nil
+}
+
+// registryConverter holds the state used while converting the types in a
+// single resource provider schema.
+type registryConverter struct {
+	raw      *registrySchema
+	schema   *Schema
+	resource *ResourceType
+
+	// names records the property type name chosen for each object schema,
+	// so that each is converted only once even if it refers to itself.
+	names map[*jsonSchema]string
+
+	// resolving tracks the definitions currently being resolved, so that
+	// definitions that are aliases of one another don't cause a loop.
+	resolving map[string]bool
+}
+
+// typeFor returns the type corresponding to the given JSON schema, using the
+// given name for a property type if the schema describes an object.
+func (c *registryConverter) typeFor(s *jsonSchema, name string) Type {
+	jsonType := Type{PrimitiveType: Json}
+	if s == nil {
+		return jsonType
+	}
+
+	if s.Ref != "" {
+		defName := strings.TrimPrefix(s.Ref, "#/definitions/")
+		def, exists := c.raw.Definitions[defName]
+		if defName == s.Ref || !exists || c.resolving[defName] {
+			return jsonType
+		}
+		c.resolving[defName] = true
+		defer delete(c.resolving, defName)
+		return c.typeFor(def, defName)
+	}
+
+	if len(s.OneOf) != 0 || len(s.AnyOf) != 0 {
+		return jsonType
+	}
+
+	switch s.typeName() {
+	case "string":
+		if s.Format == "date-time" {
+			return Type{PrimitiveType: Timestamp}
+		}
+		return Type{PrimitiveType: String}
+	case "integer":
+		return Type{PrimitiveType: Integer}
+	case "number":
+		return Type{PrimitiveType: Double}
+	case "boolean":
+		return Type{PrimitiveType: Boolean}
+
+	case "array":
+		item := c.typeFor(s.Items, name)
+		switch {
+		case item.PrimitiveType != "" && item.PrimitiveType != Json:
+			return Type{TypeName: "List", ItemPrimitiveType: item.PrimitiveType}
+		case item.PropertyType != nil:
+			return Type{TypeName: "List", ItemTypeName: item.TypeName, ItemPropertyType: item.PropertyType}
+		}
+		// The resource specification format can't describe lists of
+		// lists, or lists of values of varying types.
+		return jsonType
+
+	case "object", "":
+		if len(s.Properties) != 0 {
+			pt := c.propertyType(s, name)
+			return Type{TypeName: pt.Name, PropertyType: pt}
+		}
+		var elem *jsonSchema
+		for _, k := range sortedSchemaKeys(s.PatternProperties) {
+			elem = s.PatternProperties[k]
+			break
+		}
+		if elem == nil && len(s.AdditionalProperties) != 0 {
+			var additional jsonSchema
+			if err := json.Unmarshal(s.AdditionalProperties, &additional); err == nil {
+				elem = &additional
+			}
+		}
+		if elem == nil {
+			return jsonType
+		}
+		item := c.typeFor(elem, name)
+		switch {
+		case item.PrimitiveType != "" && item.PrimitiveType != Json:
+			return Type{TypeName: "Map", ItemPrimitiveType: item.PrimitiveType}
+		case item.PropertyType != nil:
+			return Type{TypeName: "Map", ItemTypeName: item.TypeName, ItemPropertyType: item.PropertyType}
+		}
+		return jsonType
+	}
+
+	return jsonType
+}
+
+// propertyType returns the property type for the given object schema,
+// converting it if this is the first time it has been seen.
+func (c *registryConverter) propertyType(s *jsonSchema, name string) *PropertyType {
+	if existing, seen := c.names[s]; seen {
+		if pt, exists := c.schema.PropertyTypes[c.raw.TypeName+"."+existing]; exists {
+			return pt
+		}
+		name = existing
+	} else {
+		// Objects declared inline are named after the property they belong
+		// to, which might conflict with another type's name.
+		taken := map[string]bool{}
+		for _, n := range c.names {
+			taken[n] = true
+		}
+		base := name
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		c.names[s] = name
+	}
+
+	pt := &PropertyType{
+		Name:          name,
+		ResourceType:  c.resource,
+		Documentation: c.resource.Documentation,
+		Properties:    map[string]*Property{},
+	}
+	c.schema.PropertyTypes[c.raw.TypeName+"."+name] = pt
+
+	for _, propName := range sortedSchemaKeys(s.Properties) {
+		pt.Properties[propName] = &Property{
+			Name:          propName,
+			Documentation: c.resource.Documentation,
+			Required:      stringInList(propName, s.Required),
+			UpdateType:    Mutable,
+			Type:          c.typeFor(s.Properties[propName], propName),
+		}
+	}
+
+	return pt
+}
+
+// attributeType returns the type of the read-only property at the given
+// path, if it is of a type that can be retrieved with Fn::GetAtt.
+func (c *registryConverter) attributeType(steps []string) (Type, bool) {
+	props := c.raw.Properties
+	var s *jsonSchema
+	for _, step := range steps {
+		s = c.resolve(props[step])
+		if s == nil {
+			return Type{}, false
+		}
+		props = s.Properties
+	}
+
+	ty := c.typeFor(s, steps[len(steps)-1])
+	switch {
+	case ty.PrimitiveType != "" && ty.PrimitiveType != Json:
+		return ty, true
+	case ty.TypeName == "List" && ty.ItemPrimitiveType != "":
+		return ty, true
+	}
+	return Type{}, false
+}
+
+// resolve follows the given schema's reference to a definition, if any.
+func (c *registryConverter) resolve(s *jsonSchema) *jsonSchema {
+	for i := 0; s != nil && s.Ref != ""; i++ {
+		if i > len(c.raw.Definitions) {
+			// A cycle of references that never reaches a real schema.
+			return nil
+		}
+		s = c.raw.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	return s
+}
+
+// typeName returns the JSON type named by the schema, or an empty string if
+// it does not name exactly one type other than null.
+func (s *jsonSchema) typeName() string {
+	if len(s.Type) == 0 {
+		return ""
+	}
+	var single string
+	if err := json.Unmarshal(s.Type, &single); err == nil {
+		return single
+	}
+	var multi []string
+	if err := json.Unmarshal(s.Type, &multi); err != nil {
+		return ""
+	}
+	ret := ""
+	for _, name := range multi {
+		if name == "null" {
+			continue
+		}
+		if ret != "" {
+			return "any"
+		}
+		ret = name
+	}
+	return ret
+}
+
+func sortedSchemaKeys(m map[string]*jsonSchema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringInList(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadRegistry(t *testing.T) {
+	sch, err := LoadRegistry(strings.NewReader(`{
+  "typeName": "Example::Service::Widget",
+  "documentationUrl": "https://example.com/widget",
+  "definitions": {
+    "Tag": {
+      "type": "object",
+      "properties": {
+        "Key": {"type": "string"},
+        "Value": {"type": "string"}
+      },
+      "required": ["Key"]
+    },
+    "Node": {
+      "type": "object",
+      "properties": {
+        "Name": {"type": "string"},
+        "Children": {"type": "array", "items": {"$ref": "#/definitions/Node"}}
+      }
+    },
+    "Ping": {"$ref": "#/definitions/Pong"},
+    "Pong": {"$ref": "#/definitions/Ping"}
+  },
+  "properties": {
+    "Name": {"type": "string"},
+    "Size": {"type": "integer"},
+    "Ratio": {"type": "number"},
+    "Enabled": {"type": ["boolean", "null"]},
+    "Created": {"type": "string", "format": "date-time"},
+    "Aliases": {"type": "array", "items": {"type": "string"}},
+    "Tags": {"type": "array", "items": {"$ref": "#/definitions/Tag"}},
+    "Labels": {"type": "object", "patternProperties": {".*": {"type": "string"}}},
+    "Tree": {"$ref": "#/definitions/Node"},
+    "Tag": {
+      "type": "object",
+      "properties": {
+        "Color": {"type": "string"}
+      }
+    },
+    "Loop": {"$ref": "#/definitions/Ping"},
+    "Either": {"oneOf": [{"type": "string"}, {"type": "integer"}]},
+    "Arn": {"type": "string"},
+    "Settings": {"type": "object"},
+    "Endpoint": {
+      "type": "object",
+      "properties": {
+        "Address": {"type": "string"},
+        "Port": {"type": "integer"}
+      }
+    }
+  },
+  "required": ["Name"],
+  "readOnlyProperties": ["/properties/Arn", "/properties/Endpoint/Address", "/properties/Tree"],
+  "createOnlyProperties": ["/properties/Name"]
+}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rsch, exists := sch.ResourceTypes["Example::Service::Widget"]
+	if !exists {
+		t.Fatalf("no resource type Example::Service::Widget")
+	}
+	if got, want := rsch.Documentation, "https://example.com/widget"; got != want {
+		t.Errorf("wrong documentation\ngot:  %s\nwant: %s", got, want)
+	}
+
+	t.Run("properties", func(t *testing.T) {
+		got := map[string]string{}
+		for name, prop := range rsch.Properties {
+			got[name] = describeType(&prop.Type)
+		}
+		want := map[string]string{
+			"Name":     "String",
+			"Size":     "Integer",
+			"Ratio":    "Double",
+			"Enabled":  "Boolean",
+			"Created":  "Timestamp",
+			"Aliases":  "List of String",
+			"Tags":     "List of Tag",
+			"Labels":   "Map of String",
+			"Tag":      "Tag2",
+			"Loop":     "Json",
+			"Either":   "Json",
+			"Settings": "Json",
+			"Endpoint": "Endpoint",
+		}
+		checkDescriptions(t, got, want)
+
+		if !rsch.Properties["Name"].Required || rsch.Properties["Size"].Required {
+			t.Errorf("wrong required properties")
+		}
+		if got, want := rsch.Properties["Name"].UpdateType, Immutable; got != want {
+			t.Errorf("wrong update type for Name\ngot:  %s\nwant: %s", got, want)
+		}
+		if got, want := rsch.Properties["Size"].UpdateType, Mutable; got != want {
+			t.Errorf("wrong update type for Size\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		got := map[string]string{}
+		for name, attr := range rsch.Attributes {
+			got[name] = describeType(&attr.Type)
+		}
+		want := map[string]string{
+			"Arn":              "String",
+			"Endpoint.Address": "String",
+		}
+		checkDescriptions(t, got, want)
+	})
+
+	t.Run("property types", func(t *testing.T) {
+		got := map[string]string{}
+		for typeName, pt := range sch.PropertyTypes {
+			for name, prop := range pt.Properties {
+				got[typeName+"."+name] = describeType(&prop.Type)
+			}
+		}
+		want := map[string]string{
+			"Example::Service::Widget.Tag.Key":          "String",
+			"Example::Service::Widget.Tag.Value":        "String",
+			"Example::Service::Widget.Tag2.Color":       "String",
+			"Example::Service::Widget.Node.Name":        "String",
+			"Example::Service::Widget.Node.Children":    "List of Node",
+			"Example::Service::Widget.Endpoint.Address": "String",
+			"Example::Service::Widget.Endpoint.Port":    "Integer",
+		}
+		checkDescriptions(t, got, want)
+
+		node := sch.PropertyTypes["Example::Service::Widget.Node"]
+		if got := node.Properties["Children"].ItemPropertyType; got != node {
+			t.Errorf("Node.Children does not refer back to Node")
+		}
+		if !sch.PropertyTypes["Example::Service::Widget.Tag"].Properties["Key"].Required {
+			t.Errorf("Tag.Key is not required")
+		}
+	})
+}
+
+func TestLoadRegistryErrors(t *testing.T) {
+	tests := map[string]string{
+		"no type name": `{"properties": {"Name": {"type": "string"}}}`,
+		"invalid JSON": `{"typeName": `,
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadRegistry(strings.NewReader(src))
+			if err == nil {
+				t.Fatalf("succeeded; want error")
+			}
+		})
+	}
+}
+
+// describeType returns a short description of the given type, for
+// comparison in tests.
+func describeType(ty *Type) string {
+	switch {
+	case ty.PrimitiveType != "":
+		return string(ty.PrimitiveType)
+	case ty.ItemPrimitiveType != "":
+		return ty.TypeName + " of " + string(ty.ItemPrimitiveType)
+	case ty.ItemPropertyType != nil:
+		return ty.TypeName + " of " + ty.ItemPropertyType.Name
+	case ty.PropertyType != nil:
+		return ty.PropertyType.Name
+	default:
+		return "unknown type " + ty.TypeName
+	}
+}
+
+func checkDescriptions(t *testing.T, got, want map[string]string) {
+	t.Helper()
+
+	var names []string
+	for name := range got {
+		names = append(names, name)
+	}
+	for name := range want {
+		if _, exists := got[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if got[name] != want[name] {
+			t.Errorf("wrong type for %s\ngot:  %q\nwant: %q", name, got[name], want[name])
+		}
+	}
+}
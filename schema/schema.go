@@ -2,6 +2,10 @@ package schema
 
 //go:generate go run generate_builtin.go
 
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
 type Schema struct {
 	ResourceTypes       map[string]*ResourceType `json:"ResourceTypes"`
 	ResourceSpecVersion string                   `json:"ResourceSpecificationVersion"`
@@ -13,6 +17,12 @@ type ResourceType struct {
 	Documentation string                `json:"Documentation"`
 	Attributes    map[string]*Attribute `json:"Attributes"`
 	Properties    map[string]*Property  `json:"Properties"`
+
+	// AdditionalProperties and AdditionalAttributes are set for custom
+	// resource types, which accept properties other than those declared and
+	// allow any attribute to be retrieved as a string.
+	AdditionalProperties bool `json:"-"`
+	AdditionalAttributes bool `json:"-"`
 }
 
 type PropertyType struct {
@@ -20,6 +30,8 @@ type PropertyType struct {
 	ResourceType  *ResourceType        `json:"-"`
 	Documentation string               `json:"Documentation"`
 	Properties    map[string]*Property `json:"Properties"`
+
+	ctyTypeCache cty.Type
 }
 
 type Property struct {
@@ -42,7 +54,7 @@ type Type struct {
 	PrimitiveType     PrimitiveType `json:"PrimitiveType"`
 	ItemTypeName      string        `json:"ItemType"`
 	ItemPropertyType  *PropertyType `json:"-"`
-	ItemPrimitiveType PrimitiveType `json:"ItemPrimitiveType"`
+	ItemPrimitiveType PrimitiveType `json:"PrimitiveItemType"`
 }
 
 type PrimitiveType string
@@ -54,6 +66,7 @@ const (
 	Double    PrimitiveType = "Double"
 	Boolean   PrimitiveType = "Boolean"
 	Timestamp PrimitiveType = "Timestamp"
+	Json      PrimitiveType = "Json"
 )
 
 type UpdateType string
@@ -0,0 +1,23 @@
+package schema
+
+import (
+	"strings"
+)
+
+// ServerlessTransform is the name of the transform that a template must
+// declare in order to use the AWS SAM resource types described by
+// Serverless.
+const ServerlessTransform = "AWS::Serverless-2016-10-31"
+
+// Serverless returns a schema describing the resource types that are added
+// by ServerlessTransform.
+func Serverless() *Schema {
+	r := strings.NewReader(serverlessSource)
+	schema, err := Load(r)
+	if err != nil {
+		// Should never happen, since serverlessSource should always be valid
+		panic(err)
+	}
+
+	return schema
+}
@@ -0,0 +1,176 @@
+package schema
+
+// serverlessSource describes the resource types added by the
+// AWS::Serverless-2016-10-31 transform, in the same format as the resource
+// specification that builtinSource is generated from.
+//
+// AWS doesn't publish a resource specification for these types, so this is
+// maintained by hand from the AWS SAM specification. Properties that accept
+// several different kinds of value, such as either an S3 URI string or an
+// object describing an S3 location, use the Json primitive type.
+const serverlessSource = `{
+  "ResourceSpecificationVersion": "2016-10-31",
+  "PropertyTypes": {
+    "AWS::Serverless::Function.DeadLetterQueue": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#deadletterqueue-object",
+      "Properties": {
+        "TargetArn": {"Required": true, "PrimitiveType": "String"},
+        "Type": {"Required": true, "PrimitiveType": "String"}
+      }
+    },
+    "AWS::Serverless::Function.FunctionEnvironment": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#environment-object",
+      "Properties": {
+        "Variables": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"}
+      }
+    },
+    "AWS::Serverless::Function.VpcConfig": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlessfunction",
+      "Properties": {
+        "SecurityGroupIds": {"Required": true, "Type": "List", "PrimitiveItemType": "String"},
+        "SubnetIds": {"Required": true, "Type": "List", "PrimitiveItemType": "String"}
+      }
+    },
+    "AWS::Serverless::SimpleTable.PrimaryKey": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#primary-key-object",
+      "Properties": {
+        "Name": {"Required": false, "PrimitiveType": "String"},
+        "Type": {"Required": true, "PrimitiveType": "String"}
+      }
+    },
+    "AWS::Serverless::SimpleTable.ProvisionedThroughput": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlesssimpletable",
+      "Properties": {
+        "ReadCapacityUnits": {"Required": false, "PrimitiveType": "Integer"},
+        "WriteCapacityUnits": {"Required": true, "PrimitiveType": "Integer"}
+      }
+    }
+  },
+  "ResourceTypes": {
+    "AWS::Serverless::Api": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlessapi",
+      "Attributes": {
+        "RootResourceId": {"PrimitiveType": "String"}
+      },
+      "Properties": {
+        "AccessLogSetting": {"Required": false, "PrimitiveType": "Json"},
+        "Auth": {"Required": false, "PrimitiveType": "Json"},
+        "BinaryMediaTypes": {"Required": false, "Type": "List", "PrimitiveItemType": "String"},
+        "CacheClusterEnabled": {"Required": false, "PrimitiveType": "Boolean"},
+        "CacheClusterSize": {"Required": false, "PrimitiveType": "String"},
+        "Cors": {"Required": false, "PrimitiveType": "Json"},
+        "DefinitionBody": {"Required": false, "PrimitiveType": "Json"},
+        "DefinitionUri": {"Required": false, "PrimitiveType": "Json"},
+        "EndpointConfiguration": {"Required": false, "PrimitiveType": "Json"},
+        "MethodSettings": {"Required": false, "PrimitiveType": "Json"},
+        "Name": {"Required": false, "PrimitiveType": "String"},
+        "OpenApiVersion": {"Required": false, "PrimitiveType": "String"},
+        "StageName": {"Required": true, "PrimitiveType": "String"},
+        "Tags": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"},
+        "TracingEnabled": {"Required": false, "PrimitiveType": "Boolean"},
+        "Variables": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"}
+      }
+    },
+    "AWS::Serverless::Application": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlessapplication",
+      "Properties": {
+        "Location": {"Required": true, "PrimitiveType": "Json"},
+        "NotificationARNs": {"Required": false, "Type": "List", "PrimitiveItemType": "String"},
+        "Parameters": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"},
+        "Tags": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"},
+        "TimeoutInMinutes": {"Required": false, "PrimitiveType": "Integer"}
+      }
+    },
+    "AWS::Serverless::Function": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlessfunction",
+      "Attributes": {
+        "Arn": {"PrimitiveType": "String"}
+      },
+      "Properties": {
+        "AutoPublishAlias": {"Required": false, "PrimitiveType": "String"},
+        "CodeUri": {"Required": false, "PrimitiveType": "Json"},
+        "DeadLetterQueue": {"Required": false, "Type": "DeadLetterQueue"},
+        "DeploymentPreference": {"Required": false, "PrimitiveType": "Json"},
+        "Description": {"Required": false, "PrimitiveType": "String"},
+        "Environment": {"Required": false, "Type": "FunctionEnvironment"},
+        "Events": {"Required": false, "Type": "Map", "PrimitiveItemType": "Json"},
+        "FunctionName": {"Required": false, "PrimitiveType": "String"},
+        "Handler": {"Required": false, "PrimitiveType": "String"},
+        "ImageUri": {"Required": false, "PrimitiveType": "String"},
+        "InlineCode": {"Required": false, "PrimitiveType": "String"},
+        "KmsKeyArn": {"Required": false, "PrimitiveType": "String"},
+        "Layers": {"Required": false, "Type": "List", "PrimitiveItemType": "String"},
+        "MemorySize": {"Required": false, "PrimitiveType": "Integer"},
+        "PackageType": {"Required": false, "PrimitiveType": "String"},
+        "PermissionsBoundary": {"Required": false, "PrimitiveType": "String"},
+        "Policies": {"Required": false, "PrimitiveType": "Json"},
+        "ReservedConcurrentExecutions": {"Required": false, "PrimitiveType": "Integer"},
+        "Role": {"Required": false, "PrimitiveType": "String"},
+        "Runtime": {"Required": false, "PrimitiveType": "String"},
+        "Tags": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"},
+        "Timeout": {"Required": false, "PrimitiveType": "Integer"},
+        "Tracing": {"Required": false, "PrimitiveType": "String"},
+        "VpcConfig": {"Required": false, "Type": "VpcConfig"}
+      }
+    },
+    "AWS::Serverless::HttpApi": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlesshttpapi",
+      "Properties": {
+        "AccessLogSettings": {"Required": false, "PrimitiveType": "Json"},
+        "Auth": {"Required": false, "PrimitiveType": "Json"},
+        "CorsConfiguration": {"Required": false, "PrimitiveType": "Json"},
+        "DefaultRouteSettings": {"Required": false, "PrimitiveType": "Json"},
+        "DefinitionBody": {"Required": false, "PrimitiveType": "Json"},
+        "DefinitionUri": {"Required": false, "PrimitiveType": "Json"},
+        "FailOnWarnings": {"Required": false, "PrimitiveType": "Boolean"},
+        "StageName": {"Required": false, "PrimitiveType": "String"},
+        "StageVariables": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"},
+        "Tags": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"}
+      }
+    },
+    "AWS::Serverless::LayerVersion": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlesslayerversion",
+      "Properties": {
+        "CompatibleRuntimes": {"Required": false, "Type": "List", "PrimitiveItemType": "String"},
+        "ContentUri": {"Required": true, "PrimitiveType": "Json"},
+        "Description": {"Required": false, "PrimitiveType": "String"},
+        "LayerName": {"Required": false, "PrimitiveType": "String"},
+        "LicenseInfo": {"Required": false, "PrimitiveType": "String"},
+        "RetentionPolicy": {"Required": false, "PrimitiveType": "String"}
+      }
+    },
+    "AWS::Serverless::SimpleTable": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlesssimpletable",
+      "Attributes": {
+        "Arn": {"PrimitiveType": "String"}
+      },
+      "Properties": {
+        "PrimaryKey": {"Required": false, "Type": "PrimaryKey"},
+        "ProvisionedThroughput": {"Required": false, "Type": "ProvisionedThroughput"},
+        "SSESpecification": {"Required": false, "PrimitiveType": "Json"},
+        "TableName": {"Required": false, "PrimitiveType": "String"},
+        "Tags": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"}
+      }
+    },
+    "AWS::Serverless::StateMachine": {
+      "Documentation": "https://github.com/awslabs/serverless-application-model/blob/master/versions/2016-10-31.md#awsserverlessstatemachine",
+      "Attributes": {
+        "Name": {"PrimitiveType": "String"}
+      },
+      "Properties": {
+        "Definition": {"Required": false, "PrimitiveType": "Json"},
+        "DefinitionSubstitutions": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"},
+        "DefinitionUri": {"Required": false, "PrimitiveType": "Json"},
+        "Events": {"Required": false, "Type": "Map", "PrimitiveItemType": "Json"},
+        "Logging": {"Required": false, "PrimitiveType": "Json"},
+        "Name": {"Required": false, "PrimitiveType": "String"},
+        "Policies": {"Required": false, "PrimitiveType": "Json"},
+        "Role": {"Required": false, "PrimitiveType": "String"},
+        "Tags": {"Required": false, "Type": "Map", "PrimitiveItemType": "String"},
+        "Tracing": {"Required": false, "PrimitiveType": "Json"},
+        "Type": {"Required": false, "PrimitiveType": "String"}
+      }
+    }
+  }
+}
+`